@@ -175,6 +175,72 @@ func main() {
 				Value:   "/fileserver/media",
 				EnvVars: []string{envNames.StorageServeBasePath},
 			},
+
+			// FEDERATION FLAGS
+			&cli.StringFlag{
+				Name:    flagNames.FederationMode,
+				Usage:   "Which remote instances to federate with: open (everyone), blocklist (everyone not blocked by an admin) or allowlist (only instances allowed by an admin)",
+				Value:   "blocklist",
+				EnvVars: []string{envNames.FederationMode},
+			},
+			&cli.BoolFlag{
+				Name:    flagNames.FederationSlow,
+				Usage:   "Score remote instances by reputation, and let new or poorly behaved ones federate with this instance only slowly",
+				Value:   false,
+				EnvVars: []string{envNames.FederationSlow},
+			},
+			&cli.BoolFlag{
+				Name:    flagNames.FederationGreedy,
+				Usage:   "Backfill the posts and reply threads of remote accounts when local accounts follow or view them",
+				Value:   false,
+				EnvVars: []string{envNames.FederationGreedy},
+			},
+			&cli.IntFlag{
+				Name:    flagNames.FederationBackfillMaxPages,
+				Usage:   "Max number of pages to fetch from each remote collection when backfilling",
+				Value:   5,
+				EnvVars: []string{envNames.FederationBackfillMaxPages},
+			},
+			&cli.IntFlag{
+				Name:    flagNames.FederationBackfillMaxDepth,
+				Usage:   "Max depth of replies to fetch below each status when backfilling",
+				Value:   3,
+				EnvVars: []string{envNames.FederationBackfillMaxDepth},
+			},
+
+			// DISTRIBUTOR FLAGS
+			&cli.IntFlag{
+				Name:    flagNames.DistributorWorkers,
+				Usage:   "Number of messages (new statuses, follows, account updates etc) to process side effects for at once",
+				Value:   4,
+				EnvVars: []string{envNames.DistributorWorkers},
+			},
+			&cli.IntFlag{
+				Name:    flagNames.DistributorQueueSize,
+				Usage:   "Number of messages that can be waiting to be processed by each worker before new ones have to wait",
+				Value:   100,
+				EnvVars: []string{envNames.DistributorQueueSize},
+			},
+
+			// STATUSES FLAGS
+			&cli.IntFlag{
+				Name:    flagNames.StatusesMaxChars,
+				Usage:   "Max permitted characters for posted statuses",
+				Value:   5000,
+				EnvVars: []string{envNames.StatusesMaxChars},
+			},
+			&cli.IntFlag{
+				Name:    flagNames.StatusesCWMaxChars,
+				Usage:   "Max permitted characters for content/spoiler warnings on statuses",
+				Value:   100,
+				EnvVars: []string{envNames.StatusesCWMaxChars},
+			},
+			&cli.IntFlag{
+				Name:    flagNames.StatusesMaxMediaFiles,
+				Usage:   "Maximum number of media files/attachments per status",
+				Value:   6,
+				EnvVars: []string{envNames.StatusesMaxMediaFiles},
+			},
 		},
 		Commands: []*cli.Command{
 			{
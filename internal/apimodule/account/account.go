@@ -29,6 +29,8 @@ import (
 	"github.com/superseriousbusiness/gotosocial/internal/config"
 	"github.com/superseriousbusiness/gotosocial/internal/db"
 	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+	"github.com/superseriousbusiness/gotosocial/internal/federation"
 	"github.com/superseriousbusiness/gotosocial/internal/media"
 	"github.com/superseriousbusiness/gotosocial/internal/oauth"
 	"github.com/superseriousbusiness/gotosocial/internal/router"
@@ -40,6 +42,8 @@ const (
 	basePathWithID        = basePath + "/:" + idKey
 	verifyPath            = basePath + "/verify_credentials"
 	updateCredentialsPath = basePath + "/update_credentials"
+	aliasesPath           = basePath + "/aliases"
+	movePath              = basePath + "/move"
 )
 
 type accountModule struct {
@@ -47,16 +51,20 @@ type accountModule struct {
 	db           db.DB
 	oauthServer  oauth.Server
 	mediaHandler media.MediaHandler
+	federator    federation.Federator
+	distributor  distributor.Distributor
 	log          *logrus.Logger
 }
 
 // New returns a new account module
-func New(config *config.Config, db db.DB, oauthServer oauth.Server, mediaHandler media.MediaHandler, log *logrus.Logger) apimodule.ClientAPIModule {
+func New(config *config.Config, db db.DB, oauthServer oauth.Server, mediaHandler media.MediaHandler, federator federation.Federator, distributor distributor.Distributor, log *logrus.Logger) apimodule.ClientAPIModule {
 	return &accountModule{
 		config:       config,
 		db:           db,
 		oauthServer:  oauthServer,
 		mediaHandler: mediaHandler,
+		federator:    federator,
+		distributor:  distributor,
 		log:          log,
 	}
 }
@@ -64,7 +72,10 @@ func New(config *config.Config, db db.DB, oauthServer oauth.Server, mediaHandler
 // Route attaches all routes from this module to the given router
 func (m *accountModule) Route(r router.Router) error {
 	r.AttachHandler(http.MethodPost, basePath, m.accountCreatePOSTHandler)
+	r.AttachHandler(http.MethodDelete, basePath, m.accountDELETEHandler)
 	r.AttachHandler(http.MethodGet, basePathWithID, m.muxHandler)
+	r.AttachHandler(http.MethodPost, aliasesPath, m.accountAliasesPOSTHandler)
+	r.AttachHandler(http.MethodPost, movePath, m.accountMovePOSTHandler)
 	return nil
 }
 
@@ -75,6 +86,7 @@ func (m *accountModule) CreateTables(db db.DB) error {
 		&model.Follow{},
 		&model.FollowRequest{},
 		&model.Status{},
+		&model.StatusFave{},
 		&model.Application{},
 		&model.EmailDomainBlock{},
 		&model.MediaAttachment{},
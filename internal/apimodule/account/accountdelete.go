@@ -0,0 +1,61 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package account
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superseriousbusiness/gotosocial/internal/oauth"
+	"github.com/superseriousbusiness/gotosocial/pkg/mastotypes"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// accountDELETEHandler deletes the requesting account, once the user has confirmed it with their password.
+// The account is gone as soon as this returns, but what it leaves behind is removed in the background.
+// It should be served as a DELETE at /api/v1/accounts
+func (m *accountModule) accountDELETEHandler(c *gin.Context) {
+	l := m.log.WithField("func", "accountDELETEHandler")
+	authed, err := oauth.MustAuth(c, true, false, true, true)
+	if err != nil {
+		l.Debugf("couldn't auth: %s", err)
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	form := &mastotypes.AccountDeleteRequest{}
+	if err := c.ShouldBind(form); err != nil {
+		l.Debugf("could not parse form from request: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(authed.User.EncryptedPassword), []byte(form.Password)); err != nil {
+		l.Debugf("wrong password for account %s", authed.Account.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "password was incorrect"})
+		return
+	}
+
+	if err := m.federator.DeleteAccount(c.Request.Context(), authed.Account); err != nil {
+		l.Errorf("error deleting account %s: %s", authed.Account.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error deleting account"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
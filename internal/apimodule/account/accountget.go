@@ -24,11 +24,15 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/superseriousbusiness/gotosocial/internal/db"
 	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/oauth"
 )
 
 // accountGetHandler serves the account information held by the server in response to a GET
 // request. It should be served as a GET at /api/v1/accounts/:id.
 //
+// When a signed-in user views a remote account, the account is queued to be backfilled, so that
+// its posts are there to look at when greedy federation is enabled.
+//
 // See: https://docs.joinmastodon.org/methods/accounts/
 func (m *accountModule) accountGETHandler(c *gin.Context) {
 	targetAcctID := c.Param(idKey)
@@ -46,6 +50,16 @@ func (m *accountModule) accountGETHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if !targetAccount.DeletedAt.IsZero() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+		return
+	}
+
+	if targetAccount.Domain != "" {
+		if _, err := oauth.MustAuth(c, true, false, false, true); err == nil {
+			m.federator.Backfill(targetAccount)
+		}
+	}
 
 	acctInfo, err := m.db.AccountToMastoPublic(targetAccount)
 	if err != nil {
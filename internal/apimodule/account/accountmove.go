@@ -0,0 +1,180 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/oauth"
+	"github.com/superseriousbusiness/gotosocial/pkg/mastotypes"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// accountAliasesPOSTHandler sets the accounts that the requesting account is also known as, replacing any it had before.
+// Another account can only be moved to this one if it's listed here.
+// It should be served as a POST at /api/v1/accounts/aliases
+func (m *accountModule) accountAliasesPOSTHandler(c *gin.Context) {
+	l := m.log.WithField("func", "accountAliasesPOSTHandler")
+	authed, err := oauth.MustAuth(c, true, false, false, true)
+	if err != nil {
+		l.Debugf("couldn't auth: %s", err)
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	form := &mastotypes.AccountAliasesRequest{}
+	if err := c.ShouldBind(form); err != nil {
+		l.Debugf("could not parse form from request: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	aliases := []string{}
+	seen := map[string]bool{}
+	for _, a := range form.AlsoKnownAs {
+		uri, err := m.resolveAccountURI(c.Request.Context(), a)
+		if err != nil {
+			l.Debugf("could not resolve alias %s: %s", a, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("could not resolve alias %s: %s", a, err)})
+			return
+		}
+		if uri.String() == authed.Account.URI {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "an account can't be an alias of itself"})
+			return
+		}
+		if !seen[uri.String()] {
+			seen[uri.String()] = true
+			aliases = append(aliases, uri.String())
+		}
+	}
+
+	acct := &model.Account{}
+	if err := m.db.GetByID(authed.Account.ID, acct); err != nil {
+		l.Errorf("error getting account %s: %s", authed.Account.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	acct.AlsoKnownAs = aliases
+	if err := m.db.UpdateByID(acct.ID, acct); err != nil {
+		l.Errorf("error updating aliases of account %s: %s", acct.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	acctSensitive, err := m.db.AccountToMastoSensitive(acct)
+	if err != nil {
+		l.Errorf("could not convert account into mastosensitive account: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, acctSensitive)
+}
+
+// accountMovePOSTHandler moves the requesting account to another account, which has to list it as an alias.
+// The requesting account is then shown as having moved, and its followers are asked to follow the other account instead.
+// It should be served as a POST at /api/v1/accounts/move
+func (m *accountModule) accountMovePOSTHandler(c *gin.Context) {
+	l := m.log.WithField("func", "accountMovePOSTHandler")
+	authed, err := oauth.MustAuth(c, true, false, true, true)
+	if err != nil {
+		l.Debugf("couldn't auth: %s", err)
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	form := &mastotypes.AccountMoveRequest{}
+	if err := c.ShouldBind(form); err != nil {
+		l.Debugf("could not parse form from request: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(authed.User.EncryptedPassword), []byte(form.Password)); err != nil {
+		l.Debugf("wrong password for account %s", authed.Account.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "password was incorrect"})
+		return
+	}
+
+	targetIRI, err := m.resolveAccountURI(c.Request.Context(), form.MovedTo)
+	if err != nil {
+		l.Debugf("could not resolve account %s: %s", form.MovedTo, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("could not resolve account %s: %s", form.MovedTo, err)})
+		return
+	}
+
+	acct := &model.Account{}
+	if err := m.db.GetByID(authed.Account.ID, acct); err != nil {
+		l.Errorf("error getting account %s: %s", authed.Account.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if _, err := m.federator.MoveAccount(c.Request.Context(), acct, targetIRI); err != nil {
+		l.Debugf("could not move account %s to %s: %s", acct.ID, targetIRI, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("could not move account: %s", err)})
+		return
+	}
+
+	acctSensitive, err := m.db.AccountToMastoSensitive(acct)
+	if err != nil {
+		l.Errorf("could not convert account into mastosensitive account: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, acctSensitive)
+}
+
+// resolveAccountURI returns the activitypub uri of the account given by s, which can either be the uri itself,
+// or a username@domain handle; the domain can be left out for accounts on this instance.
+func (m *accountModule) resolveAccountURI(ctx context.Context, s string) (*url.URL, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "@")
+	if s == "" {
+		return nil, errors.New("no account given")
+	}
+
+	if strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://") {
+		uri, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		if uri.Host == "" {
+			return nil, errors.New("uri has no host")
+		}
+		return uri, nil
+	}
+
+	username, domain := s, ""
+	if i := strings.Index(s, "@"); i != -1 {
+		username, domain = s[:i], s[i+1:]
+	}
+	if domain == "" || domain == m.config.Host {
+		acct := &model.Account{}
+		if err := m.db.GetLocalAccountByUsername(username, acct); err != nil {
+			return nil, fmt.Errorf("no local account %s", username)
+		}
+		return url.Parse(acct.URI)
+	}
+	return m.federator.FingerRemoteAccount(ctx, username, domain)
+}
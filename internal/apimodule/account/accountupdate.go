@@ -28,6 +28,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
 	"github.com/superseriousbusiness/gotosocial/internal/oauth"
 	"github.com/superseriousbusiness/gotosocial/internal/util"
 	"github.com/superseriousbusiness/gotosocial/pkg/mastotypes"
@@ -175,6 +176,11 @@ func (m *accountModule) accountUpdateCredentialsPATCHHandler(c *gin.Context) {
 		return
 	}
 
+	// the update is stored, so the account's followers can hear about it
+	if err := m.distributor.Send(c.Request.Context(), distributor.AccountUpdated{Account: updatedAccount}); err != nil {
+		l.Errorf("error sending updated account %s to the distributor: %s", updatedAccount.ID, err)
+	}
+
 	acctSensitive, err := m.db.AccountToMastoSensitive(updatedAccount)
 	if err != nil {
 		l.Tracef("could not convert account into mastosensitive account: %s", err)
@@ -0,0 +1,66 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package admin
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+// accountDELETEHandler lets an admin delete any account, local or remote, other than their own.
+// Deleting a remote account only removes it from this instance; its own server isn't told about it.
+// It should be served as a DELETE at /api/v1/admin/accounts/:id
+func (m *adminModule) accountDELETEHandler(c *gin.Context) {
+	l := m.log.WithField("func", "accountDELETEHandler")
+	authed, ok := m.mustAdmin(c, l)
+	if !ok {
+		return
+	}
+
+	targetAcctID := c.Param(idKey)
+	if targetAcctID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no account id specified"})
+		return
+	}
+	if targetAcctID == authed.Account.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "admins can't delete their own account this way"})
+		return
+	}
+
+	targetAccount := &model.Account{}
+	if err := m.db.GetByID(targetAcctID, targetAccount); err != nil {
+		if _, ok := err.(db.ErrNoEntries); ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+			return
+		}
+		l.Errorf("error getting account %s: %s", targetAcctID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	if err := m.federator.DeleteAccount(c.Request.Context(), targetAccount); err != nil {
+		l.Errorf("error deleting account %s: %s", targetAccount.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error deleting account"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
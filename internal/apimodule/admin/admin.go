@@ -0,0 +1,106 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package admin provides the /api/v1/admin endpoints, which let the admins of this instance moderate it.
+package admin
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/superseriousbusiness/gotosocial/internal/apimodule"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/federation"
+	"github.com/superseriousbusiness/gotosocial/internal/oauth"
+	"github.com/superseriousbusiness/gotosocial/internal/router"
+)
+
+const (
+	idKey                    = "id"
+	domainKey                = "domain"
+	basePath                 = "/api/v1/admin"
+	accountsPath             = basePath + "/accounts"
+	accountsPathWithID       = accountsPath + "/:" + idKey
+	pendingPath              = basePath + "/federation/pending"
+	pendingPathWithID        = pendingPath + "/:" + idKey
+	pendingReleasePath       = pendingPathWithID + "/release"
+	reputationPathWithDomain = basePath + "/federation/reputation/:" + domainKey
+)
+
+type adminModule struct {
+	config    *config.Config
+	db        db.DB
+	federator federation.Federator
+	log       *logrus.Logger
+}
+
+// New returns a new admin module
+func New(config *config.Config, db db.DB, federator federation.Federator, log *logrus.Logger) apimodule.ClientAPIModule {
+	return &adminModule{
+		config:    config,
+		db:        db,
+		federator: federator,
+		log:       log,
+	}
+}
+
+// Route attaches all routes from this module to the given router
+func (m *adminModule) Route(r router.Router) error {
+	r.AttachHandler(http.MethodDelete, accountsPathWithID, m.accountDELETEHandler)
+	r.AttachHandler(http.MethodGet, pendingPath, m.pendingGETHandler)
+	r.AttachHandler(http.MethodPost, pendingReleasePath, m.pendingReleasePOSTHandler)
+	r.AttachHandler(http.MethodDelete, pendingPathWithID, m.pendingDELETEHandler)
+	r.AttachHandler(http.MethodPut, reputationPathWithDomain, m.reputationPUTHandler)
+	r.AttachHandler(http.MethodDelete, reputationPathWithDomain, m.reputationDELETEHandler)
+	return nil
+}
+
+func (m *adminModule) CreateTables(db db.DB) error {
+	models := []interface{}{
+		&model.User{},
+		&model.Account{},
+	}
+
+	for _, m := range models {
+		if err := db.CreateTable(m); err != nil {
+			return fmt.Errorf("error creating table: %s", err)
+		}
+	}
+	return nil
+}
+
+// mustAdmin authenticates the request, and checks that it was made by the user of an admin. If it wasn't, a response
+// has already been written and false is returned.
+func (m *adminModule) mustAdmin(c *gin.Context, l *logrus.Entry) (*oauth.Authed, bool) {
+	authed, err := oauth.MustAuth(c, true, false, true, true)
+	if err != nil {
+		l.Debugf("couldn't auth: %s", err)
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if !authed.User.Admin {
+		l.Debugf("user %s is not an admin", authed.User.ID)
+		c.JSON(http.StatusForbidden, gin.H{"error": "not an admin"})
+		return nil, false
+	}
+	return authed, true
+}
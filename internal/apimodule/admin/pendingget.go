@@ -0,0 +1,59 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/pkg/mastotypes"
+)
+
+// pendingGETHandler lists the deliveries that are being held for review, because of the poor reputation of the domains that made them.
+// It should be served as a GET at /api/v1/admin/federation/pending
+func (m *adminModule) pendingGETHandler(c *gin.Context) {
+	l := m.log.WithField("func", "pendingGETHandler")
+	if _, ok := m.mustAdmin(c, l); !ok {
+		return
+	}
+
+	pending := []model.PendingActivity{}
+	if err := m.db.GetAll(&pending); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			l.Errorf("error getting pending activities: %s", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+	}
+
+	mastoPending := []mastotypes.AdminPendingActivity{}
+	for _, p := range pending {
+		mastoPending = append(mastoPending, mastotypes.AdminPendingActivity{
+			ID:        p.ID,
+			CreatedAt: p.CreatedAt.Format(time.RFC3339),
+			Domain:    p.Domain,
+			AccountID: p.AccountID,
+			InboxPath: p.InboxPath,
+			Activity:  p.Activity,
+		})
+	}
+	c.JSON(http.StatusOK, mastoPending)
+}
@@ -0,0 +1,91 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+package admin
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+// pendingReleasePOSTHandler lets a delivery that's being held for review through, by processing it as if it had just come in.
+// It should be served as a POST at /api/v1/admin/federation/pending/:id/release
+func (m *adminModule) pendingReleasePOSTHandler(c *gin.Context) {
+	l := m.log.WithField("func", "pendingReleasePOSTHandler")
+	if _, ok := m.mustAdmin(c, l); !ok {
+		return
+	}
+
+	pending, ok := m.getPending(c, l)
+	if !ok {
+		return
+	}
+
+	if err := m.federator.ReleasePendingActivity(c.Request.Context(), pending); err != nil {
+		l.Errorf("error releasing pending activity %s: %s", pending.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error processing activity"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// pendingDELETEHandler rejects a delivery that's being held for review, by removing it without processing it.
+// It should be served as a DELETE at /api/v1/admin/federation/pending/:id
+func (m *adminModule) pendingDELETEHandler(c *gin.Context) {
+	l := m.log.WithField("func", "pendingDELETEHandler")
+	if _, ok := m.mustAdmin(c, l); !ok {
+		return
+	}
+
+	pending, ok := m.getPending(c, l)
+	if !ok {
+		return
+	}
+
+	if err := m.db.DeleteByID(pending.ID, &model.PendingActivity{}); err != nil {
+		l.Errorf("error deleting pending activity %s: %s", pending.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// getPending returns the pending activity with the id given in the request path. If there isn't one, a response has
+// already been written and false is returned.
+func (m *adminModule) getPending(c *gin.Context, l *logrus.Entry) (*model.PendingActivity, bool) {
+	pendingID := c.Param(idKey)
+	if pendingID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no pending activity id specified"})
+		return nil, false
+	}
+
+	pending := &model.PendingActivity{}
+	if err := m.db.GetByID(pendingID, pending); err != nil {
+		if _, ok := err.(db.ErrNoEntries); ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+			return nil, false
+		}
+		l.Errorf("error getting pending activity %s: %s", pendingID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return nil, false
+	}
+	return pending, true
+}
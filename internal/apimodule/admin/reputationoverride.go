@@ -0,0 +1,118 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+package admin
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/reputation"
+	"github.com/superseriousbusiness/gotosocial/pkg/mastotypes"
+)
+
+// reputationPUTHandler pins the reputation score of a remote domain, replacing any score it was pinned to before.
+// Reputations are cached for a while, so the new score may take a few minutes to be used.
+// It should be served as a PUT at /api/v1/admin/federation/reputation/:domain
+func (m *adminModule) reputationPUTHandler(c *gin.Context) {
+	l := m.log.WithField("func", "reputationPUTHandler")
+	authed, ok := m.mustAdmin(c, l)
+	if !ok {
+		return
+	}
+
+	domain := strings.ToLower(c.Param(domainKey))
+	if domain == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no domain specified"})
+		return
+	}
+	if domain == strings.ToLower(m.config.Host) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "this instance doesn't have a reputation"})
+		return
+	}
+
+	form := &mastotypes.AdminReputationOverrideRequest{}
+	if err := c.ShouldBind(form); err != nil {
+		l.Debugf("could not parse form from request: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if *form.Score < reputation.MinScore || *form.Score > reputation.MaxScore {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "score must be between 0 and 100"})
+		return
+	}
+
+	override := &model.ReputationOverride{}
+	err := m.db.GetWhere("domain", domain, override)
+	if err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			l.Errorf("error getting reputation override for %s: %s", domain, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+	}
+	override.Domain = domain
+	override.Score = *form.Score
+	override.PrivateComment = form.PrivateComment
+	override.UpdatedAt = time.Now()
+	if err == nil {
+		err = m.db.UpdateByID(override.ID, override)
+	} else {
+		override.CreatedByAccountID = authed.Account.ID
+		err = m.db.Put(override)
+	}
+	if err != nil {
+		l.Errorf("error storing reputation override for %s: %s", domain, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mastotypes.AdminReputationOverride{
+		Domain:         override.Domain,
+		Score:          override.Score,
+		UpdatedAt:      override.UpdatedAt.Format(time.RFC3339),
+		PrivateComment: override.PrivateComment,
+	})
+}
+
+// reputationDELETEHandler unpins the reputation score of a remote domain, so that it's calculated again.
+// It should be served as a DELETE at /api/v1/admin/federation/reputation/:domain
+func (m *adminModule) reputationDELETEHandler(c *gin.Context) {
+	l := m.log.WithField("func", "reputationDELETEHandler")
+	if _, ok := m.mustAdmin(c, l); !ok {
+		return
+	}
+
+	domain := strings.ToLower(c.Param(domainKey))
+	if domain == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no domain specified"})
+		return
+	}
+
+	if err := m.db.DeleteWhere("domain", domain, &model.ReputationOverride{}); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			l.Errorf("error deleting reputation override for %s: %s", domain, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
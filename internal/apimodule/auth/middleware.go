@@ -59,6 +59,10 @@ func (m *authModule) oauthTokenMiddleware(c *gin.Context) {
 			l.Warnf("no account found for validated user %s", uid)
 			return
 		}
+		if !acct.DeletedAt.IsZero() {
+			l.Debugf("account of user %s has been deleted", uid)
+			return
+		}
 		c.Set(oauth.SessionAuthorizedAccount, acct)
 		l.Tracef("set gin context %s to %+v", oauth.SessionAuthorizedAccount, acct)
 	}
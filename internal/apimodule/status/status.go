@@ -0,0 +1,92 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package status provides the /api/v1/statuses endpoints, for posting, viewing and deleting statuses.
+package status
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"github.com/superseriousbusiness/gotosocial/internal/apimodule"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+	"github.com/superseriousbusiness/gotosocial/internal/formatter"
+	"github.com/superseriousbusiness/gotosocial/internal/router"
+)
+
+const (
+	idKey          = "id"
+	basePath       = "/api/v1/statuses"
+	basePathWithID = basePath + "/:" + idKey
+	contextPath    = basePathWithID + "/context"
+
+	contentTypePlain    = "text/plain"
+	contentTypeMarkdown = "text/markdown"
+)
+
+type statusModule struct {
+	config      *config.Config
+	db          db.DB
+	distributor distributor.Distributor
+	formatter   formatter.Formatter
+	log         *logrus.Logger
+}
+
+// New returns a new status module
+func New(config *config.Config, db db.DB, distributor distributor.Distributor, formatter formatter.Formatter, log *logrus.Logger) apimodule.ClientAPIModule {
+	return &statusModule{
+		config:      config,
+		db:          db,
+		distributor: distributor,
+		formatter:   formatter,
+		log:         log,
+	}
+}
+
+// Route attaches all routes from this module to the given router
+func (m *statusModule) Route(r router.Router) error {
+	r.AttachHandler(http.MethodPost, basePath, m.statusCreatePOSTHandler)
+	r.AttachHandler(http.MethodGet, basePathWithID, m.statusGETHandler)
+	r.AttachHandler(http.MethodDelete, basePathWithID, m.statusDELETEHandler)
+	r.AttachHandler(http.MethodGet, contextPath, m.statusContextGETHandler)
+	return nil
+}
+
+func (m *statusModule) CreateTables(db db.DB) error {
+	models := []interface{}{
+		&model.User{},
+		&model.Account{},
+		&model.Follow{},
+		&model.Status{},
+		&model.StatusFave{},
+		&model.Mention{},
+		&model.Application{},
+		&model.MediaAttachment{},
+	}
+
+	for _, m := range models {
+		if err := db.CreateTable(m); err != nil {
+			return fmt.Errorf("error creating table: %s", err)
+		}
+	}
+	return nil
+}
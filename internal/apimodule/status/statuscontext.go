@@ -0,0 +1,165 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package status
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/oauth"
+	"github.com/superseriousbusiness/gotosocial/pkg/mastotypes"
+)
+
+// maxContextStatuses is the most statuses that are shown above, and below, a status in its context.
+const maxContextStatuses = 100
+
+// statusContextGETHandler serves the thread that the given status is in: the statuses it replies to, oldest first, and the
+// replies to it and to those replies, in the order they were posted. Statuses that the requester can't see are left out.
+// It should be served as a GET at /api/v1/statuses/:id/context
+//
+// See: https://docs.joinmastodon.org/methods/statuses/
+func (m *statusModule) statusContextGETHandler(c *gin.Context) {
+	l := m.log.WithField("func", "statusContextGETHandler")
+
+	targetStatusID := c.Param(idKey)
+	if targetStatusID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no status id specified"})
+		return
+	}
+
+	var requestingAccount *model.Account
+	if authed, err := oauth.MustAuth(c, true, false, true, true); err == nil {
+		requestingAccount = authed.Account
+	}
+
+	status, err := m.getVisibleStatus(targetStatusID, requestingAccount)
+	if err != nil {
+		if _, ok := err.(db.ErrNoEntries); ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+			return
+		}
+		l.Errorf("error getting status %s: %s", targetStatusID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	ancestors, err := m.ancestors(status, requestingAccount)
+	if err != nil {
+		l.Errorf("error getting ancestors of status %s: %s", status.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	descendants, err := m.descendants(status, requestingAccount)
+	if err != nil {
+		l.Errorf("error getting descendants of status %s: %s", status.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	context := &mastotypes.Context{
+		Ancestors:   []mastotypes.Status{},
+		Descendants: []mastotypes.Status{},
+	}
+	for _, s := range ancestors {
+		mastoStatus, err := m.db.StatusToMasto(s, requestingAccount)
+		if err != nil {
+			l.Errorf("error converting status %s: %s", s.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		context.Ancestors = append(context.Ancestors, *mastoStatus)
+	}
+	for _, s := range descendants {
+		mastoStatus, err := m.db.StatusToMasto(s, requestingAccount)
+		if err != nil {
+			l.Errorf("error converting status %s: %s", s.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		context.Descendants = append(context.Descendants, *mastoStatus)
+	}
+	c.JSON(http.StatusOK, context)
+}
+
+// ancestors returns the statuses that the given status replies to, all the way up the thread, oldest first.
+// The thread stops at the first status that's gone or that the requesting account can't see.
+func (m *statusModule) ancestors(status *model.Status, requestingAccount *model.Account) ([]*model.Status, error) {
+	ancestors := []*model.Status{}
+	seen := map[string]bool{status.ID: true}
+	for s := status; s.InReplyToID != "" && !seen[s.InReplyToID] && len(ancestors) < maxContextStatuses; {
+		parent, err := m.getVisibleStatus(s.InReplyToID, requestingAccount)
+		if err != nil {
+			if _, ok := err.(db.ErrNoEntries); ok {
+				break
+			}
+			return nil, err
+		}
+		seen[parent.ID] = true
+		ancestors = append([]*model.Status{parent}, ancestors...)
+		s = parent
+	}
+	return ancestors, nil
+}
+
+// descendants returns the replies to the given status, and the replies to those, and so on, oldest first.
+// Replies that the requesting account can't see are left out, along with the replies to them.
+func (m *statusModule) descendants(status *model.Status, requestingAccount *model.Account) ([]*model.Status, error) {
+	descendants := []*model.Status{}
+	seen := map[string]bool{status.ID: true}
+	queue := []string{status.ID}
+	for len(queue) != 0 && len(descendants) < maxContextStatuses {
+		id := queue[0]
+		queue = queue[1:]
+
+		replies := []model.Status{}
+		if err := m.db.GetWhere("in_reply_to_id", id, &replies); err != nil {
+			if _, ok := err.(db.ErrNoEntries); ok {
+				continue
+			}
+			return nil, err
+		}
+		for i := range replies {
+			reply := &replies[i]
+			if seen[reply.ID] {
+				continue
+			}
+			seen[reply.ID] = true
+			visible, err := m.statusVisible(reply, requestingAccount)
+			if err != nil {
+				return nil, err
+			}
+			if !visible {
+				continue
+			}
+			descendants = append(descendants, reply)
+			queue = append(queue, reply.ID)
+		}
+	}
+
+	sort.SliceStable(descendants, func(i, j int) bool {
+		return descendants[i].CreatedAt.Before(descendants[j].CreatedAt)
+	})
+	if len(descendants) > maxContextStatuses {
+		descendants = descendants[:maxContextStatuses]
+	}
+	return descendants, nil
+}
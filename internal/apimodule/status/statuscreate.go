@@ -0,0 +1,280 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package status
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+	"github.com/superseriousbusiness/gotosocial/internal/formatter"
+	"github.com/superseriousbusiness/gotosocial/internal/oauth"
+	"github.com/superseriousbusiness/gotosocial/pkg/mastotypes"
+)
+
+// statusCreatePOSTHandler handles the posting of a new status by the requesting account.
+// It should be served as a POST at /api/v1/statuses
+//
+// The status is stored straight away, and federated in the background.
+//
+// See: https://docs.joinmastodon.org/methods/statuses/
+func (m *statusModule) statusCreatePOSTHandler(c *gin.Context) {
+	l := m.log.WithField("func", "statusCreatePOSTHandler")
+	authed, err := oauth.MustAuth(c, true, true, true, true)
+	if err != nil {
+		l.Debugf("couldn't auth: %s", err)
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	form := &mastotypes.StatusRequest{}
+	if err := c.ShouldBind(form); err != nil {
+		l.Debugf("could not parse form from request: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := m.validateCreateStatus(form); err != nil {
+		l.Debugf("error validating form: %s", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	visibility, err := parseVisibility(form.Visibility, authed.Account.Privacy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// local-only statuses stay on this instance
+	visibility.LocalOnly = form.LocalOnly
+
+	policy, err := parseInteractionPolicy(form)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var formatted *formatter.Formatted
+	if form.ContentType == contentTypeMarkdown {
+		formatted = m.formatter.FromMarkdown(form.Status)
+	} else {
+		formatted = m.formatter.FromPlain(form.Status)
+	}
+
+	statusID := uuid.NewString()
+	now := time.Now()
+	status := &model.Status{
+		ID:                       statusID,
+		URI:                      fmt.Sprintf("%s/statuses/%s", authed.Account.URI, statusID),
+		URL:                      fmt.Sprintf("%s/%s", authed.Account.URL, statusID),
+		Content:                  formatted.HTML,
+		Text:                     form.Status,
+		CreatedAt:                now,
+		UpdatedAt:                now,
+		Local:                    true,
+		AccountID:                authed.Account.ID,
+		ContentWarning:           form.SpoilerText,
+		Sensitive:                form.Sensitive,
+		Language:                 form.Language,
+		Tags:                     formatted.Tags,
+		CreatedWithApplicationID: authed.Application.ID,
+		Visibility:               visibility,
+		InteractionPolicy:        policy,
+	}
+	if status.Language == "" {
+		status.Language = authed.Account.Language
+	}
+
+	// make sure the status being replied to exists, and that the requester can see it and is allowed to reply to it
+	if form.InReplyToID != "" {
+		inReplyTo, err := m.getVisibleStatus(form.InReplyToID, authed.Account)
+		if err != nil {
+			if _, ok := err.(db.ErrNoEntries); ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("status %s to reply to was not found", form.InReplyToID)})
+				return
+			}
+			l.Errorf("error getting status %s to reply to: %s", form.InReplyToID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+		allowed, err := m.db.StatusInteractionAllowed(inReplyTo, authed.Account, model.InteractionReply)
+		if err != nil {
+			l.Errorf("error checking whether account %s can reply to status %s: %s", authed.Account.ID, inReplyTo.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("you can't reply to status %s", inReplyTo.ID)})
+			return
+		}
+		status.InReplyToID = inReplyTo.ID
+		status.InReplyToAccountID = inReplyTo.AccountID
+	}
+
+	// make sure the attachments exist, and that they belong to the requester and aren't attached to anything else yet
+	attachments := []*model.MediaAttachment{}
+	for _, id := range form.MediaIDs {
+		attachment := &model.MediaAttachment{}
+		if err := m.db.GetByID(id, attachment); err != nil {
+			if _, ok := err.(db.ErrNoEntries); ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("media %s was not found", id)})
+				return
+			}
+			l.Errorf("error getting media %s: %s", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+		if attachment.AccountID != authed.Account.ID || attachment.StatusID != "" || attachment.Avatar || attachment.Header {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("media %s can't be attached to this status", id)})
+			return
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	if err := m.db.Put(status); err != nil {
+		l.Errorf("error storing status: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	for _, a := range attachments {
+		if err := m.db.UpdateOneByID(a.ID, "status_id", status.ID, &model.MediaAttachment{}); err != nil {
+			l.Errorf("error attaching media %s to status %s: %s", a.ID, status.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+	}
+
+	for _, mentioned := range formatted.Mentions {
+		if err := m.db.Put(&model.Mention{
+			StatusID:        status.ID,
+			OriginAccountID: authed.Account.ID,
+			TargetAccountID: mentioned.ID,
+		}); err != nil {
+			l.Errorf("error storing mention of %s in status %s: %s", mentioned.ID, status.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+	}
+
+	// the status is already stored, so if it can't be federated, that's not the requester's problem
+	if err := m.distributor.Send(c.Request.Context(), distributor.StatusCreated{Status: status}); err != nil {
+		l.Errorf("error sending status %s to the distributor: %s", status.ID, err)
+	}
+
+	mastoStatus, err := m.db.StatusToMasto(status, authed.Account)
+	if err != nil {
+		l.Errorf("error converting status %s: %s", status.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, mastoStatus)
+}
+
+// validateCreateStatus checks that the given form is one that a status can be made from, and that it's within the
+// limits set in the config.
+func (m *statusModule) validateCreateStatus(form *mastotypes.StatusRequest) error {
+	if strings.TrimSpace(form.Status) == "" && len(form.MediaIDs) == 0 {
+		return errors.New("no status or media provided")
+	}
+	if form.Poll != nil {
+		return errors.New("polls are not supported")
+	}
+	if form.ScheduledAt != "" {
+		return errors.New("scheduled statuses are not supported")
+	}
+	if form.ContentType != "" && form.ContentType != contentTypePlain && form.ContentType != contentTypeMarkdown {
+		return fmt.Errorf("content type %s not recognised", form.ContentType)
+	}
+
+	limits := m.config.StatusesConfig
+	if chars := utf8.RuneCountInString(form.Status); chars > limits.MaxChars {
+		return fmt.Errorf("status too long, %d characters provided but limit is %d", chars, limits.MaxChars)
+	}
+	if chars := utf8.RuneCountInString(form.SpoilerText); chars > limits.CWMaxChars {
+		return fmt.Errorf("content warning too long, %d characters provided but limit is %d", chars, limits.CWMaxChars)
+	}
+	if len(form.MediaIDs) > limits.MaxMediaFiles {
+		return fmt.Errorf("too many media files attached to status, %d attached but limit is %d", len(form.MediaIDs), limits.MaxMediaFiles)
+	}
+	return nil
+}
+
+// parseVisibility returns the visibility with the given mastodon api name: one of public, unlisted, private or direct.
+// If no visibility is given, the default privacy of the account is used, or public if that isn't set either.
+// Public statuses are shown on the local timeline as well as the federated one.
+func parseVisibility(visibility string, defaultPrivacy string) (*model.Visibility, error) {
+	if visibility == "" {
+		visibility = defaultPrivacy
+	}
+	switch visibility {
+	case "", "public":
+		return &model.Visibility{
+			Public:    true,
+			Local:     true,
+			Followers: true,
+		}, nil
+	case "unlisted":
+		return &model.Visibility{
+			Unlisted:  true,
+			Followers: true,
+		}, nil
+	case "private":
+		return &model.Visibility{
+			Followers: true,
+		}, nil
+	case "direct":
+		return &model.Visibility{
+			Direct: true,
+		}, nil
+	default:
+		return nil, fmt.Errorf("visibility %s not recognised", visibility)
+	}
+}
+
+// parseInteractionPolicy returns the interaction policy set in the given form. Any of its scopes that aren't set let everyone
+// interact with the status in that way.
+func parseInteractionPolicy(form *mastotypes.StatusRequest) (*model.InteractionPolicy, error) {
+	policy := &model.InteractionPolicy{}
+	for _, field := range []struct {
+		name  string
+		value string
+		scope *model.InteractionScope
+	}{
+		{"can_boost", form.CanBoost, &policy.CanBoost},
+		{"can_reply", form.CanReply, &policy.CanReply},
+		{"can_like", form.CanLike, &policy.CanLike},
+	} {
+		switch scope := model.InteractionScope(field.value); scope {
+		case "":
+			*field.scope = model.InteractionEveryone
+		case model.InteractionEveryone, model.InteractionFollowers, model.InteractionMutuals, model.InteractionMentioned:
+			*field.scope = scope
+		default:
+			return nil, fmt.Errorf("%s %s not recognised", field.name, field.value)
+		}
+	}
+	return policy, nil
+}
@@ -0,0 +1,342 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package status
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+	"github.com/superseriousbusiness/gotosocial/internal/formatter"
+	"github.com/superseriousbusiness/gotosocial/internal/oauth"
+	"github.com/superseriousbusiness/gotosocial/pkg/mastotypes"
+	oauthmodels "github.com/superseriousbusiness/oauth2/v4/models"
+)
+
+type StatusCreateTestSuite struct {
+	suite.Suite
+	config          *config.Config
+	log             *logrus.Logger
+	testAccount     *model.Account
+	testUser        *model.User
+	testApplication *model.Application
+	testToken       *oauthmodels.Token
+	testAttachment  *model.MediaAttachment
+	testReplyTo     *model.Status
+	mockDB          *db.MockDB
+	mockDistributor *distributor.MockDistributor
+	statusModule    *statusModule
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *StatusCreateTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	c := config.Empty()
+	c.Protocol = "https"
+	c.Host = "example.org"
+	c.StatusesConfig.MaxChars = 20
+	c.StatusesConfig.CWMaxChars = 10
+	c.StatusesConfig.MaxMediaFiles = 2
+	suite.config = c
+
+	suite.testAccount = &model.Account{
+		ID:       "c2e1bb4d-8d29-4ab6-bde4-1e5c4e2f2a4b",
+		Username: "test_user",
+		URI:      "https://example.org/users/test_user",
+		URL:      "https://example.org/@test_user",
+		Privacy:  "unlisted",
+		Language: "en",
+	}
+	suite.testUser = &model.User{
+		ID:        "8d5e1a2b-7c6f-4e3d-9a8b-1c2d3e4f5a6b",
+		AccountID: suite.testAccount.ID,
+	}
+	suite.testApplication = &model.Application{
+		ID:   "f9e8d7c6-b5a4-4938-8271-6a5b4c3d2e1f",
+		Name: "test app",
+	}
+	suite.testToken = &oauthmodels.Token{
+		ClientID: "a-known-client-id",
+		UserID:   suite.testUser.ID,
+		Access:   "some-access-token",
+	}
+	suite.testAttachment = &model.MediaAttachment{
+		ID:        "0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d",
+		AccountID: suite.testAccount.ID,
+		Type:      model.FileTypeImage,
+	}
+	suite.testReplyTo = &model.Status{
+		ID:         "5f4e3d2c-1b0a-4f9e-8d7c-6b5a4f3e2d1c",
+		AccountID:  "1a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d",
+		Visibility: &model.Visibility{Public: true, Followers: true},
+	}
+}
+
+// SetupTest creates a fresh mock db, mock distributor and status module for each test
+func (suite *StatusCreateTestSuite) SetupTest() {
+	suite.mockDB = &db.MockDB{}
+	suite.mockDB.On("GetByID", suite.testAttachment.ID, mock.AnythingOfType("*model.MediaAttachment")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*model.MediaAttachment) = *suite.testAttachment
+	})
+	suite.mockDB.On("GetByID", suite.testReplyTo.ID, mock.AnythingOfType("*model.Status")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*model.Status) = *suite.testReplyTo
+	})
+	suite.mockDB.On("GetByID", mock.AnythingOfType("string"), mock.Anything).Return(db.ErrNoEntries{})
+	// the test account doesn't follow anyone and isn't mentioned anywhere, so it can only interact with statuses that everyone can
+	suite.mockDB.On("StatusInteractionAllowed", mock.AnythingOfType("*model.Status"), suite.testAccount, mock.AnythingOfType("model.Interaction")).Return(func(s *model.Status, a *model.Account, i model.Interaction) bool {
+		return s.InteractionPolicy.ScopeOf(i) == model.InteractionEveryone
+	}, nil)
+	suite.mockDB.On("Put", mock.AnythingOfType("*model.Status")).Return(nil)
+	suite.mockDB.On("UpdateOneByID", mock.AnythingOfType("string"), "status_id", mock.AnythingOfType("string"), &model.MediaAttachment{}).Return(nil)
+	suite.mockDB.On("StatusToMasto", mock.AnythingOfType("*model.Status"), suite.testAccount).Return(&mastotypes.Status{}, nil)
+
+	suite.mockDistributor = &distributor.MockDistributor{}
+	suite.mockDistributor.On("Send", mock.Anything, mock.AnythingOfType("distributor.StatusCreated")).Return(nil)
+
+	suite.statusModule = New(suite.config, suite.mockDB, suite.mockDistributor, formatter.New(suite.config, suite.mockDB, suite.log), suite.log).(*statusModule)
+}
+
+// post performs an authorized POST of the given form, and returns the recorded response
+func (suite *StatusCreateTestSuite) post(form url.Values) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Set(oauth.SessionAuthorizedToken, suite.testToken)
+	ctx.Set(oauth.SessionAuthorizedApplication, suite.testApplication)
+	ctx.Set(oauth.SessionAuthorizedUser, suite.testUser)
+	ctx.Set(oauth.SessionAuthorizedAccount, suite.testAccount)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "https://example.org"+basePath, strings.NewReader(form.Encode()))
+	ctx.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	suite.statusModule.statusCreatePOSTHandler(ctx)
+	return recorder
+}
+
+// stored returns the status that was put in the mock db
+func (suite *StatusCreateTestSuite) stored() *model.Status {
+	for _, c := range suite.mockDB.Calls {
+		if c.Method == "Put" {
+			return c.Arguments.Get(0).(*model.Status)
+		}
+	}
+	suite.FailNow("no status was stored")
+	return nil
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *StatusCreateTestSuite) TestPostNewStatus() {
+	recorder := suite.post(url.Values{
+		"status":       {"hello <world>\nhi"},
+		"spoiler_text": {"greetings"},
+	})
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+
+	status := suite.stored()
+	assert.NotEmpty(suite.T(), status.ID)
+	assert.Equal(suite.T(), "https://example.org/users/test_user/statuses/"+status.ID, status.URI)
+	assert.Equal(suite.T(), "https://example.org/@test_user/"+status.ID, status.URL)
+	assert.Equal(suite.T(), "<p>hello &lt;world&gt;<br />hi</p>", status.Content)
+	assert.Equal(suite.T(), "hello <world>\nhi", status.Text)
+	assert.Equal(suite.T(), "greetings", status.ContentWarning)
+	assert.Equal(suite.T(), "en", status.Language)
+	assert.Equal(suite.T(), suite.testApplication.ID, status.CreatedWithApplicationID)
+	assert.True(suite.T(), status.Local)
+	// the account's default privacy is used
+	assert.Equal(suite.T(), &model.Visibility{Unlisted: true, Followers: true}, status.Visibility)
+
+	suite.mockDistributor.AssertCalled(suite.T(), "Send", mock.Anything, distributor.StatusCreated{Status: status})
+}
+
+func (suite *StatusCreateTestSuite) TestPostWithMediaAndReply() {
+	recorder := suite.post(url.Values{
+		"status":         {"look at this"},
+		"media_ids":      {suite.testAttachment.ID},
+		"in_reply_to_id": {suite.testReplyTo.ID},
+		"visibility":     {"private"},
+	})
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+
+	status := suite.stored()
+	assert.Equal(suite.T(), suite.testReplyTo.ID, status.InReplyToID)
+	assert.Equal(suite.T(), suite.testReplyTo.AccountID, status.InReplyToAccountID)
+	assert.Equal(suite.T(), &model.Visibility{Followers: true}, status.Visibility)
+	suite.mockDB.AssertCalled(suite.T(), "UpdateOneByID", suite.testAttachment.ID, "status_id", status.ID, &model.MediaAttachment{})
+}
+
+func (suite *StatusCreateTestSuite) TestPostLocalOnly() {
+	recorder := suite.post(url.Values{
+		"status":     {"just for us"},
+		"visibility": {"public"},
+		"local_only": {"true"},
+	})
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.Equal(suite.T(), &model.Visibility{Public: true, Local: true, Followers: true, LocalOnly: true}, suite.stored().Visibility)
+}
+
+func (suite *StatusCreateTestSuite) TestPostInteractionPolicy() {
+	recorder := suite.post(url.Values{
+		"status":    {"hello"},
+		"can_boost": {"followers"},
+		"can_reply": {"mentioned"},
+	})
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.Equal(suite.T(), &model.InteractionPolicy{
+		CanBoost: model.InteractionFollowers,
+		CanReply: model.InteractionMentioned,
+		CanLike:  model.InteractionEveryone,
+	}, suite.stored().InteractionPolicy)
+}
+
+func (suite *StatusCreateTestSuite) TestPostUnknownInteractionScope() {
+	recorder := suite.post(url.Values{
+		"status":   {"hello"},
+		"can_like": {"friends"},
+	})
+	assert.Equal(suite.T(), http.StatusBadRequest, recorder.Code)
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+}
+
+func (suite *StatusCreateTestSuite) TestPostReplyNotAllowed() {
+	suite.testReplyTo.InteractionPolicy = &model.InteractionPolicy{CanReply: model.InteractionMutuals}
+	defer func() { suite.testReplyTo.InteractionPolicy = nil }()
+
+	recorder := suite.post(url.Values{
+		"status":         {"hello"},
+		"in_reply_to_id": {suite.testReplyTo.ID},
+	})
+	assert.Equal(suite.T(), http.StatusForbidden, recorder.Code)
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+}
+
+func (suite *StatusCreateTestSuite) TestPostMentionsAndTags() {
+	friend := &model.Account{
+		ID:       "9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b",
+		Username: "friend",
+		URL:      "https://example.org/@friend",
+	}
+	suite.mockDB.On("GetLocalAccountByUsername", "friend", mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*model.Account) = *friend
+	})
+	suite.mockDB.On("GetLocalAccountByUsername", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("Put", mock.AnythingOfType("*model.Mention")).Return(nil)
+
+	recorder := suite.post(url.Values{
+		"status":       {"**@friend** #Go @who"},
+		"content_type": {"text/markdown"},
+	})
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+
+	status := suite.stored()
+	assert.Equal(suite.T(), `<p><strong><span class="h-card"><a href="https://example.org/@friend" class="u-url mention" rel="nofollow noopener noreferrer">@<span>friend</span></a></span></strong> `+
+		`<a href="https://example.org/tags/go" class="mention hashtag" rel="tag nofollow noopener noreferrer">#<span>Go</span></a> @who</p>`, status.Content)
+	assert.Equal(suite.T(), []string{"go"}, status.Tags)
+	suite.mockDB.AssertCalled(suite.T(), "Put", &model.Mention{
+		StatusID:        status.ID,
+		OriginAccountID: suite.testAccount.ID,
+		TargetAccountID: friend.ID,
+	})
+}
+
+func (suite *StatusCreateTestSuite) TestPostUnknownContentType() {
+	recorder := suite.post(url.Values{
+		"status":       {"hello"},
+		"content_type": {"text/html"},
+	})
+	assert.Equal(suite.T(), http.StatusBadRequest, recorder.Code)
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+}
+
+func (suite *StatusCreateTestSuite) TestPostTooLong() {
+	recorder := suite.post(url.Values{
+		"status": {"this status is far too long for the limit"},
+	})
+	assert.Equal(suite.T(), http.StatusBadRequest, recorder.Code)
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+	suite.mockDistributor.AssertNotCalled(suite.T(), "Send", mock.Anything, mock.Anything)
+}
+
+func (suite *StatusCreateTestSuite) TestPostCWTooLong() {
+	recorder := suite.post(url.Values{
+		"status":       {"hello"},
+		"spoiler_text": {"a very long content warning"},
+	})
+	assert.Equal(suite.T(), http.StatusBadRequest, recorder.Code)
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+}
+
+func (suite *StatusCreateTestSuite) TestPostEmpty() {
+	recorder := suite.post(url.Values{
+		"status": {"   "},
+	})
+	assert.Equal(suite.T(), http.StatusBadRequest, recorder.Code)
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+}
+
+func (suite *StatusCreateTestSuite) TestPostUnknownVisibility() {
+	recorder := suite.post(url.Values{
+		"status":     {"hello"},
+		"visibility": {"secret"},
+	})
+	assert.Equal(suite.T(), http.StatusBadRequest, recorder.Code)
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+}
+
+func (suite *StatusCreateTestSuite) TestPostSomeoneElsesMedia() {
+	suite.testAttachment.AccountID = "1a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d"
+	defer func() { suite.testAttachment.AccountID = suite.testAccount.ID }()
+
+	recorder := suite.post(url.Values{
+		"status":    {"hello"},
+		"media_ids": {suite.testAttachment.ID},
+	})
+	assert.Equal(suite.T(), http.StatusBadRequest, recorder.Code)
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+}
+
+func (suite *StatusCreateTestSuite) TestPostReplyToUnknownStatus() {
+	recorder := suite.post(url.Values{
+		"status":         {"hello"},
+		"in_reply_to_id": {"9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b"},
+	})
+	assert.Equal(suite.T(), http.StatusBadRequest, recorder.Code)
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+}
+
+func TestStatusCreateTestSuite(t *testing.T) {
+	suite.Run(t, new(StatusCreateTestSuite))
+}
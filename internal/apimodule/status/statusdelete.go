@@ -0,0 +1,87 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package status
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+	"github.com/superseriousbusiness/gotosocial/internal/oauth"
+)
+
+// statusDELETEHandler deletes a status of the requesting account, and returns it as it was, along with the text it was
+// written with, so that it can be redrafted. It should be served as a DELETE at /api/v1/statuses/:id
+//
+// The status is gone as soon as this returns. The delete is federated, and what the status left behind is removed, in the background.
+//
+// See: https://docs.joinmastodon.org/methods/statuses/
+func (m *statusModule) statusDELETEHandler(c *gin.Context) {
+	l := m.log.WithField("func", "statusDELETEHandler")
+	authed, err := oauth.MustAuth(c, true, false, true, true)
+	if err != nil {
+		l.Debugf("couldn't auth: %s", err)
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	targetStatusID := c.Param(idKey)
+	if targetStatusID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no status id specified"})
+		return
+	}
+
+	status, err := m.getVisibleStatus(targetStatusID, authed.Account)
+	if err != nil {
+		if _, ok := err.(db.ErrNoEntries); ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+			return
+		}
+		l.Errorf("error getting status %s: %s", targetStatusID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if status.AccountID != authed.Account.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "status doesn't belong to requesting account"})
+		return
+	}
+
+	mastoStatus, err := m.db.StatusToMasto(status, authed.Account)
+	if err != nil {
+		l.Errorf("error converting status %s: %s", status.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	mastoStatus.Text = status.Text
+
+	if err := m.db.DeleteByID(status.ID, &model.Status{}); err != nil {
+		l.Errorf("error deleting status %s: %s", status.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	// the status is already gone, so if the delete can't be federated, that's not the requester's problem
+	if err := m.distributor.Send(c.Request.Context(), distributor.StatusDeleted{Status: status}); err != nil {
+		l.Errorf("error sending deleted status %s to the distributor: %s", status.ID, err)
+	}
+
+	c.JSON(http.StatusOK, mastoStatus)
+}
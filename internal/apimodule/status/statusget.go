@@ -0,0 +1,68 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package status
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/oauth"
+)
+
+// statusGETHandler serves the status with the given id, if the requester is allowed to see it.
+// It should be served as a GET at /api/v1/statuses/:id
+//
+// Public and unlisted statuses can be viewed without logging in.
+//
+// See: https://docs.joinmastodon.org/methods/statuses/
+func (m *statusModule) statusGETHandler(c *gin.Context) {
+	l := m.log.WithField("func", "statusGETHandler")
+
+	targetStatusID := c.Param(idKey)
+	if targetStatusID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no status id specified"})
+		return
+	}
+
+	var requestingAccount *model.Account
+	if authed, err := oauth.MustAuth(c, true, false, true, true); err == nil {
+		requestingAccount = authed.Account
+	}
+
+	status, err := m.getVisibleStatus(targetStatusID, requestingAccount)
+	if err != nil {
+		if _, ok := err.(db.ErrNoEntries); ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+			return
+		}
+		l.Errorf("error getting status %s: %s", targetStatusID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	mastoStatus, err := m.db.StatusToMasto(status, requestingAccount)
+	if err != nil {
+		l.Errorf("error converting status %s: %s", status.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, mastoStatus)
+}
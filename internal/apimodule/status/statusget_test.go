@@ -0,0 +1,265 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+	"github.com/superseriousbusiness/gotosocial/internal/formatter"
+	"github.com/superseriousbusiness/gotosocial/internal/oauth"
+	"github.com/superseriousbusiness/gotosocial/pkg/mastotypes"
+	oauthmodels "github.com/superseriousbusiness/oauth2/v4/models"
+)
+
+type StatusGetTestSuite struct {
+	suite.Suite
+	config          *config.Config
+	log             *logrus.Logger
+	author          *model.Account
+	follower        *model.Account
+	stranger        *model.Account
+	publicStatus    *model.Status
+	privateStatus   *model.Status
+	reply           *model.Status
+	privateReply    *model.Status
+	localOnly       *model.Status
+	mockDB          *db.MockDB
+	mockDistributor *distributor.MockDistributor
+	statusModule    *statusModule
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *StatusGetTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+	suite.config = config.Empty()
+
+	suite.author = &model.Account{ID: "c2e1bb4d-8d29-4ab6-bde4-1e5c4e2f2a4b", Username: "author"}
+	suite.follower = &model.Account{ID: "2b6d3f1c-5d43-4c8b-9c8e-6f5d1c2b3a41", Username: "follower"}
+	suite.stranger = &model.Account{ID: "8a7c1e2d-3b4f-4e5a-8c9d-0e1f2a3b4c5d", Username: "stranger"}
+
+	now := time.Now()
+	suite.publicStatus = &model.Status{
+		ID:         "5f4e3d2c-1b0a-4f9e-8d7c-6b5a4f3e2d1c",
+		AccountID:  suite.author.ID,
+		Content:    "<p>public</p>",
+		Text:       "public",
+		Local:      true,
+		CreatedAt:  now.Add(-3 * time.Minute),
+		Visibility: &model.Visibility{Public: true, Followers: true},
+	}
+	suite.privateStatus = &model.Status{
+		ID:         "7c1e9a0b-2d3f-4a5b-8c6d-9e0f1a2b3c4d",
+		AccountID:  suite.author.ID,
+		Content:    "<p>private</p>",
+		Local:      true,
+		CreatedAt:  now.Add(-2 * time.Minute),
+		Visibility: &model.Visibility{Followers: true},
+	}
+	suite.reply = &model.Status{
+		ID:          "0f1e2d3c-4b5a-4968-8776-a5b4c3d2e1f0",
+		AccountID:   suite.follower.ID,
+		InReplyToID: suite.publicStatus.ID,
+		CreatedAt:   now.Add(-1 * time.Minute),
+		Visibility:  &model.Visibility{Unlisted: true, Followers: true},
+	}
+	suite.privateReply = &model.Status{
+		ID:          "5e4d3c2b-1a09-4f8e-8d7c-6b5a49382716",
+		AccountID:   suite.author.ID,
+		InReplyToID: suite.publicStatus.ID,
+		CreatedAt:   now,
+		Visibility:  &model.Visibility{Followers: true},
+	}
+	suite.localOnly = &model.Status{
+		ID:         "3c2b1a09-8f7e-4d6c-9b5a-493827160f1e",
+		AccountID:  suite.author.ID,
+		Local:      true,
+		CreatedAt:  now,
+		Visibility: &model.Visibility{Public: true, Local: true, Followers: true, LocalOnly: true},
+	}
+}
+
+// SetupTest creates a fresh mock db, mock distributor and status module for each test.
+// The follower follows the author, and the stranger doesn't follow anyone.
+func (suite *StatusGetTestSuite) SetupTest() {
+	suite.mockDB = &db.MockDB{}
+	for _, s := range []*model.Status{suite.publicStatus, suite.privateStatus, suite.reply, suite.privateReply, suite.localOnly} {
+		status := s
+		suite.mockDB.On("GetByID", status.ID, mock.AnythingOfType("*model.Status")).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(1).(*model.Status) = *status
+		})
+	}
+	suite.mockDB.On("GetByID", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Status")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetWhere", "status_id", mock.AnythingOfType("string"), mock.AnythingOfType("*[]model.Mention")).Return(nil)
+	suite.mockDB.On("GetWhere", "in_reply_to_id", suite.publicStatus.ID, mock.AnythingOfType("*[]model.Status")).Return(nil).Run(func(args mock.Arguments) {
+		// newest first, to check that descendants get sorted
+		*args.Get(2).(*[]model.Status) = []model.Status{*suite.privateReply, *suite.reply}
+	})
+	suite.mockDB.On("GetWhere", "in_reply_to_id", mock.AnythingOfType("string"), mock.AnythingOfType("*[]model.Status")).Return(nil)
+	suite.mockDB.On("GetFollowingByAccountID", suite.follower.ID, mock.AnythingOfType("*[]model.Follow")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*[]model.Follow) = []model.Follow{{AccountID: suite.follower.ID, TargetAccountID: suite.author.ID}}
+	})
+	suite.mockDB.On("GetFollowingByAccountID", mock.AnythingOfType("string"), mock.AnythingOfType("*[]model.Follow")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("StatusToMasto", mock.AnythingOfType("*model.Status"), mock.Anything).Return(func(s *model.Status, requestingAccount *model.Account) *mastotypes.Status {
+		return &mastotypes.Status{ID: s.ID, Content: s.Content}
+	}, nil)
+	suite.mockDB.On("DeleteByID", mock.AnythingOfType("string"), &model.Status{}).Return(nil)
+
+	suite.mockDistributor = &distributor.MockDistributor{}
+	suite.mockDistributor.On("Send", mock.Anything, mock.AnythingOfType("distributor.StatusDeleted")).Return(nil)
+
+	suite.statusModule = New(suite.config, suite.mockDB, suite.mockDistributor, formatter.New(suite.config, suite.mockDB, suite.log), suite.log).(*statusModule)
+}
+
+// request calls the given handler for the status with the given id, as the given account, which can be nil to make the request
+// without logging in, and returns the recorded response
+func (suite *StatusGetTestSuite) request(handler gin.HandlerFunc, method string, statusID string, account *model.Account) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	if account != nil {
+		ctx.Set(oauth.SessionAuthorizedToken, &oauthmodels.Token{Access: "some-access-token"})
+		ctx.Set(oauth.SessionAuthorizedUser, &model.User{AccountID: account.ID})
+		ctx.Set(oauth.SessionAuthorizedAccount, account)
+	}
+	ctx.Request = httptest.NewRequest(method, "https://example.org"+basePath+"/"+statusID, nil)
+	ctx.Params = gin.Params{gin.Param{Key: idKey, Value: statusID}}
+	handler(ctx)
+	return recorder
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *StatusGetTestSuite) TestGetPublicStatusLoggedOut() {
+	recorder := suite.request(suite.statusModule.statusGETHandler, http.MethodGet, suite.publicStatus.ID, nil)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.Contains(suite.T(), recorder.Body.String(), suite.publicStatus.ID)
+}
+
+func (suite *StatusGetTestSuite) TestGetPrivateStatus() {
+	recorder := suite.request(suite.statusModule.statusGETHandler, http.MethodGet, suite.privateStatus.ID, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, recorder.Code)
+
+	recorder = suite.request(suite.statusModule.statusGETHandler, http.MethodGet, suite.privateStatus.ID, suite.stranger)
+	assert.Equal(suite.T(), http.StatusNotFound, recorder.Code)
+
+	recorder = suite.request(suite.statusModule.statusGETHandler, http.MethodGet, suite.privateStatus.ID, suite.follower)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+
+	recorder = suite.request(suite.statusModule.statusGETHandler, http.MethodGet, suite.privateStatus.ID, suite.author)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+}
+
+func (suite *StatusGetTestSuite) TestGetLocalOnlyStatus() {
+	recorder := suite.request(suite.statusModule.statusGETHandler, http.MethodGet, suite.localOnly.ID, nil)
+	assert.Equal(suite.T(), http.StatusNotFound, recorder.Code)
+
+	recorder = suite.request(suite.statusModule.statusGETHandler, http.MethodGet, suite.localOnly.ID, suite.stranger)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+}
+
+func (suite *StatusGetTestSuite) TestGetUnknownStatus() {
+	recorder := suite.request(suite.statusModule.statusGETHandler, http.MethodGet, "9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b", suite.author)
+	assert.Equal(suite.T(), http.StatusNotFound, recorder.Code)
+}
+
+func (suite *StatusGetTestSuite) TestGetContext() {
+	recorder := suite.request(suite.statusModule.statusContextGETHandler, http.MethodGet, suite.reply.ID, suite.follower)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	context := &mastotypes.Context{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), context); err != nil {
+		suite.FailNow(err.Error())
+	}
+	if assert.Len(suite.T(), context.Ancestors, 1) {
+		assert.Equal(suite.T(), suite.publicStatus.ID, context.Ancestors[0].ID)
+	}
+	assert.Empty(suite.T(), context.Descendants)
+
+	// the follower can see both replies, oldest first
+	recorder = suite.request(suite.statusModule.statusContextGETHandler, http.MethodGet, suite.publicStatus.ID, suite.follower)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	context = &mastotypes.Context{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), context); err != nil {
+		suite.FailNow(err.Error())
+	}
+	assert.Empty(suite.T(), context.Ancestors)
+	if assert.Len(suite.T(), context.Descendants, 2) {
+		assert.Equal(suite.T(), suite.reply.ID, context.Descendants[0].ID)
+		assert.Equal(suite.T(), suite.privateReply.ID, context.Descendants[1].ID)
+	}
+
+	// the stranger only gets to see the unlisted reply
+	recorder = suite.request(suite.statusModule.statusContextGETHandler, http.MethodGet, suite.publicStatus.ID, suite.stranger)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	context = &mastotypes.Context{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), context); err != nil {
+		suite.FailNow(err.Error())
+	}
+	if assert.Len(suite.T(), context.Descendants, 1) {
+		assert.Equal(suite.T(), suite.reply.ID, context.Descendants[0].ID)
+	}
+}
+
+func (suite *StatusGetTestSuite) TestDeleteOwnStatus() {
+	recorder := suite.request(suite.statusModule.statusDELETEHandler, http.MethodDelete, suite.publicStatus.ID, suite.author)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+
+	deleted := &mastotypes.Status{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), deleted); err != nil {
+		suite.FailNow(err.Error())
+	}
+	assert.Equal(suite.T(), "public", deleted.Text)
+
+	suite.mockDB.AssertCalled(suite.T(), "DeleteByID", suite.publicStatus.ID, &model.Status{})
+	suite.mockDistributor.AssertCalled(suite.T(), "Send", mock.Anything, distributor.StatusDeleted{Status: suite.publicStatus})
+}
+
+func (suite *StatusGetTestSuite) TestDeleteSomeoneElsesStatus() {
+	recorder := suite.request(suite.statusModule.statusDELETEHandler, http.MethodDelete, suite.publicStatus.ID, suite.follower)
+	assert.Equal(suite.T(), http.StatusForbidden, recorder.Code)
+
+	recorder = suite.request(suite.statusModule.statusDELETEHandler, http.MethodDelete, suite.privateStatus.ID, suite.stranger)
+	assert.Equal(suite.T(), http.StatusNotFound, recorder.Code)
+
+	suite.mockDB.AssertNotCalled(suite.T(), "DeleteByID", mock.Anything, mock.Anything)
+	suite.mockDistributor.AssertNotCalled(suite.T(), "Send", mock.Anything, mock.Anything)
+}
+
+func TestStatusGetTestSuite(t *testing.T) {
+	suite.Run(t, new(StatusGetTestSuite))
+}
@@ -0,0 +1,92 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package status
+
+import (
+	"fmt"
+
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+// getVisibleStatus gets the status with the given id, as long as it can be seen by the requesting account, which is nil if
+// nobody is logged in. If the status doesn't exist, or if it can't be seen, db.ErrNoEntries is returned, so that statuses
+// that can't be seen are indistinguishable from those that don't exist.
+func (m *statusModule) getVisibleStatus(id string, requestingAccount *model.Account) (*model.Status, error) {
+	status := &model.Status{}
+	if err := m.db.GetByID(id, status); err != nil {
+		return nil, err
+	}
+	visible, err := m.statusVisible(status, requestingAccount)
+	if err != nil {
+		return nil, err
+	}
+	if !visible {
+		return nil, db.ErrNoEntries{}
+	}
+	return status, nil
+}
+
+// statusVisible returns true if the given status can be seen by the requesting account, which is nil if nobody is logged in.
+// Public and unlisted statuses can be seen by anyone, followers-only statuses by the followers of their author, and direct
+// statuses only by the accounts they mention. Authors can always see their own statuses, and mentioned accounts can always
+// see the statuses that mention them. Local-only statuses can't be seen by anyone who isn't logged in.
+func (m *statusModule) statusVisible(status *model.Status, requestingAccount *model.Account) (bool, error) {
+	v := status.Visibility
+	if v != nil && v.LocalOnly && status.Local && requestingAccount == nil {
+		return false, nil
+	}
+	if v != nil && !v.Direct && (v.Public || v.Unlisted) {
+		return true, nil
+	}
+	if requestingAccount == nil {
+		return false, nil
+	}
+	if requestingAccount.ID == status.AccountID {
+		return true, nil
+	}
+
+	mentions := []model.Mention{}
+	if err := m.db.GetWhere("status_id", status.ID, &mentions); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return false, fmt.Errorf("error getting mentions of status %s: %s", status.ID, err)
+		}
+	}
+	for _, mention := range mentions {
+		if mention.TargetAccountID == requestingAccount.ID {
+			return true, nil
+		}
+	}
+	if v != nil && v.Direct {
+		return false, nil
+	}
+
+	following := []model.Follow{}
+	if err := m.db.GetFollowingByAccountID(requestingAccount.ID, &following); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return false, fmt.Errorf("error getting follows of account %s: %s", requestingAccount.ID, err)
+		}
+	}
+	for _, follow := range following {
+		if follow.TargetAccountID == status.AccountID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,74 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package timeline
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/oauth"
+	"github.com/superseriousbusiness/gotosocial/pkg/mastotypes"
+)
+
+// homeTimelineGETHandler serves the home timeline of the requesting account: statuses posted by the accounts it follows
+// and by itself. It should be served as a GET at /api/v1/timelines/home
+//
+// Pages of the timeline are linked to with a Link header, like mastodon does, so clients can scroll through it.
+//
+// See: https://docs.joinmastodon.org/methods/timelines/
+func (m *timelineModule) homeTimelineGETHandler(c *gin.Context) {
+	l := m.log.WithField("func", "homeTimelineGETHandler")
+	authed, err := oauth.MustAuth(c, true, true, true, true)
+	if err != nil {
+		l.Debugf("couldn't auth: %s", err)
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	p, err := parsePageParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	statuses, err := m.timeline.HomeTimeline(authed.Account, p.maxID, p.sinceID, p.minID, p.limit)
+	if err != nil {
+		if _, ok := err.(db.ErrNoEntries); ok {
+			// one of the statuses being paged by is gone, so there's nothing to page from
+			c.JSON(http.StatusOK, []mastotypes.Status{})
+			return
+		}
+		l.Errorf("error getting home timeline of account %s: %s", authed.Account.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	mastoStatuses, err := m.statusesToMasto(statuses, authed.Account)
+	if err != nil {
+		l.Errorf("error converting home timeline of account %s: %s", authed.Account.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error converting status"})
+		return
+	}
+
+	if link := m.pageLinks(homePath, statuses, keptQuery(c, limitKey)); link != "" {
+		c.Header("Link", link)
+	}
+	c.JSON(http.StatusOK, mastoStatuses)
+}
@@ -0,0 +1,178 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package timeline
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/oauth"
+	"github.com/superseriousbusiness/gotosocial/internal/timeline"
+	"github.com/superseriousbusiness/gotosocial/pkg/mastotypes"
+	oauthmodels "github.com/superseriousbusiness/oauth2/v4/models"
+)
+
+type HomeTimelineTestSuite struct {
+	suite.Suite
+	config          *config.Config
+	log             *logrus.Logger
+	testAccount     *model.Account
+	testUser        *model.User
+	testApplication *model.Application
+	testToken       *oauthmodels.Token
+	testStatuses    []*model.Status
+	mockDB          *db.MockDB
+	mockManager     *timeline.MockManager
+	timelineModule  *timelineModule
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *HomeTimelineTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	c := config.Empty()
+	c.Protocol = "https"
+	c.Host = "example.org"
+	suite.config = c
+
+	suite.testAccount = &model.Account{
+		ID:       "c2e1bb4d-8d29-4ab6-bde4-1e5c4e2f2a4b",
+		Username: "test_user",
+	}
+	suite.testUser = &model.User{
+		ID:        "8d5e1a2b-7c6f-4e3d-9a8b-1c2d3e4f5a6b",
+		AccountID: suite.testAccount.ID,
+	}
+	suite.testApplication = &model.Application{
+		ID:   "f9e8d7c6-b5a4-4938-8271-6a5b4c3d2e1f",
+		Name: "test app",
+	}
+	suite.testToken = &oauthmodels.Token{
+		ClientID: "a-known-client-id",
+		UserID:   suite.testUser.ID,
+		Access:   "some-access-token",
+	}
+	suite.testStatuses = []*model.Status{
+		{ID: "5f4e3d2c-1b0a-4f9e-8d7c-6b5a4f3e2d1c"},
+		{ID: "1a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d"},
+	}
+}
+
+// SetupTest creates a fresh mock db, mock timeline manager and timeline module for each test
+func (suite *HomeTimelineTestSuite) SetupTest() {
+	suite.mockDB = &db.MockDB{}
+	suite.mockDB.On("StatusToMasto", mock.AnythingOfType("*model.Status"), suite.testAccount).Return(func(s *model.Status, requestingAccount *model.Account) *mastotypes.Status {
+		return &mastotypes.Status{ID: s.ID}
+	}, nil)
+
+	suite.mockManager = &timeline.MockManager{}
+
+	suite.timelineModule = New(suite.config, suite.mockDB, suite.mockManager, suite.log).(*timelineModule)
+}
+
+// get performs an authorized GET of the home timeline with the given query, and returns the recorded response
+func (suite *HomeTimelineTestSuite) get(query string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Set(oauth.SessionAuthorizedToken, suite.testToken)
+	ctx.Set(oauth.SessionAuthorizedApplication, suite.testApplication)
+	ctx.Set(oauth.SessionAuthorizedUser, suite.testUser)
+	ctx.Set(oauth.SessionAuthorizedAccount, suite.testAccount)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "https://example.org"+homePath+query, nil)
+	suite.timelineModule.homeTimelineGETHandler(ctx)
+	return recorder
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *HomeTimelineTestSuite) TestGetHomeTimeline() {
+	suite.mockManager.On("HomeTimeline", suite.testAccount, "", "", "", defaultLimit).Return(suite.testStatuses, nil)
+
+	recorder := suite.get("")
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+
+	statuses := []mastotypes.Status{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &statuses); err != nil {
+		suite.FailNow(err.Error())
+	}
+	if assert.Len(suite.T(), statuses, 2) {
+		assert.Equal(suite.T(), suite.testStatuses[0].ID, statuses[0].ID)
+		assert.Equal(suite.T(), suite.testStatuses[1].ID, statuses[1].ID)
+	}
+	assert.Equal(suite.T(), `<https://example.org/api/v1/timelines/home?max_id=1a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d>; rel="next", `+
+		`<https://example.org/api/v1/timelines/home?min_id=5f4e3d2c-1b0a-4f9e-8d7c-6b5a4f3e2d1c>; rel="prev"`, recorder.Header().Get("Link"))
+}
+
+func (suite *HomeTimelineTestSuite) TestGetHomeTimelinePaged() {
+	maxID := "0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+	sinceID := "9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b"
+	suite.mockManager.On("HomeTimeline", suite.testAccount, maxID, sinceID, "", maxLimit).Return(suite.testStatuses[1:], nil)
+
+	recorder := suite.get("?max_id=" + maxID + "&since_id=" + sinceID + "&limit=100")
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.Equal(suite.T(), `<https://example.org/api/v1/timelines/home?limit=100&max_id=1a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d>; rel="next", `+
+		`<https://example.org/api/v1/timelines/home?limit=100&min_id=1a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d>; rel="prev"`, recorder.Header().Get("Link"))
+}
+
+func (suite *HomeTimelineTestSuite) TestGetEmptyHomeTimeline() {
+	suite.mockManager.On("HomeTimeline", suite.testAccount, "", "", "", defaultLimit).Return([]*model.Status{}, nil)
+
+	recorder := suite.get("")
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.Equal(suite.T(), "[]", recorder.Body.String())
+	assert.Empty(suite.T(), recorder.Header().Get("Link"))
+}
+
+func (suite *HomeTimelineTestSuite) TestGetHomeTimelineFromUnknownStatus() {
+	minID := "0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d"
+	suite.mockManager.On("HomeTimeline", suite.testAccount, "", "", minID, defaultLimit).Return(nil, db.ErrNoEntries{})
+
+	recorder := suite.get("?min_id=" + minID)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.Equal(suite.T(), "[]", recorder.Body.String())
+}
+
+func (suite *HomeTimelineTestSuite) TestGetHomeTimelineBadParams() {
+	assert.Equal(suite.T(), http.StatusBadRequest, suite.get("?max_id=not-an-id").Code)
+	assert.Equal(suite.T(), http.StatusBadRequest, suite.get("?limit=0").Code)
+	assert.Equal(suite.T(), http.StatusBadRequest, suite.get("?limit=lots").Code)
+	suite.mockManager.AssertNotCalled(suite.T(), "HomeTimeline", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHomeTimelineTestSuite(t *testing.T) {
+	suite.Run(t, new(HomeTimelineTestSuite))
+}
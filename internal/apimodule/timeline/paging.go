@@ -0,0 +1,123 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package timeline
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/pkg/mastotypes"
+)
+
+// pageParams are the query parameters that page through a timeline, the way the mastodon api does.
+type pageParams struct {
+	maxID   string
+	sinceID string
+	minID   string
+	limit   int
+}
+
+// parsePageParams gets the paging parameters out of the query of the given request. The error returned if any of them
+// are invalid can be shown to the client.
+func parsePageParams(c *gin.Context) (*pageParams, error) {
+	p := &pageParams{
+		maxID:   c.Query(maxIDKey),
+		sinceID: c.Query(sinceIDKey),
+		minID:   c.Query(minIDKey),
+		limit:   defaultLimit,
+	}
+	for _, id := range []string{p.maxID, p.sinceID, p.minID} {
+		if id == "" {
+			continue
+		}
+		if _, err := uuid.Parse(id); err != nil {
+			return nil, errors.New("invalid status id")
+		}
+	}
+
+	if c.Query(limitKey) != "" {
+		limit, err := strconv.Atoi(c.Query(limitKey))
+		if err != nil || limit < 1 {
+			return nil, errors.New("invalid limit")
+		}
+		if limit > maxLimit {
+			limit = maxLimit
+		}
+		p.limit = limit
+	}
+	return p, nil
+}
+
+// statusesToMasto converts the given statuses into their mastodon api representation, as seen by the requesting account,
+// which is nil if nobody is logged in.
+func (m *timelineModule) statusesToMasto(statuses []*model.Status, requestingAccount *model.Account) ([]*mastotypes.Status, error) {
+	mastoStatuses := []*mastotypes.Status{}
+	for _, s := range statuses {
+		mastoStatus, err := m.db.StatusToMasto(s, requestingAccount)
+		if err != nil {
+			return nil, fmt.Errorf("error converting status %s: %s", s.ID, err)
+		}
+		mastoStatuses = append(mastoStatuses, mastoStatus)
+	}
+	return mastoStatuses, nil
+}
+
+// keptQuery returns the query parameters of the given request with the given keys, so that they can be kept in the links
+// to other pages of a timeline.
+func keptQuery(c *gin.Context, keys ...string) url.Values {
+	kept := url.Values{}
+	for _, key := range keys {
+		if value := c.Query(key); value != "" {
+			kept.Set(key, value)
+		}
+	}
+	return kept
+}
+
+// pageLinks returns a Link header pointing to the pages of the timeline at the given path that come after and before the
+// given page of statuses, which is newest first, or an empty string if the page is empty. The given query parameters, such
+// as the limit that the client asked for, are kept in the links.
+func (m *timelineModule) pageLinks(path string, statuses []*model.Status, kept url.Values) string {
+	if len(statuses) == 0 {
+		return ""
+	}
+	next := m.pageURL(path, maxIDKey, statuses[len(statuses)-1].ID, kept)
+	prev := m.pageURL(path, minIDKey, statuses[0].ID, kept)
+	return fmt.Sprintf(`<%s>; rel="next", <%s>; rel="prev"`, next, prev)
+}
+
+// pageURL returns the url of the page at the given path that's paged with the given key and status id.
+func (m *timelineModule) pageURL(path string, key string, id string, kept url.Values) string {
+	query := url.Values{key: []string{id}}
+	for k, v := range kept {
+		query[k] = v
+	}
+	u := &url.URL{
+		Scheme:   m.config.Protocol,
+		Host:     m.config.Host,
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
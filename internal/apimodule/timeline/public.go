@@ -0,0 +1,95 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package timeline
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/oauth"
+	"github.com/superseriousbusiness/gotosocial/pkg/mastotypes"
+)
+
+// publicTimelineGETHandler serves the public timeline: public statuses known to this instance. It should be served as a
+// GET at /api/v1/timelines/public, and can be viewed without logging in, though local-only statuses are then left out.
+//
+// local=true only shows statuses posted on this instance, and only_media=true only statuses with media attached. Pages of
+// the timeline are linked to with a Link header, like for the home timeline.
+//
+// See: https://docs.joinmastodon.org/methods/timelines/
+func (m *timelineModule) publicTimelineGETHandler(c *gin.Context) {
+	l := m.log.WithField("func", "publicTimelineGETHandler")
+
+	// the public timeline can be viewed without logging in, but blocks and mutes apply if you are
+	var requestingAccount *model.Account
+	if authed, err := oauth.MustAuth(c, true, false, true, true); err == nil {
+		requestingAccount = authed.Account
+	}
+
+	p, err := parsePageParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	local, err := parseBoolQuery(c, localKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid local"})
+		return
+	}
+	onlyMedia, err := parseBoolQuery(c, onlyMediaKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid only_media"})
+		return
+	}
+
+	statuses, err := m.timeline.PublicTimeline(requestingAccount, local, onlyMedia, p.maxID, p.sinceID, p.minID, p.limit)
+	if err != nil {
+		if _, ok := err.(db.ErrNoEntries); ok {
+			// one of the statuses being paged by is gone, so there's nothing to page from
+			c.JSON(http.StatusOK, []mastotypes.Status{})
+			return
+		}
+		l.Errorf("error getting public timeline: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	mastoStatuses, err := m.statusesToMasto(statuses, requestingAccount)
+	if err != nil {
+		l.Errorf("error converting public timeline: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error converting status"})
+		return
+	}
+
+	if link := m.pageLinks(publicPath, statuses, keptQuery(c, limitKey, localKey, onlyMediaKey)); link != "" {
+		c.Header("Link", link)
+	}
+	c.JSON(http.StatusOK, mastoStatuses)
+}
+
+// parseBoolQuery parses the query parameter of the given request with the given key as a bool, which is false if it isn't set.
+func parseBoolQuery(c *gin.Context, key string) (bool, error) {
+	if c.Query(key) == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(c.Query(key))
+}
@@ -0,0 +1,94 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package timeline provides the /api/v1/timelines endpoints, for viewing timelines of statuses.
+package timeline
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"github.com/superseriousbusiness/gotosocial/internal/apimodule"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/router"
+	"github.com/superseriousbusiness/gotosocial/internal/timeline"
+)
+
+const (
+	basePath   = "/api/v1/timelines"
+	homePath   = basePath + "/home"
+	publicPath = basePath + "/public"
+
+	maxIDKey     = "max_id"
+	sinceIDKey   = "since_id"
+	minIDKey     = "min_id"
+	limitKey     = "limit"
+	localKey     = "local"
+	onlyMediaKey = "only_media"
+
+	// defaultLimit is how many statuses are returned if the client doesn't say
+	defaultLimit = 20
+	// maxLimit is the most statuses that can be returned at once
+	maxLimit = 40
+)
+
+type timelineModule struct {
+	config   *config.Config
+	db       db.DB
+	timeline timeline.Manager
+	log      *logrus.Logger
+}
+
+// New returns a new timeline module
+func New(config *config.Config, db db.DB, timelineManager timeline.Manager, log *logrus.Logger) apimodule.ClientAPIModule {
+	return &timelineModule{
+		config:   config,
+		db:       db,
+		timeline: timelineManager,
+		log:      log,
+	}
+}
+
+// Route attaches all routes from this module to the given router
+func (m *timelineModule) Route(r router.Router) error {
+	r.AttachHandler(http.MethodGet, homePath, m.homeTimelineGETHandler)
+	r.AttachHandler(http.MethodGet, publicPath, m.publicTimelineGETHandler)
+	return nil
+}
+
+func (m *timelineModule) CreateTables(db db.DB) error {
+	models := []interface{}{
+		&model.Account{},
+		&model.Follow{},
+		&model.Block{},
+		&model.Mute{},
+		&model.Status{},
+		&model.Mention{},
+		&model.MediaAttachment{},
+	}
+
+	for _, m := range models {
+		if err := db.CreateTable(m); err != nil {
+			return fmt.Errorf("error creating table: %s", err)
+		}
+	}
+	return nil
+}
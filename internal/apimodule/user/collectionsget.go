@@ -0,0 +1,201 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package user
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/typeutils"
+)
+
+// collectionPageSize is the most accounts that a page of a followers or following collection will contain.
+const collectionPageSize = 20
+
+// followersGETHandler serves the followers collection of a local account. It should be served as a GET at /users/:username/followers
+//
+// If the account hides its collections, only the number of followers is shown, unless the request is signed by one of them.
+func (m *userModule) followersGETHandler(c *gin.Context) {
+	m.collectionGET(c, false)
+}
+
+// followingGETHandler serves the collection of accounts that a local account follows. It should be served as a GET at /users/:username/following
+//
+// If the account hides its collections, only the number of followed accounts is shown, unless the request is signed by one of its followers.
+func (m *userModule) followingGETHandler(c *gin.Context) {
+	m.collectionGET(c, true)
+}
+
+// collectionGET serves either the followers or the following collection of the requested account. Without a page query parameter,
+// an OrderedCollection pointing to the first page is served; otherwise the page with that number (starting at 1) is served.
+func (m *userModule) collectionGET(c *gin.Context, following bool) {
+	l := m.log.WithField("func", "collectionGET")
+
+	if !wantsActivityStreams(c.GetHeader("Accept")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "not an activitypub request"})
+		return
+	}
+
+	requestedUsername := c.Param(usernameKey)
+	if requestedUsername == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no username specified"})
+		return
+	}
+
+	acct := &model.Account{}
+	if err := m.db.GetLocalAccountByUsername(requestedUsername, acct); err != nil {
+		if _, ok := err.(db.ErrNoEntries); ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+			return
+		}
+		l.Errorf("error getting account %s: %s", requestedUsername, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	requester, err := m.federator.AuthenticateGet(c.Request.Context(), c.Request)
+	if err != nil {
+		l.Debugf("could not authenticate request: %s", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authorized"})
+		return
+	}
+
+	// we always need the followers, to see whether the requester is one of them
+	followers := []model.Follow{}
+	if err := m.db.GetFollowersByAccountID(acct.ID, &followers); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			l.Errorf("error getting followers of account %s: %s", acct.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+	}
+	follows := followers
+	collectionURL := acct.FollowersURL
+	if following {
+		follows = []model.Follow{}
+		if err := m.db.GetFollowingByAccountID(acct.ID, &follows); err != nil {
+			if _, ok := err.(db.ErrNoEntries); !ok {
+				l.Errorf("error getting accounts followed by account %s: %s", acct.ID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+				return
+			}
+		}
+		collectionURL = acct.FollowingURL
+	}
+
+	visible := !acct.HideCollections
+	if requester != nil {
+		for _, f := range followers {
+			if f.AccountID == requester.ID {
+				visible = true
+				break
+			}
+		}
+	}
+
+	collection, err := url.Parse(collectionURL)
+	if err != nil {
+		l.Errorf("error parsing collection url %s: %s", collectionURL, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error converting collection"})
+		return
+	}
+
+	var t vocab.Type
+	if c.Query(pageKey) == "" {
+		var first *url.URL
+		if visible {
+			first = collectionPageIRI(collection, 1)
+		}
+		t = typeutils.AccountsCollectionToAS(collection, first, len(follows))
+	} else {
+		page, err := strconv.Atoi(c.Query(pageKey))
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page"})
+			return
+		}
+		if !visible {
+			c.JSON(http.StatusForbidden, gin.H{"error": "collection is hidden"})
+			return
+		}
+
+		start := (page - 1) * collectionPageSize
+		if start > len(follows) {
+			start = len(follows)
+		}
+		end := start + collectionPageSize
+		if end > len(follows) {
+			end = len(follows)
+		}
+
+		accountURIs := []*url.URL{}
+		for _, f := range follows[start:end] {
+			id := f.AccountID
+			if following {
+				id = f.TargetAccountID
+			}
+			a := &model.Account{}
+			if err := m.db.GetByID(id, a); err != nil {
+				if _, ok := err.(db.ErrNoEntries); ok {
+					continue
+				}
+				l.Errorf("error getting account %s: %s", id, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+				return
+			}
+			uri, err := url.Parse(a.URI)
+			if err != nil {
+				l.Errorf("error parsing uri of account %s: %s", id, err)
+				continue
+			}
+			accountURIs = append(accountURIs, uri)
+		}
+
+		var next, prev *url.URL
+		if end < len(follows) {
+			next = collectionPageIRI(collection, page+1)
+		}
+		if page > 1 {
+			prev = collectionPageIRI(collection, page-1)
+		}
+		t = typeutils.AccountsCollectionPageToAS(collectionPageIRI(collection, page), collection, next, prev, len(follows), accountURIs)
+	}
+
+	data, err := streams.Serialize(t)
+	if err != nil {
+		l.Errorf("error serializing collection %s: %s", collectionURL, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error serializing collection"})
+		return
+	}
+
+	c.Header("Content-Type", activityStreamsContentType)
+	c.JSON(http.StatusOK, data)
+}
+
+// collectionPageIRI returns the iri of the page with the given number of the given collection.
+func collectionPageIRI(collection *url.URL, page int) *url.URL {
+	p := *collection
+	p.RawQuery = url.Values{pageKey: []string{strconv.Itoa(page)}}.Encode()
+	return &p
+}
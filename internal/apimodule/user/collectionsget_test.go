@@ -0,0 +1,234 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/federation"
+	"github.com/superseriousbusiness/gotosocial/internal/util"
+)
+
+type CollectionsGetTestSuite struct {
+	suite.Suite
+	config           *config.Config
+	log              *logrus.Logger
+	testAccountLocal *model.Account
+	follower         *model.Account
+	stranger         *model.Account
+	mockDB           *db.MockDB
+	mockFederator    *federation.MockFederator
+	userModule       *userModule
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *CollectionsGetTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	c := config.Empty()
+	c.Protocol = "https"
+	c.Host = "example.org"
+	suite.config = c
+
+	uris := util.GenerateURIs("test_user", c.Protocol, c.Host)
+	suite.testAccountLocal = &model.Account{
+		ID:           "c2e1bb4d-8d29-4ab6-bde4-1e5c4e2f2a4b",
+		Username:     "test_user",
+		URI:          uris.UserURI,
+		FollowersURL: uris.FollowersURL,
+		FollowingURL: uris.FollowingURL,
+	}
+	suite.follower = &model.Account{
+		ID:     "follower-00",
+		URI:    "https://remote.example/users/follower_00",
+		Domain: "remote.example",
+	}
+	suite.stranger = &model.Account{
+		ID:     "stranger",
+		URI:    "https://remote.example/users/stranger",
+		Domain: "remote.example",
+	}
+}
+
+// SetupTest creates a fresh mock db, where the test account has 25 followers and follows 2 accounts, and a fresh user module
+func (suite *CollectionsGetTestSuite) SetupTest() {
+	suite.testAccountLocal.HideCollections = false
+
+	suite.mockDB = &db.MockDB{}
+	suite.mockDB.On("GetLocalAccountByUsername", "test_user", mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*model.Account) = *suite.testAccountLocal
+	})
+	suite.mockDB.On("GetLocalAccountByUsername", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetFollowersByAccountID", suite.testAccountLocal.ID, mock.AnythingOfType("*[]model.Follow")).Return(nil).Run(func(args mock.Arguments) {
+		followers := []model.Follow{}
+		for i := 0; i < 25; i++ {
+			followers = append(followers, model.Follow{AccountID: fmt.Sprintf("follower-%02d", i), TargetAccountID: suite.testAccountLocal.ID})
+		}
+		*args.Get(1).(*[]model.Follow) = followers
+	})
+	suite.mockDB.On("GetFollowingByAccountID", suite.testAccountLocal.ID, mock.AnythingOfType("*[]model.Follow")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*[]model.Follow) = []model.Follow{
+			{AccountID: suite.testAccountLocal.ID, TargetAccountID: "followed-00"},
+			{AccountID: suite.testAccountLocal.ID, TargetAccountID: "followed-01"},
+		}
+	})
+	suite.mockDB.On("GetByID", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		id := args.String(0)
+		*args.Get(1).(*model.Account) = model.Account{ID: id, URI: "https://remote.example/users/" + id}
+	})
+
+	suite.mockFederator = &federation.MockFederator{}
+	suite.userModule = New(suite.config, suite.mockDB, suite.mockFederator, suite.log).(*userModule)
+}
+
+// get performs a GET of the given collection of the test account, signed by the given requester if it's not nil,
+// and returns the recorded response along with its decoded body
+func (suite *CollectionsGetTestSuite) get(collection string, query string, requester *model.Account) (*httptest.ResponseRecorder, map[string]interface{}) {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "https://example.org/users/test_user/"+collection+query, nil)
+	ctx.Request.Header.Set("Accept", activityStreamsContentType)
+	ctx.Params = gin.Params{gin.Param{Key: usernameKey, Value: "test_user"}}
+	suite.mockFederator.On("AuthenticateGet", mock.Anything, ctx.Request).Return(requester, nil)
+
+	if collection == "followers" {
+		suite.userModule.followersGETHandler(ctx)
+	} else {
+		suite.userModule.followingGETHandler(ctx)
+	}
+
+	body := map[string]interface{}{}
+	if recorder.Code == http.StatusOK {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+			suite.FailNow(err.Error())
+		}
+	}
+	return recorder, body
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *CollectionsGetTestSuite) TestGetFollowers() {
+	recorder, collection := suite.get("followers", "", nil)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.Equal(suite.T(), activityStreamsContentType, recorder.Header().Get("Content-Type"))
+	assert.Equal(suite.T(), "OrderedCollection", collection["type"])
+	assert.Equal(suite.T(), "https://example.org/users/test_user/followers", collection["id"])
+	assert.EqualValues(suite.T(), 25, collection["totalItems"])
+	assert.Equal(suite.T(), "https://example.org/users/test_user/followers?page=1", collection["first"])
+}
+
+func (suite *CollectionsGetTestSuite) TestGetFollowersPages() {
+	recorder, page := suite.get("followers", "?page=1", nil)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.Equal(suite.T(), "OrderedCollectionPage", page["type"])
+	assert.Equal(suite.T(), "https://example.org/users/test_user/followers?page=1", page["id"])
+	assert.Equal(suite.T(), "https://example.org/users/test_user/followers", page["partOf"])
+	assert.Equal(suite.T(), "https://example.org/users/test_user/followers?page=2", page["next"])
+	assert.NotContains(suite.T(), page, "prev")
+	items := page["orderedItems"].([]interface{})
+	assert.Len(suite.T(), items, collectionPageSize)
+	assert.Equal(suite.T(), "https://remote.example/users/follower-00", items[0])
+
+	recorder, page = suite.get("followers", "?page=2", nil)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.NotContains(suite.T(), page, "next")
+	assert.Equal(suite.T(), "https://example.org/users/test_user/followers?page=1", page["prev"])
+	assert.Len(suite.T(), page["orderedItems"], 5)
+}
+
+func (suite *CollectionsGetTestSuite) TestGetFollowing() {
+	recorder, page := suite.get("following", "?page=1", nil)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.Equal(suite.T(), "https://example.org/users/test_user/following", page["partOf"])
+	assert.EqualValues(suite.T(), 2, page["totalItems"])
+	assert.Equal(suite.T(), []interface{}{"https://remote.example/users/followed-00", "https://remote.example/users/followed-01"}, page["orderedItems"])
+}
+
+func (suite *CollectionsGetTestSuite) TestGetHiddenCollections() {
+	suite.testAccountLocal.HideCollections = true
+
+	// just the count
+	recorder, collection := suite.get("followers", "", suite.stranger)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.EqualValues(suite.T(), 25, collection["totalItems"])
+	assert.NotContains(suite.T(), collection, "first")
+
+	recorder, collection = suite.get("following", "", nil)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.EqualValues(suite.T(), 2, collection["totalItems"])
+	assert.NotContains(suite.T(), collection, "first")
+
+	recorder, _ = suite.get("followers", "?page=1", suite.stranger)
+	assert.Equal(suite.T(), http.StatusForbidden, recorder.Code)
+}
+
+func (suite *CollectionsGetTestSuite) TestGetHiddenCollectionsAsFollower() {
+	suite.testAccountLocal.HideCollections = true
+
+	recorder, collection := suite.get("followers", "", suite.follower)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.Equal(suite.T(), "https://example.org/users/test_user/followers?page=1", collection["first"])
+
+	recorder, page := suite.get("following", "?page=1", suite.follower)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.Len(suite.T(), page["orderedItems"], 2)
+}
+
+func (suite *CollectionsGetTestSuite) TestGetBadSignature() {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "https://example.org/users/test_user/followers", nil)
+	ctx.Request.Header.Set("Accept", activityStreamsContentType)
+	ctx.Params = gin.Params{gin.Param{Key: usernameKey, Value: "test_user"}}
+	suite.mockFederator.On("AuthenticateGet", mock.Anything, ctx.Request).Return(nil, errors.New("signature could not be verified"))
+
+	suite.userModule.followersGETHandler(ctx)
+	assert.Equal(suite.T(), http.StatusUnauthorized, recorder.Code)
+}
+
+func (suite *CollectionsGetTestSuite) TestGetInvalidPage() {
+	recorder, _ := suite.get("followers", "?page=zero", nil)
+	assert.Equal(suite.T(), http.StatusBadRequest, recorder.Code)
+}
+
+func TestCollectionsGetTestSuite(t *testing.T) {
+	suite.Run(t, new(CollectionsGetTestSuite))
+}
@@ -0,0 +1,48 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package user
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// inboxPOSTHandler handles activities delivered by remote servers to the inbox of a local account.
+// It should be served as a POST at /users/:username/inbox
+//
+// The heavy lifting (authentication, deduplication, side effects) is done by the go-fed federating actor,
+// which also writes the response in most cases.
+func (m *userModule) inboxPOSTHandler(c *gin.Context) {
+	l := m.log.WithField("func", "inboxPOSTHandler")
+
+	handled, err := m.federator.FederatingActor().PostInbox(c.Request.Context(), c.Writer, c.Request)
+	if err != nil {
+		l.Errorf("error handling post to inbox %s: %s", c.Request.URL.Path, err)
+		if !c.Writer.Written() {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error processing activity"})
+		}
+		return
+	}
+
+	if !handled {
+		// go-fed didn't recognise this as an activitypub request
+		c.JSON(http.StatusBadRequest, gin.H{"error": "not an activitypub request"})
+	}
+}
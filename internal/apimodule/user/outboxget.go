@@ -0,0 +1,108 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package user
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-fed/activity/streams"
+	"github.com/google/uuid"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/typeutils"
+)
+
+// outboxGETHandler serves the outbox of a local account to remote servers. It should be served as a GET at /users/:username/outbox
+//
+// Without any query parameters, the outbox is served as an OrderedCollection that points to its first page. Pages, picked with the
+// page, max_id and min_id query parameters, are served by the go-fed federating actor.
+func (m *userModule) outboxGETHandler(c *gin.Context) {
+	l := m.log.WithField("func", "outboxGETHandler")
+
+	if !wantsActivityStreams(c.GetHeader("Accept")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "not an activitypub request"})
+		return
+	}
+
+	requestedUsername := c.Param(usernameKey)
+	if requestedUsername == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no username specified"})
+		return
+	}
+
+	acct := &model.Account{}
+	if err := m.db.GetLocalAccountByUsername(requestedUsername, acct); err != nil {
+		if _, ok := err.(db.ErrNoEntries); ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+			return
+		}
+		l.Errorf("error getting account %s: %s", requestedUsername, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	maxID := c.Query(maxIDKey)
+	minID := c.Query(minIDKey)
+	for _, id := range []string{maxID, minID} {
+		if id == "" {
+			continue
+		}
+		if _, err := uuid.Parse(id); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status id"})
+			return
+		}
+	}
+
+	if c.Query(pageKey) == "" && maxID == "" && minID == "" {
+		outbox, err := url.Parse(acct.OutboxURL)
+		if err != nil {
+			l.Errorf("error parsing outbox url of account %s: %s", acct.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error converting outbox"})
+			return
+		}
+		first := *outbox
+		first.RawQuery = url.Values{pageKey: []string{"true"}}.Encode()
+
+		data, err := streams.Serialize(typeutils.OrderedCollectionToAS(outbox, &first))
+		if err != nil {
+			l.Errorf("error serializing outbox of account %s: %s", acct.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error serializing outbox"})
+			return
+		}
+		c.Header("Content-Type", activityStreamsContentType)
+		c.JSON(http.StatusOK, data)
+		return
+	}
+
+	handled, err := m.federator.FederatingActor().GetOutbox(c.Request.Context(), c.Writer, c.Request)
+	if err != nil {
+		l.Errorf("error serving outbox %s: %s", c.Request.URL.Path, err)
+		if !c.Writer.Written() {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error serving outbox"})
+		}
+		return
+	}
+
+	if !handled {
+		// go-fed didn't recognise this as an activitypub request
+		c.JSON(http.StatusBadRequest, gin.H{"error": "not an activitypub request"})
+	}
+}
@@ -0,0 +1,47 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package user
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sharedInboxPOSTHandler handles activities delivered by remote servers to the shared inbox of this instance,
+// which they use to deliver one activity to several local accounts at once. It should be served as a POST at /inbox
+//
+// The federator passes the activity on to the inbox of each local account that it's for.
+func (m *userModule) sharedInboxPOSTHandler(c *gin.Context) {
+	l := m.log.WithField("func", "sharedInboxPOSTHandler")
+
+	handled, err := m.federator.PostSharedInbox(c.Request.Context(), c.Writer, c.Request)
+	if err != nil {
+		l.Errorf("error handling post to shared inbox: %s", err)
+		if !c.Writer.Written() {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error processing activity"})
+		}
+		return
+	}
+
+	if !handled {
+		// not an activitypub request
+		c.JSON(http.StatusBadRequest, gin.H{"error": "not an activitypub request"})
+	}
+}
@@ -0,0 +1,109 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package user provides the ActivityPub-facing endpoints of local accounts, under /users/:username,
+// and the shared inbox of this instance at /inbox.
+package user
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"github.com/superseriousbusiness/gotosocial/internal/apimodule"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/federation"
+	"github.com/superseriousbusiness/gotosocial/internal/router"
+)
+
+const (
+	usernameKey               = "username"
+	usersBasePath             = "/users"
+	usersBasePathWithUsername = usersBasePath + "/:" + usernameKey
+	inboxPath                 = usersBasePathWithUsername + "/inbox"
+	outboxPath                = usersBasePathWithUsername + "/outbox"
+	followersPath             = usersBasePathWithUsername + "/followers"
+	followingPath             = usersBasePathWithUsername + "/following"
+	sharedInboxPath           = "/inbox"
+
+	pageKey  = "page"
+	maxIDKey = "max_id"
+	minIDKey = "min_id"
+
+	activityStreamsContentType = "application/activity+json"
+	ldJSONContentType          = "application/ld+json"
+	htmlContentType            = "text/html"
+)
+
+type userModule struct {
+	config    *config.Config
+	db        db.DB
+	federator federation.Federator
+	log       *logrus.Logger
+}
+
+// New returns a new user module
+func New(config *config.Config, db db.DB, federator federation.Federator, log *logrus.Logger) apimodule.ClientAPIModule {
+	return &userModule{
+		config:    config,
+		db:        db,
+		federator: federator,
+		log:       log,
+	}
+}
+
+// Route attaches all routes from this module to the given router
+func (m *userModule) Route(r router.Router) error {
+	r.AttachHandler(http.MethodGet, usersBasePathWithUsername, m.userGETHandler)
+	r.AttachHandler(http.MethodPost, inboxPath, m.inboxPOSTHandler)
+	r.AttachHandler(http.MethodGet, outboxPath, m.outboxGETHandler)
+	r.AttachHandler(http.MethodGet, followersPath, m.followersGETHandler)
+	r.AttachHandler(http.MethodGet, followingPath, m.followingGETHandler)
+	r.AttachHandler(http.MethodPost, sharedInboxPath, m.sharedInboxPOSTHandler)
+	return nil
+}
+
+func (m *userModule) CreateTables(db db.DB) error {
+	models := []interface{}{
+		&model.Account{},
+		&model.MediaAttachment{},
+		&model.Follow{},
+		&model.FollowRequest{},
+		&model.Status{},
+		&model.StatusFave{},
+		&model.Mention{},
+		&model.DomainBlock{},
+		&model.DomainAllow{},
+		&model.Block{},
+		&model.Mute{},
+		&model.Report{},
+		&model.ReputationOverride{},
+		&model.PendingActivity{},
+		&model.Delivery{},
+		&model.UnavailableDomain{},
+	}
+
+	for _, m := range models {
+		if err := db.CreateTable(m); err != nil {
+			return fmt.Errorf("error creating table: %s", err)
+		}
+	}
+	return nil
+}
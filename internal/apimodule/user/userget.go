@@ -0,0 +1,154 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package user
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-fed/activity/streams"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/typeutils"
+	"github.com/superseriousbusiness/gotosocial/internal/util"
+)
+
+// userGETHandler serves the ActivityPub representation of a local account, in response to a GET request
+// that asks for activitystreams. It should be served at /users/:username.
+//
+// Requests that want html instead (ie., browsers) are given a web view of the account's profile.
+func (m *userModule) userGETHandler(c *gin.Context) {
+	l := m.log.WithField("func", "userGETHandler")
+
+	requestedUsername := c.Param(usernameKey)
+	if requestedUsername == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no username specified"})
+		return
+	}
+
+	acct := &model.Account{}
+	if err := m.db.GetLocalAccountByUsername(requestedUsername, acct); err != nil {
+		if _, ok := err.(db.ErrNoEntries); ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+			return
+		}
+		l.Errorf("error getting account %s: %s", requestedUsername, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if !acct.DeletedAt.IsZero() {
+		c.JSON(http.StatusGone, gin.H{"error": "account has been deleted"})
+		return
+	}
+
+	// the same url serves both activitystreams and html, so make sure caches keep them apart
+	c.Header("Vary", "Accept")
+
+	avatar := &model.MediaAttachment{}
+	if err := m.db.GetAvatarForAccountID(avatar, acct.ID); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			l.Errorf("error getting avatar for account %s: %s", acct.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+		avatar = nil
+	}
+
+	if !wantsActivityStreams(c.GetHeader("Accept")) {
+		m.profileHTML(c, acct, avatar)
+		return
+	}
+
+	header := &model.MediaAttachment{}
+	if err := m.db.GetHeaderForAccountID(header, acct.ID); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			l.Errorf("error getting header for account %s: %s", acct.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+		header = nil
+	}
+
+	var movedToURI string
+	if acct.MovedToAccountID != "" {
+		movedTo := &model.Account{}
+		if err := m.db.GetByID(acct.MovedToAccountID, movedTo); err != nil {
+			l.Errorf("error getting account %s that account %s moved to: %s", acct.MovedToAccountID, acct.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return
+		}
+		movedToURI = movedTo.URI
+	}
+
+	uris := util.GenerateURIs(acct.Username, m.config.Protocol, m.config.Host)
+	person, err := typeutils.AccountToAS(acct, avatar, header, uris.SharedInboxURL, movedToURI)
+	if err != nil {
+		l.Errorf("error converting account %s to activitystreams: %s", acct.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error converting account"})
+		return
+	}
+
+	data, err := streams.Serialize(person)
+	if err != nil {
+		l.Errorf("error serializing account %s: %s", acct.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "error serializing account"})
+		return
+	}
+
+	c.Header("Content-Type", activityStreamsContentType)
+	c.JSON(http.StatusOK, data)
+}
+
+// profileHTML serves a web view of the given account's profile.
+func (m *userModule) profileHTML(c *gin.Context, acct *model.Account, avatar *model.MediaAttachment) {
+	displayName := acct.DisplayName
+	if displayName == "" {
+		displayName = acct.Username
+	}
+	var avatarURL string
+	if avatar != nil {
+		avatarURL = avatar.File.Path
+	}
+
+	c.HTML(http.StatusOK, "profile.tmpl", gin.H{
+		"username":    acct.Username,
+		"host":        m.config.Host,
+		"displayName": displayName,
+		"note":        acct.Note,
+		"avatar":      avatarURL,
+		"uri":         acct.URI,
+	})
+}
+
+// wantsActivityStreams checks the given accept header, and returns true if the activitystreams representation
+// of a resource should be served rather than html. Media types are considered in the order they're given, and
+// the first one that we know how to serve wins. If there's no match, html is assumed.
+func wantsActivityStreams(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.Split(part, ";")[0])
+		switch mediaType {
+		case activityStreamsContentType, ldJSONContentType:
+			return true
+		case htmlContentType:
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package user
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/federation"
+	"github.com/superseriousbusiness/gotosocial/internal/util"
+)
+
+type UserGetTestSuite struct {
+	suite.Suite
+	config           *config.Config
+	log              *logrus.Logger
+	testAccountLocal *model.Account
+	mockDB           *db.MockDB
+	userModule       *userModule
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *UserGetTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	c := config.Empty()
+	c.Protocol = "https"
+	c.Host = "example.org"
+	suite.config = c
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	uris := util.GenerateURIs("test_user", c.Protocol, c.Host)
+	suite.testAccountLocal = &model.Account{
+		ID:                    "c2e1bb4d-8d29-4ab6-bde4-1e5c4e2f2a4b",
+		Username:              "test_user",
+		DisplayName:           "Test User",
+		Note:                  "a test account",
+		Locked:                true,
+		URI:                   uris.UserURI,
+		URL:                   uris.UserURL,
+		InboxURL:              uris.InboxURL,
+		OutboxURL:             uris.OutboxURL,
+		FollowersURL:          uris.FollowersURL,
+		FollowingURL:          uris.FollowingURL,
+		FeaturedCollectionURL: uris.CollectionURL,
+		PrivateKey:            key,
+		PublicKey:             &key.PublicKey,
+		PublicKeyURI:          uris.PublicKeyURI,
+	}
+}
+
+// SetupTest creates a fresh mock db and user module for each test
+func (suite *UserGetTestSuite) SetupTest() {
+	suite.mockDB = &db.MockDB{}
+	suite.mockDB.On("GetLocalAccountByUsername", "test_user", mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*model.Account) = *suite.testAccountLocal
+	})
+	suite.mockDB.On("GetLocalAccountByUsername", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetAvatarForAccountID", mock.AnythingOfType("*model.MediaAttachment"), suite.testAccountLocal.ID).Return(nil).Run(func(args mock.Arguments) {
+		avatar := args.Get(0).(*model.MediaAttachment)
+		avatar.File.Path = "https://example.org/fileserver/avatar.png"
+		avatar.File.ContentType = "image/png"
+	})
+	suite.mockDB.On("GetHeaderForAccountID", mock.AnythingOfType("*model.MediaAttachment"), suite.testAccountLocal.ID).Return(db.ErrNoEntries{})
+
+	suite.userModule = New(suite.config, suite.mockDB, &federation.MockFederator{}, suite.log).(*userModule)
+}
+
+// get performs a GET for the given username with the given accept header, and returns the recorded response
+func (suite *UserGetTestSuite) get(username string, accept string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	ctx, engine := gin.CreateTestContext(recorder)
+	// because go tests are run within the test package directory, we need to load the templates from up the tree
+	engine.LoadHTMLGlob("../../../web/template/*")
+	ctx.Request = httptest.NewRequest(http.MethodGet, "https://example.org/users/"+username, nil)
+	if accept != "" {
+		ctx.Request.Header.Set("Accept", accept)
+	}
+	ctx.Params = gin.Params{gin.Param{Key: usernameKey, Value: username}}
+	suite.userModule.userGETHandler(ctx)
+	return recorder
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *UserGetTestSuite) TestGetActivityStreams() {
+	recorder := suite.get("test_user", `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.Equal(suite.T(), activityStreamsContentType, recorder.Header().Get("Content-Type"))
+
+	person := map[string]interface{}{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &person); err != nil {
+		suite.FailNow(err.Error())
+	}
+	assert.Equal(suite.T(), "Person", person["type"])
+	assert.Equal(suite.T(), "https://example.org/users/test_user", person["id"])
+	assert.Equal(suite.T(), "test_user", person["preferredUsername"])
+	assert.Equal(suite.T(), "Test User", person["name"])
+	assert.Equal(suite.T(), "https://example.org/users/test_user/inbox", person["inbox"])
+	assert.Equal(suite.T(), "https://example.org/users/test_user/following", person["following"])
+	assert.Equal(suite.T(), true, person["manuallyApprovesFollowers"])
+	assert.Equal(suite.T(), map[string]interface{}{"sharedInbox": "https://example.org/inbox"}, person["endpoints"])
+
+	publicKey, ok := person["publicKey"].(map[string]interface{})
+	if assert.True(suite.T(), ok) {
+		assert.Equal(suite.T(), "https://example.org/users/test_user#main-key", publicKey["id"])
+		assert.Equal(suite.T(), "https://example.org/users/test_user", publicKey["owner"])
+		assert.Contains(suite.T(), publicKey["publicKeyPem"], "BEGIN PUBLIC KEY")
+	}
+
+	icon, ok := person["icon"].(map[string]interface{})
+	if assert.True(suite.T(), ok) {
+		assert.Equal(suite.T(), "Image", icon["type"])
+		assert.Equal(suite.T(), "image/png", icon["mediaType"])
+		assert.Equal(suite.T(), "https://example.org/fileserver/avatar.png", icon["url"])
+	}
+	assert.NotContains(suite.T(), person, "image")
+}
+
+func (suite *UserGetTestSuite) TestGetBotIsService() {
+	suite.testAccountLocal.Bot = true
+	defer func() { suite.testAccountLocal.Bot = false }()
+
+	recorder := suite.get("test_user", activityStreamsContentType)
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+
+	person := map[string]interface{}{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &person); err != nil {
+		suite.FailNow(err.Error())
+	}
+	assert.Equal(suite.T(), "Service", person["type"])
+}
+
+func (suite *UserGetTestSuite) TestGetHTML() {
+	recorder := suite.get("test_user", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.Contains(suite.T(), recorder.Header().Get("Content-Type"), "text/html")
+	assert.Contains(suite.T(), recorder.Body.String(), "@test_user@example.org")
+	assert.Contains(suite.T(), recorder.Body.String(), `href="https://example.org/users/test_user"`)
+}
+
+func (suite *UserGetTestSuite) TestGetNoAcceptIsHTML() {
+	recorder := suite.get("test_user", "")
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.Contains(suite.T(), recorder.Header().Get("Content-Type"), "text/html")
+}
+
+func (suite *UserGetTestSuite) TestGetUnknownUser() {
+	recorder := suite.get("nobody", activityStreamsContentType)
+	assert.Equal(suite.T(), http.StatusNotFound, recorder.Code)
+}
+
+func TestUserGetTestSuite(t *testing.T) {
+	suite.Run(t, new(UserGetTestSuite))
+}
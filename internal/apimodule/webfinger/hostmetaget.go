@@ -0,0 +1,40 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package webfinger
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hostMetaGETHandler serves an XRD document pointing remote servers towards our webfinger endpoint.
+// It should be served as a GET at /.well-known/host-meta
+//
+// See: https://docs.joinmastodon.org/spec/webfinger/
+func (m *webfingerModule) hostMetaGETHandler(c *gin.Context) {
+	template := fmt.Sprintf("%s://%s%s?%s={uri}", m.config.Protocol, m.config.Host, webfingerPath, resourceKey)
+	xrd := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<XRD xmlns="http://docs.oasis-open.org/ns/xri/xrd-1.0">
+  <Link rel="lrdd" type="%s" template="%s"/>
+</XRD>
+`, xrdContentType, template)
+	c.Data(http.StatusOK, xrdContentType+"; charset=utf-8", []byte(xrd))
+}
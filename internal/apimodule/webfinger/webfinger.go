@@ -0,0 +1,77 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package webfinger provides the /.well-known/webfinger and /.well-known/host-meta endpoints,
+// which allow remote servers to discover accounts on this instance.
+package webfinger
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"github.com/superseriousbusiness/gotosocial/internal/apimodule"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/router"
+)
+
+const (
+	resourceKey   = "resource"
+	webfingerPath = "/.well-known/webfinger"
+	hostMetaPath  = "/.well-known/host-meta"
+
+	jrdContentType = "application/jrd+json"
+	xrdContentType = "application/xrd+xml"
+)
+
+type webfingerModule struct {
+	config *config.Config
+	db     db.DB
+	log    *logrus.Logger
+}
+
+// New returns a new webfinger module
+func New(config *config.Config, db db.DB, log *logrus.Logger) apimodule.ClientAPIModule {
+	return &webfingerModule{
+		config: config,
+		db:     db,
+		log:    log,
+	}
+}
+
+// Route attaches all routes from this module to the given router
+func (m *webfingerModule) Route(r router.Router) error {
+	r.AttachHandler(http.MethodGet, webfingerPath, m.webfingerGETHandler)
+	r.AttachHandler(http.MethodGet, hostMetaPath, m.hostMetaGETHandler)
+	return nil
+}
+
+func (m *webfingerModule) CreateTables(db db.DB) error {
+	models := []interface{}{
+		&model.Account{},
+	}
+
+	for _, m := range models {
+		if err := db.CreateTable(m); err != nil {
+			return fmt.Errorf("error creating table: %s", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package webfinger
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/util"
+	"github.com/superseriousbusiness/gotosocial/pkg/mastotypes"
+)
+
+// webfingerGETHandler serves a JRD describing the local account named in the 'resource' query parameter.
+// It should be served as a GET at /.well-known/webfinger?resource=acct:some_user@example.org
+//
+// See: https://docs.joinmastodon.org/spec/webfinger/
+func (m *webfingerModule) webfingerGETHandler(c *gin.Context) {
+	l := m.log.WithField("func", "webfingerGETHandler")
+
+	resource := c.Query(resourceKey)
+	if resource == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no resource specified"})
+		return
+	}
+
+	username, err := m.parseResource(resource)
+	if err != nil {
+		l.Debugf("couldn't parse resource %s: %s", resource, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	acct := &model.Account{}
+	if err := m.db.GetLocalAccountByUsername(username, acct); err != nil {
+		if _, ok := err.(db.ErrNoEntries); ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+			return
+		}
+		l.Errorf("error getting account %s: %s", username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if !acct.DeletedAt.IsZero() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found"})
+		return
+	}
+
+	uris := util.GenerateURIs(acct.Username, m.config.Protocol, m.config.Host)
+	c.Header("Content-Type", jrdContentType)
+	c.JSON(http.StatusOK, &mastotypes.WellKnownResponse{
+		Subject: fmt.Sprintf("acct:%s@%s", acct.Username, m.config.Host),
+		Aliases: []string{
+			uris.UserURI,
+			uris.UserURL,
+		},
+		Links: []mastotypes.Link{
+			{
+				Rel:  "http://webfinger.net/rel/profile-page",
+				Type: "text/html",
+				Href: uris.UserURL,
+			},
+			{
+				Rel:  "self",
+				Type: "application/activity+json",
+				Href: uris.UserURI,
+			},
+		},
+	})
+}
+
+// parseResource extracts a local username from the given webfinger resource. The resource can be
+// either an acct URI (acct:some_user@example.org) or the ActivityPub URI or profile URL of the account.
+// An error is returned if the resource doesn't point to an account on this instance.
+func (m *webfingerModule) parseResource(resource string) (string, error) {
+	if strings.HasPrefix(resource, "acct:") {
+		acct := strings.TrimPrefix(strings.TrimPrefix(resource, "acct:"), "@")
+		parts := strings.Split(acct, "@")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return "", fmt.Errorf("resource %s is not of the form acct:user@host", resource)
+		}
+		if !strings.EqualFold(parts[1], m.config.Host) {
+			return "", fmt.Errorf("host %s is not this instance", parts[1])
+		}
+		return parts[0], nil
+	}
+
+	u, err := url.Parse(resource)
+	if err != nil || !u.IsAbs() {
+		return "", fmt.Errorf("resource %s is neither an acct uri nor an absolute url", resource)
+	}
+	if !strings.EqualFold(u.Host, m.config.Host) {
+		return "", fmt.Errorf("host %s is not this instance", u.Host)
+	}
+	switch {
+	case strings.HasPrefix(u.Path, "/users/"):
+		if username := strings.TrimPrefix(u.Path, "/users/"); username != "" && !strings.Contains(username, "/") {
+			return username, nil
+		}
+	case strings.HasPrefix(u.Path, "/@"):
+		if username := strings.TrimPrefix(u.Path, "/@"); username != "" && !strings.Contains(username, "/") {
+			return username, nil
+		}
+	}
+	return "", fmt.Errorf("resource %s doesn't point to an account", resource)
+}
@@ -0,0 +1,154 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package webfinger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/pkg/mastotypes"
+)
+
+type WebfingerGetTestSuite struct {
+	suite.Suite
+	config          *config.Config
+	log             *logrus.Logger
+	mockDB          *db.MockDB
+	webfingerModule *webfingerModule
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *WebfingerGetTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	c := config.Empty()
+	c.Protocol = "https"
+	c.Host = "example.org"
+	suite.config = c
+}
+
+// SetupTest creates a fresh mock db and webfinger module for each test
+func (suite *WebfingerGetTestSuite) SetupTest() {
+	suite.mockDB = &db.MockDB{}
+	suite.mockDB.On("GetLocalAccountByUsername", "test_user", mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*model.Account).Username = "test_user"
+	})
+	suite.mockDB.On("GetLocalAccountByUsername", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+
+	suite.webfingerModule = New(suite.config, suite.mockDB, suite.log).(*webfingerModule)
+}
+
+// webfinger performs a webfinger request for the given resource, and returns the recorded response
+func (suite *WebfingerGetTestSuite) webfinger(resource string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodGet, fmt.Sprintf("https://example.org%s?%s=%s", webfingerPath, resourceKey, resource), nil)
+	suite.webfingerModule.webfingerGETHandler(ctx)
+	return recorder
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *WebfingerGetTestSuite) TestWebfingerAcct() {
+	recorder := suite.webfinger("acct:test_user@example.org")
+
+	result := recorder.Result()
+	defer result.Body.Close()
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.Equal(suite.T(), jrdContentType, result.Header.Get("Content-Type"))
+
+	b, err := io.ReadAll(result.Body)
+	assert.NoError(suite.T(), err)
+	wkr := &mastotypes.WellKnownResponse{}
+	if err := json.Unmarshal(b, wkr); err != nil {
+		suite.FailNow(err.Error())
+	}
+	assert.Equal(suite.T(), "acct:test_user@example.org", wkr.Subject)
+	assert.Contains(suite.T(), wkr.Aliases, "https://example.org/users/test_user")
+	assert.Contains(suite.T(), wkr.Links, mastotypes.Link{
+		Rel:  "self",
+		Type: "application/activity+json",
+		Href: "https://example.org/users/test_user",
+	})
+	assert.Contains(suite.T(), wkr.Links, mastotypes.Link{
+		Rel:  "http://webfinger.net/rel/profile-page",
+		Type: "text/html",
+		Href: "https://example.org/@test_user",
+	})
+}
+
+func (suite *WebfingerGetTestSuite) TestWebfingerAccountURI() {
+	recorder := suite.webfinger("https://example.org/users/test_user")
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	recorder = suite.webfinger("https://example.org/@test_user")
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+}
+
+func (suite *WebfingerGetTestSuite) TestWebfingerUnknownUser() {
+	recorder := suite.webfinger("acct:nobody@example.org")
+	assert.Equal(suite.T(), http.StatusNotFound, recorder.Code)
+}
+
+func (suite *WebfingerGetTestSuite) TestWebfingerOtherHost() {
+	recorder := suite.webfinger("acct:test_user@somewhere.else")
+	assert.Equal(suite.T(), http.StatusNotFound, recorder.Code)
+	suite.mockDB.AssertNotCalled(suite.T(), "GetLocalAccountByUsername", mock.Anything, mock.Anything)
+}
+
+func (suite *WebfingerGetTestSuite) TestWebfingerNoResource() {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "https://example.org"+webfingerPath, nil)
+	suite.webfingerModule.webfingerGETHandler(ctx)
+	assert.Equal(suite.T(), http.StatusBadRequest, recorder.Code)
+}
+
+func (suite *WebfingerGetTestSuite) TestHostMeta() {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "https://example.org"+hostMetaPath, nil)
+	suite.webfingerModule.hostMetaGETHandler(ctx)
+
+	assert.Equal(suite.T(), http.StatusOK, recorder.Code)
+	assert.Contains(suite.T(), recorder.Body.String(), `template="https://example.org/.well-known/webfinger?resource={uri}"`)
+}
+
+func TestWebfingerGetTestSuite(t *testing.T) {
+	suite.Run(t, new(WebfingerGetTestSuite))
+}
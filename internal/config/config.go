@@ -27,15 +27,18 @@ import (
 
 // Config pulls together all the configuration needed to run gotosocial
 type Config struct {
-	LogLevel        string          `yaml:"logLevel"`
-	ApplicationName string          `yaml:"applicationName"`
-	Host            string          `yaml:"host"`
-	Protocol        string          `yaml:"protocol"`
-	DBConfig        *DBConfig       `yaml:"db"`
-	TemplateConfig  *TemplateConfig `yaml:"template"`
-	AccountsConfig  *AccountsConfig `yaml:"accounts"`
-	MediaConfig     *MediaConfig    `yaml:"media"`
-	StorageConfig   *StorageConfig  `yaml:"storage"`
+	LogLevel          string             `yaml:"logLevel"`
+	ApplicationName   string             `yaml:"applicationName"`
+	Host              string             `yaml:"host"`
+	Protocol          string             `yaml:"protocol"`
+	DBConfig          *DBConfig          `yaml:"db"`
+	TemplateConfig    *TemplateConfig    `yaml:"template"`
+	AccountsConfig    *AccountsConfig    `yaml:"accounts"`
+	MediaConfig       *MediaConfig       `yaml:"media"`
+	StorageConfig     *StorageConfig     `yaml:"storage"`
+	FederationConfig  *FederationConfig  `yaml:"federation"`
+	DistributorConfig *DistributorConfig `yaml:"distributor"`
+	StatusesConfig    *StatusesConfig    `yaml:"statuses"`
 }
 
 // FromFile returns a new config from a file, or an error if something goes amiss.
@@ -53,11 +56,14 @@ func FromFile(path string) (*Config, error) {
 // Empty just returns an empty config
 func Empty() *Config {
 	return &Config{
-		DBConfig:       &DBConfig{},
-		TemplateConfig: &TemplateConfig{},
-		AccountsConfig: &AccountsConfig{},
-		MediaConfig:    &MediaConfig{},
-		StorageConfig:  &StorageConfig{},
+		DBConfig:          &DBConfig{},
+		TemplateConfig:    &TemplateConfig{},
+		AccountsConfig:    &AccountsConfig{},
+		MediaConfig:       &MediaConfig{},
+		StorageConfig:     &StorageConfig{},
+		FederationConfig:  &FederationConfig{},
+		DistributorConfig: &DistributorConfig{},
+		StatusesConfig:    &StatusesConfig{},
 	}
 }
 
@@ -68,7 +74,8 @@ func loadFromFile(path string) (*Config, error) {
 		return nil, fmt.Errorf("could not read file at path %s: %s", path, err)
 	}
 
-	config := &Config{}
+	// start from an empty config, so that sections left out of the file are still there to be filled in from flags
+	config := Empty()
 	if err := yaml.Unmarshal(bytes, config); err != nil {
 		return nil, fmt.Errorf("could not unmarshal file at path %s: %s", path, err)
 	}
@@ -173,6 +180,49 @@ func (c *Config) ParseCLIFlags(f KeyedFlags) {
 	if c.StorageConfig.ServeBasePath == "" || f.IsSet(fn.StorageServeBasePath) {
 		c.StorageConfig.ServeBasePath = f.String(fn.StorageServeBasePath)
 	}
+
+	// federation flags
+	if c.FederationConfig.Mode == "" || f.IsSet(fn.FederationMode) {
+		c.FederationConfig.Mode = f.String(fn.FederationMode)
+	}
+
+	if f.IsSet(fn.FederationSlow) {
+		c.FederationConfig.SlowFederation = f.Bool(fn.FederationSlow)
+	}
+
+	if f.IsSet(fn.FederationGreedy) {
+		c.FederationConfig.Greedy = f.Bool(fn.FederationGreedy)
+	}
+
+	if c.FederationConfig.BackfillMaxPages == 0 || f.IsSet(fn.FederationBackfillMaxPages) {
+		c.FederationConfig.BackfillMaxPages = f.Int(fn.FederationBackfillMaxPages)
+	}
+
+	if c.FederationConfig.BackfillMaxDepth == 0 || f.IsSet(fn.FederationBackfillMaxDepth) {
+		c.FederationConfig.BackfillMaxDepth = f.Int(fn.FederationBackfillMaxDepth)
+	}
+
+	// distributor flags
+	if c.DistributorConfig.Workers == 0 || f.IsSet(fn.DistributorWorkers) {
+		c.DistributorConfig.Workers = f.Int(fn.DistributorWorkers)
+	}
+
+	if c.DistributorConfig.QueueSize == 0 || f.IsSet(fn.DistributorQueueSize) {
+		c.DistributorConfig.QueueSize = f.Int(fn.DistributorQueueSize)
+	}
+
+	// statuses flags
+	if c.StatusesConfig.MaxChars == 0 || f.IsSet(fn.StatusesMaxChars) {
+		c.StatusesConfig.MaxChars = f.Int(fn.StatusesMaxChars)
+	}
+
+	if c.StatusesConfig.CWMaxChars == 0 || f.IsSet(fn.StatusesCWMaxChars) {
+		c.StatusesConfig.CWMaxChars = f.Int(fn.StatusesCWMaxChars)
+	}
+
+	if c.StatusesConfig.MaxMediaFiles == 0 || f.IsSet(fn.StatusesMaxMediaFiles) {
+		c.StatusesConfig.MaxMediaFiles = f.Int(fn.StatusesMaxMediaFiles)
+	}
 }
 
 // KeyedFlags is a wrapper for any type that can store keyed flags and give them back.
@@ -213,6 +263,19 @@ type Flags struct {
 	StorageServeProtocol string
 	StorageServeHost     string
 	StorageServeBasePath string
+
+	FederationMode             string
+	FederationSlow             string
+	FederationGreedy           string
+	FederationBackfillMaxPages string
+	FederationBackfillMaxDepth string
+
+	DistributorWorkers   string
+	DistributorQueueSize string
+
+	StatusesMaxChars      string
+	StatusesCWMaxChars    string
+	StatusesMaxMediaFiles string
 }
 
 // GetFlagNames returns a struct containing the names of the various flags used for
@@ -245,6 +308,19 @@ func GetFlagNames() Flags {
 		StorageServeProtocol: "storage-serve-protocol",
 		StorageServeHost:     "storage-serve-host",
 		StorageServeBasePath: "storage-serve-base-path",
+
+		FederationMode:             "federation-mode",
+		FederationSlow:             "federation-slow",
+		FederationGreedy:           "federation-greedy",
+		FederationBackfillMaxPages: "federation-backfill-max-pages",
+		FederationBackfillMaxDepth: "federation-backfill-max-depth",
+
+		DistributorWorkers:   "distributor-workers",
+		DistributorQueueSize: "distributor-queue-size",
+
+		StatusesMaxChars:      "statuses-max-chars",
+		StatusesCWMaxChars:    "statuses-cw-max-chars",
+		StatusesMaxMediaFiles: "statuses-max-media-files",
 	}
 }
 
@@ -278,5 +354,18 @@ func GetEnvNames() Flags {
 		StorageServeProtocol: "GTS_STORAGE_SERVE_PROTOCOL",
 		StorageServeHost:     "GTS_STORAGE_SERVE_HOST",
 		StorageServeBasePath: "GTS_STORAGE_SERVE_BASE_PATH",
+
+		FederationMode:             "GTS_FEDERATION_MODE",
+		FederationSlow:             "GTS_FEDERATION_SLOW",
+		FederationGreedy:           "GTS_FEDERATION_GREEDY",
+		FederationBackfillMaxPages: "GTS_FEDERATION_BACKFILL_MAX_PAGES",
+		FederationBackfillMaxDepth: "GTS_FEDERATION_BACKFILL_MAX_DEPTH",
+
+		DistributorWorkers:   "GTS_DISTRIBUTOR_WORKERS",
+		DistributorQueueSize: "GTS_DISTRIBUTOR_QUEUE_SIZE",
+
+		StatusesMaxChars:      "GTS_STATUSES_MAX_CHARS",
+		StatusesCWMaxChars:    "GTS_STATUSES_CW_MAX_CHARS",
+		StatusesMaxMediaFiles: "GTS_STATUSES_MAX_MEDIA_FILES",
 	}
 }
@@ -0,0 +1,27 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package config
+
+// DistributorConfig contains configuration for the distributor, which runs the side effects of things happening on this instance
+type DistributorConfig struct {
+	// Workers is how many messages the distributor handles at once
+	Workers int `yaml:"workers"`
+	// QueueSize is how many messages can be waiting to be handled by each worker before anything that sends a message to it has to wait
+	QueueSize int `yaml:"queueSize"`
+}
@@ -0,0 +1,44 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package config
+
+const (
+	// FederationModeOpen federates with any instance, ignoring domain blocks entirely.
+	FederationModeOpen = "open"
+	// FederationModeBlocklist federates with any instance that hasn't been blocked by an admin.
+	FederationModeBlocklist = "blocklist"
+	// FederationModeAllowlist only federates with instances that have been explicitly allowed by an admin.
+	FederationModeAllowlist = "allowlist"
+)
+
+// FederationConfig contains configuration for how this instance federates with other instances
+type FederationConfig struct {
+	// Mode determines which remote instances we're willing to talk to: open, blocklist or allowlist
+	Mode string `yaml:"mode"`
+	// SlowFederation enables reputation scoring of remote instances, so that new or poorly behaved
+	// instances are throttled, have their media stripped, or have their activities held for review.
+	SlowFederation bool `yaml:"slowFederation"`
+	// Greedy enables backfilling of remote accounts: when a local account follows or views a remote account,
+	// the remote account's outbox, featured collection and reply threads are fetched and stored in the background.
+	Greedy bool `yaml:"greedy"`
+	// BackfillMaxPages is the most collection pages that will be fetched for each collection when backfilling
+	BackfillMaxPages int `yaml:"backfillMaxPages"`
+	// BackfillMaxDepth is how many levels of replies will be fetched below each backfilled status
+	BackfillMaxDepth int `yaml:"backfillMaxDepth"`
+}
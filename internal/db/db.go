@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/go-fed/activity/pub"
 	"github.com/sirupsen/logrus"
@@ -112,17 +113,27 @@ type DB interface {
 	// In case of no entries, a 'no entries' error will be returned
 	GetAccountByUserID(userID string, account *model.Account) error
 
+	// GetLocalAccountByUsername is a shortcut for the common action of fetching an account on this instance (ie., with no domain) by its username.
+	// The given account pointer will be set to the result of the query, whatever it is.
+	// In case of no entries, a 'no entries' error will be returned
+	GetLocalAccountByUsername(username string, account *model.Account) error
+
+	// GetRemoteAccountByUsername is a shortcut for the common action of fetching an account on another instance by its username and domain.
+	// The given account pointer will be set to the result of the query, whatever it is.
+	// In case of no entries, a 'no entries' error will be returned
+	GetRemoteAccountByUsername(username string, domain string, account *model.Account) error
+
 	// GetFollowRequestsForAccountID is a shortcut for the common action of fetching a list of follow requests targeting the given account ID.
 	// The given slice 'followRequests' will be set to the result of the query, whatever it is.
 	// In case of no entries, a 'no entries' error will be returned
 	GetFollowRequestsForAccountID(accountID string, followRequests *[]model.FollowRequest) error
 
-	// GetFollowingByAccountID is a shortcut for the common action of fetching a list of accounts that accountID is following.
+	// GetFollowingByAccountID is a shortcut for the common action of fetching a list of accounts that accountID is following, newest follows first.
 	// The given slice 'following' will be set to the result of the query, whatever it is.
 	// In case of no entries, a 'no entries' error will be returned
 	GetFollowingByAccountID(accountID string, following *[]model.Follow) error
 
-	// GetFollowersByAccountID is a shortcut for the common action of fetching a list of accounts that accountID is followed by.
+	// GetFollowersByAccountID is a shortcut for the common action of fetching a list of accounts that accountID is followed by, newest follows first.
 	// The given slice 'followers' will be set to the result of the query, whatever it is.
 	// In case of no entries, a 'no entries' error will be returned
 	GetFollowersByAccountID(accountID string, followers *[]model.Follow) error
@@ -135,14 +146,71 @@ type DB interface {
 	// GetStatusesByTimeDescending is a shortcut for getting the most recent statuses. accountID is optional, if not provided
 	// then all statuses will be returned. If limit is set to 0, the size of the returned slice will not be limited. This can
 	// be very memory intensive so you probably shouldn't do this!
+	// maxID and minID are optional, and are used for paging: if maxID is set, only statuses older than the status with that id
+	// are returned, and if minID is set, only the statuses immediately newer than the status with that id are returned.
+	// Either way, the newest status comes first.
 	// In case of no entries, a 'no entries' error will be returned
-	GetStatusesByTimeDescending(accountID string, statuses *[]model.Status, limit int) error
+	GetStatusesByTimeDescending(accountID string, statuses *[]model.Status, limit int, maxID string, minID string) error
+
+	// GetHomeTimelineStatuses gets the most recent statuses posted by the given account and by the accounts it follows,
+	// which make up its home timeline before any filtering. limit, maxID and minID work the same as for GetStatusesByTimeDescending,
+	// and the newest status comes first.
+	// In case of no entries, a 'no entries' error will be returned
+	GetHomeTimelineStatuses(accountID string, statuses *[]model.Status, limit int, maxID string, minID string) error
+
+	// GetPublicTimelineStatuses gets the most recent public statuses known to this instance, leaving out boosts, which make
+	// up the public timeline before any filtering. If local is true, only statuses posted on this instance that are
+	// visible on the local timeline are returned. If onlyMedia is true, only statuses with media attached are returned.
+	// limit, maxID and minID work the same as for GetStatusesByTimeDescending, and the newest status comes first.
+	// In case of no entries, a 'no entries' error will be returned
+	GetPublicTimelineStatuses(local bool, onlyMedia bool, statuses *[]model.Status, limit int, maxID string, minID string) error
+
+	// StatusInteractionAllowed checks whether the given account may interact with the given status in the given way,
+	// according to the interaction policy of the status: whether the account follows the author, is followed back by them,
+	// or is mentioned in the status. The author of a status can always interact with it.
+	// Whether the account can see the status at all isn't checked here.
+	StatusInteractionAllowed(status *model.Status, account *model.Account, interaction model.Interaction) (bool, error)
 
 	// GetLastStatusForAccountID simply gets the most recent status by the given account.
 	// The given slice 'status' pointer will be set to the result of the query, whatever it is.
 	// In case of no entries, a 'no entries' error will be returned
 	GetLastStatusForAccountID(accountID string, status *model.Status) error
 
+	// GetFirstAccountForDomain gets the account on the given domain that has been in our database the longest,
+	// which tells us roughly when we first came into contact with that domain.
+	// The given account pointer will be set to the result of the query, whatever it is.
+	// In case of no entries, a 'no entries' error will be returned
+	GetFirstAccountForDomain(domain string, account *model.Account) error
+
+	// CountLocalInteractionsWithDomain counts the entries of i's type that were made by local accounts and that target accounts on the given domain.
+	// i should be a pointer to a model with AccountID and TargetAccountID fields, such as a Follow, Block, Mute or Report.
+	CountLocalInteractionsWithDomain(domain string, i interface{}) (int, error)
+
+	// GetDueDeliveries is a shortcut for getting deliveries whose next attempt is due at or before the given time, oldest first.
+	// If limit is set to 0, the size of the returned slice will not be limited.
+	// The given slice 'deliveries' will be set to the result of the query, whatever it is.
+	// In case of no entries, a 'no entries' error will be returned
+	GetDueDeliveries(before time.Time, limit int, deliveries *[]model.Delivery) error
+
+	// GetStaleRemoteAccounts is a shortcut for getting remote accounts that haven't been fetched from their servers since the given time, least recently fetched first.
+	// Accounts that have been deleted are left out.
+	// If limit is set to 0, the size of the returned slice will not be limited.
+	// The given slice 'accounts' will be set to the result of the query, whatever it is.
+	// In case of no entries, a 'no entries' error will be returned
+	GetStaleRemoteAccounts(before time.Time, limit int, accounts *[]model.Account) error
+
+	// GetAccountsToPurge is a shortcut for getting accounts that have been deleted, but that haven't had everything they left behind removed yet, longest deleted first.
+	// If limit is set to 0, the size of the returned slice will not be limited.
+	// The given slice 'accounts' will be set to the result of the query, whatever it is.
+	// In case of no entries, a 'no entries' error will be returned
+	GetAccountsToPurge(limit int, accounts *[]model.Account) error
+
+	// GetKnownInboxes is a shortcut for getting the inbox of every remote account that we know about and that hasn't been deleted,
+	// or its shared inbox instead if it has one, without duplicates.
+	// The given slice 'inboxes' will be set to the result of the query, whatever it is.
+	// In case of no entries, a 'no entries' error will be returned
+	GetKnownInboxes(inboxes *[]string) error
+
 	// IsUsernameAvailable checks whether a given username is available on our domain.
 	// Returns an error if the username is already taken, or something went wrong in the db.
 	IsUsernameAvailable(username string) error
@@ -182,6 +250,12 @@ type DB interface {
 	// if something goes wrong. The returned account should be ready to serialize on an API level, and may NOT have sensitive fields.
 	// In other words, this is the public record that the server has of an account.
 	AccountToMastoPublic(account *model.Account) (*mastotypes.Account, error)
+
+	// StatusToMasto takes a db model status as a param, and returns a populated mastotype status, or an error if something goes wrong.
+	// The requesting account is the account that the status is being served to: it's used to work out whether they've faved or boosted
+	// the status. It can be nil, if the status is being served to someone who isn't logged in.
+	// Whether or not the requesting account is allowed to see the status is not checked here, so do that before calling this.
+	StatusToMasto(status *model.Status, requestingAccount *model.Account) (*mastotypes.Status, error)
 }
 
 // New returns a new database service that satisfies the DB interface and, by extension,
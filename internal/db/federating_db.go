@@ -21,28 +21,46 @@ package db
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/url"
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/go-fed/activity/pub"
 	"github.com/go-fed/activity/streams"
 	"github.com/go-fed/activity/streams/vocab"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/typeutils"
+	"github.com/superseriousbusiness/gotosocial/internal/util"
+)
+
+// CtxKey is used for setting and retrieving values on the contexts that are passed through go-fed to the federating database.
+type CtxKey string
+
+const (
+	// CtxRequestingAccount is the context key for the *model.Account that signed the request being handled. Activities
+	// and statuses created with a context that has it set have to come from that account.
+	CtxRequestingAccount CtxKey = "requestingAccount"
 )
 
 // FederatingDB uses the underlying DB interface to implement the go-fed pub.Database interface.
 // It doesn't care what the underlying implementation of the DB interface is, as long as it works.
 type federatingDB struct {
-	locks  *sync.Map
+	locks  *lockTable
 	db     DB
 	config *config.Config
+	log    *logrus.Entry
 }
 
-func newFederatingDB(db DB, config *config.Config) pub.Database {
+func newFederatingDB(db DB, config *config.Config, log *logrus.Entry) pub.Database {
 	return &federatingDB{
-		locks:  new(sync.Map),
+		locks:  newLockTable(),
 		db:     db,
 		config: config,
+		log:    log,
 	}
 }
 
@@ -52,108 +70,1132 @@ func newFederatingDB(db DB, config *config.Config) pub.Database {
 func (f *federatingDB) Lock(ctx context.Context, id *url.URL) error {
 	// Before any other Database methods are called, the relevant `id`
 	// entries are locked to allow for fine-grained concurrency.
-
-	// Strategy: create a new lock, if stored, continue. Otherwise, lock the
-	// existing mutex.
-	mu := &sync.Mutex{}
-	mu.Lock() // Optimistically lock if we do store it.
-	i, loaded := f.locks.LoadOrStore(id.String(), mu)
-	if loaded {
-		mu = i.(*sync.Mutex)
-		mu.Lock()
-	}
+	f.locks.lock(id.String())
 	return nil
 }
 
 func (f *federatingDB) Unlock(ctx context.Context, id *url.URL) error {
 	// Once Go-Fed is done calling Database methods, the relevant `id`
 	// entries are unlocked.
-
-	i, ok := f.locks.Load(id.String())
-	if !ok {
-		return errors.New("missing an id in unlock")
-	}
-	mu := i.(*sync.Mutex)
-	mu.Unlock()
-	return nil
+	return f.locks.unlock(id.String())
 }
 
+// InboxContains returns true if the OrderedCollection at 'inbox'
+// contains the specified 'id'.
+//
+// We don't keep inboxes as such, since activities are turned into statuses, follows, faves etc. as they come in,
+// so we just check whether we've already stored whatever the activity with this id created.
 func (f *federatingDB) InboxContains(ctx context.Context, inbox *url.URL, id *url.URL) (bool, error) {
-	return false, nil
+	return f.Exists(ctx, id)
 }
 
+// GetInbox returns the first ordered collection page of the outbox at
+// the specified IRI, for prepending new items.
+//
+// Since we don't keep inboxes (see InboxContains), this always returns an empty page.
 func (f *federatingDB) GetInbox(ctx context.Context, inboxIRI *url.URL) (inbox vocab.ActivityStreamsOrderedCollectionPage, err error) {
-	return nil, nil
+	page := streams.NewActivityStreamsOrderedCollectionPage()
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(inboxIRI)
+	page.SetJSONLDId(idProp)
+	return page, nil
 }
 
+// SetInbox saves the inbox value given from GetInbox, with new items
+// prepended. Note that the new items must not be added as independent
+// database entries. Separate calls to Create will do that.
+//
+// Since we don't keep inboxes (see InboxContains), this is a no-op.
 func (f *federatingDB) SetInbox(ctx context.Context, inbox vocab.ActivityStreamsOrderedCollectionPage) error {
 	return nil
 }
 
+// Owns returns true if the IRI belongs to this instance, and if
+// the database has an entry for the IRI.
 func (f *federatingDB) Owns(ctx context.Context, id *url.URL) (owns bool, err error) {
 	return id.Host == f.config.Host, nil
 }
 
+// ActorForOutbox fetches the actor's IRI for the given outbox IRI.
 func (f *federatingDB) ActorForOutbox(ctx context.Context, outboxIRI *url.URL) (actorIRI *url.URL, err error) {
-	return nil, nil
+	acct := &model.Account{}
+	if err := f.db.GetWhere("outbox_url", f.localIRI(outboxIRI).String(), acct); err != nil {
+		return nil, fmt.Errorf("error getting account with outbox %s: %s", outboxIRI, err)
+	}
+	return url.Parse(acct.URI)
 }
 
+// ActorForInbox fetches the actor's IRI for the given inbox IRI.
 func (f *federatingDB) ActorForInbox(ctx context.Context, inboxIRI *url.URL) (actorIRI *url.URL, err error) {
-	return nil, nil
+	acct := &model.Account{}
+	if err := f.db.GetWhere("inbox_url", f.localIRI(inboxIRI).String(), acct); err != nil {
+		return nil, fmt.Errorf("error getting account with inbox %s: %s", inboxIRI, err)
+	}
+	return url.Parse(acct.URI)
 }
 
+// OutboxForInbox fetches the corresponding actor's outbox IRI for the
+// actor's inbox IRI.
 func (f *federatingDB) OutboxForInbox(ctx context.Context, inboxIRI *url.URL) (outboxIRI *url.URL, err error) {
-	return nil, nil
+	acct := &model.Account{}
+	if err := f.db.GetWhere("inbox_url", f.localIRI(inboxIRI).String(), acct); err != nil {
+		return nil, fmt.Errorf("error getting account with inbox %s: %s", inboxIRI, err)
+	}
+	return url.Parse(acct.OutboxURL)
 }
 
+// Exists returns true if the database has an entry for the specified
+// id. It may not be owned by this application instance.
 func (f *federatingDB) Exists(ctx context.Context, id *url.URL) (exists bool, err error) {
-	return false, nil
+	if _, err := f.getByURI(id.String()); err != nil {
+		if _, ok := err.(ErrNoEntries); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
 }
 
+// Get returns the database entry for the specified id.
 func (f *federatingDB) Get(ctx context.Context, id *url.URL) (value vocab.Type, err error) {
-	return nil, nil
+	i, err := f.getByURI(id.String())
+	if err != nil {
+		if _, ok := err.(ErrNoEntries); !ok {
+			return nil, err
+		}
+		// it's not a thing with a uri, but it might still be one of the collections we can build
+		return f.getCollection(ctx, id)
+	}
+
+	switch entry := i.(type) {
+	case *model.Status:
+		return f.statusToAS(entry)
+	case *model.Account:
+		return f.accountToAS(entry)
+	case *model.Follow:
+		origin := &model.Account{}
+		if err := f.db.GetByID(entry.AccountID, origin); err != nil {
+			return nil, fmt.Errorf("error getting origin account of follow %s: %s", entry.URI, err)
+		}
+		target := &model.Account{}
+		if err := f.db.GetByID(entry.TargetAccountID, target); err != nil {
+			return nil, fmt.Errorf("error getting target account of follow %s: %s", entry.URI, err)
+		}
+		return typeutils.FollowToAS(entry, origin, target)
+	case *model.FollowRequest:
+		// a follow that hasn't been accepted yet is still just a Follow as far as activitypub is concerned
+		origin := &model.Account{}
+		if err := f.db.GetByID(entry.AccountID, origin); err != nil {
+			return nil, fmt.Errorf("error getting origin account of follow request %s: %s", entry.URI, err)
+		}
+		target := &model.Account{}
+		if err := f.db.GetByID(entry.TargetAccountID, target); err != nil {
+			return nil, fmt.Errorf("error getting target account of follow request %s: %s", entry.URI, err)
+		}
+		return typeutils.FollowToAS(&model.Follow{URI: entry.URI}, origin, target)
+	case *model.StatusFave:
+		origin := &model.Account{}
+		if err := f.db.GetByID(entry.AccountID, origin); err != nil {
+			return nil, fmt.Errorf("error getting origin account of fave %s: %s", entry.URI, err)
+		}
+		status := &model.Status{}
+		if err := f.db.GetByID(entry.StatusID, status); err != nil {
+			return nil, fmt.Errorf("error getting status of fave %s: %s", entry.URI, err)
+		}
+		return typeutils.FaveToAS(entry, origin, status)
+	}
+	return nil, fmt.Errorf("don't know how to convert %T with uri %s", i, id)
 }
 
+// Create adds a new entry to the database which must be able to be
+// keyed by its id.
+//
+// Note that Activity values received from federated peers may also be
+// created in the database this way if the Federating Protocol is
+// enabled. The client may freely decide to store only the id instead of
+// the entire value.
+//
+// Under certain conditions and network activities, Create may be called
+// multiple times for the same ActivityStreams object.
 func (f *federatingDB) Create(ctx context.Context, asType vocab.Type) error {
-	t, err := streams.NewTypeResolver()
-	if err != nil {
-		return err
-	}
-	if err := t.Resolve(ctx, asType); err != nil {
-		return err
+	l := f.log.WithFields(logrus.Fields{
+		"func":   "Create",
+		"asType": asType.GetTypeName(),
+	})
+
+	switch asType.GetTypeName() {
+	case "Note":
+		note, ok := asType.(vocab.ActivityStreamsNote)
+		if !ok {
+			return errors.New("could not convert type to note")
+		}
+		return f.createStatus(ctx, note)
+	case "Create":
+		// the create itself isn't stored, but whoever sent it has to be the one doing the creating
+		create, ok := asType.(vocab.ActivityStreamsCreate)
+		if !ok {
+			return errors.New("could not convert type to create")
+		}
+		actorIRI, err := typeutils.ExtractActor(create)
+		if err != nil {
+			return fmt.Errorf("error extracting actor of create: %s", err)
+		}
+		return checkSigner(ctx, actorIRI)
+	case "Follow":
+		follow, ok := asType.(vocab.ActivityStreamsFollow)
+		if !ok {
+			return errors.New("could not convert type to follow")
+		}
+		return f.createFollow(ctx, follow)
+	case "Like":
+		like, ok := asType.(vocab.ActivityStreamsLike)
+		if !ok {
+			return errors.New("could not convert type to like")
+		}
+		return f.createFave(ctx, like)
+	case "Announce":
+		announce, ok := asType.(vocab.ActivityStreamsAnnounce)
+		if !ok {
+			return errors.New("could not convert type to announce")
+		}
+		return f.createBoost(ctx, announce)
 	}
-	asType.GetTypeName()
+
+	// other activities (Create, Accept, Undo etc) don't need storing in their own right,
+	// since their side effects are handled by the federating callbacks
+	l.Debug("nothing to store for this type")
 	return nil
 }
 
+// Update sets an existing entry to the database based on the value's
+// id.
+//
+// Note that Activity values received from federated peers may also be
+// updated in the database this way if the Federating Protocol is
+// enabled. The client may freely decide to store only the id instead of
+// the entire value.
 func (f *federatingDB) Update(ctx context.Context, asType vocab.Type) error {
+	l := f.log.WithFields(logrus.Fields{
+		"func":   "Update",
+		"asType": asType.GetTypeName(),
+	})
+
+	switch asType.GetTypeName() {
+	case "Note":
+		note, ok := asType.(vocab.ActivityStreamsNote)
+		if !ok {
+			return errors.New("could not convert type to note")
+		}
+		return f.updateStatus(ctx, note)
+	case "Person", "Application", "Organization", "Service", "Group":
+		accountable, ok := asType.(typeutils.Accountable)
+		if !ok {
+			return errors.New("could not convert type to accountable")
+		}
+		return f.updateAccount(ctx, accountable)
+	case "Collection":
+		collection, ok := asType.(vocab.ActivityStreamsCollection)
+		if !ok {
+			return errors.New("could not convert type to collection")
+		}
+		return f.updateCollection(ctx, collection)
+	}
+
+	l.Debug("nothing to update for this type")
 	return nil
 }
 
+// Delete removes the entry with the given id.
+//
+// Delete is only called for federated objects. Deletes from the Social
+// Protocol instead call Update to create a Tombstone.
+//
+// Only remote things can be deleted this way, and only by the account that owns them: the author of a status,
+// or whoever sent a follow, follow request or fave.
 func (f *federatingDB) Delete(ctx context.Context, id *url.URL) error {
+	l := f.log.WithFields(logrus.Fields{
+		"func": "Delete",
+		"id":   id.String(),
+	})
+
+	i, err := f.getByURI(id.String())
+	if err != nil {
+		if _, ok := err.(ErrNoEntries); ok {
+			// it's already gone
+			return nil
+		}
+		return err
+	}
+
+	switch entry := i.(type) {
+	case *model.Status:
+		if entry.Local {
+			return fmt.Errorf("status %s is local, so it can't be deleted through federation", id)
+		}
+		if err := f.checkOwner(ctx, entry.AccountID); err != nil {
+			return fmt.Errorf("status %s can't be deleted: %s", id, err)
+		}
+		// take faves and boosts of the status with it
+		if err := f.db.DeleteWhere("status_id", entry.ID, &model.StatusFave{}); err != nil {
+			return fmt.Errorf("error deleting faves of status %s: %s", entry.ID, err)
+		}
+		if err := f.db.DeleteWhere("boost_of_id", entry.ID, &model.Status{}); err != nil {
+			return fmt.Errorf("error deleting boosts of status %s: %s", entry.ID, err)
+		}
+		return f.db.DeleteByID(entry.ID, &model.Status{})
+	case *model.Follow:
+		if err := f.checkOwner(ctx, entry.AccountID); err != nil {
+			return fmt.Errorf("follow %s can't be deleted: %s", id, err)
+		}
+		return f.db.DeleteByID(entry.ID, &model.Follow{})
+	case *model.FollowRequest:
+		if err := f.checkOwner(ctx, entry.AccountID); err != nil {
+			return fmt.Errorf("follow request %s can't be deleted: %s", id, err)
+		}
+		return f.db.DeleteByID(entry.ID, &model.FollowRequest{})
+	case *model.StatusFave:
+		if err := f.checkOwner(ctx, entry.AccountID); err != nil {
+			return fmt.Errorf("fave %s can't be deleted: %s", id, err)
+		}
+		return f.db.DeleteByID(entry.ID, &model.StatusFave{})
+	case *model.Account:
+		// removing an account means removing everything it owns, which isn't something we do here: the federator's
+		// Delete callback tombstones the account, and what it owns is purged in the background
+		l.Debug("not deleting account")
+		return nil
+	}
 	return nil
 }
 
+// GetOutbox returns the first ordered collection page of the outbox
+// at the specified IRI, for prepending new items.
+//
+// Outboxes are built from statuses when they're served, so this just returns an empty page for go-fed to prepend to.
 func (f *federatingDB) GetOutbox(ctx context.Context, outboxIRI *url.URL) (inbox vocab.ActivityStreamsOrderedCollectionPage, err error) {
-	return nil, nil
+	page := streams.NewActivityStreamsOrderedCollectionPage()
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(outboxIRI)
+	page.SetJSONLDId(idProp)
+	return page, nil
 }
 
+// SetOutbox saves the outbox value given from GetOutbox, with new items
+// prepended. Note that the new items must not be added as independent
+// database entries. Separate calls to Create will do that.
 func (f *federatingDB) SetOutbox(ctx context.Context, outbox vocab.ActivityStreamsOrderedCollectionPage) error {
 	return nil
 }
 
+// NewID creates a new IRI id for the provided activity or object. The
+// implementation does not need to set the 'id' property and simply
+// needs to determine the value.
+//
+// Things created by a local actor are namespaced under that actor's uri, eg.,
+// https://example.org/users/some_user/statuses/[uuid] for a note.
 func (f *federatingDB) NewID(ctx context.Context, t vocab.Type) (id *url.URL, err error) {
-	return nil, nil
+	var actorIRI *url.URL
+	switch v := t.(type) {
+	case typeutils.Activityable:
+		actorIRI, _ = typeutils.ExtractActor(v)
+	case typeutils.Statusable:
+		actorIRI, _ = typeutils.ExtractAttributedTo(v)
+	}
+
+	path := strings.ToLower(t.GetTypeName())
+	if t.GetTypeName() == "Note" {
+		path = "statuses"
+	}
+
+	if actorIRI != nil && actorIRI.Host == f.config.Host {
+		return url.Parse(fmt.Sprintf("%s/%s/%s", actorIRI, path, uuid.NewString()))
+	}
+	return url.Parse(fmt.Sprintf("%s://%s/%s/%s", f.config.Protocol, f.config.Host, path, uuid.NewString()))
 }
 
+// Followers obtains the Followers Collection for an actor with the
+// given id.
+//
+// If modified, the library will then call Update.
 func (f *federatingDB) Followers(ctx context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error) {
-	return nil, nil
+	acct := &model.Account{}
+	if err := f.db.GetWhere("uri", actorIRI.String(), acct); err != nil {
+		return nil, fmt.Errorf("error getting account with uri %s: %s", actorIRI, err)
+	}
+	return f.followersCollection(acct)
+}
+
+// Following obtains the Following Collection for an actor with the
+// given id.
+//
+// If modified, the library will then call Update.
+func (f *federatingDB) Following(ctx context.Context, actorIRI *url.URL) (following vocab.ActivityStreamsCollection, err error) {
+	acct := &model.Account{}
+	if err := f.db.GetWhere("uri", actorIRI.String(), acct); err != nil {
+		return nil, fmt.Errorf("error getting account with uri %s: %s", actorIRI, err)
+	}
+	return f.followingCollection(acct)
+}
+
+// Liked obtains the Liked Collection for an actor with the
+// given id.
+//
+// If modified, the library will then call Update.
+func (f *federatingDB) Liked(ctx context.Context, actorIRI *url.URL) (liked vocab.ActivityStreamsCollection, err error) {
+	acct := &model.Account{}
+	if err := f.db.GetWhere("uri", actorIRI.String(), acct); err != nil {
+		return nil, fmt.Errorf("error getting account with uri %s: %s", actorIRI, err)
+	}
+
+	faves := []model.StatusFave{}
+	if err := f.db.GetWhere("account_id", acct.ID, &faves); err != nil {
+		if _, ok := err.(ErrNoEntries); !ok {
+			return nil, fmt.Errorf("error getting faves of account %s: %s", acct.ID, err)
+		}
+	}
+
+	items := []*url.URL{}
+	for _, fave := range faves {
+		status := &model.Status{}
+		if err := f.db.GetByID(fave.StatusID, status); err != nil {
+			return nil, fmt.Errorf("error getting faved status %s: %s", fave.StatusID, err)
+		}
+		statusURI, err := url.Parse(status.URI)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing status uri %s: %s", status.URI, err)
+		}
+		items = append(items, statusURI)
+	}
+
+	likedURI, err := url.Parse(acct.URI + "/liked")
+	if err != nil {
+		return nil, fmt.Errorf("error parsing liked uri: %s", err)
+	}
+	return typeutils.CollectionToAS(likedURI, items), nil
+}
+
+/*
+	CONVERSION AND STORAGE HELPERS
+*/
+
+// localIRI returns a copy of the given iri with its scheme set to our configured protocol, if it's an iri on this instance.
+// This is needed because go-fed always assumes https when it builds inbox iris from incoming requests.
+func (f *federatingDB) localIRI(iri *url.URL) *url.URL {
+	local := *iri
+	if local.Host == f.config.Host {
+		local.Scheme = f.config.Protocol
+	}
+	return &local
+}
+
+// getByURI looks for an entry with the given activitypub uri in the database. Statuses, accounts, follows,
+// follow requests and faves are checked in that order, and a pointer to the first model found is returned.
+// In case of no entries, a 'no entries' error will be returned
+func (f *federatingDB) getByURI(uri string) (interface{}, error) {
+	candidates := []interface{}{
+		&model.Status{},
+		&model.Account{},
+		&model.Follow{},
+		&model.FollowRequest{},
+		&model.StatusFave{},
+	}
+	for _, c := range candidates {
+		if err := f.db.GetWhere("uri", uri, c); err != nil {
+			if _, ok := err.(ErrNoEntries); ok {
+				continue
+			}
+			return nil, err
+		}
+		return c, nil
+	}
+	return nil, ErrNoEntries{}
+}
+
+// getCollection returns the followers or following collection with the given id, if there's an account that owns it.
+func (f *federatingDB) getCollection(ctx context.Context, id *url.URL) (vocab.Type, error) {
+	acct := &model.Account{}
+	if err := f.db.GetWhere("followers_url", id.String(), acct); err == nil {
+		return f.followersCollection(acct)
+	} else if _, ok := err.(ErrNoEntries); !ok {
+		return nil, err
+	}
+
+	if err := f.db.GetWhere("following_url", id.String(), acct); err == nil {
+		return f.followingCollection(acct)
+	} else if _, ok := err.(ErrNoEntries); !ok {
+		return nil, err
+	}
+
+	return nil, ErrNoEntries{}
+}
+
+// followersCollection returns a collection of the uris of all accounts that follow the given account.
+func (f *federatingDB) followersCollection(acct *model.Account) (vocab.ActivityStreamsCollection, error) {
+	follows := []model.Follow{}
+	if err := f.db.GetFollowersByAccountID(acct.ID, &follows); err != nil {
+		if _, ok := err.(ErrNoEntries); !ok {
+			return nil, fmt.Errorf("error getting followers of account %s: %s", acct.ID, err)
+		}
+	}
+
+	followerIDs := []string{}
+	for _, follow := range follows {
+		followerIDs = append(followerIDs, follow.AccountID)
+	}
+	return f.accountsCollection(acct.FollowersURL, followerIDs)
+}
+
+// followingCollection returns a collection of the uris of all accounts that the given account follows.
+func (f *federatingDB) followingCollection(acct *model.Account) (vocab.ActivityStreamsCollection, error) {
+	follows := []model.Follow{}
+	if err := f.db.GetFollowingByAccountID(acct.ID, &follows); err != nil {
+		if _, ok := err.(ErrNoEntries); !ok {
+			return nil, fmt.Errorf("error getting following of account %s: %s", acct.ID, err)
+		}
+	}
+
+	followingIDs := []string{}
+	for _, follow := range follows {
+		followingIDs = append(followingIDs, follow.TargetAccountID)
+	}
+	return f.accountsCollection(acct.FollowingURL, followingIDs)
+}
+
+// accountsCollection returns a collection with the given id, containing the uris of the accounts with the given database ids.
+func (f *federatingDB) accountsCollection(id string, accountIDs []string) (vocab.ActivityStreamsCollection, error) {
+	collectionURI, err := url.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing collection uri %s: %s", id, err)
+	}
+
+	items := []*url.URL{}
+	for _, accountID := range accountIDs {
+		acct := &model.Account{}
+		if err := f.db.GetByID(accountID, acct); err != nil {
+			return nil, fmt.Errorf("error getting account %s: %s", accountID, err)
+		}
+		acctURI, err := url.Parse(acct.URI)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing account uri %s: %s", acct.URI, err)
+		}
+		items = append(items, acctURI)
+	}
+	return typeutils.CollectionToAS(collectionURI, items), nil
+}
+
+// statusToAS converts the given status to a Note, or an Announce if it's a boost.
+// Local-only statuses are never handed out, so for them ErrNoEntries is returned, as if they didn't exist.
+func (f *federatingDB) statusToAS(status *model.Status) (vocab.Type, error) {
+	if status.Local && status.Visibility != nil && status.Visibility.LocalOnly {
+		return nil, ErrNoEntries{}
+	}
+
+	author := &model.Account{}
+	if err := f.db.GetByID(status.AccountID, author); err != nil {
+		return nil, fmt.Errorf("error getting account of status %s: %s", status.URI, err)
+	}
+
+	if status.BoostOfID != "" {
+		boosted := &model.Status{}
+		if err := f.db.GetByID(status.BoostOfID, boosted); err != nil {
+			return nil, fmt.Errorf("error getting boosted status of %s: %s", status.URI, err)
+		}
+		return typeutils.BoostToAS(status, author, boosted)
+	}
+
+	var inReplyTo *model.Status
+	if status.InReplyToID != "" {
+		inReplyTo = &model.Status{}
+		if err := f.db.GetByID(status.InReplyToID, inReplyTo); err != nil {
+			if _, ok := err.(ErrNoEntries); !ok {
+				return nil, fmt.Errorf("error getting replied-to status of %s: %s", status.URI, err)
+			}
+			inReplyTo = nil
+		}
+	}
+	return typeutils.StatusToAS(status, author, inReplyTo)
+}
+
+// accountToAS converts the given account to a Person or Service, along with its avatar and header if it has them.
+func (f *federatingDB) accountToAS(acct *model.Account) (vocab.Type, error) {
+	avatar := &model.MediaAttachment{}
+	if err := f.db.GetAvatarForAccountID(avatar, acct.ID); err != nil {
+		if _, ok := err.(ErrNoEntries); !ok {
+			return nil, fmt.Errorf("error getting avatar of account %s: %s", acct.ID, err)
+		}
+		avatar = nil
+	}
+
+	header := &model.MediaAttachment{}
+	if err := f.db.GetHeaderForAccountID(header, acct.ID); err != nil {
+		if _, ok := err.(ErrNoEntries); !ok {
+			return nil, fmt.Errorf("error getting header of account %s: %s", acct.ID, err)
+		}
+		header = nil
+	}
+
+	var sharedInboxURL string
+	if acct.Domain == "" {
+		sharedInboxURL = util.GenerateURIs(acct.Username, f.config.Protocol, f.config.Host).SharedInboxURL
+	}
+
+	var movedToURI string
+	if acct.MovedToAccountID != "" {
+		movedTo := &model.Account{}
+		if err := f.db.GetByID(acct.MovedToAccountID, movedTo); err != nil {
+			return nil, fmt.Errorf("error getting account %s that account %s moved to: %s", acct.MovedToAccountID, acct.ID, err)
+		}
+		movedToURI = movedTo.URI
+	}
+	return typeutils.AccountToAS(acct, avatar, header, sharedInboxURL, movedToURI)
+}
+
+// AccountForIRI returns the account with the given activitypub uri from the given db. If there's no such account, ErrNoEntries is returned.
+func AccountForIRI(db DB, iri *url.URL) (*model.Account, error) {
+	acct := &model.Account{}
+	if err := db.GetWhere("uri", iri.String(), acct); err != nil {
+		if _, ok := err.(ErrNoEntries); ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error getting account %s: %s", iri, err)
+	}
+	return acct, nil
+}
+
+// statusForIRI returns the status with the given activitypub uri.
+func (f *federatingDB) statusForIRI(iri *url.URL) (*model.Status, error) {
+	status := &model.Status{}
+	if err := f.db.GetWhere("uri", iri.String(), status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// createStatus stores the given note as a status, along with its mentions and attachments, if we don't have it already.
+// If the note replies to a status we know about, it will be threaded onto it; dereferencing parents that we don't
+// know about yet is left to the federator, since it needs to make requests to other servers. Replies to statuses
+// whose interaction policy doesn't let the author reply to them are dropped.
+//
+// The note has to be attributed to an account on the same server as the note itself, and, if it was delivered to us,
+// to the account that signed the delivery.
+func (f *federatingDB) createStatus(ctx context.Context, note typeutils.Statusable) error {
+	l := f.log.WithField("func", "createStatus")
+
+	idProp := note.GetJSONLDId()
+	if idProp == nil || !idProp.IsIRI() {
+		return errors.New("note had no id")
+	}
+	uri := idProp.GetIRI().String()
+
+	existing := &model.Status{}
+	if err := f.db.GetWhere("uri", uri, existing); err == nil {
+		l.Debugf("status %s already exists", uri)
+		return nil
+	} else if _, ok := err.(ErrNoEntries); !ok {
+		return fmt.Errorf("error checking for existing status %s: %s", uri, err)
+	}
+
+	authorIRI, err := typeutils.ExtractAttributedTo(note)
+	if err != nil {
+		return fmt.Errorf("error extracting author of status %s: %s", uri, err)
+	}
+	if authorIRI.Host != idProp.GetIRI().Host {
+		return fmt.Errorf("status %s is attributed to %s, which is on a different server", uri, authorIRI)
+	}
+	if err := checkSigner(ctx, authorIRI); err != nil {
+		return fmt.Errorf("status %s can't be created: %s", uri, err)
+	}
+	author, err := AccountForIRI(f.db, authorIRI)
+	if err != nil {
+		return fmt.Errorf("error getting author %s of status %s: %s", authorIRI, uri, err)
+	}
+
+	status, err := typeutils.ASStatusToStatus(note, author)
+	if err != nil {
+		return fmt.Errorf("error converting note to status: %s", err)
+	}
+	// mentions and attachments need to refer to the status, so we can't wait for the db to give it an id
+	status.ID = uuid.NewString()
+
+	if inReplyToIRI, err := typeutils.ExtractInReplyTo(note); err == nil {
+		if inReplyTo, err := f.statusForIRI(f.localIRI(inReplyToIRI)); err == nil {
+			allowed, err := f.db.StatusInteractionAllowed(inReplyTo, author, model.InteractionReply)
+			if err != nil {
+				return fmt.Errorf("error checking whether %s can reply to status %s: %s", author.URI, inReplyTo.ID, err)
+			}
+			if !allowed {
+				l.Debugf("account %s isn't allowed to reply to status %s, dropping status %s", author.URI, inReplyTo.ID, uri)
+				return nil
+			}
+			status.InReplyToID = inReplyTo.ID
+		} else if _, ok := err.(ErrNoEntries); !ok {
+			return fmt.Errorf("error getting replied-to status %s: %s", inReplyToIRI, err)
+		}
+	}
+
+	if err := f.db.Put(status); err != nil {
+		return fmt.Errorf("error putting status %s: %s", uri, err)
+	}
+
+	// we only record mentions of accounts we know about, which will always include any of our own accounts
+	for _, href := range typeutils.ExtractMentions(note) {
+		target, err := AccountForIRI(f.db, f.localIRI(href))
+		if err != nil {
+			if _, ok := err.(ErrNoEntries); ok {
+				l.Debugf("mentioned account %s isn't one we know about", href)
+				continue
+			}
+			return fmt.Errorf("error getting mentioned account %s: %s", href, err)
+		}
+		if err := f.db.Put(&model.Mention{
+			StatusID:        status.ID,
+			OriginAccountID: author.ID,
+			TargetAccountID: target.ID,
+		}); err != nil {
+			return fmt.Errorf("error putting mention of %s in status %s: %s", href, uri, err)
+		}
+	}
+
+	for _, a := range typeutils.ExtractAttachments(note) {
+		attachment, err := typeutils.ASAttachmentToAttachment(a)
+		if err != nil {
+			l.Debugf("skipping attachment of status %s: %s", uri, err)
+			continue
+		}
+		attachment.StatusID = status.ID
+		attachment.AccountID = author.ID
+		if err := f.db.Put(attachment); err != nil {
+			return fmt.Errorf("error putting attachment %s of status %s: %s", attachment.RemoteURL, uri, err)
+		}
+	}
+
+	return nil
 }
 
-func (f *federatingDB) Following(ctx context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error) {
-	return nil, nil
+// createFollow stores a follow sent by one of our accounts as a follow request, which will be turned into a
+// proper follow once the target accepts it. Follows that come in from other servers are handled by the
+// federator's Follow callback instead, since whether they need approving depends on the target account.
+func (f *federatingDB) createFollow(ctx context.Context, follow typeutils.Activityable) error {
+	l := f.log.WithField("func", "createFollow")
+
+	origin, target, uri, err := ActivityAccounts(ctx, f.db, follow)
+	if err != nil {
+		return err
+	}
+	if origin.Domain != "" {
+		l.Debugf("follow %s is from a remote account, nothing to store", uri)
+		return nil
+	}
+	if target == nil {
+		l.Debugf("target of follow %s isn't an account we know about", uri)
+		return nil
+	}
+
+	requests := []model.FollowRequest{}
+	if err := f.db.GetFollowRequestsForAccountID(target.ID, &requests); err != nil {
+		if _, ok := err.(ErrNoEntries); !ok {
+			return fmt.Errorf("error getting existing follow requests for account %s: %s", target.ID, err)
+		}
+	}
+	for _, existing := range requests {
+		if existing.AccountID == origin.ID {
+			l.Debugf("account %s has already requested to follow account %s", origin.ID, target.ID)
+			return nil
+		}
+	}
+
+	return f.db.Put(&model.FollowRequest{
+		AccountID:       origin.ID,
+		TargetAccountID: target.ID,
+		URI:             uri.String(),
+	})
 }
 
-func (f *federatingDB) Liked(ctx context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error) {
-	return nil, nil
+// createFave stores the given like as a fave, as long as it targets a status we know about and its actor is allowed to like it.
+func (f *federatingDB) createFave(ctx context.Context, like typeutils.Activityable) error {
+	l := f.log.WithField("func", "createFave")
+
+	origin, status, uri, err := f.activityStatus(ctx, like)
+	if err != nil {
+		return err
+	}
+	if status == nil {
+		l.Debugf("target of like %s isn't a status we know about", uri)
+		return nil
+	}
+	allowed, err := f.db.StatusInteractionAllowed(status, origin, model.InteractionLike)
+	if err != nil {
+		return fmt.Errorf("error checking whether account %s can like status %s: %s", origin.ID, status.ID, err)
+	}
+	if !allowed {
+		l.Debugf("account %s isn't allowed to like status %s, dropping like %s", origin.ID, status.ID, uri)
+		return nil
+	}
+
+	faves := []model.StatusFave{}
+	if err := f.db.GetWhere("account_id", origin.ID, &faves); err != nil {
+		if _, ok := err.(ErrNoEntries); !ok {
+			return fmt.Errorf("error getting existing faves of account %s: %s", origin.ID, err)
+		}
+	}
+	for _, existing := range faves {
+		if existing.StatusID == status.ID {
+			l.Debugf("account %s already faved status %s", origin.ID, status.ID)
+			return nil
+		}
+	}
+
+	return f.db.Put(&model.StatusFave{
+		AccountID:       origin.ID,
+		TargetAccountID: status.AccountID,
+		StatusID:        status.ID,
+		URI:             uri.String(),
+	})
+}
+
+// createBoost stores the given announce as a status boosting another status, as long as it targets a status we know about
+// and its actor is allowed to boost it.
+func (f *federatingDB) createBoost(ctx context.Context, announce vocab.ActivityStreamsAnnounce) error {
+	l := f.log.WithField("func", "createBoost")
+
+	origin, boosted, uri, err := f.activityStatus(ctx, announce)
+	if err != nil {
+		return err
+	}
+	if boosted == nil {
+		l.Debugf("target of announce %s isn't a status we know about", uri)
+		return nil
+	}
+	allowed, err := f.db.StatusInteractionAllowed(boosted, origin, model.InteractionBoost)
+	if err != nil {
+		return fmt.Errorf("error checking whether account %s can boost status %s: %s", origin.ID, boosted.ID, err)
+	}
+	if !allowed {
+		l.Debugf("account %s isn't allowed to boost status %s, dropping announce %s", origin.ID, boosted.ID, uri)
+		return nil
+	}
+
+	existing := &model.Status{}
+	if err := f.db.GetWhere("uri", uri.String(), existing); err == nil {
+		l.Debugf("boost %s already exists", uri)
+		return nil
+	} else if _, ok := err.(ErrNoEntries); !ok {
+		return fmt.Errorf("error checking for existing boost %s: %s", uri, err)
+	}
+
+	boost, err := typeutils.ASBoostToStatus(announce)
+	if err != nil {
+		return fmt.Errorf("error converting announce to status: %s", err)
+	}
+	boost.AccountID = origin.ID
+	boost.BoostOfID = boosted.ID
+	boost.Local = origin.Domain == ""
+
+	return f.db.Put(boost)
+}
+
+// ActivityAccounts returns the actor and object accounts of the given activity from the given db, along with the activity's id.
+// An error is returned if the actor is unknown; if the object is unknown, the returned object account will be nil.
+// If the activity was delivered to us, its actor has to be the account that signed the delivery.
+func ActivityAccounts(ctx context.Context, db DB, activity typeutils.Activityable) (actor *model.Account, object *model.Account, id *url.URL, err error) {
+	actor, objectIRI, id, err := ActivityActor(ctx, db, activity)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	object, err = AccountForIRI(db, objectIRI)
+	if err != nil {
+		if _, ok := err.(ErrNoEntries); !ok {
+			return nil, nil, nil, err
+		}
+		return actor, nil, id, nil
+	}
+	return actor, object, id, nil
+}
+
+// activityStatus returns the actor account and object status of the given activity, along with the activity's id.
+// An error is returned if the actor is unknown; if the object is unknown, the returned status will be nil.
+func (f *federatingDB) activityStatus(ctx context.Context, activity typeutils.Activityable) (actor *model.Account, object *model.Status, id *url.URL, err error) {
+	actor, objectIRI, id, err := ActivityActor(ctx, f.db, activity)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	object, err = f.statusForIRI(objectIRI)
+	if err != nil {
+		if _, ok := err.(ErrNoEntries); !ok {
+			return nil, nil, nil, fmt.Errorf("error getting object status %s: %s", objectIRI, err)
+		}
+		return actor, nil, id, nil
+	}
+	return actor, object, id, nil
+}
+
+// ActivityActor returns the actor account of the given activity from the given db, and the object iri of the activity, along with
+// the activity's id. If the activity was delivered to us, its actor has to be the account that signed the delivery.
+func ActivityActor(ctx context.Context, db DB, activity typeutils.Activityable) (*model.Account, *url.URL, *url.URL, error) {
+	idProp := activity.GetJSONLDId()
+	if idProp == nil || !idProp.IsIRI() {
+		return nil, nil, nil, fmt.Errorf("%s had no id", activity.GetTypeName())
+	}
+	id := idProp.GetIRI()
+
+	actorIRI, err := typeutils.ExtractActor(activity)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error extracting actor of %s: %s", id, err)
+	}
+	objectIRI, err := typeutils.ExtractObject(activity)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error extracting object of %s: %s", id, err)
+	}
+	if err := checkSigner(ctx, actorIRI); err != nil {
+		return nil, nil, nil, fmt.Errorf("%s can't be accepted: %s", id, err)
+	}
+
+	actor, err := AccountForIRI(db, actorIRI)
+	if err != nil {
+		if _, ok := err.(ErrNoEntries); ok {
+			return nil, nil, nil, fmt.Errorf("actor %s of %s isn't an account we know about", actorIRI, id)
+		}
+		return nil, nil, nil, err
+	}
+	return actor, objectIRI, id, nil
+}
+
+// checkSigner returns an error if the request being handled with the given context was signed by an account other
+// than the one with the given uri. Contexts that aren't for a signed request, like when we're creating our own
+// activities, or storing statuses we've dereferenced ourselves, aren't checked.
+func checkSigner(ctx context.Context, uri *url.URL) error {
+	signer, ok := ctx.Value(CtxRequestingAccount).(*model.Account)
+	if !ok || signer == nil {
+		return nil
+	}
+	if signer.URI != uri.String() {
+		return fmt.Errorf("it's from %s but was delivered by %s", uri, signer.URI)
+	}
+	return nil
+}
+
+// checkOwner returns an error if the account with the given id, which owns something that's being changed through federation,
+// is one of our own accounts, or if it isn't the account that signed the request being handled with the given context.
+func (f *federatingDB) checkOwner(ctx context.Context, accountID string) error {
+	owner := &model.Account{}
+	if err := f.db.GetByID(accountID, owner); err != nil {
+		return fmt.Errorf("error getting owner %s: %s", accountID, err)
+	}
+	if owner.Domain == "" {
+		return fmt.Errorf("it belongs to local account %s", owner.URI)
+	}
+	ownerIRI, err := url.Parse(owner.URI)
+	if err != nil {
+		return fmt.Errorf("error parsing uri of owner %s: %s", owner.ID, err)
+	}
+	return checkSigner(ctx, ownerIRI)
+}
+
+// updateStatus updates the content of a remote status that we already have. The note has to be attributed to the author
+// of the status, and, if it was delivered to us, the update has to have been signed by the author.
+func (f *federatingDB) updateStatus(ctx context.Context, note typeutils.Statusable) error {
+	l := f.log.WithField("func", "updateStatus")
+
+	idProp := note.GetJSONLDId()
+	if idProp == nil || !idProp.IsIRI() {
+		return errors.New("note had no id")
+	}
+	uri := idProp.GetIRI().String()
+
+	status := &model.Status{}
+	if err := f.db.GetWhere("uri", uri, status); err != nil {
+		if _, ok := err.(ErrNoEntries); ok {
+			l.Debugf("status %s isn't one we know about", uri)
+			return nil
+		}
+		return fmt.Errorf("error getting status %s: %s", uri, err)
+	}
+	if status.Local {
+		// local statuses are only ever changed through the client api
+		return nil
+	}
+
+	author := &model.Account{}
+	if err := f.db.GetByID(status.AccountID, author); err != nil {
+		return fmt.Errorf("error getting author of status %s: %s", uri, err)
+	}
+	authorIRI, err := typeutils.ExtractAttributedTo(note)
+	if err != nil {
+		return fmt.Errorf("error extracting author of status %s: %s", uri, err)
+	}
+	if authorIRI.String() != author.URI {
+		return fmt.Errorf("update of status %s is attributed to %s, but the status is by %s", uri, authorIRI, author.URI)
+	}
+	if err := checkSigner(ctx, authorIRI); err != nil {
+		return fmt.Errorf("status %s can't be updated: %s", uri, err)
+	}
+	updated, err := typeutils.ASStatusToStatus(note, author)
+	if err != nil {
+		return fmt.Errorf("error converting note to status: %s", err)
+	}
+
+	status.Content = updated.Content
+	status.ContentWarning = updated.ContentWarning
+	status.URL = updated.URL
+	status.UpdatedAt = time.Now()
+	return f.db.UpdateByID(status.ID, status)
+}
+
+// updateAccount updates the profile of a remote account that we already have. If the update was delivered to us,
+// it has to have been signed by the account itself, since it may carry a new key.
+func (f *federatingDB) updateAccount(ctx context.Context, accountable typeutils.Accountable) error {
+	l := f.log.WithField("func", "updateAccount")
+
+	updated, err := typeutils.ASRepresentationToAccount(accountable)
+	if err != nil {
+		return fmt.Errorf("error converting to account: %s", err)
+	}
+	updatedIRI, err := url.Parse(updated.URI)
+	if err != nil {
+		return fmt.Errorf("error parsing account uri %s: %s", updated.URI, err)
+	}
+	if err := checkSigner(ctx, updatedIRI); err != nil {
+		return fmt.Errorf("account %s can't be updated: %s", updated.URI, err)
+	}
+
+	acct := &model.Account{}
+	if err := f.db.GetWhere("uri", updated.URI, acct); err != nil {
+		if _, ok := err.(ErrNoEntries); ok {
+			l.Debugf("account %s isn't one we know about", updated.URI)
+			return nil
+		}
+		return fmt.Errorf("error getting account %s: %s", updated.URI, err)
+	}
+	if acct.Domain == "" {
+		// local accounts are only ever changed through the client api
+		return nil
+	}
+
+	// an update is as good as fetching the account ourselves, and may carry a new key
+	if typeutils.UpdateRemoteAccount(acct, updated) {
+		l.Debugf("account %s has a new public key %s", acct.URI, acct.PublicKeyURI)
+	}
+	acct.UpdatedAt = time.Now()
+	acct.LastFetchedAt = acct.UpdatedAt
+	return f.db.UpdateByID(acct.ID, acct)
+}
+
+// updateCollection brings the follows in the database in line with the given followers or following collection.
+// Accounts that are in the collection but not yet followed/following are added, and those that aren't in
+// the collection any more are removed. Items of the collection that aren't known accounts are ignored.
+//
+// Only collections of remote accounts are updated this way, and, if the update was delivered to us, only by the owner
+// of the collection. The follows of our own accounts are only ever changed by Follow, Accept, Reject and Undo, so
+// they're never added or removed here, on either side of the follow.
+func (f *federatingDB) updateCollection(ctx context.Context, collection vocab.ActivityStreamsCollection) error {
+	l := f.log.WithField("func", "updateCollection")
+
+	idProp := collection.GetJSONLDId()
+	if idProp == nil || !idProp.IsIRI() {
+		return errors.New("collection had no id")
+	}
+	id := idProp.GetIRI().String()
+
+	// work out whose collection this is, and which kind
+	owner := &model.Account{}
+	follows := []model.Follow{}
+	var followers bool
+	if err := f.db.GetWhere("followers_url", id, owner); err == nil {
+		followers = true
+		if err := f.db.GetFollowersByAccountID(owner.ID, &follows); err != nil {
+			if _, ok := err.(ErrNoEntries); !ok {
+				return fmt.Errorf("error getting followers of account %s: %s", owner.ID, err)
+			}
+		}
+	} else if _, ok := err.(ErrNoEntries); !ok {
+		return err
+	} else if err := f.db.GetWhere("following_url", id, owner); err == nil {
+		if err := f.db.GetFollowingByAccountID(owner.ID, &follows); err != nil {
+			if _, ok := err.(ErrNoEntries); !ok {
+				return fmt.Errorf("error getting following of account %s: %s", owner.ID, err)
+			}
+		}
+	} else if _, ok := err.(ErrNoEntries); ok {
+		l.Debugf("collection %s isn't one we know about", id)
+		return nil
+	} else {
+		return err
+	}
+
+	if owner.Domain == "" {
+		l.Debugf("collection %s belongs to local account %s, not updating it", id, owner.URI)
+		return nil
+	}
+	ownerIRI, err := url.Parse(owner.URI)
+	if err != nil {
+		return fmt.Errorf("error parsing uri of account %s: %s", owner.ID, err)
+	}
+	if err := checkSigner(ctx, ownerIRI); err != nil {
+		return fmt.Errorf("collection %s can't be updated: %s", id, err)
+	}
+
+	// map the other side of each existing follow to the follow itself, leaving out our own accounts
+	existing := make(map[string]model.Follow, len(follows))
+	for _, follow := range follows {
+		otherID := follow.AccountID
+		if !followers {
+			otherID = follow.TargetAccountID
+		}
+		other := &model.Account{}
+		if err := f.db.GetByID(otherID, other); err != nil {
+			if _, ok := err.(ErrNoEntries); !ok {
+				return fmt.Errorf("error getting account %s: %s", otherID, err)
+			}
+		} else if other.Domain == "" {
+			continue
+		}
+		existing[otherID] = follow
+	}
+
+	if itemsProp := collection.GetActivityStreamsItems(); itemsProp != nil {
+		for iter := itemsProp.Begin(); iter != itemsProp.End(); iter = iter.Next() {
+			itemIRI, err := pub.ToId(iter)
+			if err != nil {
+				continue
+			}
+			acct, err := AccountForIRI(f.db, itemIRI)
+			if err != nil {
+				if _, ok := err.(ErrNoEntries); ok {
+					l.Debugf("item %s of collection %s isn't an account we know about", itemIRI, id)
+					continue
+				}
+				return fmt.Errorf("error getting account %s: %s", itemIRI, err)
+			}
+			if acct.Domain == "" {
+				l.Debugf("item %s of collection %s is a local account, not following or unfollowing it", itemIRI, id)
+				continue
+			}
+
+			if _, ok := existing[acct.ID]; ok {
+				delete(existing, acct.ID)
+				continue
+			}
+
+			follow := &model.Follow{
+				AccountID:       acct.ID,
+				TargetAccountID: owner.ID,
+			}
+			if !followers {
+				follow.AccountID = owner.ID
+				follow.TargetAccountID = acct.ID
+			}
+			if err := f.db.Put(follow); err != nil {
+				return fmt.Errorf("error putting follow: %s", err)
+			}
+		}
+	}
+
+	// whatever's left over isn't in the collection any more
+	for _, follow := range existing {
+		if err := f.db.DeleteByID(follow.ID, &model.Follow{}); err != nil {
+			return fmt.Errorf("error deleting follow %s: %s", follow.ID, err)
+		}
+	}
+	return nil
 }
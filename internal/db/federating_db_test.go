@@ -18,4 +18,668 @@
 
 package db
 
-// TODO: write tests for pgfed
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+type FederatingDBTestSuite struct {
+	suite.Suite
+	config        *config.Config
+	log           *logrus.Logger
+	localAccount  *model.Account
+	remoteAccount *model.Account
+	otherRemote   *model.Account
+	localStatus   *model.Status
+	remoteStatus  *model.Status
+	mockDB        *MockDB
+	federatingDB  pub.Database
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *FederatingDBTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	c := config.Empty()
+	c.Protocol = "http"
+	c.Host = "localhost:8080"
+	suite.config = c
+
+	suite.localAccount = &model.Account{
+		ID:           "2b6d3f1c-5d43-4c8b-9c8e-6f5d1c2b3a41",
+		Username:     "local_user",
+		URI:          "http://localhost:8080/users/local_user",
+		InboxURL:     "http://localhost:8080/users/local_user/inbox",
+		OutboxURL:    "http://localhost:8080/users/local_user/outbox",
+		FollowersURL: "http://localhost:8080/users/local_user/followers",
+		FollowingURL: "http://localhost:8080/users/local_user/following",
+	}
+	suite.remoteAccount = &model.Account{
+		ID:           "8a7c1e2d-3b4f-4e5a-8c9d-0e1f2a3b4c5d",
+		Username:     "remote_user",
+		Domain:       "example.org",
+		URI:          "https://example.org/users/remote_user",
+		InboxURL:     "https://example.org/users/remote_user/inbox",
+		FollowersURL: "https://example.org/users/remote_user/followers",
+	}
+	suite.otherRemote = &model.Account{
+		ID:       "3c2b1a09-8f7e-4d6c-9b5a-493827160f1e",
+		Username: "another_user",
+		Domain:   "another.example.org",
+		URI:      "https://another.example.org/users/another_user",
+	}
+	suite.localStatus = &model.Status{
+		ID:        "5e4d3c2b-1a09-4f8e-8d7c-6b5a49382716",
+		URI:       "http://localhost:8080/users/local_user/statuses/5e4d3c2b-1a09-4f8e-8d7c-6b5a49382716",
+		AccountID: suite.localAccount.ID,
+		Local:     true,
+	}
+	suite.remoteStatus = &model.Status{
+		ID:        "9f8e7d6c-5b4a-4392-8170-6f5e4d3c2b1a",
+		URI:       "https://example.org/users/remote_user/statuses/9",
+		AccountID: suite.remoteAccount.ID,
+	}
+}
+
+// SetupTest creates a fresh mock db and federating db for each test. The mock db knows about
+// the local and remote accounts and statuses by uri, but nothing else.
+func (suite *FederatingDBTestSuite) SetupTest() {
+	suite.mockDB = &MockDB{}
+	suite.expectByURI(suite.localAccount.URI, suite.localAccount)
+	suite.expectByURI(suite.remoteAccount.URI, suite.remoteAccount)
+	suite.expectByURI(suite.otherRemote.URI, suite.otherRemote)
+	suite.expectByURI(suite.localStatus.URI, suite.localStatus)
+	suite.expectByURI(suite.remoteStatus.URI, suite.remoteStatus)
+	suite.mockDB.On("GetWhere", "uri", mock.AnythingOfType("string"), mock.Anything).Return(ErrNoEntries{})
+	suite.mockDB.On("GetWhere", "inbox_url", suite.localAccount.InboxURL, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*model.Account) = *suite.localAccount
+	})
+	suite.mockDB.On("GetWhere", "followers_url", suite.localAccount.FollowersURL, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*model.Account) = *suite.localAccount
+	})
+	suite.mockDB.On("GetByID", suite.remoteAccount.ID, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*model.Account) = *suite.remoteAccount
+	})
+	suite.mockDB.On("Put", mock.Anything).Return(nil)
+	// the remote account doesn't follow anyone and isn't mentioned anywhere, so it can only interact with statuses that everyone can
+	suite.mockDB.On("StatusInteractionAllowed", mock.AnythingOfType("*model.Status"), mock.AnythingOfType("*model.Account"), mock.AnythingOfType("model.Interaction")).Return(func(s *model.Status, a *model.Account, i model.Interaction) bool {
+		return s.InteractionPolicy.ScopeOf(i) == model.InteractionEveryone
+	}, nil)
+
+	suite.federatingDB = newFederatingDB(suite.mockDB, suite.config, suite.log.WithField("service", "db"))
+}
+
+// expectByURI makes the mock db return the given model when it's looked up by the given uri
+func (suite *FederatingDBTestSuite) expectByURI(uri string, i interface{}) {
+	switch entry := i.(type) {
+	case *model.Account:
+		suite.mockDB.On("GetWhere", "uri", uri, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(2).(*model.Account) = *entry
+		})
+	case *model.Status:
+		suite.mockDB.On("GetWhere", "uri", uri, mock.AnythingOfType("*model.Status")).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(2).(*model.Status) = *entry
+		})
+	}
+}
+
+// signedBy returns a context for handling a request signed by the given account
+func (suite *FederatingDBTestSuite) signedBy(account *model.Account) context.Context {
+	return context.WithValue(context.Background(), CtxRequestingAccount, account)
+}
+
+// toType converts the given json into an activitystreams type
+func (suite *FederatingDBTestSuite) toType(j string) vocab.Type {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(j), &m); err != nil {
+		suite.FailNow(err.Error())
+	}
+	t, err := streams.ToType(context.Background(), m)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	return t
+}
+
+// putCalls returns the arguments of all calls to Put on the mock db
+func (suite *FederatingDBTestSuite) putCalls() []interface{} {
+	puts := []interface{}{}
+	for _, call := range suite.mockDB.Calls {
+		if call.Method == "Put" {
+			puts = append(puts, call.Arguments.Get(0))
+		}
+	}
+	return puts
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *FederatingDBTestSuite) TestCreateFollow() {
+	suite.mockDB.On("GetFollowRequestsForAccountID", suite.remoteAccount.ID, mock.AnythingOfType("*[]model.FollowRequest")).Return(ErrNoEntries{})
+
+	follow := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "http://localhost:8080/users/local_user/follow/1",
+		"type": "Follow",
+		"actor": "http://localhost:8080/users/local_user",
+		"object": "https://example.org/users/remote_user"
+	}`)
+	err := suite.federatingDB.Create(context.Background(), follow)
+	assert.NoError(suite.T(), err)
+
+	// our follow is pending until the remote account accepts it
+	puts := suite.putCalls()
+	if assert.Len(suite.T(), puts, 1) {
+		assert.Equal(suite.T(), &model.FollowRequest{
+			AccountID:       suite.localAccount.ID,
+			TargetAccountID: suite.remoteAccount.ID,
+			URI:             "http://localhost:8080/users/local_user/follow/1",
+		}, puts[0])
+	}
+}
+
+func (suite *FederatingDBTestSuite) TestCreateFollowFromRemote() {
+	follow := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/follows/1",
+		"type": "Follow",
+		"actor": "https://example.org/users/remote_user",
+		"object": "http://localhost:8080/users/local_user"
+	}`)
+	err := suite.federatingDB.Create(context.Background(), follow)
+	assert.NoError(suite.T(), err)
+
+	// incoming follows are dealt with by the federating callbacks, not here
+	assert.Empty(suite.T(), suite.putCalls())
+}
+
+func (suite *FederatingDBTestSuite) TestCreateFollowUnknownTarget() {
+	follow := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "http://localhost:8080/users/local_user/follow/1",
+		"type": "Follow",
+		"actor": "http://localhost:8080/users/local_user",
+		"object": "https://somewhere.else/users/someone"
+	}`)
+	err := suite.federatingDB.Create(context.Background(), follow)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), suite.putCalls())
+}
+
+func (suite *FederatingDBTestSuite) TestCreateNote() {
+	note := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/users/remote_user/statuses/1",
+		"type": "Note",
+		"attributedTo": "https://example.org/users/remote_user",
+		"inReplyTo": "http://localhost:8080/users/local_user/statuses/5e4d3c2b-1a09-4f8e-8d7c-6b5a49382716",
+		"content": "<p>hello</p>",
+		"summary": "greetings",
+		"published": "2021-04-01T12:00:00Z",
+		"to": ["https://www.w3.org/ns/activitystreams#Public"],
+		"cc": ["https://example.org/users/remote_user/followers"]
+	}`)
+	err := suite.federatingDB.Create(suite.signedBy(suite.remoteAccount), note)
+	assert.NoError(suite.T(), err)
+
+	puts := suite.putCalls()
+	if assert.Len(suite.T(), puts, 1) {
+		status, ok := puts[0].(*model.Status)
+		if assert.True(suite.T(), ok) {
+			assert.Equal(suite.T(), "https://example.org/users/remote_user/statuses/1", status.URI)
+			assert.Equal(suite.T(), "<p>hello</p>", status.Content)
+			assert.Equal(suite.T(), "greetings", status.ContentWarning)
+			assert.Equal(suite.T(), suite.remoteAccount.ID, status.AccountID)
+			assert.Equal(suite.T(), suite.localStatus.ID, status.InReplyToID)
+			assert.False(suite.T(), status.Local)
+			assert.True(suite.T(), status.Visibility.Public)
+			assert.Equal(suite.T(), 2021, status.CreatedAt.Year())
+		}
+	}
+}
+
+func (suite *FederatingDBTestSuite) TestCreateDirectNoteWithMentionsAndAttachments() {
+	note := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/users/remote_user/statuses/2",
+		"type": "Note",
+		"attributedTo": "https://example.org/users/remote_user",
+		"content": "<p>hey @local_user, look at this</p>",
+		"to": ["http://localhost:8080/users/local_user"],
+		"tag": [
+			{"type": "Mention", "href": "http://localhost:8080/users/local_user", "name": "@local_user@localhost:8080"},
+			{"type": "Mention", "href": "https://somewhere.else/users/someone", "name": "@someone@somewhere.else"}
+		],
+		"attachment": [
+			{"type": "Document", "mediaType": "image/png", "url": "https://example.org/media/1.png", "name": "a picture"},
+			{"type": "Document", "mediaType": "application/pdf", "url": "https://example.org/media/2.pdf"}
+		]
+	}`)
+	err := suite.federatingDB.Create(context.Background(), note)
+	assert.NoError(suite.T(), err)
+
+	// we should have the status, the mention of the local account, and the image: the mention of an account
+	// we don't know and the attachment we can't do anything with are skipped
+	puts := suite.putCalls()
+	if !assert.Len(suite.T(), puts, 3) {
+		return
+	}
+
+	status, ok := puts[0].(*model.Status)
+	if !assert.True(suite.T(), ok) {
+		return
+	}
+	assert.NotEmpty(suite.T(), status.ID)
+	assert.Equal(suite.T(), &model.Visibility{Direct: true}, status.Visibility)
+
+	assert.Equal(suite.T(), &model.Mention{
+		StatusID:        status.ID,
+		OriginAccountID: suite.remoteAccount.ID,
+		TargetAccountID: suite.localAccount.ID,
+	}, puts[1])
+
+	attachment, ok := puts[2].(*model.MediaAttachment)
+	if assert.True(suite.T(), ok) {
+		assert.Equal(suite.T(), status.ID, attachment.StatusID)
+		assert.Equal(suite.T(), suite.remoteAccount.ID, attachment.AccountID)
+		assert.Equal(suite.T(), "https://example.org/media/1.png", attachment.RemoteURL)
+		assert.Equal(suite.T(), "a picture", attachment.Description)
+		assert.Equal(suite.T(), model.FileTypeImage, attachment.Type)
+		assert.Equal(suite.T(), model.ProcessingStatusReceived, attachment.Processing)
+	}
+}
+
+func (suite *FederatingDBTestSuite) TestCreateNoteAlreadyExists() {
+	note := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "http://localhost:8080/users/local_user/statuses/5e4d3c2b-1a09-4f8e-8d7c-6b5a49382716",
+		"type": "Note",
+		"attributedTo": "http://localhost:8080/users/local_user",
+		"content": "hello"
+	}`)
+	err := suite.federatingDB.Create(context.Background(), note)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), suite.putCalls())
+}
+
+func (suite *FederatingDBTestSuite) TestCreateLike() {
+	suite.mockDB.On("GetWhere", "account_id", suite.remoteAccount.ID, mock.AnythingOfType("*[]model.StatusFave")).Return(nil)
+
+	like := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/likes/1",
+		"type": "Like",
+		"actor": "https://example.org/users/remote_user",
+		"object": "http://localhost:8080/users/local_user/statuses/5e4d3c2b-1a09-4f8e-8d7c-6b5a49382716"
+	}`)
+	err := suite.federatingDB.Create(context.Background(), like)
+	assert.NoError(suite.T(), err)
+
+	puts := suite.putCalls()
+	if assert.Len(suite.T(), puts, 1) {
+		assert.Equal(suite.T(), &model.StatusFave{
+			AccountID:       suite.remoteAccount.ID,
+			TargetAccountID: suite.localAccount.ID,
+			StatusID:        suite.localStatus.ID,
+			URI:             "https://example.org/likes/1",
+		}, puts[0])
+	}
+}
+
+func (suite *FederatingDBTestSuite) TestCreateAnnounce() {
+	announce := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/users/remote_user/statuses/2/activity",
+		"type": "Announce",
+		"actor": "https://example.org/users/remote_user",
+		"object": "http://localhost:8080/users/local_user/statuses/5e4d3c2b-1a09-4f8e-8d7c-6b5a49382716",
+		"to": ["https://www.w3.org/ns/activitystreams#Public"]
+	}`)
+	err := suite.federatingDB.Create(context.Background(), announce)
+	assert.NoError(suite.T(), err)
+
+	puts := suite.putCalls()
+	if assert.Len(suite.T(), puts, 1) {
+		boost, ok := puts[0].(*model.Status)
+		if assert.True(suite.T(), ok) {
+			assert.Equal(suite.T(), "https://example.org/users/remote_user/statuses/2/activity", boost.URI)
+			assert.Equal(suite.T(), suite.remoteAccount.ID, boost.AccountID)
+			assert.Equal(suite.T(), suite.localStatus.ID, boost.BoostOfID)
+		}
+	}
+}
+
+func (suite *FederatingDBTestSuite) TestInteractionsNotAllowed() {
+	suite.localStatus.InteractionPolicy = &model.InteractionPolicy{
+		CanBoost: model.InteractionFollowers,
+		CanReply: model.InteractionMutuals,
+		CanLike:  model.InteractionMentioned,
+	}
+	defer func() { suite.localStatus.InteractionPolicy = nil }()
+	suite.mockDB.On("GetWhere", "account_id", suite.remoteAccount.ID, mock.AnythingOfType("*[]model.StatusFave")).Return(nil)
+
+	for _, j := range []string{`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/users/remote_user/statuses/3",
+		"type": "Note",
+		"attributedTo": "https://example.org/users/remote_user",
+		"inReplyTo": "http://localhost:8080/users/local_user/statuses/5e4d3c2b-1a09-4f8e-8d7c-6b5a49382716",
+		"content": "<p>hello</p>",
+		"to": ["https://www.w3.org/ns/activitystreams#Public"]
+	}`, `{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/likes/2",
+		"type": "Like",
+		"actor": "https://example.org/users/remote_user",
+		"object": "http://localhost:8080/users/local_user/statuses/5e4d3c2b-1a09-4f8e-8d7c-6b5a49382716"
+	}`, `{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/users/remote_user/statuses/4/activity",
+		"type": "Announce",
+		"actor": "https://example.org/users/remote_user",
+		"object": "http://localhost:8080/users/local_user/statuses/5e4d3c2b-1a09-4f8e-8d7c-6b5a49382716",
+		"to": ["https://www.w3.org/ns/activitystreams#Public"]
+	}`} {
+		err := suite.federatingDB.Create(context.Background(), suite.toType(j))
+		assert.NoError(suite.T(), err)
+	}
+	assert.Empty(suite.T(), suite.putCalls())
+}
+
+func (suite *FederatingDBTestSuite) TestCreateFromSomeoneElse() {
+	suite.mockDB.On("GetWhere", "account_id", suite.remoteAccount.ID, mock.AnythingOfType("*[]model.StatusFave")).Return(nil)
+	impostor := &model.Account{ID: "3c4d5e6f-7a8b-4c9d-8e0f-1a2b3c4d5e6f", URI: "https://evil.example/users/impostor"}
+
+	for name, j := range map[string]string{
+		"create": `{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"id": "https://example.org/users/remote_user/statuses/5/activity",
+			"type": "Create",
+			"actor": "https://example.org/users/remote_user",
+			"object": "https://example.org/users/remote_user/statuses/5"
+		}`,
+		"note": `{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"id": "https://example.org/users/remote_user/statuses/5",
+			"type": "Note",
+			"attributedTo": "https://example.org/users/remote_user",
+			"content": "<p>not from me</p>",
+			"to": ["https://www.w3.org/ns/activitystreams#Public"]
+		}`,
+		"like": `{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"id": "https://example.org/likes/3",
+			"type": "Like",
+			"actor": "https://example.org/users/remote_user",
+			"object": "http://localhost:8080/users/local_user/statuses/5e4d3c2b-1a09-4f8e-8d7c-6b5a49382716"
+		}`,
+		"announce": `{
+			"@context": "https://www.w3.org/ns/activitystreams",
+			"id": "https://example.org/users/remote_user/statuses/6/activity",
+			"type": "Announce",
+			"actor": "https://example.org/users/remote_user",
+			"object": "http://localhost:8080/users/local_user/statuses/5e4d3c2b-1a09-4f8e-8d7c-6b5a49382716",
+			"to": ["https://www.w3.org/ns/activitystreams#Public"]
+		}`,
+	} {
+		err := suite.federatingDB.Create(suite.signedBy(impostor), suite.toType(j))
+		assert.Error(suite.T(), err, name)
+	}
+	assert.Empty(suite.T(), suite.putCalls())
+}
+
+func (suite *FederatingDBTestSuite) TestCreateNoteAttributedToLocalAccount() {
+	note := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/users/remote_user/statuses/7",
+		"type": "Note",
+		"attributedTo": "http://localhost:8080/users/local_user",
+		"content": "<p>i'm totally local_user</p>",
+		"to": ["https://www.w3.org/ns/activitystreams#Public"]
+	}`)
+	err := suite.federatingDB.Create(suite.signedBy(suite.remoteAccount), note)
+	assert.Error(suite.T(), err)
+	assert.Empty(suite.T(), suite.putCalls())
+}
+
+func (suite *FederatingDBTestSuite) TestCreateNoteAttributedToOtherServer() {
+	// even a status we dereferenced ourselves has to come from the server its author is on
+	note := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://evil.example/statuses/8",
+		"type": "Note",
+		"attributedTo": "https://example.org/users/remote_user",
+		"content": "<p>hello</p>",
+		"to": ["https://www.w3.org/ns/activitystreams#Public"]
+	}`)
+	err := suite.federatingDB.Create(context.Background(), note)
+	assert.Error(suite.T(), err)
+	assert.Empty(suite.T(), suite.putCalls())
+}
+
+func (suite *FederatingDBTestSuite) TestCreateLikeSignedByActor() {
+	suite.mockDB.On("GetWhere", "account_id", suite.remoteAccount.ID, mock.AnythingOfType("*[]model.StatusFave")).Return(nil)
+
+	like := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/likes/4",
+		"type": "Like",
+		"actor": "https://example.org/users/remote_user",
+		"object": "http://localhost:8080/users/local_user/statuses/5e4d3c2b-1a09-4f8e-8d7c-6b5a49382716"
+	}`)
+	err := suite.federatingDB.Create(suite.signedBy(suite.remoteAccount), like)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), suite.putCalls(), 1)
+}
+
+func (suite *FederatingDBTestSuite) TestDeleteStatus() {
+	suite.mockDB.On("DeleteWhere", mock.AnythingOfType("string"), suite.remoteStatus.ID, mock.Anything).Return(nil)
+	suite.mockDB.On("DeleteByID", suite.remoteStatus.ID, mock.AnythingOfType("*model.Status")).Return(nil)
+
+	err := suite.federatingDB.Delete(suite.signedBy(suite.remoteAccount), testURL(suite.remoteStatus.URI))
+	assert.NoError(suite.T(), err)
+	suite.mockDB.AssertCalled(suite.T(), "DeleteByID", suite.remoteStatus.ID, mock.AnythingOfType("*model.Status"))
+}
+
+func (suite *FederatingDBTestSuite) TestDeleteStatusOfSomeoneElse() {
+	impostor := &model.Account{ID: "3c4d5e6f-7a8b-4c9d-8e0f-1a2b3c4d5e6f", URI: "https://evil.example/users/impostor"}
+
+	err := suite.federatingDB.Delete(suite.signedBy(impostor), testURL(suite.remoteStatus.URI))
+	assert.Error(suite.T(), err)
+
+	// our own statuses can't be deleted through federation at all
+	err = suite.federatingDB.Delete(suite.signedBy(suite.remoteAccount), testURL(suite.localStatus.URI))
+	assert.Error(suite.T(), err)
+
+	suite.mockDB.AssertNotCalled(suite.T(), "DeleteByID", mock.Anything, mock.Anything)
+	suite.mockDB.AssertNotCalled(suite.T(), "DeleteWhere", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *FederatingDBTestSuite) TestUpdateStatusFromSomeoneElse() {
+	impostor := &model.Account{ID: "3c4d5e6f-7a8b-4c9d-8e0f-1a2b3c4d5e6f", URI: "https://evil.example/users/impostor"}
+	note := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/users/remote_user/statuses/9",
+		"type": "Note",
+		"attributedTo": "https://example.org/users/remote_user",
+		"content": "<p>not what i said</p>",
+		"to": ["https://www.w3.org/ns/activitystreams#Public"]
+	}`)
+	err := suite.federatingDB.Update(suite.signedBy(impostor), note)
+	assert.Error(suite.T(), err)
+	suite.mockDB.AssertNotCalled(suite.T(), "UpdateByID", mock.Anything, mock.Anything)
+}
+
+func (suite *FederatingDBTestSuite) TestExists() {
+	exists, err := suite.federatingDB.Exists(context.Background(), testURL(suite.localStatus.URI))
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), exists)
+
+	exists, err = suite.federatingDB.InboxContains(context.Background(), testURL(suite.localAccount.InboxURL), testURL("https://example.org/some/activity"))
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), exists)
+}
+
+func (suite *FederatingDBTestSuite) TestActorForInboxUsesConfiguredProtocol() {
+	// go-fed always builds inbox iris with https, but we're running on http
+	actor, err := suite.federatingDB.ActorForInbox(context.Background(), testURL("https://localhost:8080/users/local_user/inbox"))
+	if assert.NoError(suite.T(), err) {
+		assert.Equal(suite.T(), suite.localAccount.URI, actor.String())
+	}
+
+	outbox, err := suite.federatingDB.OutboxForInbox(context.Background(), testURL("https://localhost:8080/users/local_user/inbox"))
+	if assert.NoError(suite.T(), err) {
+		assert.Equal(suite.T(), suite.localAccount.OutboxURL, outbox.String())
+	}
+}
+
+func (suite *FederatingDBTestSuite) TestFollowersCollection() {
+	suite.mockDB.On("GetFollowersByAccountID", suite.localAccount.ID, mock.AnythingOfType("*[]model.Follow")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*[]model.Follow) = []model.Follow{{ID: "some-follow", AccountID: suite.remoteAccount.ID, TargetAccountID: suite.localAccount.ID}}
+	})
+
+	followers, err := suite.federatingDB.Followers(context.Background(), testURL(suite.localAccount.URI))
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	assert.Equal(suite.T(), suite.localAccount.FollowersURL, followers.GetJSONLDId().GetIRI().String())
+	if assert.Equal(suite.T(), 1, followers.GetActivityStreamsItems().Len()) {
+		assert.Equal(suite.T(), suite.remoteAccount.URI, followers.GetActivityStreamsItems().At(0).GetIRI().String())
+	}
+}
+
+func (suite *FederatingDBTestSuite) TestUpdateFollowersCollection() {
+	// the remote account is currently followed by an account that's gone, which isn't in the updated collection
+	suite.mockDB.On("GetWhere", "followers_url", suite.remoteAccount.FollowersURL, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*model.Account) = *suite.remoteAccount
+	})
+	suite.mockDB.On("GetFollowersByAccountID", suite.remoteAccount.ID, mock.AnythingOfType("*[]model.Follow")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*[]model.Follow) = []model.Follow{{ID: "stale-follow", AccountID: "some-other-account", TargetAccountID: suite.remoteAccount.ID}}
+	})
+	suite.mockDB.On("GetByID", "some-other-account", mock.AnythingOfType("*model.Account")).Return(ErrNoEntries{})
+	suite.mockDB.On("DeleteByID", "stale-follow", mock.AnythingOfType("*model.Follow")).Return(nil)
+
+	followers := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/users/remote_user/followers",
+		"type": "Collection",
+		"items": ["https://another.example.org/users/another_user", "https://unknown.example/users/nobody"]
+	}`)
+	err := suite.federatingDB.Update(suite.signedBy(suite.remoteAccount), followers)
+	assert.NoError(suite.T(), err)
+
+	puts := suite.putCalls()
+	if assert.Len(suite.T(), puts, 1) {
+		assert.Equal(suite.T(), &model.Follow{
+			AccountID:       suite.otherRemote.ID,
+			TargetAccountID: suite.remoteAccount.ID,
+		}, puts[0])
+	}
+	suite.mockDB.AssertCalled(suite.T(), "DeleteByID", "stale-follow", mock.AnythingOfType("*model.Follow"))
+}
+
+func (suite *FederatingDBTestSuite) TestUpdateFollowersCollectionWithLocalAccounts() {
+	otherLocal := &model.Account{
+		ID:       "6d5c4b3a-2918-4f7e-a6d5-c4b3a2918f7e",
+		Username: "other_local_user",
+		URI:      "http://localhost:8080/users/other_local_user",
+	}
+	suite.mockDB.On("GetByID", otherLocal.ID, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*model.Account) = *otherLocal
+	})
+
+	// another local account really follows the remote account, but the remote account leaves it out of its followers,
+	// and claims to be followed by the local account instead
+	suite.mockDB.On("GetWhere", "followers_url", suite.remoteAccount.FollowersURL, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*model.Account) = *suite.remoteAccount
+	})
+	suite.mockDB.On("GetFollowersByAccountID", suite.remoteAccount.ID, mock.AnythingOfType("*[]model.Follow")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*[]model.Follow) = []model.Follow{{ID: "local-follow", AccountID: otherLocal.ID, TargetAccountID: suite.remoteAccount.ID}}
+	})
+
+	followers := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/users/remote_user/followers",
+		"type": "Collection",
+		"items": ["http://localhost:8080/users/local_user"]
+	}`)
+	err := suite.federatingDB.Update(suite.signedBy(suite.remoteAccount), followers)
+	assert.NoError(suite.T(), err)
+
+	// the follows of local accounts only change through follow, accept and undo
+	assert.Empty(suite.T(), suite.putCalls())
+	suite.mockDB.AssertNotCalled(suite.T(), "DeleteByID", mock.Anything, mock.Anything)
+}
+
+func (suite *FederatingDBTestSuite) TestUpdateLocalFollowersCollection() {
+	suite.mockDB.On("GetFollowersByAccountID", suite.localAccount.ID, mock.AnythingOfType("*[]model.Follow")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*[]model.Follow) = []model.Follow{{ID: "some-follow", AccountID: "some-other-account", TargetAccountID: suite.localAccount.ID}}
+	})
+
+	followers := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "http://localhost:8080/users/local_user/followers",
+		"type": "Collection",
+		"items": ["https://example.org/users/remote_user"]
+	}`)
+	err := suite.federatingDB.Update(suite.signedBy(suite.remoteAccount), followers)
+	assert.NoError(suite.T(), err)
+	assert.Empty(suite.T(), suite.putCalls())
+	suite.mockDB.AssertNotCalled(suite.T(), "DeleteByID", mock.Anything, mock.Anything)
+}
+
+func (suite *FederatingDBTestSuite) TestNewID() {
+	note := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"type": "Note",
+		"attributedTo": "http://localhost:8080/users/local_user",
+		"content": "hello"
+	}`)
+	id, err := suite.federatingDB.NewID(context.Background(), note)
+	if assert.NoError(suite.T(), err) {
+		assert.Regexp(suite.T(), `^http://localhost:8080/users/local_user/statuses/[0-9a-f-]{36}$`, id.String())
+	}
+
+	follow := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"type": "Follow",
+		"actor": "http://localhost:8080/users/local_user",
+		"object": "https://example.org/users/remote_user"
+	}`)
+	id, err = suite.federatingDB.NewID(context.Background(), follow)
+	if assert.NoError(suite.T(), err) {
+		assert.Regexp(suite.T(), `^http://localhost:8080/users/local_user/follow/[0-9a-f-]{36}$`, id.String())
+	}
+}
+
+func testURL(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func TestFederatingDBTestSuite(t *testing.T) {
+	suite.Run(t, new(FederatingDBTestSuite))
+}
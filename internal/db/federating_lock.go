@@ -0,0 +1,85 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"errors"
+	"sync"
+)
+
+// lockTable hands out one mutex per key, for fine-grained locking of IRIs by the federatingDB.
+// Each entry counts the callers currently holding or waiting on its mutex, and is removed from
+// the table as soon as that count drops to zero, so the table only ever holds keys that are in use.
+type lockTable struct {
+	mu    sync.Mutex
+	locks map[string]*refLock
+}
+
+// refLock is a mutex along with the number of callers holding or waiting on it.
+// refs is guarded by the mutex of the lockTable that the refLock belongs to.
+type refLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func newLockTable() *lockTable {
+	return &lockTable{
+		locks: make(map[string]*refLock),
+	}
+}
+
+// lock blocks until the mutex for the given key is held by the caller.
+func (t *lockTable) lock(key string) {
+	t.mu.Lock()
+	l, ok := t.locks[key]
+	if !ok {
+		l = &refLock{}
+		t.locks[key] = l
+	}
+	l.refs++
+	t.mu.Unlock()
+
+	l.mu.Lock()
+}
+
+// unlock releases the mutex for the given key, removing it from the table if nobody else is waiting for it.
+// An error is returned if the key isn't locked.
+func (t *lockTable) unlock(key string) error {
+	t.mu.Lock()
+	l, ok := t.locks[key]
+	if !ok {
+		t.mu.Unlock()
+		return errors.New("missing an id in unlock")
+	}
+	l.refs--
+	if l.refs == 0 {
+		delete(t.locks, key)
+	}
+	t.mu.Unlock()
+
+	l.mu.Unlock()
+	return nil
+}
+
+// len returns the number of keys currently held or waited on.
+func (t *lockTable) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.locks)
+}
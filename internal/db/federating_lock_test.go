@@ -0,0 +1,160 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+)
+
+type FederatingLockTestSuite struct {
+	suite.Suite
+	federatingDB *federatingDB
+}
+
+// SetupTest creates a fresh federatingDB for each test; the locks don't touch the underlying db so it can be a bare mock
+func (suite *FederatingLockTestSuite) SetupTest() {
+	suite.federatingDB = &federatingDB{
+		locks:  newLockTable(),
+		db:     &MockDB{},
+		config: config.Empty(),
+	}
+}
+
+// TestConcurrentInboxDelivery simulates lots of activities being delivered to a handful of inboxes at once,
+// locking the activity and then the inbox the same way go-fed does. Run with -race to check the locking.
+func (suite *FederatingLockTestSuite) TestConcurrentInboxDelivery() {
+	ctx := context.Background()
+	const (
+		inboxCount    = 4
+		deliveryCount = 500
+	)
+
+	inboxes := make([]*url.URL, inboxCount)
+	delivered := make([]int, inboxCount) // deliberately unsynchronized, only the inbox locks protect these
+	for i := range inboxes {
+		inboxes[i] = testURL(fmt.Sprintf("http://localhost:8080/users/user_%d/inbox", i))
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < deliveryCount; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			activity := testURL(fmt.Sprintf("https://example.org/activities/%d", i))
+			inbox := i % inboxCount
+
+			assert.NoError(suite.T(), suite.federatingDB.Lock(ctx, activity))
+			assert.NoError(suite.T(), suite.federatingDB.Lock(ctx, inboxes[inbox]))
+			delivered[inbox]++
+			assert.NoError(suite.T(), suite.federatingDB.Unlock(ctx, inboxes[inbox]))
+			assert.NoError(suite.T(), suite.federatingDB.Unlock(ctx, activity))
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range delivered {
+		assert.Equal(suite.T(), deliveryCount/inboxCount, delivered[i])
+	}
+	// nobody holds or waits on anything any more, so the table should be empty
+	assert.Equal(suite.T(), 0, suite.federatingDB.locks.len())
+}
+
+func (suite *FederatingLockTestSuite) TestLockExcludes() {
+	ctx := context.Background()
+	iri := testURL("https://example.org/some/thing")
+
+	assert.NoError(suite.T(), suite.federatingDB.Lock(ctx, iri))
+
+	acquired := make(chan struct{})
+	go func() {
+		suite.federatingDB.Lock(ctx, iri)
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		suite.FailNow("second lock was acquired while the first was still held")
+	default:
+	}
+
+	assert.NoError(suite.T(), suite.federatingDB.Unlock(ctx, iri))
+	<-acquired
+	assert.Equal(suite.T(), 1, suite.federatingDB.locks.len())
+	assert.NoError(suite.T(), suite.federatingDB.Unlock(ctx, iri))
+	assert.Equal(suite.T(), 0, suite.federatingDB.locks.len())
+}
+
+func (suite *FederatingLockTestSuite) TestUnlockWithoutLock() {
+	err := suite.federatingDB.Unlock(context.Background(), testURL("https://example.org/never/locked"))
+	assert.Error(suite.T(), err)
+}
+
+func TestFederatingLockTestSuite(t *testing.T) {
+	suite.Run(t, new(FederatingLockTestSuite))
+}
+
+// BenchmarkFederatingDBLockUnique locks and unlocks a new iri every time, which is what happens as new activities
+// come in. The entries metric should stay at zero: the table shouldn't grow with the number of iris it's seen.
+func BenchmarkFederatingDBLockUnique(b *testing.B) {
+	ctx := context.Background()
+	f := &federatingDB{locks: newLockTable()}
+	iris := make([]*url.URL, b.N)
+	for i := range iris {
+		iris[i] = testURL(fmt.Sprintf("https://example.org/activities/%d", i))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Lock(ctx, iris[i])
+		f.Unlock(ctx, iris[i])
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(f.locks.len()), "entries")
+}
+
+// BenchmarkFederatingDBLockContended has many goroutines fighting over the same few inbox iris.
+func BenchmarkFederatingDBLockContended(b *testing.B) {
+	ctx := context.Background()
+	f := &federatingDB{locks: newLockTable()}
+	inboxes := make([]*url.URL, 4)
+	for i := range inboxes {
+		inboxes[i] = testURL(fmt.Sprintf("http://localhost:8080/users/user_%d/inbox", i))
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			inbox := inboxes[i%len(inboxes)]
+			f.Lock(ctx, inbox)
+			f.Unlock(ctx, inbox)
+			i++
+		}
+	})
+	b.StopTimer()
+	b.ReportMetric(float64(f.locks.len()), "entries")
+}
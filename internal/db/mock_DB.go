@@ -13,6 +13,8 @@ import (
 	net "net"
 
 	pub "github.com/go-fed/activity/pub"
+
+	time "time"
 )
 
 // MockDB is an autogenerated mock type for the DB type
@@ -20,6 +22,29 @@ type MockDB struct {
 	mock.Mock
 }
 
+// AccountToMastoPublic provides a mock function with given fields: account
+func (_m *MockDB) AccountToMastoPublic(account *model.Account) (*mastotypes.Account, error) {
+	ret := _m.Called(account)
+
+	var r0 *mastotypes.Account
+	if rf, ok := ret.Get(0).(func(*model.Account) *mastotypes.Account); ok {
+		r0 = rf(account)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*mastotypes.Account)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*model.Account) error); ok {
+		r1 = rf(account)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // AccountToMastoSensitive provides a mock function with given fields: account
 func (_m *MockDB) AccountToMastoSensitive(account *model.Account) (*mastotypes.Account, error) {
 	ret := _m.Called(account)
@@ -43,6 +68,27 @@ func (_m *MockDB) AccountToMastoSensitive(account *model.Account) (*mastotypes.A
 	return r0, r1
 }
 
+// CountLocalInteractionsWithDomain provides a mock function with given fields: domain, i
+func (_m *MockDB) CountLocalInteractionsWithDomain(domain string, i interface{}) (int, error) {
+	ret := _m.Called(domain, i)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(string, interface{}) int); ok {
+		r0 = rf(domain, i)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, interface{}) error); ok {
+		r1 = rf(domain, i)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // CreateTable provides a mock function with given fields: i
 func (_m *MockDB) CreateTable(i interface{}) error {
 	ret := _m.Called(i)
@@ -129,6 +175,20 @@ func (_m *MockDB) GetAccountByUserID(userID string, account *model.Account) erro
 	return r0
 }
 
+// GetAccountsToPurge provides a mock function with given fields: limit, accounts
+func (_m *MockDB) GetAccountsToPurge(limit int, accounts *[]model.Account) error {
+	ret := _m.Called(limit, accounts)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(int, *[]model.Account) error); ok {
+		r0 = rf(limit, accounts)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // GetAll provides a mock function with given fields: i
 func (_m *MockDB) GetAll(i interface{}) error {
 	ret := _m.Called(i)
@@ -143,6 +203,20 @@ func (_m *MockDB) GetAll(i interface{}) error {
 	return r0
 }
 
+// GetAvatarForAccountID provides a mock function with given fields: avatar, accountID
+func (_m *MockDB) GetAvatarForAccountID(avatar *model.MediaAttachment, accountID string) error {
+	ret := _m.Called(avatar, accountID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*model.MediaAttachment, string) error); ok {
+		r0 = rf(avatar, accountID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // GetByID provides a mock function with given fields: id, i
 func (_m *MockDB) GetByID(id string, i interface{}) error {
 	ret := _m.Called(id, i)
@@ -157,6 +231,34 @@ func (_m *MockDB) GetByID(id string, i interface{}) error {
 	return r0
 }
 
+// GetDueDeliveries provides a mock function with given fields: before, limit, deliveries
+func (_m *MockDB) GetDueDeliveries(before time.Time, limit int, deliveries *[]model.Delivery) error {
+	ret := _m.Called(before, limit, deliveries)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(time.Time, int, *[]model.Delivery) error); ok {
+		r0 = rf(before, limit, deliveries)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetFirstAccountForDomain provides a mock function with given fields: domain, account
+func (_m *MockDB) GetFirstAccountForDomain(domain string, account *model.Account) error {
+	ret := _m.Called(domain, account)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, *model.Account) error); ok {
+		r0 = rf(domain, account)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // GetFollowRequestsForAccountID provides a mock function with given fields: accountID, followRequests
 func (_m *MockDB) GetFollowRequestsForAccountID(accountID string, followRequests *[]model.FollowRequest) error {
 	ret := _m.Called(accountID, followRequests)
@@ -199,6 +301,48 @@ func (_m *MockDB) GetFollowingByAccountID(accountID string, following *[]model.F
 	return r0
 }
 
+// GetHeaderForAccountID provides a mock function with given fields: header, accountID
+func (_m *MockDB) GetHeaderForAccountID(header *model.MediaAttachment, accountID string) error {
+	ret := _m.Called(header, accountID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*model.MediaAttachment, string) error); ok {
+		r0 = rf(header, accountID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetHomeTimelineStatuses provides a mock function with given fields: accountID, statuses, limit, maxID, minID
+func (_m *MockDB) GetHomeTimelineStatuses(accountID string, statuses *[]model.Status, limit int, maxID string, minID string) error {
+	ret := _m.Called(accountID, statuses, limit, maxID, minID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, *[]model.Status, int, string, string) error); ok {
+		r0 = rf(accountID, statuses, limit, maxID, minID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetKnownInboxes provides a mock function with given fields: inboxes
+func (_m *MockDB) GetKnownInboxes(inboxes *[]string) error {
+	ret := _m.Called(inboxes)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*[]string) error); ok {
+		r0 = rf(inboxes)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // GetLastStatusForAccountID provides a mock function with given fields: accountID, status
 func (_m *MockDB) GetLastStatusForAccountID(accountID string, status *model.Status) error {
 	ret := _m.Called(accountID, status)
@@ -213,6 +357,62 @@ func (_m *MockDB) GetLastStatusForAccountID(accountID string, status *model.Stat
 	return r0
 }
 
+// GetLocalAccountByUsername provides a mock function with given fields: username, account
+func (_m *MockDB) GetLocalAccountByUsername(username string, account *model.Account) error {
+	ret := _m.Called(username, account)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, *model.Account) error); ok {
+		r0 = rf(username, account)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetPublicTimelineStatuses provides a mock function with given fields: local, onlyMedia, statuses, limit, maxID, minID
+func (_m *MockDB) GetPublicTimelineStatuses(local bool, onlyMedia bool, statuses *[]model.Status, limit int, maxID string, minID string) error {
+	ret := _m.Called(local, onlyMedia, statuses, limit, maxID, minID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(bool, bool, *[]model.Status, int, string, string) error); ok {
+		r0 = rf(local, onlyMedia, statuses, limit, maxID, minID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetRemoteAccountByUsername provides a mock function with given fields: username, domain, account
+func (_m *MockDB) GetRemoteAccountByUsername(username string, domain string, account *model.Account) error {
+	ret := _m.Called(username, domain, account)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, *model.Account) error); ok {
+		r0 = rf(username, domain, account)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetStaleRemoteAccounts provides a mock function with given fields: before, limit, accounts
+func (_m *MockDB) GetStaleRemoteAccounts(before time.Time, limit int, accounts *[]model.Account) error {
+	ret := _m.Called(before, limit, accounts)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(time.Time, int, *[]model.Account) error); ok {
+		r0 = rf(before, limit, accounts)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // GetStatusesByAccountID provides a mock function with given fields: accountID, statuses
 func (_m *MockDB) GetStatusesByAccountID(accountID string, statuses *[]model.Status) error {
 	ret := _m.Called(accountID, statuses)
@@ -227,13 +427,13 @@ func (_m *MockDB) GetStatusesByAccountID(accountID string, statuses *[]model.Sta
 	return r0
 }
 
-// GetStatusesByTimeDescending provides a mock function with given fields: accountID, statuses, limit
-func (_m *MockDB) GetStatusesByTimeDescending(accountID string, statuses *[]model.Status, limit int) error {
-	ret := _m.Called(accountID, statuses, limit)
+// GetStatusesByTimeDescending provides a mock function with given fields: accountID, statuses, limit, maxID, minID
+func (_m *MockDB) GetStatusesByTimeDescending(accountID string, statuses *[]model.Status, limit int, maxID string, minID string) error {
+	ret := _m.Called(accountID, statuses, limit, maxID, minID)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string, *[]model.Status, int) error); ok {
-		r0 = rf(accountID, statuses, limit)
+	if rf, ok := ret.Get(0).(func(string, *[]model.Status, int, string, string) error); ok {
+		r0 = rf(accountID, statuses, limit, maxID, minID)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -334,6 +534,64 @@ func (_m *MockDB) Put(i interface{}) error {
 	return r0
 }
 
+// SetHeaderOrAvatarForAccountID provides a mock function with given fields: mediaAttachment, accountID
+func (_m *MockDB) SetHeaderOrAvatarForAccountID(mediaAttachment *model.MediaAttachment, accountID string) error {
+	ret := _m.Called(mediaAttachment, accountID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*model.MediaAttachment, string) error); ok {
+		r0 = rf(mediaAttachment, accountID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// StatusInteractionAllowed provides a mock function with given fields: status, account, interaction
+func (_m *MockDB) StatusInteractionAllowed(status *model.Status, account *model.Account, interaction model.Interaction) (bool, error) {
+	ret := _m.Called(status, account, interaction)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(*model.Status, *model.Account, model.Interaction) bool); ok {
+		r0 = rf(status, account, interaction)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*model.Status, *model.Account, model.Interaction) error); ok {
+		r1 = rf(status, account, interaction)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// StatusToMasto provides a mock function with given fields: status, requestingAccount
+func (_m *MockDB) StatusToMasto(status *model.Status, requestingAccount *model.Account) (*mastotypes.Status, error) {
+	ret := _m.Called(status, requestingAccount)
+
+	var r0 *mastotypes.Status
+	if rf, ok := ret.Get(0).(func(*model.Status, *model.Account) *mastotypes.Status); ok {
+		r0 = rf(status, requestingAccount)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*mastotypes.Status)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(*model.Status, *model.Account) error); ok {
+		r1 = rf(status, requestingAccount)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Stop provides a mock function with given fields: ctx
 func (_m *MockDB) Stop(ctx context.Context) error {
 	ret := _m.Called(ctx)
@@ -361,3 +619,17 @@ func (_m *MockDB) UpdateByID(id string, i interface{}) error {
 
 	return r0
 }
+
+// UpdateOneByID provides a mock function with given fields: id, key, value, i
+func (_m *MockDB) UpdateOneByID(id string, key string, value interface{}, i interface{}) error {
+	ret := _m.Called(id, key, value, i)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, interface{}, interface{}) error); ok {
+		r0 = rf(id, key, value, i)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -73,8 +73,8 @@ type Account struct {
 	Note string
 	// Is this a memorial account, ie., has the user passed away?
 	Memorial bool
-	// This account has moved this account id in the database
-	MovedToAccountID int
+	// This account has moved to the account with this id in the database
+	MovedToAccountID string
 	// When was this account created?
 	CreatedAt time.Time `pg:"type:timestamp,notnull,default:now()"`
 	// When was this account last updated?
@@ -111,20 +111,26 @@ type Account struct {
 	URL string `pg:",unique"`
 	// Last time this account was located using the webfinger API.
 	LastWebfingeredAt time.Time `pg:"type:timestamp"`
+	// Last time we fetched (or tried to fetch) this account from its server. Only set for remote accounts.
+	LastFetchedAt time.Time `pg:"type:timestamp"`
 	// Address of this account's activitypub inbox, for sending activity to
 	InboxURL string `pg:",unique"`
 	// Address of this account's activitypub outbox
 	OutboxURL string `pg:",unique"`
-	// Don't support shared inbox right now so this is just a stub for a future implementation
-	SharedInboxURL string `pg:",unique"`
+	// Address of the shared inbox of this account's instance, if it has one. Deliveries to several accounts
+	// on the same instance can go to the shared inbox once, instead of to each account's inbox.
+	SharedInboxURL string
 	// URL for getting the followers list of this account
 	FollowersURL string `pg:",unique"`
+	// URL for getting the list of accounts this account follows
+	FollowingURL string `pg:",unique"`
 	// URL for getting the featured collection list of this account
 	FeaturedCollectionURL string `pg:",unique"`
 	// What type of activitypub actor is this account?
 	ActorType string
-	// This account is associated with x account id
-	AlsoKnownAs string
+	// Activitypub uris of other accounts that are also this account, ie., its aliases. An account can only be moved to an
+	// account that lists it here, and vice versa.
+	AlsoKnownAs []string
 
 	/*
 		CRYPTO FIELDS
@@ -135,6 +141,8 @@ type Account struct {
 	PrivateKey *rsa.PrivateKey
 	// Publickey for encoding activitypub requests, will be defined for both local and remote accounts
 	PublicKey *rsa.PublicKey
+	// Web-reachable location of the public key, used as the keyId of http signatures made by this account
+	PublicKeyURI string `pg:",unique"`
 
 	/*
 		ADMIN FIELDS
@@ -146,9 +154,13 @@ type Account struct {
 	SilencedAt time.Time `pg:"type:timestamp"`
 	// When was this account suspended (eg., don't allow it to log in/post, don't accept media/posts from this account)
 	SuspendedAt time.Time `pg:"type:timestamp"`
+	// When was this account deleted? A deleted account is kept as a tombstone, so that its username and uris can't be taken again.
+	DeletedAt time.Time `pg:"type:timestamp"`
+	// When was everything that this account left behind when it was deleted (statuses, media, follows etc) removed?
+	PurgedAt time.Time `pg:"type:timestamp"`
 	// How much do we trust this account 🤔
 	TrustLevel int
-	// Should we hide this account's collections?
+	// Should we hide this account's collections? If so, only their sizes are shown, except to followers of the account.
 	HideCollections bool
 	// id of the user that suspended this account through an admin action
 	SuspensionOrigin int
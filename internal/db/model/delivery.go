@@ -0,0 +1,42 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package model
+
+import "time"
+
+// Delivery is an activity waiting to be delivered to the inbox of a remote account. Deliveries are kept in the database
+// until they succeed or we give up on them, so that nothing is lost if the remote server is down for a while, or if we restart.
+type Delivery struct {
+	// ID of this delivery in the database
+	ID string `pg:"type:uuid,default:gen_random_uuid(),pk,notnull,unique"`
+	// When was this delivery queued
+	CreatedAt time.Time `pg:"type:timestamp,notnull,default:now()"`
+	// ID of the local account whose key the delivery should be signed with
+	AccountID string `pg:",notnull"`
+	// Inbox to deliver to
+	TargetInbox string `pg:",notnull"`
+	// Serialized activity to deliver
+	Payload string `pg:",notnull"`
+	// How many times has delivery been attempted and failed
+	Attempts int `pg:",use_zero"`
+	// When should the next attempt be made
+	NextAttemptAt time.Time `pg:"type:timestamp,notnull,default:now()"`
+	// Error from the most recent failed attempt
+	LastError string
+}
@@ -0,0 +1,41 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package model
+
+import "time"
+
+// DomainAllow represents a domain that an admin has explicitly allowed this instance to federate with.
+// Domain allows only have an effect when the instance is running in allowlist federation mode.
+type DomainAllow struct {
+	// ID of this allow in the database
+	ID string `pg:"type:uuid,default:gen_random_uuid(),pk,notnull,unique"`
+	// Domain to allow. Subdomains and wildcards work just like they do for domain blocks, so 'example.org'
+	// also allows 'gts.example.org', and '*.example.org' allows every subdomain of 'example.org'.
+	Domain string `pg:",notnull"`
+	// When was this allow created
+	CreatedAt time.Time `pg:"type:timestamp,notnull,default:now()"`
+	// When was this allow updated
+	UpdatedAt time.Time `pg:"type:timestamp,notnull,default:now()"`
+	// Account ID of the creator of this allow
+	CreatedByAccountID string `pg:",notnull"`
+	// Private comment on this allow, viewable to admins
+	PrivateComment string
+	// Public comment on this allow, viewable (optionally) by everyone
+	PublicComment string
+}
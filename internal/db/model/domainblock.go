@@ -24,9 +24,10 @@ import "time"
 type DomainBlock struct {
 	// ID of this block in the database
 	ID string `pg:"type:uuid,default:gen_random_uuid(),pk,notnull,unique"`
-	// Domain to block. If ANY PART of the candidate domain contains this string, it will be blocked.
-	// For example: 'example.org' also blocks 'gts.example.org'. '.com' blocks *any* '.com' domains.
-	// TODO: implement wildcards here
+	// Domain to block. Subdomains of the domain are blocked too, so 'example.org' also blocks 'gts.example.org',
+	// but not 'notexample.org'. A label of '*' matches any single label: '*.example.org' blocks every subdomain of
+	// 'example.org' but not 'example.org' itself, and 'gts.*.org' blocks 'gts.example.org' but not 'gts.example.com.org'.
+	// A leading dot is ignored, so '.com' blocks every '.com' domain.
 	Domain string `pg:",notnull"`
 	// When was this block created
 	CreatedAt time.Time `pg:"type:timestamp,notnull,default:now()"`
@@ -34,14 +35,29 @@ type DomainBlock struct {
 	UpdatedAt time.Time `pg:"type:timestamp,notnull,default:now()"`
 	// Account ID of the creator of this block
 	CreatedByAccountID string `pg:",notnull"`
-	// TODO: define this
-	Severity int
-	// Reject media from this domain?
+	// How severely is the domain blocked?
+	Severity DomainBlockSeverity
+	// Reject media from this domain? If so, attachments are stripped from statuses from the domain before they're
+	// stored. Always true in effect if the domain is suspended.
 	RejectMedia bool
-	// Reject reports from this domain?
+	// Reject reports from this domain? Always true in effect if the domain is suspended.
 	RejectReports bool
 	// Private comment on this block, viewable to admins
 	PrivateComment string
 	// Public comment on this block, viewable (optionally) by everyone
 	PublicComment string
 }
+
+// DomainBlockSeverity describes how severely a domain is blocked, beyond rejecting its media and/or reports.
+type DomainBlockSeverity int
+
+const (
+	// DomainBlockSeverityNoop means that the block doesn't restrict federation with the domain at all,
+	// apart from whatever RejectMedia and RejectReports say.
+	DomainBlockSeverityNoop DomainBlockSeverity = 0
+	// DomainBlockSeveritySilence means that statuses from the domain are kept off public timelines,
+	// and only shown to accounts that follow their authors.
+	DomainBlockSeveritySilence DomainBlockSeverity = 1
+	// DomainBlockSeveritySuspend means that nothing is accepted from or delivered to the domain at all.
+	DomainBlockSeveritySuspend DomainBlockSeverity = 2
+)
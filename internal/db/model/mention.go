@@ -0,0 +1,35 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package model
+
+import "time"
+
+// Mention refers to the 'tagging' or 'mention' of an account in a status, by the account that posted the status
+type Mention struct {
+	// id of this mention in the database
+	ID string `pg:"type:uuid,default:gen_random_uuid(),pk,notnull,unique"`
+	// id of the status this mention originates from
+	StatusID string `pg:",unique:statustarget,notnull"`
+	// when was this mention created
+	CreatedAt time.Time `pg:"type:timestamp,notnull,default:now()"`
+	// id of the account that posted the status, and so created the mention
+	OriginAccountID string `pg:",notnull"`
+	// id of the account being mentioned
+	TargetAccountID string `pg:",unique:statustarget,notnull"`
+}
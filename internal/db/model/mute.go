@@ -0,0 +1,37 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package model
+
+import "time"
+
+// Mute refers to the muting of one account by another. Unlike blocks, mutes are never federated.
+type Mute struct {
+	// id of this mute in the database
+	ID string `pg:"type:uuid,default:gen_random_uuid(),pk,notnull,unique"`
+	// When was this mute created?
+	CreatedAt time.Time `pg:"type:timestamp,notnull,default:now()"`
+	// When was this mute updated?
+	UpdatedAt time.Time `pg:"type:timestamp,notnull,default:now()"`
+	// Who created this mute?
+	AccountID string `pg:",unique:srctarget,notnull"`
+	// Who is targeted by this mute?
+	TargetAccountID string `pg:",unique:srctarget,notnull"`
+	// Should notifications from the target account be hidden too?
+	HideNotifications bool
+}
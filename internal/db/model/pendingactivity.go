@@ -0,0 +1,38 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package model
+
+import "time"
+
+// PendingActivity is an activity that was delivered to one of our inboxes by an instance with a poor reputation,
+// and which is being held for an admin to review instead of being processed straight away.
+type PendingActivity struct {
+	// ID of this pending activity in the database
+	ID string `pg:"type:uuid,default:gen_random_uuid(),pk,notnull,unique"`
+	// When was the activity delivered to us
+	CreatedAt time.Time `pg:"type:timestamp,notnull,default:now()"`
+	// Domain that the activity was delivered from
+	Domain string `pg:",notnull"`
+	// ID of the account whose key signed the delivery
+	AccountID string `pg:",notnull"`
+	// Path of the inbox that the activity was delivered to, eg '/users/some_user/inbox'
+	InboxPath string `pg:",notnull"`
+	// The activity itself, exactly as it was delivered
+	Activity string `pg:",notnull"`
+}
@@ -0,0 +1,45 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package model
+
+import "time"
+
+// Report represents one account reporting another account (and optionally some of its statuses) to the admins.
+type Report struct {
+	// id of this report in the database
+	ID string `pg:"type:uuid,default:gen_random_uuid(),pk,notnull,unique"`
+	// When was this report created?
+	CreatedAt time.Time `pg:"type:timestamp,notnull,default:now()"`
+	// When was this report updated?
+	UpdatedAt time.Time `pg:"type:timestamp,notnull,default:now()"`
+	// Who created this report?
+	AccountID string `pg:",notnull"`
+	// Who is being reported?
+	TargetAccountID string `pg:",notnull"`
+	// Database IDs of the reported statuses, if any
+	StatusIDs []string
+	// Why was the report made?
+	Comment string
+	// ActivityPub URI of this report, if it was federated
+	URI string `pg:",unique"`
+	// When was action taken on this report by an admin? Zero if it's still open.
+	ActionTakenAt time.Time `pg:"type:timestamp"`
+	// Which account took action on this report?
+	ActionTakenByAccountID string
+}
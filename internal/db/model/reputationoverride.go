@@ -0,0 +1,40 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package model
+
+import "time"
+
+// ReputationOverride pins the reputation score of a remote domain to a value chosen by an admin,
+// instead of the score that would otherwise be calculated for it.
+type ReputationOverride struct {
+	// ID of this override in the database
+	ID string `pg:"type:uuid,default:gen_random_uuid(),pk,notnull,unique"`
+	// Domain that the override applies to, eg 'example.org'. Subdomains are scored separately, so they aren't covered.
+	Domain string `pg:",notnull,unique"`
+	// Score to use for the domain, from 0 (not trusted at all) to 100 (fully trusted)
+	Score int `pg:",notnull,use_zero"`
+	// When was this override created
+	CreatedAt time.Time `pg:"type:timestamp,notnull,default:now()"`
+	// When was this override updated
+	UpdatedAt time.Time `pg:"type:timestamp,notnull,default:now()"`
+	// Account ID of the creator of this override
+	CreatedByAccountID string `pg:",notnull"`
+	// Private comment on this override, viewable to admins
+	PrivateComment string
+}
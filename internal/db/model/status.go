@@ -30,6 +30,8 @@ type Status struct {
 	URL string `pg:",unique"`
 	// the html-formatted content of this status
 	Content string
+	// the text of this status as the author wrote it, before it was formatted; only kept for local statuses
+	Text string
 	// when was this status created?
 	CreatedAt time.Time `pg:"type:timestamp,notnull,default:now()"`
 	// when was this status updated?
@@ -40,12 +42,24 @@ type Status struct {
 	AccountID string
 	// id of the status this status is a reply to
 	InReplyToID string
+	// id of the account that posted the status this status is a reply to
+	InReplyToAccountID string
 	// id of the status this status is a boost of
 	BoostOfID string
 	// cw string for this status
 	ContentWarning string
+	// should the content and media of this status be hidden behind a click?
+	Sensitive bool
+	// ISO 639 language code of this status
+	Language string
+	// names of the hashtags used in this status, lowercased
+	Tags []string `pg:",array"`
+	// id of the application that this status was posted with, if it was posted through the client API
+	CreatedWithApplicationID string
 	// visibility entry for this status
 	Visibility *Visibility
+	// who can boost, reply to and like this status; nil lets everyone who can see it do all of them
+	InteractionPolicy *InteractionPolicy
 }
 
 // Visibility represents the visibility granularity of a status. It is a combination of flags.
@@ -60,4 +74,65 @@ type Visibility struct {
 	Unlisted bool
 	// Is this status shown on public and federated timelines?
 	Public bool
+	// Is this status kept on this instance, never to be sent to or served to other servers? Local-only statuses can
+	// only be seen by users of this instance. Statuses stored before this flag existed don't have it, so they're federated.
+	LocalOnly bool
+}
+
+// InteractionPolicy says who can interact with a status in each of the ways it can be interacted with, on top of who
+// can see it. An empty scope is the same as InteractionEveryone. The author of a status and the accounts it mentions
+// can always interact with it.
+type InteractionPolicy struct {
+	// Who can boost this status?
+	CanBoost InteractionScope
+	// Who can reply to this status?
+	CanReply InteractionScope
+	// Who can like this status?
+	CanLike InteractionScope
+}
+
+// InteractionScope is who can interact with a status in some way.
+type InteractionScope string
+
+const (
+	// InteractionEveryone lets anyone who can see the status interact with it
+	InteractionEveryone InteractionScope = "everyone"
+	// InteractionFollowers lets the followers of the author interact with the status
+	InteractionFollowers InteractionScope = "followers"
+	// InteractionMutuals lets the followers of the author that the author follows back interact with the status
+	InteractionMutuals InteractionScope = "mutuals"
+	// InteractionMentioned only lets the accounts mentioned in the status interact with it
+	InteractionMentioned InteractionScope = "mentioned"
+)
+
+// Interaction is a way of interacting with a status.
+type Interaction int
+
+const (
+	// InteractionBoost is boosting a status
+	InteractionBoost Interaction = iota
+	// InteractionReply is replying to a status
+	InteractionReply
+	// InteractionLike is liking, or faving, a status
+	InteractionLike
+)
+
+// ScopeOf returns who can interact with a status in the given way under the policy, which may be nil.
+func (p *InteractionPolicy) ScopeOf(interaction Interaction) InteractionScope {
+	if p == nil {
+		return InteractionEveryone
+	}
+	var scope InteractionScope
+	switch interaction {
+	case InteractionBoost:
+		scope = p.CanBoost
+	case InteractionReply:
+		scope = p.CanReply
+	case InteractionLike:
+		scope = p.CanLike
+	}
+	if scope == "" {
+		return InteractionEveryone
+	}
+	return scope
 }
@@ -0,0 +1,32 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package model
+
+import "time"
+
+// UnavailableDomain is a domain that we've given up on delivering to, after repeated failures. Nothing will be delivered
+// to the domain until we hear from it again.
+type UnavailableDomain struct {
+	// ID of this entry in the database
+	ID string `pg:"type:uuid,default:gen_random_uuid(),pk,notnull,unique"`
+	// Domain that couldn't be delivered to, eg 'example.org'
+	Domain string `pg:",notnull,unique"`
+	// When was the domain marked as unavailable
+	CreatedAt time.Time `pg:"type:timestamp,notnull,default:now()"`
+}
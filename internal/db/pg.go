@@ -37,6 +37,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/superseriousbusiness/gotosocial/internal/config"
 	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/formatter"
 	"github.com/superseriousbusiness/gotosocial/internal/util"
 	"github.com/superseriousbusiness/gotosocial/pkg/mastotypes"
 	"golang.org/x/crypto/bcrypt"
@@ -112,7 +113,7 @@ func newPostgresService(ctx context.Context, c *config.Config, log *logrus.Entry
 		cancel: cancel,
 	}
 
-	federatingDB := newFederatingDB(ps, c)
+	federatingDB := newFederatingDB(ps, c, log)
 	ps.federationDB = federatingDB
 
 	// we can confidently return this useable postgres service now
@@ -327,6 +328,26 @@ func (ps *postgresService) GetAccountByUserID(userID string, account *model.Acco
 	return nil
 }
 
+func (ps *postgresService) GetLocalAccountByUsername(username string, account *model.Account) error {
+	if err := ps.conn.Model(account).Where("username = ?", username).Where("domain IS NULL").Select(); err != nil {
+		if err == pg.ErrNoRows {
+			return ErrNoEntries{}
+		}
+		return err
+	}
+	return nil
+}
+
+func (ps *postgresService) GetRemoteAccountByUsername(username string, domain string, account *model.Account) error {
+	if err := ps.conn.Model(account).Where("username = ?", username).Where("domain = ?", domain).Select(); err != nil {
+		if err == pg.ErrNoRows {
+			return ErrNoEntries{}
+		}
+		return err
+	}
+	return nil
+}
+
 func (ps *postgresService) GetFollowRequestsForAccountID(accountID string, followRequests *[]model.FollowRequest) error {
 	if err := ps.conn.Model(followRequests).Where("target_account_id = ?", accountID).Select(); err != nil {
 		if err == pg.ErrNoRows {
@@ -338,7 +359,7 @@ func (ps *postgresService) GetFollowRequestsForAccountID(accountID string, follo
 }
 
 func (ps *postgresService) GetFollowingByAccountID(accountID string, following *[]model.Follow) error {
-	if err := ps.conn.Model(following).Where("account_id = ?", accountID).Select(); err != nil {
+	if err := ps.conn.Model(following).Where("account_id = ?", accountID).Order("created_at DESC").Select(); err != nil {
 		if err == pg.ErrNoRows {
 			return ErrNoEntries{}
 		}
@@ -348,7 +369,7 @@ func (ps *postgresService) GetFollowingByAccountID(accountID string, following *
 }
 
 func (ps *postgresService) GetFollowersByAccountID(accountID string, followers *[]model.Follow) error {
-	if err := ps.conn.Model(followers).Where("target_account_id = ?", accountID).Select(); err != nil {
+	if err := ps.conn.Model(followers).Where("target_account_id = ?", accountID).Order("created_at DESC").Select(); err != nil {
 		if err == pg.ErrNoRows {
 			return ErrNoEntries{}
 		}
@@ -367,13 +388,50 @@ func (ps *postgresService) GetStatusesByAccountID(accountID string, statuses *[]
 	return nil
 }
 
-func (ps *postgresService) GetStatusesByTimeDescending(accountID string, statuses *[]model.Status, limit int) error {
-	q := ps.conn.Model(statuses).Order("created_at DESC")
+func (ps *postgresService) GetStatusesByTimeDescending(accountID string, statuses *[]model.Status, limit int, maxID string, minID string) error {
+	q := ps.conn.Model(statuses)
+	if accountID != "" {
+		q = q.Where("account_id = ?", accountID)
+	}
+	return ps.selectStatusesByTime(q, statuses, limit, maxID, minID)
+}
+
+func (ps *postgresService) GetHomeTimelineStatuses(accountID string, statuses *[]model.Status, limit int, maxID string, minID string) error {
+	following := ps.conn.Model(&model.Follow{}).Column("target_account_id").Where("account_id = ?", accountID)
+	q := ps.conn.Model(statuses).WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+		return q.Where("account_id = ?", accountID).WhereOr("account_id IN (?)", following), nil
+	})
+	return ps.selectStatusesByTime(q, statuses, limit, maxID, minID)
+}
+
+func (ps *postgresService) GetPublicTimelineStatuses(local bool, onlyMedia bool, statuses *[]model.Status, limit int, maxID string, minID string) error {
+	// visibility is stored as jsonb, so its flags have to be picked out of it
+	q := ps.conn.Model(statuses).
+		Where("visibility->>'Public' = 'true'").
+		Where("boost_of_id IS NULL")
+	if local {
+		q = q.Where("local = true").Where("visibility->>'Local' = 'true'")
+	}
+	if onlyMedia {
+		q = q.Where("id IN (?)", ps.conn.Model(&model.MediaAttachment{}).Column("status_id").Where("status_id IS NOT NULL"))
+	}
+	return ps.selectStatusesByTime(q, statuses, limit, maxID, minID)
+}
+
+// selectStatusesByTime selects statuses with the given query into the given slice, newest first, paging them by time
+// with limit, maxID and minID as described for GetStatusesByTimeDescending.
+func (ps *postgresService) selectStatusesByTime(q *orm.Query, statuses *[]model.Status, limit int, maxID string, minID string) error {
 	if limit != 0 {
 		q = q.Limit(limit)
 	}
-	if accountID != "" {
-		q = q.Where("account_id = ?", accountID)
+	if maxID != "" {
+		q = q.Where("created_at < (?)", ps.conn.Model(&model.Status{}).Column("created_at").Where("id = ?", maxID))
+	}
+	if minID != "" {
+		// to get the statuses immediately newer than minID, we have to go oldest first, and reverse them afterwards
+		q = q.Where("created_at > (?)", ps.conn.Model(&model.Status{}).Column("created_at").Where("id = ?", minID)).Order("created_at ASC")
+	} else {
+		q = q.Order("created_at DESC")
 	}
 	if err := q.Select(); err != nil {
 		if err == pg.ErrNoRows {
@@ -381,9 +439,45 @@ func (ps *postgresService) GetStatusesByTimeDescending(accountID string, statuse
 		}
 		return err
 	}
+	if minID != "" {
+		s := *statuses
+		for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+			s[i], s[j] = s[j], s[i]
+		}
+	}
 	return nil
 }
 
+func (ps *postgresService) StatusInteractionAllowed(status *model.Status, account *model.Account, interaction model.Interaction) (bool, error) {
+	scope := status.InteractionPolicy.ScopeOf(interaction)
+	if scope == model.InteractionEveryone || account.ID == status.AccountID {
+		return true, nil
+	}
+
+	mentioned, err := ps.conn.Model(&model.Mention{}).Where("status_id = ?", status.ID).Where("target_account_id = ?", account.ID).Exists()
+	if err != nil {
+		return false, err
+	}
+	if mentioned || scope == model.InteractionMentioned {
+		return mentioned, nil
+	}
+
+	follows, err := ps.conn.Model(&model.Follow{}).Where("account_id = ?", account.ID).Where("target_account_id = ?", status.AccountID).Exists()
+	if err != nil {
+		return false, err
+	}
+	switch scope {
+	case model.InteractionFollowers:
+		return follows, nil
+	case model.InteractionMutuals:
+		if !follows {
+			return false, nil
+		}
+		return ps.conn.Model(&model.Follow{}).Where("account_id = ?", status.AccountID).Where("target_account_id = ?", account.ID).Exists()
+	}
+	return false, fmt.Errorf("interaction scope %s not recognised", scope)
+}
+
 func (ps *postgresService) GetLastStatusForAccountID(accountID string, status *model.Status) error {
 	if err := ps.conn.Model(status).Order("created_at DESC").Limit(1).Where("account_id = ?", accountID).Select(); err != nil {
 		if err == pg.ErrNoRows {
@@ -395,6 +489,82 @@ func (ps *postgresService) GetLastStatusForAccountID(accountID string, status *m
 
 }
 
+func (ps *postgresService) GetFirstAccountForDomain(domain string, account *model.Account) error {
+	if err := ps.conn.Model(account).Where("domain = ?", domain).Order("created_at ASC").Limit(1).Select(); err != nil {
+		if err == pg.ErrNoRows {
+			return ErrNoEntries{}
+		}
+		return err
+	}
+	return nil
+}
+
+func (ps *postgresService) CountLocalInteractionsWithDomain(domain string, i interface{}) (int, error) {
+	return ps.conn.Model(i).
+		Join("JOIN accounts AS origin_account ON origin_account.id = ?TableAlias.account_id").
+		Join("JOIN accounts AS target_account ON target_account.id = ?TableAlias.target_account_id").
+		Where("origin_account.domain IS NULL").
+		Where("target_account.domain = ?", domain).
+		Count()
+}
+
+func (ps *postgresService) GetDueDeliveries(before time.Time, limit int, deliveries *[]model.Delivery) error {
+	q := ps.conn.Model(deliveries).Where("next_attempt_at <= ?", before).Order("next_attempt_at ASC")
+	if limit != 0 {
+		q = q.Limit(limit)
+	}
+	if err := q.Select(); err != nil {
+		if err == pg.ErrNoRows {
+			return ErrNoEntries{}
+		}
+		return err
+	}
+	return nil
+}
+
+func (ps *postgresService) GetStaleRemoteAccounts(before time.Time, limit int, accounts *[]model.Account) error {
+	q := ps.conn.Model(accounts).Where("domain != ''").Where("deleted_at IS NULL").Where("last_fetched_at IS NULL OR last_fetched_at < ?", before).Order("last_fetched_at ASC NULLS FIRST")
+	if limit != 0 {
+		q = q.Limit(limit)
+	}
+	if err := q.Select(); err != nil {
+		if err == pg.ErrNoRows {
+			return ErrNoEntries{}
+		}
+		return err
+	}
+	return nil
+}
+
+func (ps *postgresService) GetAccountsToPurge(limit int, accounts *[]model.Account) error {
+	q := ps.conn.Model(accounts).Where("deleted_at IS NOT NULL").Where("purged_at IS NULL").Order("deleted_at ASC")
+	if limit != 0 {
+		q = q.Limit(limit)
+	}
+	if err := q.Select(); err != nil {
+		if err == pg.ErrNoRows {
+			return ErrNoEntries{}
+		}
+		return err
+	}
+	return nil
+}
+
+func (ps *postgresService) GetKnownInboxes(inboxes *[]string) error {
+	q := ps.conn.Model(&model.Account{}).
+		ColumnExpr("DISTINCT COALESCE(NULLIF(shared_inbox_url, ''), inbox_url)").
+		Where("domain != ''").
+		Where("deleted_at IS NULL").
+		Where("inbox_url != ''")
+	if err := q.Select(inboxes); err != nil {
+		if err == pg.ErrNoRows {
+			return ErrNoEntries{}
+		}
+		return err
+	}
+	return nil
+}
+
 func (ps *postgresService) IsUsernameAvailable(username string) error {
 	// if no error we fail because it means we found something
 	// if error but it's not pg.ErrNoRows then we fail
@@ -451,11 +621,14 @@ func (ps *postgresService) NewSignup(username string, reason string, requireAppr
 		URL:                   uris.UserURL,
 		PrivateKey:            key,
 		PublicKey:             &key.PublicKey,
+		PublicKeyURI:          uris.PublicKeyURI,
 		ActorType:             "Person",
 		URI:                   uris.UserURI,
 		InboxURL:              uris.InboxURL,
 		OutboxURL:             uris.OutboxURL,
+		SharedInboxURL:        uris.SharedInboxURL,
 		FollowersURL:          uris.FollowersURL,
+		FollowingURL:          uris.FollowingURL,
 		FeaturedCollectionURL: uris.CollectionURL,
 	}
 	if _, err = ps.conn.Model(a).Insert(); err != nil {
@@ -638,6 +811,23 @@ func (ps *postgresService) AccountToMastoPublic(a *model.Account) (*mastotypes.A
 		acct = a.Username
 	}
 
+	// if the account has moved, the account it moved to is shown along with it, so clients can redirect to it
+	var moved *mastotypes.Account
+	if a.MovedToAccountID != "" {
+		movedTo := &model.Account{}
+		if err := ps.GetByID(a.MovedToAccountID, movedTo); err != nil {
+			if _, ok := err.(ErrNoEntries); !ok {
+				return nil, fmt.Errorf("error getting moved to account: %s", err)
+			}
+		} else {
+			// don't follow any move of the moved to account in turn, so a chain (or loop) of moves stays at one level
+			movedTo.MovedToAccountID = ""
+			if moved, err = ps.AccountToMastoPublic(movedTo); err != nil {
+				return nil, fmt.Errorf("error converting moved to account: %s", err)
+			}
+		}
+	}
+
 	return &mastotypes.Account{
 		ID:             a.ID,
 		Username:       a.Username,
@@ -658,5 +848,199 @@ func (ps *postgresService) AccountToMastoPublic(a *model.Account) (*mastotypes.A
 		LastStatusAt:   lastStatusAt,
 		Emojis:         nil, // TODO: implement this
 		Fields:         fields,
+		Moved:          moved,
 	}, nil
 }
+
+func (ps *postgresService) StatusToMasto(s *model.Status, requestingAccount *model.Account) (*mastotypes.Status, error) {
+	// the account that posted the status
+	author := &model.Account{}
+	if err := ps.GetByID(s.AccountID, author); err != nil {
+		return nil, fmt.Errorf("error getting author of status %s: %s", s.ID, err)
+	}
+	mastoAuthor, err := ps.AccountToMastoPublic(author)
+	if err != nil {
+		return nil, fmt.Errorf("error converting author of status %s: %s", s.ID, err)
+	}
+
+	// if this is a boost, the boosted status is shown inside it
+	var reblog *mastotypes.Status
+	if s.BoostOfID != "" {
+		boosted := &model.Status{}
+		if err := ps.GetByID(s.BoostOfID, boosted); err != nil {
+			return nil, fmt.Errorf("error getting boosted status of %s: %s", s.ID, err)
+		}
+		if reblog, err = ps.StatusToMasto(boosted, requestingAccount); err != nil {
+			return nil, fmt.Errorf("error converting boosted status of %s: %s", s.ID, err)
+		}
+	}
+
+	// count replies
+	replies := []model.Status{}
+	if err := ps.GetWhere("in_reply_to_id", s.ID, &replies); err != nil {
+		if _, ok := err.(ErrNoEntries); !ok {
+			return nil, fmt.Errorf("error getting replies: %s", err)
+		}
+	}
+
+	// count boosts, and check whether the requesting account boosted it
+	boosts := []model.Status{}
+	if err := ps.GetWhere("boost_of_id", s.ID, &boosts); err != nil {
+		if _, ok := err.(ErrNoEntries); !ok {
+			return nil, fmt.Errorf("error getting boosts: %s", err)
+		}
+	}
+	var reblogged bool
+	for _, b := range boosts {
+		if requestingAccount != nil && b.AccountID == requestingAccount.ID {
+			reblogged = true
+		}
+	}
+
+	// count faves, and check whether the requesting account faved it
+	faves := []model.StatusFave{}
+	if err := ps.GetWhere("status_id", s.ID, &faves); err != nil {
+		if _, ok := err.(ErrNoEntries); !ok {
+			return nil, fmt.Errorf("error getting faves: %s", err)
+		}
+	}
+	var favourited bool
+	for _, f := range faves {
+		if requestingAccount != nil && f.AccountID == requestingAccount.ID {
+			favourited = true
+		}
+	}
+
+	// the application the status was posted with; only its name and website are shown
+	var application *mastotypes.Application
+	if s.CreatedWithApplicationID != "" {
+		app := &model.Application{}
+		if err := ps.GetByID(s.CreatedWithApplicationID, app); err != nil {
+			if _, ok := err.(ErrNoEntries); !ok {
+				return nil, fmt.Errorf("error getting application: %s", err)
+			}
+		} else {
+			application = &mastotypes.Application{
+				Name:    app.Name,
+				Website: app.Website,
+			}
+		}
+	}
+
+	// get the media attached to the status
+	attachments := []model.MediaAttachment{}
+	if err := ps.GetWhere("status_id", s.ID, &attachments); err != nil {
+		if _, ok := err.(ErrNoEntries); !ok {
+			return nil, fmt.Errorf("error getting attachments: %s", err)
+		}
+	}
+	mastoAttachments := []mastotypes.Attachment{}
+	for _, a := range attachments {
+		mastoAttachments = append(mastoAttachments, attachmentToMasto(&a))
+	}
+
+	// get the accounts mentioned in the status
+	mentions := []model.Mention{}
+	if err := ps.GetWhere("status_id", s.ID, &mentions); err != nil {
+		if _, ok := err.(ErrNoEntries); !ok {
+			return nil, fmt.Errorf("error getting mentions: %s", err)
+		}
+	}
+	mastoMentions := []mastotypes.Mention{}
+	for _, m := range mentions {
+		target := &model.Account{}
+		if err := ps.GetByID(m.TargetAccountID, target); err != nil {
+			if _, ok := err.(ErrNoEntries); ok {
+				continue
+			}
+			return nil, fmt.Errorf("error getting mentioned account: %s", err)
+		}
+		acct := target.Username
+		if target.Domain != "" {
+			acct = fmt.Sprintf("%s@%s", target.Username, target.Domain)
+		}
+		mastoMentions = append(mastoMentions, mastotypes.Mention{
+			ID:       target.ID,
+			Username: target.Username,
+			URL:      target.URL,
+			Acct:     acct,
+		})
+	}
+
+	mastoPolicy := &mastotypes.InteractionPolicy{
+		CanBoost: string(s.InteractionPolicy.ScopeOf(model.InteractionBoost)),
+		CanReply: string(s.InteractionPolicy.ScopeOf(model.InteractionReply)),
+		CanLike:  string(s.InteractionPolicy.ScopeOf(model.InteractionLike)),
+	}
+
+	mastoTags := []mastotypes.Tag{}
+	for _, t := range s.Tags {
+		mastoTags = append(mastoTags, mastotypes.Tag{
+			Name: t,
+			URL:  formatter.TagURL(ps.config, t),
+		})
+	}
+
+	return &mastotypes.Status{
+		ID:                 s.ID,
+		CreatedAt:          s.CreatedAt.Format(time.RFC3339),
+		InReplyToID:        s.InReplyToID,
+		InReplyToAccountID: s.InReplyToAccountID,
+		Sensitive:          s.Sensitive,
+		SpoilerText:        s.ContentWarning,
+		Visibility:         visibilityToMasto(s.Visibility),
+		LocalOnly:          s.Local && s.Visibility != nil && s.Visibility.LocalOnly,
+		InteractionPolicy:  mastoPolicy,
+		Language:           s.Language,
+		URI:                s.URI,
+		URL:                s.URL,
+		RepliesCount:       len(replies),
+		ReblogsCount:       len(boosts),
+		FavouritesCount:    len(faves),
+		Favourited:         favourited,
+		Reblogged:          reblogged,
+		Content:            s.Content,
+		Reblog:             reblog,
+		Application:        application,
+		Account:            mastoAuthor,
+		MediaAttachments:   mastoAttachments,
+		Mentions:           mastoMentions,
+		Tags:               mastoTags,
+		Emojis:             []mastotypes.Emoji{}, // TODO: implement this
+	}, nil
+}
+
+// attachmentToMasto converts the given media attachment into a mastotype attachment, ready to be served through the API.
+func attachmentToMasto(a *model.MediaAttachment) mastotypes.Attachment {
+	mastoType := string(a.Type)
+	if a.Type == model.FileTypeGif {
+		// gifs are served as looping soundless animations
+		mastoType = "gifv"
+	}
+	return mastotypes.Attachment{
+		ID:          a.ID,
+		Type:        mastoType,
+		URL:         a.File.Path,
+		PreviewURL:  a.Thumbnail.Path,
+		RemoteURL:   a.RemoteURL,
+		Description: a.Description,
+		Blurhash:    a.Blurhash,
+	}
+}
+
+// visibilityToMasto returns the mastodon api name of the given visibility: one of public, unlisted, private or direct.
+// A nil visibility is treated as private, since that's the safest guess.
+func visibilityToMasto(v *model.Visibility) string {
+	switch {
+	case v == nil:
+		return "private"
+	case v.Direct:
+		return "direct"
+	case v.Public:
+		return "public"
+	case v.Unlisted:
+		return "unlisted"
+	default:
+		return "private"
+	}
+}
@@ -19,78 +19,187 @@
 package distributor
 
 import (
-	"github.com/go-fed/activity/pub"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
 	"github.com/sirupsen/logrus"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
 )
 
-// Distributor should be passed to api modules (see internal/apimodule/...). It is used for
-// passing messages back and forth from the client API and the federating interface, via channels.
-// It also contains logic for filtering which messages should end up where.
+// ErrStopped is returned when trying to send a message to a distributor that has been stopped.
+var ErrStopped = errors.New("distributor is stopped")
+
+// Handler takes care of one side effect of a message, eg putting a new status in timelines.
+type Handler func(ctx context.Context, msg Message) error
+
+// Distributor should be passed to api modules (see internal/apimodule/...) and to the federator. Both of them send
+// messages about things that happened into the distributor, and the side effects of those things (timelines,
+// notifications, federation) are taken care of by handlers registered for each activity type.
 // It is designed to be used asynchronously: the client API and the federating API should just be able to
-// fire messages into the distributor and not wait for a reply before proceeding with other work. This allows
+// fire messages into the distributor and not wait for them to be handled before proceeding with other work. This allows
 // for clean distribution of messages without slowing down the client API and harming the user experience.
 type Distributor interface {
-	// ClientAPIIn returns a channel for accepting messages that come from the gts client API.
-	ClientAPIIn() chan interface{}
-	// ClientAPIOut returns a channel for putting in messages that need to go to the gts client API.
-	ClientAPIOut() chan interface{}
-	// Start starts the Distributor, reading from its channels and passing messages back and forth.
+	// Register registers a handler for messages of the given activity type. Several handlers can be registered for the same
+	// activity type, in which case they're called one after the other, in the order they were registered.
+	Register(activityType ActivityType, handler Handler)
+	// Send puts the given message on the queue to be handled. Messages with the same key are handled in the order they were
+	// sent. If the queue is full, Send waits until there's room in it, or until the given context is done, in which case the
+	// context's error is returned.
+	// ErrStopped is returned if the distributor has been stopped.
+	Send(ctx context.Context, msg Message) error
+	// Start starts the Distributor's workers, which take messages off the queue and pass them to their handlers.
 	Start() error
 	// Stop stops the distributor cleanly, finishing handling any remaining messages before closing down.
 	Stop() error
 }
 
-// distributor just implements the Distributor interface
+// distributor just implements the Distributor interface. Each worker has a queue of its own, and messages are put on the
+// queue of a worker picked by their key, so that messages about the same thing are handled one after the other.
 type distributor struct {
-	federator    pub.FederatingActor
-	clientAPIIn  chan interface{}
-	clientAPIOut chan interface{}
-	stop         chan interface{}
-	log          *logrus.Logger
+	queues []chan Message
+	log    *logrus.Logger
+
+	handlersMu sync.RWMutex
+	handlers   map[ActivityType][]Handler
+
+	// sendMu guards stopped, so that the queues aren't closed while a message is being sent on one of them
+	sendMu  sync.RWMutex
+	stopped bool
+	started bool
+	wg      sync.WaitGroup
 }
 
-// New returns a new Distributor that uses the given federator and logger
-func New(federator pub.FederatingActor, log *logrus.Logger) Distributor {
+// New returns a new Distributor with the number of workers and queue size given in the config. Each worker gets a queue of that size.
+func New(c *config.Config, log *logrus.Logger) Distributor {
+	workers := c.DistributorConfig.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	queueSize := c.DistributorConfig.QueueSize
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	queues := make([]chan Message, workers)
+	for i := range queues {
+		queues[i] = make(chan Message, queueSize)
+	}
 	return &distributor{
-		federator:    federator,
-		clientAPIIn:  make(chan interface{}, 100),
-		clientAPIOut: make(chan interface{}, 100),
-		stop:         make(chan interface{}),
-		log:          log,
+		queues:   queues,
+		log:      log,
+		handlers: make(map[ActivityType][]Handler),
 	}
 }
 
-// ClientAPIIn returns a channel for accepting messages that come from the gts client API.
-func (d *distributor) ClientAPIIn() chan interface{} {
-	return d.clientAPIIn
+// Register registers a handler for messages of the given activity type.
+func (d *distributor) Register(activityType ActivityType, handler Handler) {
+	d.handlersMu.Lock()
+	defer d.handlersMu.Unlock()
+	d.handlers[activityType] = append(d.handlers[activityType], handler)
 }
 
-// ClientAPIOut returns a channel for putting in messages that need to go to the gts client API.
-func (d *distributor) ClientAPIOut() chan interface{} {
-	return d.clientAPIOut
+// Send puts the given message on the queue of the worker for its key, waiting for room in the queue if necessary.
+func (d *distributor) Send(ctx context.Context, msg Message) error {
+	d.sendMu.RLock()
+	defer d.sendMu.RUnlock()
+	if d.stopped {
+		return ErrStopped
+	}
+	select {
+	case d.queueFor(msg.Key()) <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-// Start starts the Distributor, reading from its channels and passing messages back and forth.
+// Start starts the Distributor's workers, which take messages off the queue and pass them to their handlers.
 func (d *distributor) Start() error {
-	go func() {
-	DistLoop:
-		for {
-			select {
-			case clientMsgIn := <-d.clientAPIIn:
-				d.log.Infof("received clientMsgIn: %+v", clientMsgIn)
-			case clientMsgOut := <-d.clientAPIOut:
-				d.log.Infof("received clientMsgOut: %+v", clientMsgOut)
-			case <-d.stop:
-				break DistLoop
+	d.sendMu.Lock()
+	defer d.sendMu.Unlock()
+	if d.stopped {
+		return ErrStopped
+	}
+	if d.started {
+		return nil
+	}
+	d.started = true
+	for _, q := range d.queues {
+		queue := q
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for msg := range queue {
+				d.handle(msg)
 			}
-		}
-	}()
+		}()
+	}
 	return nil
 }
 
+// queueFor returns the queue of the worker that handles messages with the given key.
+func (d *distributor) queueFor(key string) chan Message {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return d.queues[h.Sum32()%uint32(len(d.queues))]
+}
+
 // Stop stops the distributor cleanly, finishing handling any remaining messages before closing down.
-// TODO: empty message buffer properly before stopping otherwise we'll lose federating messages.
+// Messages that are sent after Stop has been called are refused with ErrStopped.
 func (d *distributor) Stop() error {
-	close(d.stop)
+	d.sendMu.Lock()
+	if d.stopped {
+		d.sendMu.Unlock()
+		return nil
+	}
+	d.stopped = true
+	waiting := 0
+	for _, q := range d.queues {
+		close(q)
+		waiting += len(q)
+	}
+	started := d.started
+	d.sendMu.Unlock()
+
+	if !started {
+		if waiting != 0 {
+			d.log.WithField("func", "Stop").Warnf("distributor was never started, dropping %d messages", waiting)
+		}
+		return nil
+	}
+	d.wg.Wait()
 	return nil
 }
+
+// handle passes the given message to each of the handlers registered for its activity type.
+// Errors are logged rather than returned, since there's nobody waiting on the result.
+func (d *distributor) handle(msg Message) {
+	l := d.log.WithField("func", "handle")
+
+	d.handlersMu.RLock()
+	handlers := d.handlers[msg.ActivityType()]
+	d.handlersMu.RUnlock()
+
+	if len(handlers) == 0 {
+		l.Tracef("no handlers registered for %s", msg.ActivityType())
+		return
+	}
+	for _, h := range handlers {
+		if err := d.call(h, msg); err != nil {
+			l.Errorf("error handling %s: %s", msg.ActivityType(), err)
+		}
+	}
+}
+
+// call calls the given handler with the given message, turning a panic in the handler into an error
+// so that one bad handler doesn't bring down the whole worker.
+func (d *distributor) call(h Handler, msg Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return h(context.Background(), msg)
+}
@@ -0,0 +1,198 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package distributor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+type DistributorTestSuite struct {
+	suite.Suite
+	log    *logrus.Logger
+	config *config.Config
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *DistributorTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+}
+
+// SetupTest gives each test a fresh config with a small worker pool and queue
+func (suite *DistributorTestSuite) SetupTest() {
+	suite.config = config.Empty()
+	suite.config.DistributorConfig.Workers = 2
+	suite.config.DistributorConfig.QueueSize = 10
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *DistributorTestSuite) TestHandlersRegisteredPerActivityType() {
+	d := New(suite.config, suite.log)
+
+	var mu sync.Mutex
+	handled := []string{}
+	record := func(name string) Handler {
+		return func(ctx context.Context, msg Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled = append(handled, name)
+			return nil
+		}
+	}
+	d.Register(ActivityStatusCreated, record("timelines"))
+	d.Register(ActivityStatusCreated, record("federation"))
+	d.Register(ActivityFollowAccepted, record("notifications"))
+
+	suite.NoError(d.Start())
+	suite.NoError(d.Send(context.Background(), StatusCreated{Status: &model.Status{ID: "some-status"}}))
+	suite.NoError(d.Send(context.Background(), AccountUpdated{Account: &model.Account{ID: "some-account"}}))
+	suite.NoError(d.Stop())
+
+	// both status handlers were called in order, and nothing was registered for account updates
+	assert.Equal(suite.T(), []string{"timelines", "federation"}, handled)
+}
+
+func (suite *DistributorTestSuite) TestStopDrainsQueue() {
+	d := New(suite.config, suite.log)
+
+	var mu sync.Mutex
+	handled := 0
+	d.Register(ActivityStatusCreated, func(ctx context.Context, msg Message) error {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		handled++
+		return nil
+	})
+
+	// messages sent before start are kept until the workers are running
+	for i := 0; i < 10; i++ {
+		suite.NoError(d.Send(context.Background(), StatusCreated{}))
+	}
+	suite.NoError(d.Start())
+	suite.NoError(d.Stop())
+	assert.Equal(suite.T(), 10, handled)
+
+	// nothing more is accepted once stopped
+	assert.Equal(suite.T(), ErrStopped, d.Send(context.Background(), StatusCreated{}))
+	suite.NoError(d.Stop())
+}
+
+func (suite *DistributorTestSuite) TestSendWaitsWhenQueueIsFull() {
+	suite.config.DistributorConfig.Workers = 1
+	suite.config.DistributorConfig.QueueSize = 1
+	d := New(suite.config, suite.log)
+
+	release := make(chan struct{})
+	d.Register(ActivityStatusCreated, func(ctx context.Context, msg Message) error {
+		<-release
+		return nil
+	})
+	suite.NoError(d.Start())
+
+	// the first message is taken by the worker and the second fills the queue, at which point
+	// sending has to wait until the worker is done
+	suite.NoError(d.Send(context.Background(), StatusCreated{}))
+	assert.Eventually(suite.T(), func() bool {
+		return d.Send(context.Background(), StatusCreated{}) == nil
+	}, time.Second, time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(suite.T(), context.DeadlineExceeded, d.Send(ctx, StatusCreated{}))
+
+	close(release)
+	suite.NoError(d.Send(context.Background(), StatusCreated{}))
+	suite.NoError(d.Stop())
+}
+
+func (suite *DistributorTestSuite) TestFailingHandlers() {
+	d := New(suite.config, suite.log)
+
+	handled := make(chan Message, 2)
+	d.Register(ActivityFollowAccepted, func(ctx context.Context, msg Message) error {
+		return errors.New("something went wrong")
+	})
+	d.Register(ActivityFollowAccepted, func(ctx context.Context, msg Message) error {
+		panic("something went very wrong")
+	})
+	d.Register(ActivityFollowAccepted, func(ctx context.Context, msg Message) error {
+		handled <- msg
+		return nil
+	})
+
+	// handlers after a failing one are still called, and the workers keep going
+	suite.NoError(d.Start())
+	suite.NoError(d.Send(context.Background(), FollowAccepted{Follow: &model.Follow{ID: "1"}}))
+	suite.NoError(d.Send(context.Background(), FollowAccepted{Follow: &model.Follow{ID: "2"}}))
+	suite.NoError(d.Stop())
+	assert.Len(suite.T(), handled, 2)
+}
+
+func (suite *DistributorTestSuite) TestMessagesAboutTheSameThingHandledInOrder() {
+	suite.config.DistributorConfig.Workers = 8
+	d := New(suite.config, suite.log)
+
+	var mu sync.Mutex
+	handled := map[string][]ActivityType{}
+	record := func(ctx context.Context, msg Message) error {
+		// give the other workers a chance to get ahead, if they can
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		handled[msg.Key()] = append(handled[msg.Key()], msg.ActivityType())
+		return nil
+	}
+	d.Register(ActivityStatusCreated, record)
+	d.Register(ActivityStatusDeleted, record)
+
+	suite.NoError(d.Start())
+	ids := []string{"status-1", "status-2", "status-3", "status-4", "status-5", "status-6", "status-7", "status-8"}
+	for _, id := range ids {
+		status := &model.Status{ID: id}
+		suite.NoError(d.Send(context.Background(), StatusCreated{Status: status}))
+		suite.NoError(d.Send(context.Background(), StatusDeleted{Status: status}))
+	}
+	suite.NoError(d.Stop())
+
+	for _, id := range ids {
+		assert.Equal(suite.T(), []ActivityType{ActivityStatusCreated, ActivityStatusDeleted}, handled[id], id)
+	}
+}
+
+func TestDistributorTestSuite(t *testing.T) {
+	suite.Run(t, new(DistributorTestSuite))
+}
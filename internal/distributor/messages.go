@@ -0,0 +1,131 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package distributor
+
+import "github.com/superseriousbusiness/gotosocial/internal/db/model"
+
+// ActivityType is the kind of thing that a message is about. Handlers are registered per activity type.
+type ActivityType string
+
+const (
+	// ActivityStatusCreated is the activity type of StatusCreated messages
+	ActivityStatusCreated ActivityType = "StatusCreated"
+	// ActivityStatusDeleted is the activity type of StatusDeleted messages
+	ActivityStatusDeleted ActivityType = "StatusDeleted"
+	// ActivityFollowAccepted is the activity type of FollowAccepted messages
+	ActivityFollowAccepted ActivityType = "FollowAccepted"
+	// ActivityAccountUpdated is the activity type of AccountUpdated messages
+	ActivityAccountUpdated ActivityType = "AccountUpdated"
+)
+
+// Message is something that happened on this instance, and that may have side effects like timeline
+// updates, notifications or federation, which are taken care of by the handlers registered for its activity type.
+type Message interface {
+	// ActivityType returns the kind of thing that the message is about.
+	ActivityType() ActivityType
+	// Key returns the id of the thing that the message is about. Messages with the same key are handled one at a time,
+	// in the order they were sent.
+	Key() string
+}
+
+// StatusCreated is sent when a status has been created and stored in the database.
+type StatusCreated struct {
+	// The status that was created
+	Status *model.Status
+	// Did the status come in through federation, rather than being created through the client API?
+	// If so, it doesn't need to be federated out again.
+	FromFederation bool
+}
+
+// ActivityType returns ActivityStatusCreated.
+func (StatusCreated) ActivityType() ActivityType {
+	return ActivityStatusCreated
+}
+
+// Key returns the id of the status.
+func (m StatusCreated) Key() string {
+	if m.Status == nil {
+		return ""
+	}
+	return m.Status.ID
+}
+
+// StatusDeleted is sent when a status has been removed from the database.
+type StatusDeleted struct {
+	// The status that was deleted, as it was before it was deleted
+	Status *model.Status
+	// Did the delete come in through federation, rather than being made through the client API?
+	// If so, it doesn't need to be federated out again.
+	FromFederation bool
+}
+
+// ActivityType returns ActivityStatusDeleted.
+func (StatusDeleted) ActivityType() ActivityType {
+	return ActivityStatusDeleted
+}
+
+// Key returns the id of the status.
+func (m StatusDeleted) Key() string {
+	if m.Status == nil {
+		return ""
+	}
+	return m.Status.ID
+}
+
+// FollowAccepted is sent when a follow request has been accepted and stored in the database as a follow.
+type FollowAccepted struct {
+	// The follow that now exists
+	Follow *model.Follow
+	// Was the follow accepted by a remote account through federation, rather than by a local account through the client API?
+	FromFederation bool
+}
+
+// ActivityType returns ActivityFollowAccepted.
+func (FollowAccepted) ActivityType() ActivityType {
+	return ActivityFollowAccepted
+}
+
+// Key returns the id of the account that follows.
+func (m FollowAccepted) Key() string {
+	if m.Follow == nil {
+		return ""
+	}
+	return m.Follow.AccountID
+}
+
+// AccountUpdated is sent when the profile of an account has been updated in the database.
+type AccountUpdated struct {
+	// The account after the update
+	Account *model.Account
+	// Did the update come in through federation, rather than being made through the client API?
+	FromFederation bool
+}
+
+// ActivityType returns ActivityAccountUpdated.
+func (AccountUpdated) ActivityType() ActivityType {
+	return ActivityAccountUpdated
+}
+
+// Key returns the id of the account.
+func (m AccountUpdated) Key() string {
+	if m.Account == nil {
+		return ""
+	}
+	return m.Account.ID
+}
@@ -2,40 +2,31 @@
 
 package distributor
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+)
 
 // MockDistributor is an autogenerated mock type for the Distributor type
 type MockDistributor struct {
 	mock.Mock
 }
 
-// ClientAPIIn provides a mock function with given fields:
-func (_m *MockDistributor) ClientAPIIn() chan interface{} {
-	ret := _m.Called()
-
-	var r0 chan interface{}
-	if rf, ok := ret.Get(0).(func() chan interface{}); ok {
-		r0 = rf()
-	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(chan interface{})
-		}
-	}
-
-	return r0
+// Register provides a mock function with given fields: activityType, handler
+func (_m *MockDistributor) Register(activityType ActivityType, handler Handler) {
+	_m.Called(activityType, handler)
 }
 
-// ClientAPIOut provides a mock function with given fields:
-func (_m *MockDistributor) ClientAPIOut() chan interface{} {
-	ret := _m.Called()
+// Send provides a mock function with given fields: ctx, msg
+func (_m *MockDistributor) Send(ctx context.Context, msg Message) error {
+	ret := _m.Called(ctx, msg)
 
-	var r0 chan interface{}
-	if rf, ok := ret.Get(0).(func() chan interface{}); ok {
-		r0 = rf()
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, Message) error); ok {
+		r0 = rf(ctx, msg)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(chan interface{})
-		}
+		r0 = ret.Error(0)
 	}
 
 	return r0
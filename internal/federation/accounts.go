@@ -0,0 +1,102 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+	"github.com/superseriousbusiness/gotosocial/internal/typeutils"
+)
+
+// backfillFollowed queues the account that was just followed to be backfilled, now that one of our accounts follows it.
+// Backfilling does nothing for local accounts, or unless greedy federation is enabled.
+func (f *federator) backfillFollowed(ctx context.Context, msg distributor.Message) error {
+	accepted, ok := msg.(distributor.FollowAccepted)
+	if !ok {
+		return fmt.Errorf("expected FollowAccepted but got %T", msg)
+	}
+
+	followed := &model.Account{}
+	if err := f.db.GetByID(accepted.Follow.TargetAccountID, followed); err != nil {
+		return fmt.Errorf("error getting followed account %s: %s", accepted.Follow.TargetAccountID, err)
+	}
+	f.Backfill(followed)
+	return nil
+}
+
+// federateAccountUpdated queues an Update of a local account that was changed through the client API, for delivery
+// to the inboxes of its remote followers.
+func (f *federator) federateAccountUpdated(ctx context.Context, msg distributor.Message) error {
+	updated, ok := msg.(distributor.AccountUpdated)
+	if !ok {
+		return fmt.Errorf("expected AccountUpdated but got %T", msg)
+	}
+	account := updated.Account
+	if updated.FromFederation || account.Domain != "" {
+		return nil
+	}
+
+	followers := []model.Follow{}
+	if err := f.db.GetFollowersByAccountID(account.ID, &followers); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return fmt.Errorf("error getting followers of %s: %s", account.ID, err)
+		}
+	}
+	followerIDs := make([]string, 0, len(followers))
+	for _, follow := range followers {
+		followerIDs = append(followerIDs, follow.AccountID)
+	}
+	recipients, err := f.remoteInboxes(followerIDs)
+	if err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	accountIRI, err := url.Parse(account.URI)
+	if err != nil {
+		return fmt.Errorf("error parsing uri of account %s: %s", account.ID, err)
+	}
+	person, err := f.db.Federation().Get(ctx, accountIRI)
+	if err != nil {
+		return fmt.Errorf("error converting account %s: %s", account.ID, err)
+	}
+	update, err := typeutils.AccountUpdateToAS(account, person, f.Now())
+	if err != nil {
+		return fmt.Errorf("error converting update of account %s: %s", account.ID, err)
+	}
+
+	m, err := streams.Serialize(update)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return f.queueDelivery(account, b, recipients)
+}
@@ -0,0 +1,328 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-fed/httpsig"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/typeutils"
+)
+
+const (
+	// maxClockSkew is the maximum difference we tolerate between the Date header
+	// of a signed request and our own clock, in either direction.
+	maxClockSkew = 1 * time.Hour
+	// maxFetchSize is the maximum number of bytes we'll read when fetching a remote object.
+	maxFetchSize = 1 << 20
+	// maxInboxSize is the maximum number of bytes we'll read from a request posted to one of our inboxes.
+	maxInboxSize = 1 << 20
+	// activityStreamsAccept is the accept header value used when dereferencing activitypub objects.
+	activityStreamsAccept = `application/activity+json, application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+)
+
+// signatureAlgorithms are the algorithms we will attempt to verify an http signature with, in order.
+var signatureAlgorithms = []httpsig.Algorithm{httpsig.RSA_SHA256, httpsig.RSA_SHA512}
+
+// ctxKey is used for setting and retrieving values on the context passed through go-fed.
+type ctxKey string
+
+const (
+	// ctxRequestingAccount is the context key for the *model.Account that signed the current request. It's shared with
+	// the federating database, which checks that what's created in it comes from that account.
+	ctxRequestingAccount = db.CtxRequestingAccount
+	// ctxSharedInboxAccount is the context key for the *model.Account that signed a delivery to the shared inbox.
+	// It's set while the delivery is passed on to the inboxes of local accounts, since it's been authenticated already.
+	ctxSharedInboxAccount ctxKey = "sharedInboxAccount"
+)
+
+// authenticateRequest verifies the draft-cavage http signature on the given request, and returns the
+// account that the signing key belongs to. If the key is not yet known to us, it will be fetched from
+// the remote server and stored on the owning account.
+//
+// An error will be returned if the signature is missing or invalid, if the Date header is too far from
+// our own clock, if the Digest header doesn't match the body (for requests with a body), or if the key
+// can't be retrieved.
+func (f *federator) authenticateRequest(ctx context.Context, r *http.Request) (*model.Account, error) {
+	l := f.log.WithField("func", "authenticateRequest")
+
+	// go's http server moves the Host header onto the request itself,
+	// but httpsig needs to find it in the headers if it's been signed
+	if r.Header.Get("Host") == "" {
+		r.Header.Set("Host", r.Host)
+	}
+
+	verifier, err := httpsig.NewVerifier(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not create http sig verifier: %s", err)
+	}
+
+	signed := signedHeaders(r)
+	if !signed["(request-target)"] || !signed["date"] {
+		return nil, errors.New("signature must cover at least (request-target) and date")
+	}
+
+	if err := f.checkDate(r); err != nil {
+		return nil, err
+	}
+
+	if r.Method == http.MethodPost {
+		if !signed["digest"] {
+			return nil, errors.New("signature on POST request must cover digest")
+		}
+		if err := checkDigest(r); err != nil {
+			return nil, err
+		}
+	}
+
+	keyID, err := url.Parse(verifier.KeyId())
+	if err != nil {
+		return nil, fmt.Errorf("could not parse key id %s: %s", verifier.KeyId(), err)
+	}
+	l.Tracef("verifying request signed with key %s", keyID)
+
+	account, err := f.getAccountForKey(ctx, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get public key %s: %s", keyID, err)
+	}
+	if !account.DeletedAt.IsZero() {
+		return nil, fmt.Errorf("account %s has been deleted", account.URI)
+	}
+
+	if verify(verifier, account) {
+		return account, nil
+	}
+
+	// the account may have rotated its key since we last fetched it, so try again with a fresh copy
+	if account.Domain != "" && f.Now().Sub(account.LastFetchedAt) >= minKeyRefreshInterval {
+		l.Debugf("refreshing account %s in case its key has changed", account.URI)
+		refreshed, err := f.refreshAccount(ctx, account)
+		if err != nil {
+			return nil, fmt.Errorf("could not refresh account %s: %s", account.URI, err)
+		}
+		if refreshed.PublicKeyURI == keyID.String() && verify(verifier, refreshed) {
+			return refreshed, nil
+		}
+	}
+	return nil, fmt.Errorf("signature could not be verified with key %s", keyID)
+}
+
+// verify returns true if the signature checked by the given verifier was made with the public key of the given account.
+func verify(verifier httpsig.Verifier, account *model.Account) bool {
+	for _, algo := range signatureAlgorithms {
+		if err := verifier.Verify(account.PublicKey, algo); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticateGet authenticates a GET request for something that's public, but that may be shown differently depending on who's asking.
+// It returns the account that signed the request, or nil if the request isn't signed.
+func (f *federator) AuthenticateGet(ctx context.Context, r *http.Request) (*model.Account, error) {
+	if r.Header.Get("Signature") == "" && r.Header.Get("Authorization") == "" {
+		return nil, nil
+	}
+	return f.authenticateRequest(ctx, r)
+}
+
+// checkDate makes sure that the Date header of the given request exists, and is within maxClockSkew of now.
+func (f *federator) checkDate(r *http.Request) error {
+	dateHeader := r.Header.Get("Date")
+	if dateHeader == "" {
+		return errors.New("no date header set on request")
+	}
+	date, err := http.ParseTime(dateHeader)
+	if err != nil {
+		return fmt.Errorf("could not parse date header %s: %s", dateHeader, err)
+	}
+	skew := f.Now().Sub(date)
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		return fmt.Errorf("date header %s is too far from current time", dateHeader)
+	}
+	return nil
+}
+
+// checkDigest reads the body of the given request, up to maxInboxSize bytes, and makes sure it matches the request's Digest header.
+// The body of the request will be replaced so that it can be read again further down the line.
+func checkDigest(r *http.Request) error {
+	digestHeader := r.Header.Get("Digest")
+	if digestHeader == "" {
+		return errors.New("no digest header set on request")
+	}
+
+	var body []byte
+	if r.Body != nil {
+		b, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxInboxSize))
+		if err != nil {
+			return fmt.Errorf("could not read request body: %s", err)
+		}
+		r.Body.Close()
+		body = b
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	// a digest header may contain several comma-separated digests, we just need one we understand to match
+	for _, d := range strings.Split(digestHeader, ",") {
+		parts := strings.SplitN(strings.TrimSpace(d), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		var h hash.Hash
+		switch strings.ToUpper(parts[0]) {
+		case "SHA-256":
+			h = sha256.New()
+		case "SHA-512":
+			h = sha512.New()
+		default:
+			continue
+		}
+
+		h.Write(body)
+		if base64.StdEncoding.EncodeToString(h.Sum(nil)) != parts[1] {
+			return errors.New("digest header does not match request body")
+		}
+		return nil
+	}
+	return fmt.Errorf("no supported algorithm found in digest header %s", digestHeader)
+}
+
+// signedHeaders returns a set of the (lowercased) header names covered by the http signature of the given request.
+func signedHeaders(r *http.Request) map[string]bool {
+	sig := r.Header.Get("Signature")
+	if sig == "" {
+		sig = strings.TrimPrefix(r.Header.Get("Authorization"), "Signature ")
+	}
+
+	headers := "date" // default as per the draft spec if no headers parameter is given
+	for _, param := range strings.Split(sig, ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 && kv[0] == "headers" {
+			headers = strings.Trim(kv[1], `"`)
+		}
+	}
+
+	signed := make(map[string]bool)
+	for _, h := range strings.Fields(headers) {
+		signed[strings.ToLower(h)] = true
+	}
+	return signed
+}
+
+// getAccountForKey returns the account that owns the public key with the given id. If we haven't seen the key
+// before, it will be dereferenced, and either stored on the existing account it belongs to, or on a new account.
+//
+// The dereferenced actor has to be on the same host as the key, so that one server can't claim the accounts of another,
+// or of this instance. Only the key of an existing account is updated: the rest of its profile is left to refreshAccount.
+func (f *federator) getAccountForKey(ctx context.Context, keyID *url.URL) (*model.Account, error) {
+	account := &model.Account{}
+	err := f.db.GetWhere("public_key_uri", keyID.String(), account)
+	if err == nil && account.PublicKey != nil {
+		// we already have this key so no need to go fetch it
+		return account, nil
+	}
+	if err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return nil, fmt.Errorf("database error: %s", err)
+		}
+	}
+
+	// we don't know the key yet so we need to dereference it
+	if keyID.Host == f.config.Host {
+		return nil, errors.New("key belongs to a local account but was not found in the database")
+	}
+	if blocked, err := f.domainBlocked(keyID.Host); err != nil {
+		return nil, err
+	} else if blocked {
+		return nil, fmt.Errorf("not fetching key %s since its domain is blocked", keyID)
+	}
+	remote, err := f.fetchRemoteAccount(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if remote.PublicKeyURI != keyID.String() {
+		return nil, fmt.Errorf("remote account %s does not own key %s", remote.URI, keyID)
+	}
+	remoteURI, err := url.Parse(remote.URI)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse uri %s of remote account: %s", remote.URI, err)
+	}
+	if remoteURI.Host != keyID.Host {
+		return nil, fmt.Errorf("remote account %s is not on the same host as key %s", remote.URI, keyID)
+	}
+
+	// see if we already have the account that owns the key, in which case it's rotated its key, so bring it up to date
+	account = &model.Account{}
+	if err := f.db.GetWhere("uri", remote.URI, account); err == nil {
+		if account.Domain == "" {
+			return nil, fmt.Errorf("remote account %s claims to be local account %s", remote.URI, account.ID)
+		}
+		account.PublicKey = remote.PublicKey
+		account.PublicKeyURI = remote.PublicKeyURI
+		if err := f.db.UpdateByID(account.ID, account); err != nil {
+			return nil, fmt.Errorf("database error updating public key of account %s: %s", account.URI, err)
+		}
+		return account, nil
+	} else if _, ok := err.(db.ErrNoEntries); !ok {
+		return nil, fmt.Errorf("database error: %s", err)
+	}
+
+	// it's a completely new account to us so store it
+	if err := f.db.Put(remote); err != nil {
+		return nil, fmt.Errorf("database error storing account %s: %s", remote.URI, err)
+	}
+	return remote, nil
+}
+
+// fetchRemoteAccount dereferences the given IRI (which may be the id of an actor, or the id of
+// an actor's public key) with a signed request, and converts the response into a model account.
+// The account will not have been stored in the database.
+func (f *federator) fetchRemoteAccount(ctx context.Context, iri *url.URL) (*model.Account, error) {
+	t, err := f.dereferenceSigned(ctx, iri)
+	if err != nil {
+		return nil, err
+	}
+
+	accountable, ok := t.(typeutils.Accountable)
+	if !ok {
+		return nil, fmt.Errorf("response from %s was of type %s, which is not an account", iri, t.GetTypeName())
+	}
+
+	account, err := typeutils.ASRepresentationToAccount(accountable)
+	if err != nil {
+		return nil, err
+	}
+	account.LastFetchedAt = f.Now()
+	return account, nil
+}
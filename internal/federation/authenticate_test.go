@@ -0,0 +1,391 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-fed/httpsig"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/transport"
+)
+
+type AuthenticateTestSuite struct {
+	suite.Suite
+	log          *logrus.Logger
+	config       *config.Config
+	remoteKey    *rsa.PrivateKey
+	instance     *model.Account
+	remoteServer *httptest.Server
+	remoteActor  string
+	remoteKeyID  string
+	// servedID is the id that the stand-in remote server gives its actor, which is normally remoteActor
+	servedID  string
+	mockDB    *db.MockDB
+	federator *federator
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *AuthenticateTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	c := config.Empty()
+	c.Protocol = "http"
+	c.Host = "localhost:8080"
+	suite.config = c
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	suite.remoteKey = key
+
+	instanceKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	suite.instance = &model.Account{
+		ID:           "instance-account-id",
+		Username:     "localhost:8080",
+		PublicKeyURI: "http://localhost:8080/users/localhost:8080#main-key",
+		PrivateKey:   instanceKey,
+		PublicKey:    &instanceKey.PublicKey,
+	}
+}
+
+// SetupTest starts a stand-in remote server serving an actor with a public key, and a fresh federator
+func (suite *AuthenticateTestSuite) SetupTest() {
+	pubBytes, err := x509.MarshalPKIXPublicKey(&suite.remoteKey.PublicKey)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	pubPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes})
+
+	mux := http.NewServeMux()
+	suite.remoteServer = httptest.NewServer(mux)
+	suite.remoteActor = suite.remoteServer.URL + "/users/remote_user"
+	suite.remoteKeyID = suite.remoteActor + "#main-key"
+	suite.servedID = suite.remoteActor
+	mux.HandleFunc("/users/remote_user", func(w http.ResponseWriter, r *http.Request) {
+		// like servers running in authorized fetch mode, only answer requests signed by the instance account
+		verifier, err := httpsig.NewVerifier(r)
+		if err != nil || verifier.KeyId() != suite.instance.PublicKeyURI || verifier.Verify(suite.instance.PublicKey, httpsig.RSA_SHA256) != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/activity+json")
+		fmt.Fprintf(w, `{
+			"@context": ["https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"],
+			"id": %q,
+			"type": "Person",
+			"preferredUsername": "remote_user",
+			"name": "Remote User",
+			"inbox": %q,
+			"outbox": %q,
+			"publicKey": {"id": %q, "owner": %q, "publicKeyPem": %q}
+		}`, suite.servedID, suite.remoteActor+"/inbox", suite.remoteActor+"/outbox", suite.remoteKeyID, suite.servedID, string(pubPem))
+	})
+
+	suite.mockDB = &db.MockDB{}
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainBlock")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainAllow")).Return(db.ErrNoEntries{})
+	suite.federator = &federator{
+		db:       suite.mockDB,
+		config:   suite.config,
+		log:      suite.log,
+		client:   suite.remoteServer.Client(),
+		domains:  newDomainCache(suite.mockDB, domainCacheTTL),
+		instance: suite.instance,
+	}
+	suite.federator.transportController = transport.NewController(suite.config, suite.federator, suite.remoteServer.Client(), suite.log)
+}
+
+// TearDownTest shuts down the stand-in remote server
+func (suite *AuthenticateTestSuite) TearDownTest() {
+	suite.remoteServer.Close()
+}
+
+// signedPost returns a POST request to a local inbox, signed by the remote key with the given date
+func (suite *AuthenticateTestSuite) signedPost(body []byte, date time.Time) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "http://localhost:8080/users/local_user/inbox", bytes.NewReader(body))
+	r.Header.Set("Date", date.UTC().Format(http.TimeFormat))
+	r.Header.Set("Content-Type", "application/activity+json")
+	r.Header.Set("Host", r.Host)
+	signer, _, err := httpsig.NewSigner([]httpsig.Algorithm{httpsig.RSA_SHA256}, httpsig.DigestSha256, []string{"(request-target)", "host", "date", "digest"}, httpsig.Signature, 0)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	if err := signer.SignRequest(suite.remoteKey, suite.remoteKeyID, r, body); err != nil {
+		suite.FailNow(err.Error())
+	}
+	return r
+}
+
+// expectUnknownKey sets the mock db up to not know anything about the remote account
+func (suite *AuthenticateTestSuite) expectUnknownKey() {
+	suite.mockDB.On("GetWhere", "public_key_uri", suite.remoteKeyID, mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetWhere", "uri", suite.remoteActor, mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *AuthenticateTestSuite) TestAuthenticatePostInboxFetchesUnknownKey() {
+	suite.expectUnknownKey()
+	var stored *model.Account
+	suite.mockDB.On("Put", mock.AnythingOfType("*model.Account")).Run(func(args mock.Arguments) {
+		stored = args.Get(0).(*model.Account)
+	}).Return(nil)
+
+	w := httptest.NewRecorder()
+	ctx, authed, err := suite.federator.AuthenticatePostInbox(context.Background(), w, suite.signedPost([]byte(`{"type":"Follow"}`), time.Now()))
+	suite.NoError(err)
+	suite.True(authed)
+
+	if assert.NotNil(suite.T(), stored) {
+		suite.Equal(suite.remoteActor, stored.URI)
+		suite.Equal("remote_user", stored.Username)
+		suite.Equal(suite.remoteKeyID, stored.PublicKeyURI)
+		suite.Equal(suite.remoteKey.PublicKey.N, stored.PublicKey.N)
+	}
+
+	requester, ok := ctx.Value(ctxRequestingAccount).(*model.Account)
+	suite.True(ok)
+	suite.Equal(suite.remoteActor, requester.URI)
+}
+
+func (suite *AuthenticateTestSuite) TestAuthenticatePostInboxCachedKey() {
+	// shut the remote server down so that any attempt to fetch the key will fail
+	suite.remoteServer.Close()
+	suite.mockDB.On("GetWhere", "public_key_uri", suite.remoteKeyID, mock.AnythingOfType("*model.Account")).Run(func(args mock.Arguments) {
+		a := args.Get(2).(*model.Account)
+		a.URI = suite.remoteActor
+		a.PublicKeyURI = suite.remoteKeyID
+		a.PublicKey = &suite.remoteKey.PublicKey
+	}).Return(nil)
+
+	w := httptest.NewRecorder()
+	_, authed, err := suite.federator.AuthenticatePostInbox(context.Background(), w, suite.signedPost([]byte(`{"type":"Follow"}`), time.Now()))
+	suite.NoError(err)
+	suite.True(authed)
+}
+
+func (suite *AuthenticateTestSuite) TestAuthenticatePostInboxRotatedKey() {
+	// we have the account, but with the key it had before it was rotated
+	suite.mockDB.On("GetWhere", "public_key_uri", suite.remoteKeyID, mock.AnythingOfType("*model.Account")).Run(func(args mock.Arguments) {
+		a := args.Get(2).(*model.Account)
+		a.ID = "remote-account-id"
+		a.URI = suite.remoteActor
+		a.Domain = "remote.example"
+		a.PublicKeyURI = suite.remoteKeyID
+		a.PublicKey = suite.instance.PublicKey
+		a.LastFetchedAt = time.Now().Add(-time.Hour)
+	}).Return(nil)
+	var updated *model.Account
+	suite.mockDB.On("UpdateByID", "remote-account-id", mock.AnythingOfType("*model.Account")).Run(func(args mock.Arguments) {
+		updated = args.Get(1).(*model.Account)
+	}).Return(nil)
+	suite.mockDB.On("DeleteWhere", "domain", "remote.example", mock.AnythingOfType("*model.UnavailableDomain")).Return(nil)
+
+	w := httptest.NewRecorder()
+	_, authed, err := suite.federator.AuthenticatePostInbox(context.Background(), w, suite.signedPost([]byte(`{"type":"Follow"}`), time.Now()))
+	suite.NoError(err)
+	suite.True(authed)
+	if assert.NotNil(suite.T(), updated) {
+		suite.True(suite.remoteKey.PublicKey.Equal(updated.PublicKey))
+		suite.Equal("Remote User", updated.DisplayName)
+		suite.WithinDuration(time.Now(), updated.LastFetchedAt, time.Minute)
+	}
+}
+
+func (suite *AuthenticateTestSuite) TestAuthenticatePostInboxNewKeyOfKnownAccount() {
+	// we know the account, but not by this key, so it's been rotated to a new key id
+	suite.mockDB.On("GetWhere", "public_key_uri", suite.remoteKeyID, mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetWhere", "uri", suite.remoteActor, mock.AnythingOfType("*model.Account")).Run(func(args mock.Arguments) {
+		a := args.Get(2).(*model.Account)
+		a.ID = "remote-account-id"
+		a.URI = suite.remoteActor
+		a.Domain = "remote.example"
+		a.DisplayName = "What We Had Before"
+		a.PublicKeyURI = suite.remoteActor + "#old-key"
+		a.PublicKey = suite.instance.PublicKey
+	}).Return(nil)
+	var updated *model.Account
+	suite.mockDB.On("UpdateByID", "remote-account-id", mock.AnythingOfType("*model.Account")).Run(func(args mock.Arguments) {
+		updated = args.Get(1).(*model.Account)
+	}).Return(nil)
+
+	w := httptest.NewRecorder()
+	_, authed, err := suite.federator.AuthenticatePostInbox(context.Background(), w, suite.signedPost([]byte(`{"type":"Follow"}`), time.Now()))
+	suite.NoError(err)
+	suite.True(authed)
+	if assert.NotNil(suite.T(), updated) {
+		suite.True(suite.remoteKey.PublicKey.Equal(updated.PublicKey))
+		suite.Equal(suite.remoteKeyID, updated.PublicKeyURI)
+		// only the key is taken from the fetched actor
+		suite.Equal("What We Had Before", updated.DisplayName)
+	}
+}
+
+func (suite *AuthenticateTestSuite) TestAuthenticatePostInboxActorOnOtherHost() {
+	// the remote server claims its key belongs to an account on another server
+	suite.servedID = "https://victim.example/users/victim"
+	suite.mockDB.On("GetWhere", "public_key_uri", suite.remoteKeyID, mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+
+	w := httptest.NewRecorder()
+	_, authed, err := suite.federator.AuthenticatePostInbox(context.Background(), w, suite.signedPost([]byte(`{"type":"Follow"}`), time.Now()))
+	suite.NoError(err)
+	suite.False(authed)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+	suite.mockDB.AssertNotCalled(suite.T(), "UpdateByID", mock.Anything, mock.Anything)
+}
+
+func (suite *AuthenticateTestSuite) TestAuthenticatePostInboxActorClaimsLocalAccount() {
+	// the remote server claims its key belongs to one of our own accounts
+	suite.servedID = "http://localhost:8080/users/local_user"
+	suite.mockDB.On("GetWhere", "public_key_uri", suite.remoteKeyID, mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetWhere", "uri", suite.servedID, mock.AnythingOfType("*model.Account")).Run(func(args mock.Arguments) {
+		a := args.Get(2).(*model.Account)
+		a.ID = "local-account-id"
+		a.URI = suite.servedID
+	}).Return(nil)
+
+	w := httptest.NewRecorder()
+	_, authed, err := suite.federator.AuthenticatePostInbox(context.Background(), w, suite.signedPost([]byte(`{"type":"Follow"}`), time.Now()))
+	suite.NoError(err)
+	suite.False(authed)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+	suite.mockDB.AssertNotCalled(suite.T(), "UpdateByID", mock.Anything, mock.Anything)
+}
+
+func (suite *AuthenticateTestSuite) TestAuthenticatePostInboxWrongKeyRecentlyFetched() {
+	// the account was fetched just now, so a signature that doesn't match its key is just wrong
+	suite.mockDB.On("GetWhere", "public_key_uri", suite.remoteKeyID, mock.AnythingOfType("*model.Account")).Run(func(args mock.Arguments) {
+		a := args.Get(2).(*model.Account)
+		a.ID = "remote-account-id"
+		a.URI = suite.remoteActor
+		a.Domain = "remote.example"
+		a.PublicKeyURI = suite.remoteKeyID
+		a.PublicKey = suite.instance.PublicKey
+		a.LastFetchedAt = time.Now()
+	}).Return(nil)
+
+	w := httptest.NewRecorder()
+	_, authed, err := suite.federator.AuthenticatePostInbox(context.Background(), w, suite.signedPost([]byte(`{"type":"Follow"}`), time.Now()))
+	suite.NoError(err)
+	suite.False(authed)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+	suite.mockDB.AssertNotCalled(suite.T(), "UpdateByID", mock.Anything, mock.Anything)
+}
+
+func (suite *AuthenticateTestSuite) TestAuthenticatePostInboxBadDigest() {
+	suite.expectUnknownKey()
+	suite.mockDB.On("Put", mock.AnythingOfType("*model.Account")).Return(nil)
+
+	r := suite.signedPost([]byte(`{"type":"Follow"}`), time.Now())
+	// swap out the body after signing
+	r.Body = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"type":"Delete"}`))).Body
+
+	w := httptest.NewRecorder()
+	_, authed, err := suite.federator.AuthenticatePostInbox(context.Background(), w, r)
+	suite.NoError(err)
+	suite.False(authed)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+}
+
+func (suite *AuthenticateTestSuite) TestAuthenticatePostInboxBodyTooLarge() {
+	suite.expectUnknownKey()
+	suite.mockDB.On("Put", mock.AnythingOfType("*model.Account")).Return(nil)
+
+	body := append([]byte(`{"type":"Note","content":"`), bytes.Repeat([]byte("a"), maxInboxSize)...)
+	body = append(body, []byte(`"}`)...)
+
+	w := httptest.NewRecorder()
+	_, authed, err := suite.federator.AuthenticatePostInbox(context.Background(), w, suite.signedPost(body, time.Now()))
+	suite.NoError(err)
+	suite.False(authed)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+}
+
+func (suite *AuthenticateTestSuite) TestAuthenticatePostInboxClockSkew() {
+	w := httptest.NewRecorder()
+	_, authed, err := suite.federator.AuthenticatePostInbox(context.Background(), w, suite.signedPost([]byte(`{"type":"Follow"}`), time.Now().Add(-2*time.Hour)))
+	suite.NoError(err)
+	suite.False(authed)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthenticateTestSuite) TestAuthenticatePostInboxUnknownKey() {
+	suite.remoteKeyID = suite.remoteServer.URL + "/users/nobody#main-key"
+	suite.mockDB.On("GetWhere", "public_key_uri", suite.remoteKeyID, mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+
+	w := httptest.NewRecorder()
+	_, authed, err := suite.federator.AuthenticatePostInbox(context.Background(), w, suite.signedPost([]byte(`{"type":"Follow"}`), time.Now()))
+	suite.NoError(err)
+	suite.False(authed)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthenticateTestSuite) TestAuthenticatePostInboxUnsigned() {
+	r := httptest.NewRequest(http.MethodPost, "http://localhost:8080/users/local_user/inbox", bytes.NewReader([]byte(`{"type":"Follow"}`)))
+	w := httptest.NewRecorder()
+	_, authed, err := suite.federator.AuthenticatePostInbox(context.Background(), w, r)
+	suite.NoError(err)
+	suite.False(authed)
+	suite.Equal(http.StatusUnauthorized, w.Code)
+}
+
+func (suite *AuthenticateTestSuite) TestAuthenticateGetOutboxAnonymous() {
+	r := httptest.NewRequest(http.MethodGet, "http://localhost:8080/users/local_user/outbox", nil)
+	w := httptest.NewRecorder()
+	_, authed, err := suite.federator.AuthenticateGetOutbox(context.Background(), w, r)
+	suite.NoError(err)
+	suite.True(authed)
+}
+
+func TestAuthenticateTestSuite(t *testing.T) {
+	suite.Run(t, new(AuthenticateTestSuite))
+}
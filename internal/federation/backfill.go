@@ -0,0 +1,388 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/typeutils"
+)
+
+const (
+	// backfillQueueSize is how many accounts can be waiting to be backfilled before we start dropping them.
+	backfillQueueSize = 100
+	// backfillWorkers is how many accounts are backfilled at once.
+	backfillWorkers = 2
+	// backfillInterval is how long we wait before backfilling the same account again.
+	backfillInterval = 1 * time.Hour
+)
+
+// backfiller queues remote accounts to be backfilled in the background, and keeps track of which ones were backfilled recently.
+type backfiller struct {
+	queue  chan *model.Account
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	recent map[string]time.Time
+}
+
+// newBackfiller returns a backfiller with an empty queue. Nothing will be backfilled until it's started.
+func newBackfiller() *backfiller {
+	return &backfiller{
+		queue:  make(chan *model.Account, backfillQueueSize),
+		recent: make(map[string]time.Time),
+	}
+}
+
+// claim returns true if the account with the given uri hasn't been backfilled recently, and marks it as backfilled now.
+func (b *backfiller) claim(uri string, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for u, t := range b.recent {
+		if now.Sub(t) >= backfillInterval {
+			delete(b.recent, u)
+		}
+	}
+	if _, ok := b.recent[uri]; ok {
+		return false
+	}
+	b.recent[uri] = now
+	return true
+}
+
+// release forgets that the account with the given uri was claimed, so that it can be backfilled again straight away.
+func (b *backfiller) release(uri string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.recent, uri)
+}
+
+// Backfill queues the given remote account to have its outbox, featured collection and reply threads fetched
+// and stored in the background. It does nothing unless greedy federation is enabled.
+func (f *federator) Backfill(account *model.Account) {
+	l := f.log.WithField("func", "Backfill")
+
+	if f.backfiller == nil || account.Domain == "" {
+		return
+	}
+	if !f.backfiller.claim(account.URI, f.Now()) {
+		l.Tracef("account %s was backfilled recently", account.URI)
+		return
+	}
+	select {
+	case f.backfiller.queue <- account:
+	default:
+		l.Infof("backfill queue is full, not backfilling account %s", account.URI)
+		f.backfiller.release(account.URI)
+	}
+}
+
+// startBackfill starts the backfill workers, if greedy federation is enabled.
+func (f *federator) startBackfill() error {
+	if f.backfiller == nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	f.backfiller.cancel = cancel
+	for i := 0; i < backfillWorkers; i++ {
+		f.backfiller.wg.Add(1)
+		go func() {
+			defer f.backfiller.wg.Done()
+			for {
+				select {
+				case account := <-f.backfiller.queue:
+					f.backfillAccount(ctx, account)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// stopBackfill stops the backfill workers, abandoning any backfills that are still in progress.
+func (f *federator) stopBackfill() error {
+	if f.backfiller == nil || f.backfiller.cancel == nil {
+		return nil
+	}
+	f.backfiller.cancel()
+	f.backfiller.wg.Wait()
+	return nil
+}
+
+// backfillAccount fetches and stores the statuses in the outbox and featured collection of the given account,
+// along with their replies. Failures are logged rather than returned, since there's nobody waiting on the result.
+func (f *federator) backfillAccount(ctx context.Context, account *model.Account) {
+	l := f.log.WithField("func", "backfillAccount")
+	l.Debugf("backfilling account %s", account.URI)
+
+	maxDepth := f.config.FederationConfig.BackfillMaxDepth
+
+	if outbox, err := url.Parse(account.OutboxURL); err == nil && account.OutboxURL != "" {
+		if err := f.walkCollection(ctx, outbox, func(item *collectionItem) error {
+			return f.backfillActivity(ctx, item, maxDepth)
+		}); err != nil {
+			l.Infof("error backfilling outbox of account %s: %s", account.URI, err)
+		}
+	}
+
+	if featured, err := url.Parse(account.FeaturedCollectionURL); err == nil && account.FeaturedCollectionURL != "" {
+		if err := f.walkCollection(ctx, featured, func(item *collectionItem) error {
+			return f.backfillStatus(ctx, item, maxDepth)
+		}); err != nil {
+			l.Infof("error backfilling featured collection of account %s: %s", account.URI, err)
+		}
+	}
+}
+
+// backfillActivity backfills the status created by the given outbox item, if it's a Create of a Note.
+// Anything else, such as boosts, is skipped.
+func (f *federator) backfillActivity(ctx context.Context, item *collectionItem, depth int) error {
+	t := item.t
+	if t == nil {
+		if item.iri == nil {
+			return nil
+		}
+		var err error
+		if t, err = f.dereference(ctx, item.iri); err != nil {
+			return err
+		}
+	}
+	create, ok := t.(vocab.ActivityStreamsCreate)
+	if !ok {
+		return nil
+	}
+	objectProp := create.GetActivityStreamsObject()
+	if objectProp == nil {
+		return nil
+	}
+	for iter := objectProp.Begin(); iter != objectProp.End(); iter = iter.Next() {
+		if err := f.backfillStatus(ctx, newCollectionItem(iter, item.host), depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillStatus stores the status in the given collection item, and then the replies to it, down to the given depth.
+// Statuses that we already have are still checked for replies, as long as there's depth left to fetch them.
+func (f *federator) backfillStatus(ctx context.Context, item *collectionItem, depth int) error {
+	l := f.log.WithField("func", "backfillStatus")
+
+	if item.iri == nil {
+		return nil
+	}
+	if item.iri.Host == f.config.Host {
+		return nil
+	}
+
+	t := item.t
+	if t == nil {
+		if depth <= 0 {
+			if err := f.db.GetWhere("uri", item.iri.String(), &model.Status{}); err == nil {
+				return nil
+			} else if _, ok := err.(db.ErrNoEntries); !ok {
+				return err
+			}
+		}
+		var err error
+		if t, err = f.dereference(ctx, item.iri); err != nil {
+			return err
+		}
+		if id := t.GetJSONLDId(); id == nil || !id.IsIRI() || id.GetIRI().String() != item.iri.String() {
+			return fmt.Errorf("dereferenced status %s but got something with a different id", item.iri)
+		}
+	}
+	if _, ok := t.(typeutils.Statusable); !ok {
+		return nil
+	}
+
+	if _, err := f.storeStatus(ctx, t); err != nil {
+		// one bad status shouldn't stop the rest of the collection from being backfilled
+		l.Debugf("could not store status %s: %s", item.iri, err)
+		return nil
+	}
+
+	if depth <= 0 {
+		return nil
+	}
+	withReplies, ok := t.(interface {
+		GetActivityStreamsReplies() vocab.ActivityStreamsRepliesProperty
+	})
+	if !ok || withReplies.GetActivityStreamsReplies() == nil {
+		return nil
+	}
+	replies := newCollectionItem(withReplies.GetActivityStreamsReplies(), item.iri.Host)
+	if replies.iri == nil && replies.t == nil {
+		return nil
+	}
+	return f.walkCollectionItem(ctx, replies, func(reply *collectionItem) error {
+		return f.backfillStatus(ctx, reply, depth-1)
+	})
+}
+
+// iriOrType is satisfied by activitystreams properties and property iterators that hold either an IRI or an embedded type.
+type iriOrType interface {
+	IsIRI() bool
+	GetIRI() *url.URL
+	GetType() vocab.Type
+}
+
+// collectionItem is something found in a remote collection: the IRI of an object, and the object itself if it was
+// embedded in the collection and can be trusted.
+type collectionItem struct {
+	iri  *url.URL
+	t    vocab.Type
+	host string
+}
+
+// newCollectionItem returns a collection item for the given property, which was found on something served by the given host.
+// Embedded objects are only trusted if their id is on that same host, since anyone could embed anything. Objects with
+// other ids will have to be dereferenced from their own servers.
+func newCollectionItem(p iriOrType, host string) *collectionItem {
+	if p.IsIRI() {
+		return &collectionItem{iri: p.GetIRI(), host: host}
+	}
+	t := p.GetType()
+	if t == nil {
+		return &collectionItem{host: host}
+	}
+	id := t.GetJSONLDId()
+	if id == nil || !id.IsIRI() {
+		// anonymous objects, like pages embedded in a collection, can only have come from the host that embedded them
+		return &collectionItem{t: t, host: host}
+	}
+	if id.GetIRI().Host != host {
+		return &collectionItem{iri: id.GetIRI(), host: host}
+	}
+	return &collectionItem{iri: id.GetIRI(), t: t, host: host}
+}
+
+// walkCollection calls fn for each item in the collection at the given iri, following its pages until there are
+// no more, or until BackfillMaxPages pages have been looked at. The collection itself doesn't count as a page.
+func (f *federator) walkCollection(ctx context.Context, iri *url.URL, fn func(item *collectionItem) error) error {
+	return f.walkCollectionItem(ctx, &collectionItem{iri: iri, host: iri.Host}, fn)
+}
+
+func (f *federator) walkCollectionItem(ctx context.Context, next *collectionItem, fn func(item *collectionItem) error) error {
+	maxPages := f.config.FederationConfig.BackfillMaxPages
+	seen := make(map[string]bool)
+	pages := 0
+	for first := true; next != nil && pages < maxPages; first = false {
+		t := next.t
+		host := next.host
+		if t == nil {
+			if next.iri == nil || seen[next.iri.String()] {
+				return nil
+			}
+			seen[next.iri.String()] = true
+			var err error
+			if t, err = f.dereference(ctx, next.iri); err != nil {
+				return err
+			}
+			host = next.iri.Host
+		}
+
+		items, nextPage, isPage, err := collectionPage(t)
+		if err != nil {
+			return err
+		}
+		if isPage {
+			pages++
+		} else if !first {
+			// only the start of a walk should be a collection, everything after that should be pages
+			return nil
+		}
+
+		for _, item := range items {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(newCollectionItem(item, host)); err != nil {
+				return err
+			}
+		}
+
+		next = nil
+		if nextPage != nil {
+			next = newCollectionItem(nextPage, host)
+		}
+	}
+	return nil
+}
+
+// collectionPage returns the items of the given collection or collection page, and whatever should be looked at next:
+// the first page of a collection, or the next page of a page. isPage will be true if t was a page rather than a collection.
+func collectionPage(t vocab.Type) (items []iriOrType, next iriOrType, isPage bool, err error) {
+	var nextProp iriOrType
+
+	switch c := t.(type) {
+	case vocab.ActivityStreamsOrderedCollection:
+		items = orderedItems(c.GetActivityStreamsOrderedItems())
+		nextProp = c.GetActivityStreamsFirst()
+	case vocab.ActivityStreamsCollection:
+		items = unorderedItems(c.GetActivityStreamsItems())
+		nextProp = c.GetActivityStreamsFirst()
+	case vocab.ActivityStreamsOrderedCollectionPage:
+		items = orderedItems(c.GetActivityStreamsOrderedItems())
+		nextProp = c.GetActivityStreamsNext()
+		isPage = true
+	case vocab.ActivityStreamsCollectionPage:
+		items = unorderedItems(c.GetActivityStreamsItems())
+		nextProp = c.GetActivityStreamsNext()
+		isPage = true
+	default:
+		return nil, nil, false, fmt.Errorf("%s is not a collection", t.GetTypeName())
+	}
+
+	if nextProp != nil && (nextProp.IsIRI() || nextProp.GetType() != nil) {
+		next = nextProp
+	}
+	return items, next, isPage, nil
+}
+
+func orderedItems(p vocab.ActivityStreamsOrderedItemsProperty) []iriOrType {
+	items := []iriOrType{}
+	if p == nil {
+		return items
+	}
+	for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+		items = append(items, iter)
+	}
+	return items
+}
+
+func unorderedItems(p vocab.ActivityStreamsItemsProperty) []iriOrType {
+	items := []iriOrType{}
+	if p == nil {
+		return items
+	}
+	for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+		items = append(items, iter)
+	}
+	return items
+}
@@ -0,0 +1,263 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+// storingDatabase stands in for the federating db, and remembers the ids of everything created through it
+type storingDatabase struct {
+	recordingDatabase
+	mu      sync.Mutex
+	created map[string]bool
+}
+
+func (s *storingDatabase) Create(c context.Context, asType vocab.Type) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.created[asType.GetJSONLDId().GetIRI().String()] = true
+	return nil
+}
+
+func (s *storingDatabase) has(uri string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.created[uri]
+}
+
+type BackfillTestSuite struct {
+	suite.Suite
+	log          *logrus.Logger
+	remoteServer *httptest.Server
+	remote       string
+	account      *model.Account
+	requested    []string
+	mockDB       *db.MockDB
+	fdb          *storingDatabase
+	federator    *federator
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *BackfillTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+}
+
+// SetupTest starts a stand-in remote server with an account that has an outbox of two pages (and a third one that we
+// shouldn't get to), a featured collection, and a reply to one of its statuses. It also creates a fresh mock db that
+// knows about the remote account, and a greedy federator.
+func (suite *BackfillTestSuite) SetupTest() {
+	suite.requested = []string{}
+	mux := http.NewServeMux()
+	suite.remoteServer = httptest.NewTLSServer(mux)
+	suite.remote = suite.remoteServer.URL
+	actor := suite.remote + "/users/someone"
+
+	note := func(id string, replies string) string {
+		return fmt.Sprintf(`{"id": %q, "type": "Note", "attributedTo": %q, "content": "hello", "to": ["https://www.w3.org/ns/activitystreams#Public"]%s}`, id, actor, replies)
+	}
+	documents := map[string]string{
+		"/users/someone/outbox": fmt.Sprintf(`{"id": %q, "type": "OrderedCollection", "first": %q}`,
+			actor+"/outbox", actor+"/outbox?page=1"),
+		"/users/someone/outbox?page=1": fmt.Sprintf(`{"id": %q, "type": "OrderedCollectionPage", "next": %q, "orderedItems": [
+				{"id": %q, "type": "Create", "actor": %q, "object": %s},
+				{"id": %q, "type": "Announce", "actor": %q, "object": "https://elsewhere.example/statuses/1"}
+			]}`,
+			actor+"/outbox?page=1", actor+"/outbox?page=2",
+			actor+"/statuses/1/activity", actor,
+			note(actor+"/statuses/1", fmt.Sprintf(`, "replies": {"type": "Collection", "first": {"type": "CollectionPage", "items": [%q]}}`, suite.remote+"/users/someone/statuses/3")),
+			actor+"/statuses/9/activity", actor),
+		"/users/someone/outbox?page=2": fmt.Sprintf(`{"id": %q, "type": "OrderedCollectionPage", "next": %q, "orderedItems": [%q]}`,
+			actor+"/outbox?page=2", actor+"/outbox?page=3", actor+"/statuses/2/activity"),
+		"/users/someone/outbox?page=3": fmt.Sprintf(`{"id": %q, "type": "OrderedCollectionPage", "orderedItems": []}`, actor+"/outbox?page=3"),
+		"/users/someone/statuses/1":    note(actor+"/statuses/1", ""),
+		"/users/someone/statuses/2/activity": fmt.Sprintf(`{"id": %q, "type": "Create", "actor": %q, "object": %s}`,
+			actor+"/statuses/2/activity", actor, note(actor+"/statuses/2", "")),
+		"/users/someone/statuses/3": note(actor+"/statuses/3", ""),
+		"/users/someone/collections/featured": fmt.Sprintf(`{"id": %q, "type": "OrderedCollection", "orderedItems": [%q]}`,
+			actor+"/collections/featured", actor+"/statuses/1"),
+	}
+	var mu sync.Mutex
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		suite.requested = append(suite.requested, r.URL.RequestURI())
+		mu.Unlock()
+		doc, ok := documents[r.URL.RequestURI()]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/activity+json")
+		fmt.Fprint(w, `{"@context": "https://www.w3.org/ns/activitystreams", `+strings.TrimPrefix(doc, "{"))
+	})
+
+	suite.account = &model.Account{
+		ID:                    "remote-account-id",
+		Username:              "someone",
+		Domain:                strings.TrimPrefix(suite.remote, "https://"),
+		URI:                   actor,
+		OutboxURL:             actor + "/outbox",
+		FeaturedCollectionURL: actor + "/collections/featured",
+	}
+
+	suite.fdb = &storingDatabase{created: make(map[string]bool)}
+	suite.mockDB = &db.MockDB{}
+	suite.mockDB.On("Federation").Return(suite.fdb)
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainBlock")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainAllow")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetWhere", "uri", actor, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*model.Account) = *suite.account
+	})
+	suite.mockDB.On("GetWhere", "uri", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Status")).Return(func(key string, value interface{}, i interface{}) error {
+		if !suite.fdb.has(value.(string)) {
+			return db.ErrNoEntries{}
+		}
+		i.(*model.Status).URI = value.(string)
+		return nil
+	})
+
+	c := config.Empty()
+	c.Host = "localhost:8080"
+	c.FederationConfig.Greedy = true
+	c.FederationConfig.BackfillMaxPages = 2
+	c.FederationConfig.BackfillMaxDepth = 1
+	suite.federator = &federator{
+		db:         suite.mockDB,
+		config:     c,
+		log:        suite.log,
+		client:     suite.remoteServer.Client(),
+		domains:    newDomainCache(suite.mockDB, domainCacheTTL),
+		backfiller: newBackfiller(),
+	}
+}
+
+// TearDownTest shuts down the stand-in remote server
+func (suite *BackfillTestSuite) TearDownTest() {
+	suite.remoteServer.Close()
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *BackfillTestSuite) TestBackfillAccount() {
+	suite.federator.backfillAccount(context.Background(), suite.account)
+
+	// statuses from both pages of the outbox, and the reply to the first one
+	for _, id := range []string{"/statuses/1", "/statuses/2", "/statuses/3"} {
+		assert.True(suite.T(), suite.fdb.has(suite.account.URI+id), id)
+	}
+	assert.Len(suite.T(), suite.fdb.created, 3)
+	// we should have stopped after two pages, and not gone chasing the boosted status on another server
+	assert.NotContains(suite.T(), suite.requested, "/users/someone/outbox?page=3")
+	// the featured collection was looked at too, which means fetching status 1 for its replies
+	assert.Contains(suite.T(), suite.requested, "/users/someone/collections/featured")
+	assert.Contains(suite.T(), suite.requested, "/users/someone/statuses/1")
+}
+
+func (suite *BackfillTestSuite) TestBackfillNoDepth() {
+	suite.federator.config.FederationConfig.BackfillMaxDepth = 0
+	suite.federator.backfillAccount(context.Background(), suite.account)
+
+	assert.False(suite.T(), suite.fdb.has(suite.account.URI+"/statuses/3"))
+	// status 1 was already stored from the outbox, so there's no need to fetch it again for the featured collection
+	assert.NotContains(suite.T(), suite.requested, "/users/someone/statuses/1")
+}
+
+func (suite *BackfillTestSuite) TestBackfillInBackground() {
+	suite.NoError(suite.federator.Start())
+	suite.federator.Backfill(suite.account)
+
+	assert.Eventually(suite.T(), func() bool {
+		return suite.fdb.has(suite.account.URI + "/statuses/3")
+	}, 5*time.Second, 10*time.Millisecond)
+	suite.NoError(suite.federator.Stop())
+}
+
+func (suite *BackfillTestSuite) TestBackfillOnlyOnceInAWhile() {
+	suite.federator.Backfill(suite.account)
+	suite.federator.Backfill(suite.account)
+	assert.Len(suite.T(), suite.federator.backfiller.queue, 1)
+
+	// local accounts don't need backfilling
+	suite.federator.Backfill(&model.Account{URI: "http://localhost:8080/users/local_user"})
+	assert.Len(suite.T(), suite.federator.backfiller.queue, 1)
+}
+
+func (suite *BackfillTestSuite) TestBackfillRetriedWhenQueueFull() {
+	suite.federator.backfiller.queue = make(chan *model.Account)
+	suite.federator.Backfill(suite.account)
+	assert.NotContains(suite.T(), suite.federator.backfiller.recent, suite.account.URI)
+
+	// once there's room again, the account isn't mistaken for one that was backfilled recently
+	suite.federator.backfiller.queue = make(chan *model.Account, 1)
+	suite.federator.Backfill(suite.account)
+	assert.Len(suite.T(), suite.federator.backfiller.queue, 1)
+}
+
+func (suite *BackfillTestSuite) TestNotGreedy() {
+	suite.federator.backfiller = nil
+	suite.federator.Backfill(suite.account)
+	suite.NoError(suite.federator.Start())
+	suite.NoError(suite.federator.Stop())
+	assert.Empty(suite.T(), suite.requested)
+}
+
+func (suite *BackfillTestSuite) TestEmbeddedObjectsFromOtherHostsNotTrusted() {
+	note := streams.NewActivityStreamsNote()
+	id := streams.NewJSONLDIdProperty()
+	id.SetIRI(testURL("https://elsewhere.example/statuses/1"))
+	note.SetJSONLDId(id)
+	objectProp := streams.NewActivityStreamsObjectProperty()
+	objectProp.AppendActivityStreamsNote(note)
+
+	item := newCollectionItem(objectProp.Begin(), "example.org")
+	assert.Equal(suite.T(), "https://elsewhere.example/statuses/1", item.iri.String())
+	assert.Nil(suite.T(), item.t)
+
+	item = newCollectionItem(objectProp.Begin(), "elsewhere.example")
+	assert.NotNil(suite.T(), item.t)
+}
+
+func TestBackfillTestSuite(t *testing.T) {
+	suite.Run(t, new(BackfillTestSuite))
+}
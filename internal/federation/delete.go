@@ -0,0 +1,388 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+	"github.com/superseriousbusiness/gotosocial/internal/oauth"
+	"github.com/superseriousbusiness/gotosocial/internal/typeutils"
+)
+
+const (
+	// accountPurgePollInterval is how often we look for deleted accounts that still have things left to purge.
+	accountPurgePollInterval = 1 * time.Minute
+	// accountPurgeBatchSize is how many deleted accounts are purged at the same time.
+	accountPurgeBatchSize = 10
+	// statusPurgeBatchSize is how many statuses of a deleted account are removed in one go.
+	statusPurgeBatchSize = 100
+)
+
+// purger keeps track of the worker that removes what deleted accounts leave behind. Which accounts still need purging
+// is kept in the database, so that purging picks up where it left off after a restart.
+type purger struct {
+	wake   chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// newPurger returns a purger that won't purge anything until it's started.
+func newPurger() *purger {
+	return &purger{
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// DeleteAccount deletes the given account, by turning it into a tombstone that keeps nothing but what's needed to recognise
+// it. Deletes of local accounts are sent to the inboxes of every remote account we know about. The statuses, media, follows
+// and tokens of the account are removed in the background.
+func (f *federator) DeleteAccount(ctx context.Context, account *model.Account) error {
+	if !account.DeletedAt.IsZero() {
+		return nil
+	}
+
+	tombstone(account, f.Now())
+	if err := f.db.UpdateByID(account.ID, account); err != nil {
+		return fmt.Errorf("error tombstoning account %s: %s", account.ID, err)
+	}
+
+	if account.Domain == "" {
+		if err := f.federateAccountDelete(account); err != nil {
+			return fmt.Errorf("error sending delete of account %s: %s", account.ID, err)
+		}
+	}
+
+	if f.purger != nil {
+		select {
+		case f.purger.wake <- struct{}{}:
+		default:
+			// the worker has already been woken up
+		}
+	}
+	return nil
+}
+
+// tombstone clears everything that the given account says about itself, and marks it as deleted at the given time.
+// What's needed to recognise the account, such as its username, uris and keys, is kept.
+func tombstone(account *model.Account, now time.Time) {
+	account.DisplayName = ""
+	account.Note = ""
+	account.Fields = nil
+	account.AvatarFileName = ""
+	account.AvatarContentType = ""
+	account.AvatarFileSize = 0
+	account.AvatarRemoteURL = nil
+	account.HeaderFileName = ""
+	account.HeaderContentType = ""
+	account.HeaderFileSize = 0
+	account.HeaderRemoteURL = nil
+	account.Discoverable = false
+	account.MovedToAccountID = ""
+	account.AlsoKnownAs = nil
+	account.UpdatedAt = now
+	account.DeletedAt = now
+}
+
+// federateAccountDelete queues a Delete of the given local account for every remote inbox we know about, so that
+// everyone who might have a copy of the account gets to hear about it.
+func (f *federator) federateAccountDelete(account *model.Account) error {
+	inboxes := []string{}
+	if err := f.db.GetKnownInboxes(&inboxes); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return fmt.Errorf("error getting known inboxes: %s", err)
+		}
+	}
+	recipients := []*url.URL{}
+	for _, inbox := range inboxes {
+		iri, err := url.Parse(inbox)
+		if err != nil {
+			continue
+		}
+		recipients = append(recipients, iri)
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	del, err := typeutils.AccountDeleteToAS(account)
+	if err != nil {
+		return err
+	}
+	m, err := streams.Serialize(del)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return f.queueDelivery(account, b, recipients)
+}
+
+// delete handles a Delete once go-fed has removed what's being deleted from the database. The federating db leaves accounts
+// alone, so a remote account deleting itself is taken care of here.
+func (f *federator) delete(ctx context.Context, del vocab.ActivityStreamsDelete) error {
+	l := f.log.WithField("func", "delete")
+
+	actorIRI, err := typeutils.ExtractActor(del)
+	if err != nil {
+		return errors.New("delete had no actor")
+	}
+	objectIRI, err := typeutils.ExtractObject(del)
+	if err != nil || objectIRI.String() != actorIRI.String() {
+		// not an account deleting itself
+		return nil
+	}
+	if _, err := db.AccountForIRI(f.db, actorIRI); err != nil {
+		if _, ok := err.(db.ErrNoEntries); ok {
+			l.Debugf("not deleting account %s, since we don't know about it", actorIRI)
+			return nil
+		}
+		return err
+	}
+
+	actor, _, id, err := db.ActivityActor(ctx, f.db, del)
+	if err != nil {
+		return err
+	}
+	if actor.Domain == "" {
+		return fmt.Errorf("delete %s is of local account %s", id, actor.URI)
+	}
+	return f.DeleteAccount(ctx, actor)
+}
+
+// distributingDB wraps the federating db, so that statuses removed by an incoming Delete are sent to the distributor once
+// they're gone, to be taken out of timelines. The status has to be looked up before it's removed, since by the time go-fed
+// calls the Delete callback there's nothing left of it.
+type distributingDB struct {
+	pub.Database
+	f *federator
+}
+
+// Delete removes the entry with the given id, and sends it to the distributor if it was a status.
+func (d *distributingDB) Delete(ctx context.Context, id *url.URL) error {
+	status := &model.Status{}
+	if err := d.f.db.GetWhere("uri", id.String(), status); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return fmt.Errorf("error getting status %s: %s", id, err)
+		}
+		status = nil
+	}
+
+	if err := d.Database.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	if status != nil {
+		if err := d.f.distributor.Send(ctx, distributor.StatusDeleted{Status: status, FromFederation: true}); err != nil {
+			d.f.log.WithField("func", "Delete").Infof("could not distribute delete of status %s: %s", status.URI, err)
+		}
+	}
+	return nil
+}
+
+// startPurge starts the worker that removes what deleted accounts left behind.
+func (f *federator) startPurge() {
+	if f.purger == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	f.purger.cancel = cancel
+	f.purger.wg.Add(1)
+	go func() {
+		defer f.purger.wg.Done()
+		ticker := time.NewTicker(accountPurgePollInterval)
+		defer ticker.Stop()
+		for {
+			f.purgeAccounts(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-f.purger.wake:
+			}
+		}
+	}()
+}
+
+// stopPurge stops the purge worker once it's done with the batch it's on.
+func (f *federator) stopPurge() {
+	if f.purger == nil || f.purger.cancel == nil {
+		return
+	}
+	f.purger.cancel()
+	f.purger.wg.Wait()
+}
+
+// purgeAccounts purges deleted accounts a batch at a time, until there's nothing left to purge, or until the context is
+// cancelled. Failures are logged rather than returned, and the failed account is tried again on the next poll.
+func (f *federator) purgeAccounts(ctx context.Context) {
+	l := f.log.WithField("func", "purgeAccounts")
+
+	for ctx.Err() == nil {
+		accounts := []model.Account{}
+		if err := f.db.GetAccountsToPurge(accountPurgeBatchSize, &accounts); err != nil {
+			if _, ok := err.(db.ErrNoEntries); !ok {
+				l.Errorf("error getting accounts to purge: %s", err)
+			}
+			return
+		}
+
+		// keep going for as long as something gets purged, so that a backlog is cleared without waiting for the next poll
+		progressed := false
+		for i := range accounts {
+			if ctx.Err() != nil {
+				return
+			}
+			done, err := f.purgeAccount(ctx, &accounts[i])
+			if err != nil {
+				l.Errorf("error purging account %s: %s", accounts[i].ID, err)
+				continue
+			}
+			if done {
+				if err := f.db.UpdateOneByID(accounts[i].ID, "purged_at", f.Now(), &model.Account{}); err != nil {
+					l.Errorf("error marking account %s as purged: %s", accounts[i].ID, err)
+					continue
+				}
+			}
+			progressed = true
+		}
+		if !progressed {
+			return
+		}
+	}
+}
+
+// purgeAccount removes the next batch of statuses of the given deleted account. Once its statuses are all gone, the rest
+// of what it left behind is removed: its media, follows, follow requests, blocks, mutes and faves, and for a local account
+// its user and oauth tokens. It returns true once there's nothing left.
+//
+// Each status is sent to the distributor once it's gone, so that it's taken out of timelines. The account has already been
+// deleted as a whole, so there's no need to federate the deletes of its statuses, which is why they're marked as having
+// come in through federation.
+func (f *federator) purgeAccount(ctx context.Context, account *model.Account) (bool, error) {
+	statuses := []model.Status{}
+	if err := f.db.GetStatusesByTimeDescending(account.ID, &statuses, statusPurgeBatchSize, "", ""); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return false, fmt.Errorf("error getting statuses: %s", err)
+		}
+	}
+	for i := range statuses {
+		if err := f.purgeStatus(&statuses[i]); err != nil {
+			return false, err
+		}
+		if err := f.distributor.Send(ctx, distributor.StatusDeleted{Status: &statuses[i], FromFederation: true}); err != nil {
+			return false, fmt.Errorf("error distributing delete of status %s: %s", statuses[i].ID, err)
+		}
+	}
+	if len(statuses) == statusPurgeBatchSize {
+		return false, nil
+	}
+
+	attachments := []model.MediaAttachment{}
+	if err := f.db.GetWhere("account_id", account.ID, &attachments); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return false, fmt.Errorf("error getting media: %s", err)
+		}
+	}
+	for i := range attachments {
+		if err := f.mediaHandler.DeleteAttachment(&attachments[i]); err != nil {
+			return false, err
+		}
+	}
+
+	for _, i := range []interface{}{&model.Follow{}, &model.FollowRequest{}, &model.Block{}, &model.Mute{}} {
+		for _, key := range []string{"account_id", "target_account_id"} {
+			if err := f.db.DeleteWhere(key, account.ID, i); err != nil {
+				if _, ok := err.(db.ErrNoEntries); !ok {
+					return false, fmt.Errorf("error deleting %T: %s", i, err)
+				}
+			}
+		}
+	}
+	if err := f.db.DeleteWhere("account_id", account.ID, &model.StatusFave{}); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return false, fmt.Errorf("error deleting faves: %s", err)
+		}
+	}
+
+	if account.Domain != "" {
+		return true, nil
+	}
+	user := &model.User{}
+	if err := f.db.GetWhere("account_id", account.ID, user); err != nil {
+		if _, ok := err.(db.ErrNoEntries); ok {
+			return true, nil
+		}
+		return false, fmt.Errorf("error getting user: %s", err)
+	}
+	if err := f.db.DeleteWhere("user_id", user.ID, &oauth.Token{}); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return false, fmt.Errorf("error deleting tokens: %s", err)
+		}
+	}
+	if err := f.db.DeleteByID(user.ID, &model.User{}); err != nil {
+		return false, fmt.Errorf("error deleting user: %s", err)
+	}
+	return true, nil
+}
+
+// purgeStatus removes the given status, along with its media, mentions, faves and boosts.
+func (f *federator) purgeStatus(status *model.Status) error {
+	attachments := []model.MediaAttachment{}
+	if err := f.db.GetWhere("status_id", status.ID, &attachments); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return fmt.Errorf("error getting media of status %s: %s", status.ID, err)
+		}
+	}
+	for i := range attachments {
+		if err := f.mediaHandler.DeleteAttachment(&attachments[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := f.db.DeleteWhere("status_id", status.ID, &model.Mention{}); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return fmt.Errorf("error deleting mentions of status %s: %s", status.ID, err)
+		}
+	}
+	if err := f.db.DeleteWhere("status_id", status.ID, &model.StatusFave{}); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return fmt.Errorf("error deleting faves of status %s: %s", status.ID, err)
+		}
+	}
+	if err := f.db.DeleteWhere("boost_of_id", status.ID, &model.Status{}); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return fmt.Errorf("error deleting boosts of status %s: %s", status.ID, err)
+		}
+	}
+	return f.db.DeleteByID(status.ID, &model.Status{})
+}
@@ -0,0 +1,316 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+	"github.com/superseriousbusiness/gotosocial/internal/media"
+	"github.com/superseriousbusiness/gotosocial/internal/oauth"
+	"github.com/superseriousbusiness/gotosocial/internal/typeutils"
+)
+
+type DeleteTestSuite struct {
+	suite.Suite
+	log              *logrus.Logger
+	localAccount     *model.Account
+	remoteAccount    *model.Account
+	mockDB           *db.MockDB
+	mockMediaHandler *media.MockMediaHandler
+	mockDistributor  *distributor.MockDistributor
+	federator        *federator
+}
+
+// deletingDB is a federating db that only knows how to delete, and remembers what it deleted
+type deletingDB struct {
+	pub.Database
+	deleted []string
+}
+
+func (d *deletingDB) Delete(ctx context.Context, id *url.URL) error {
+	d.deleted = append(d.deleted, id.String())
+	return nil
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *DeleteTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+}
+
+// SetupTest creates fresh accounts, a fresh mock db and a fresh federator for each test, since deleting changes the accounts.
+func (suite *DeleteTestSuite) SetupTest() {
+	suite.localAccount = &model.Account{
+		ID:          "2b6d3f1c-5d43-4c8b-9c8e-6f5d1c2b3a41",
+		Username:    "local_user",
+		DisplayName: "Local User",
+		Note:        "i'm a local user",
+		URI:         "http://localhost:8080/users/local_user",
+		InboxURL:    "http://localhost:8080/users/local_user/inbox",
+		OutboxURL:   "http://localhost:8080/users/local_user/outbox",
+	}
+	suite.remoteAccount = &model.Account{
+		ID:          "8a7c1e2d-3b4f-4e5a-8c9d-0e1f2a3b4c5d",
+		Username:    "remote_user",
+		Domain:      "example.org",
+		DisplayName: "Remote User",
+		URI:         "https://example.org/users/remote_user",
+		InboxURL:    "https://example.org/users/remote_user/inbox",
+	}
+
+	suite.mockDB = &db.MockDB{}
+	for _, a := range []*model.Account{suite.localAccount, suite.remoteAccount} {
+		account := a
+		suite.mockDB.On("GetWhere", "uri", account.URI, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(2).(*model.Account) = *account
+		})
+	}
+	suite.mockDB.On("GetWhere", "uri", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetWhere", "inbox_url", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("UpdateByID", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Account")).Return(nil)
+	suite.mockDB.On("Put", mock.AnythingOfType("*model.Delivery")).Return(nil)
+	suite.mockDB.On("GetKnownInboxes", mock.AnythingOfType("*[]string")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*[]string) = []string{
+			"https://example.org/inbox",
+			"https://another.example.org/users/someone/inbox",
+		}
+	})
+	suite.mockDB.On("DeleteWhere", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	suite.mockDB.On("DeleteByID", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+
+	suite.mockMediaHandler = &media.MockMediaHandler{}
+	suite.mockMediaHandler.On("DeleteAttachment", mock.AnythingOfType("*model.MediaAttachment")).Return(nil)
+
+	suite.mockDistributor = &distributor.MockDistributor{}
+	suite.mockDistributor.On("Send", mock.Anything, mock.Anything).Return(nil)
+
+	suite.federator = &federator{
+		db:           suite.mockDB,
+		config:       config.Empty(),
+		log:          suite.log,
+		mediaHandler: suite.mockMediaHandler,
+		distributor:  suite.mockDistributor,
+		deliveries:   newDeliveryQueue(),
+	}
+}
+
+// expectStatuses makes the mock db return the given number of statuses for the given account, each with one attachment
+func (suite *DeleteTestSuite) expectStatuses(account *model.Account, n int) {
+	suite.mockDB.On("GetStatusesByTimeDescending", account.ID, mock.AnythingOfType("*[]model.Status"), statusPurgeBatchSize, "", "").Return(nil).Run(func(args mock.Arguments) {
+		statuses := []model.Status{}
+		for i := 0; i < n; i++ {
+			statuses = append(statuses, model.Status{ID: "status-" + string(rune('a'+i%26)), AccountID: account.ID})
+		}
+		*args.Get(1).(*[]model.Status) = statuses
+	})
+	suite.mockDB.On("GetWhere", "status_id", mock.AnythingOfType("string"), mock.AnythingOfType("*[]model.MediaAttachment")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*[]model.MediaAttachment) = []model.MediaAttachment{{ID: "attachment-of-" + args.String(1)}}
+	})
+	suite.mockDB.On("GetWhere", "account_id", account.ID, mock.AnythingOfType("*[]model.MediaAttachment")).Return(db.ErrNoEntries{})
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *DeleteTestSuite) TestDeleteLocalAccount() {
+	err := suite.federator.DeleteAccount(context.Background(), suite.localAccount)
+	suite.NoError(err)
+
+	suite.False(suite.localAccount.DeletedAt.IsZero())
+	suite.Empty(suite.localAccount.DisplayName)
+	suite.Empty(suite.localAccount.Note)
+	suite.Equal("http://localhost:8080/users/local_user", suite.localAccount.URI)
+	suite.mockDB.AssertCalled(suite.T(), "UpdateByID", suite.localAccount.ID, suite.localAccount)
+
+	// one delivery for every known inbox
+	suite.mockDB.AssertNumberOfCalls(suite.T(), "Put", 2)
+	for _, c := range suite.mockDB.Calls {
+		if c.Method != "Put" {
+			continue
+		}
+		delivery := c.Arguments.Get(0).(*model.Delivery)
+		suite.Equal(suite.localAccount.ID, delivery.AccountID)
+		suite.Contains(delivery.Payload, `"type":"Delete"`)
+		suite.Contains(delivery.Payload, `"object":"http://localhost:8080/users/local_user"`)
+	}
+}
+
+func (suite *DeleteTestSuite) TestDeleteAlreadyDeletedAccount() {
+	suite.localAccount.DeletedAt = suite.federator.Now()
+
+	err := suite.federator.DeleteAccount(context.Background(), suite.localAccount)
+	suite.NoError(err)
+	suite.mockDB.AssertNotCalled(suite.T(), "UpdateByID", mock.Anything, mock.Anything)
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+}
+
+func (suite *DeleteTestSuite) TestDeleteRemoteAccountIsNotFederated() {
+	err := suite.federator.DeleteAccount(context.Background(), suite.remoteAccount)
+	suite.NoError(err)
+
+	suite.False(suite.remoteAccount.DeletedAt.IsZero())
+	suite.mockDB.AssertNotCalled(suite.T(), "GetKnownInboxes", mock.Anything)
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+}
+
+func (suite *DeleteTestSuite) TestInboundDelete() {
+	del, err := typeutils.AccountDeleteToAS(suite.remoteAccount)
+	suite.NoError(err)
+
+	err = suite.federator.delete(signedBy(suite.remoteAccount), del)
+	suite.NoError(err)
+
+	suite.mockDB.AssertCalled(suite.T(), "UpdateByID", suite.remoteAccount.ID, mock.MatchedBy(func(a *model.Account) bool {
+		return !a.DeletedAt.IsZero() && a.DisplayName == ""
+	}))
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+}
+
+func (suite *DeleteTestSuite) TestInboundDeleteFromWrongRequester() {
+	del, err := typeutils.AccountDeleteToAS(suite.remoteAccount)
+	suite.NoError(err)
+
+	requester := &model.Account{
+		ID:     "5e4d3c2b-1a09-4f8e-8d7c-6b5a49382716",
+		Domain: "evil.example.org",
+		URI:    "https://evil.example.org/users/someone",
+	}
+	err = suite.federator.delete(signedBy(requester), del)
+	suite.Error(err)
+	suite.mockDB.AssertNotCalled(suite.T(), "UpdateByID", mock.Anything, mock.Anything)
+}
+
+func (suite *DeleteTestSuite) TestInboundDeleteOfUnknownAccount() {
+	unknown := &model.Account{
+		URI: "https://example.org/users/never_heard_of_them",
+	}
+	del, err := typeutils.AccountDeleteToAS(unknown)
+	suite.NoError(err)
+
+	err = suite.federator.delete(signedBy(unknown), del)
+	suite.NoError(err)
+	suite.mockDB.AssertNotCalled(suite.T(), "UpdateByID", mock.Anything, mock.Anything)
+}
+
+func (suite *DeleteTestSuite) TestInboundDeleteOfStatus() {
+	status := &model.Status{
+		ID:        "9f8e7d6c-5b4a-4392-8170-6f5e4d3c2b1a",
+		URI:       "https://example.org/users/remote_user/statuses/9",
+		AccountID: suite.remoteAccount.ID,
+	}
+	suite.mockDB.On("GetWhere", "uri", status.URI, mock.AnythingOfType("*model.Status")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*model.Status) = *status
+	})
+	suite.mockDB.On("GetWhere", "uri", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Status")).Return(db.ErrNoEntries{})
+	fdb := &deletingDB{}
+	d := &distributingDB{Database: fdb, f: suite.federator}
+
+	err := d.Delete(signedBy(suite.remoteAccount), testURL(status.URI))
+	suite.NoError(err)
+	suite.Equal([]string{status.URI}, fdb.deleted)
+	suite.mockDistributor.AssertCalled(suite.T(), "Send", mock.Anything, distributor.StatusDeleted{Status: status, FromFederation: true})
+
+	// deleting something that isn't a status doesn't need distributing
+	err = d.Delete(signedBy(suite.remoteAccount), testURL("https://example.org/follows/1"))
+	suite.NoError(err)
+	suite.Len(fdb.deleted, 2)
+	suite.mockDistributor.AssertNumberOfCalls(suite.T(), "Send", 1)
+}
+
+func (suite *DeleteTestSuite) TestPurgeLocalAccount() {
+	suite.expectStatuses(suite.localAccount, 1)
+	suite.mockDB.On("GetWhere", "account_id", suite.localAccount.ID, mock.AnythingOfType("*model.User")).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(2).(*model.User).ID = "user-id"
+	})
+
+	done, err := suite.federator.purgeAccount(context.Background(), suite.localAccount)
+	suite.NoError(err)
+	suite.True(done)
+	suite.mockDistributor.AssertCalled(suite.T(), "Send", mock.Anything, distributor.StatusDeleted{
+		Status:         &model.Status{ID: "status-a", AccountID: suite.localAccount.ID},
+		FromFederation: true,
+	})
+
+	suite.mockMediaHandler.AssertCalled(suite.T(), "DeleteAttachment", &model.MediaAttachment{ID: "attachment-of-status-a"})
+	suite.mockDB.AssertCalled(suite.T(), "DeleteWhere", "status_id", "status-a", &model.Mention{})
+	suite.mockDB.AssertCalled(suite.T(), "DeleteWhere", "boost_of_id", "status-a", &model.Status{})
+	suite.mockDB.AssertCalled(suite.T(), "DeleteByID", "status-a", &model.Status{})
+	suite.mockDB.AssertCalled(suite.T(), "DeleteWhere", "account_id", suite.localAccount.ID, &model.Follow{})
+	suite.mockDB.AssertCalled(suite.T(), "DeleteWhere", "target_account_id", suite.localAccount.ID, &model.Follow{})
+	suite.mockDB.AssertCalled(suite.T(), "DeleteWhere", "user_id", "user-id", &oauth.Token{})
+	suite.mockDB.AssertCalled(suite.T(), "DeleteByID", "user-id", &model.User{})
+}
+
+func (suite *DeleteTestSuite) TestPurgeRemoteAccount() {
+	suite.expectStatuses(suite.remoteAccount, 0)
+
+	done, err := suite.federator.purgeAccount(context.Background(), suite.remoteAccount)
+	suite.NoError(err)
+	suite.True(done)
+
+	suite.mockDB.AssertCalled(suite.T(), "DeleteWhere", "account_id", suite.remoteAccount.ID, &model.FollowRequest{})
+	suite.mockDB.AssertNotCalled(suite.T(), "GetWhere", "account_id", suite.remoteAccount.ID, mock.AnythingOfType("*model.User"))
+	suite.mockDB.AssertNotCalled(suite.T(), "DeleteByID", mock.Anything, &model.User{})
+}
+
+func (suite *DeleteTestSuite) TestPurgeFullBatchOfStatuses() {
+	suite.expectStatuses(suite.remoteAccount, statusPurgeBatchSize)
+
+	done, err := suite.federator.purgeAccount(context.Background(), suite.remoteAccount)
+	suite.NoError(err)
+	suite.False(done)
+
+	// follows etc are left alone until all the statuses are gone
+	suite.mockDB.AssertNotCalled(suite.T(), "DeleteWhere", "account_id", suite.remoteAccount.ID, &model.Follow{})
+}
+
+func (suite *DeleteTestSuite) TestPurgeAccountsMarksPurged() {
+	suite.remoteAccount.DeletedAt = suite.federator.Now()
+	suite.expectStatuses(suite.remoteAccount, 0)
+	suite.mockDB.On("GetAccountsToPurge", accountPurgeBatchSize, mock.AnythingOfType("*[]model.Account")).Return(nil).Once().Run(func(args mock.Arguments) {
+		*args.Get(1).(*[]model.Account) = []model.Account{*suite.remoteAccount}
+	})
+	suite.mockDB.On("GetAccountsToPurge", accountPurgeBatchSize, mock.AnythingOfType("*[]model.Account")).Return(nil)
+	suite.mockDB.On("UpdateOneByID", suite.remoteAccount.ID, "purged_at", mock.AnythingOfType("time.Time"), &model.Account{}).Return(nil)
+
+	suite.federator.purgeAccounts(context.Background())
+
+	suite.mockDB.AssertCalled(suite.T(), "UpdateOneByID", suite.remoteAccount.ID, "purged_at", mock.AnythingOfType("time.Time"), &model.Account{})
+	suite.mockDB.AssertNumberOfCalls(suite.T(), "GetAccountsToPurge", 2)
+}
+
+func TestDeleteTestSuite(t *testing.T) {
+	suite.Run(t, new(DeleteTestSuite))
+}
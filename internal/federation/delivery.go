@@ -0,0 +1,389 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/transport"
+)
+
+const (
+	// deliveryPollInterval is how often the delivery worker checks for deliveries that are due, if it isn't woken up sooner.
+	deliveryPollInterval = 10 * time.Second
+	// deliveryBatchSize is how many due deliveries are fetched from the database at once.
+	deliveryBatchSize = 50
+	// deliveryConcurrency is how many deliveries are attempted at once.
+	deliveryConcurrency = 5
+	// deliveryBaseBackoff is how long we wait before retrying a delivery after its first failure. It doubles with every failure after that.
+	deliveryBaseBackoff = 30 * time.Second
+	// deliveryMaxBackoff is the longest we'll ever wait between two attempts at the same delivery.
+	deliveryMaxBackoff = 6 * time.Hour
+	// maxDeliveryAttempts is how many times a delivery is attempted before we give up on it.
+	// With the backoff above, that's a little under two days of trying.
+	maxDeliveryAttempts = 12
+	// unavailableAfterDeliveries is how many deliveries to a domain we have to give up on, because its server couldn't be reached
+	// or kept failing, without a delivery to it succeeding in between, before we mark the whole domain as unavailable.
+	unavailableAfterDeliveries = 3
+)
+
+// deliveryQueue keeps track of the delivery worker, and of the domains that we've given up delivering to.
+// The deliveries themselves live in the database, so that they survive a restart.
+type deliveryQueue struct {
+	wake   chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	// unavailable is the set of domains that we've given up on; it mirrors the UnavailableDomain table.
+	unavailable map[string]bool
+	// failed counts the deliveries to each domain that we've given up on since the last one to it that succeeded.
+	// It's only kept in memory, so it starts over after a restart.
+	failed map[string]int
+}
+
+// newDeliveryQueue returns a delivery queue that doesn't know of any unavailable domains yet. Nothing will be delivered until it's started.
+func newDeliveryQueue() *deliveryQueue {
+	return &deliveryQueue{
+		wake:        make(chan struct{}, 1),
+		unavailable: make(map[string]bool),
+		failed:      make(map[string]int),
+	}
+}
+
+// deliveryBackoff returns how long to wait before the next attempt at a delivery that has failed the given number of times.
+func deliveryBackoff(attempts int) time.Duration {
+	backoff := deliveryBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= deliveryMaxBackoff {
+			return deliveryMaxBackoff
+		}
+	}
+	return backoff
+}
+
+// domainUnavailable returns true if we've given up delivering to the given domain.
+func (f *federator) domainUnavailable(domain string) bool {
+	if f.deliveries == nil {
+		return false
+	}
+	f.deliveries.mu.Lock()
+	defer f.deliveries.mu.Unlock()
+	return f.deliveries.unavailable[domain]
+}
+
+// markUnavailable records that we've given up delivering to the given domain.
+func (f *federator) markUnavailable(domain string) error {
+	if f.domainUnavailable(domain) {
+		return nil
+	}
+	if err := f.db.Put(&model.UnavailableDomain{Domain: domain}); err != nil {
+		return err
+	}
+	f.deliveries.mu.Lock()
+	defer f.deliveries.mu.Unlock()
+	f.deliveries.unavailable[domain] = true
+	return nil
+}
+
+// deliveryFailed records that we've given up on a delivery to the given domain because its server couldn't be reached or
+// kept failing, and marks the domain as unavailable once that's happened to enough deliveries in a row.
+func (f *federator) deliveryFailed(domain string) error {
+	f.deliveries.mu.Lock()
+	f.deliveries.failed[domain]++
+	failed := f.deliveries.failed[domain]
+	f.deliveries.mu.Unlock()
+
+	if failed < unavailableAfterDeliveries {
+		return nil
+	}
+	return f.markUnavailable(domain)
+}
+
+// markAvailable clears the given domain from the list of domains that we've given up delivering to, if it's on there,
+// and forgets about any deliveries to it that we've given up on.
+func (f *federator) markAvailable(domain string) error {
+	if f.deliveries != nil {
+		f.deliveries.mu.Lock()
+		delete(f.deliveries.failed, domain)
+		f.deliveries.mu.Unlock()
+	}
+	if domain == "" || !f.domainUnavailable(domain) {
+		return nil
+	}
+	if err := f.db.DeleteWhere("domain", domain, &model.UnavailableDomain{}); err != nil {
+		return err
+	}
+	f.deliveries.mu.Lock()
+	defer f.deliveries.mu.Unlock()
+	delete(f.deliveries.unavailable, domain)
+	return nil
+}
+
+// queueDelivery stores a delivery of the given activity to each of the given inboxes, to be signed by the given account,
+// and wakes up the delivery worker. Inboxes are grouped by shared inbox where possible, and inboxes on domains that
+// we've given up on are skipped.
+func (f *federator) queueDelivery(account *model.Account, b []byte, recipients []*url.URL) error {
+	l := f.log.WithField("func", "queueDelivery")
+
+	queued := false
+	for _, r := range f.groupBySharedInbox(recipients) {
+		if f.domainUnavailable(r.Host) {
+			l.Debugf("not delivering to %s since its domain is unavailable", r)
+			continue
+		}
+		delivery := &model.Delivery{
+			ID:            uuid.NewString(),
+			AccountID:     account.ID,
+			TargetInbox:   r.String(),
+			Payload:       string(b),
+			NextAttemptAt: f.Now(),
+		}
+		if err := f.db.Put(delivery); err != nil {
+			return fmt.Errorf("error queueing delivery to %s: %s", r, err)
+		}
+		queued = true
+	}
+
+	if queued {
+		select {
+		case f.deliveries.wake <- struct{}{}:
+		default:
+			// the worker has already been woken up
+		}
+	}
+	return nil
+}
+
+// startDeliveries loads the domains that we've given up on, and starts the worker that makes queued deliveries.
+func (f *federator) startDeliveries() error {
+	if f.deliveries == nil {
+		return nil
+	}
+
+	unavailable := []model.UnavailableDomain{}
+	if err := f.db.GetAll(&unavailable); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return fmt.Errorf("error getting unavailable domains: %s", err)
+		}
+	}
+	f.deliveries.mu.Lock()
+	for _, u := range unavailable {
+		f.deliveries.unavailable[u.Domain] = true
+	}
+	f.deliveries.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f.deliveries.cancel = cancel
+	f.deliveries.wg.Add(1)
+	go func() {
+		defer f.deliveries.wg.Done()
+		ticker := time.NewTicker(deliveryPollInterval)
+		defer ticker.Stop()
+		for {
+			f.processDeliveries(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-f.deliveries.wake:
+			}
+		}
+	}()
+	return nil
+}
+
+// stopDeliveries stops the delivery worker, waiting for any attempts in progress to be abandoned.
+func (f *federator) stopDeliveries() error {
+	if f.deliveries == nil || f.deliveries.cancel == nil {
+		return nil
+	}
+	f.deliveries.cancel()
+	f.deliveries.wg.Wait()
+	return nil
+}
+
+// processDeliveries attempts every delivery that's currently due, a batch at a time, until none are left or the context is cancelled.
+func (f *federator) processDeliveries(ctx context.Context) {
+	l := f.log.WithField("func", "processDeliveries")
+
+	for ctx.Err() == nil {
+		deliveries := []model.Delivery{}
+		if err := f.db.GetDueDeliveries(f.Now(), deliveryBatchSize, &deliveries); err != nil {
+			if _, ok := err.(db.ErrNoEntries); !ok {
+				l.Errorf("error getting due deliveries: %s", err)
+			}
+			return
+		}
+
+		wg := sync.WaitGroup{}
+		sem := make(chan struct{}, deliveryConcurrency)
+		for i := range deliveries {
+			d := &deliveries[i]
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				f.attemptDelivery(ctx, d)
+			}()
+		}
+		wg.Wait()
+
+		if len(deliveries) < deliveryBatchSize {
+			return
+		}
+	}
+}
+
+// attemptDelivery makes one attempt at the given delivery. If it succeeds the delivery is removed from the queue. If the inbox
+// rejects it outright, for example because the account it belongs to is gone, it's dropped. Otherwise the next attempt is
+// scheduled, or if there have been too many attempts we give up on the delivery, and maybe on the delivery's domain.
+func (f *federator) attemptDelivery(ctx context.Context, d *model.Delivery) {
+	l := f.log.WithField("func", "attemptDelivery")
+
+	inbox, err := url.Parse(d.TargetInbox)
+	if err != nil {
+		l.Errorf("dropping delivery %s with unparseable inbox %s: %s", d.ID, d.TargetInbox, err)
+		f.dropDelivery(d)
+		return
+	}
+
+	if f.domainUnavailable(inbox.Host) {
+		l.Debugf("dropping delivery to %s since its domain is unavailable", inbox)
+		f.dropDelivery(d)
+		return
+	}
+	blocked, err := f.domainBlocked(inbox.Host)
+	if err != nil {
+		l.Errorf("error checking whether domain %s is blocked: %s", inbox.Host, err)
+		f.retryDelivery(d, err)
+		return
+	}
+	if blocked {
+		// the domain was blocked after the delivery was queued
+		l.Debugf("dropping delivery to %s since its domain is blocked", inbox)
+		f.dropDelivery(d)
+		return
+	}
+
+	t, err := f.deliveryTransport(d)
+	if err != nil {
+		// this one's on us, so it doesn't count against the domain
+		l.Errorf("error getting transport for delivery %s: %s", d.ID, err)
+		d.Attempts++
+		if d.Attempts >= maxDeliveryAttempts {
+			f.dropDelivery(d)
+			return
+		}
+		f.retryDelivery(d, err)
+		return
+	}
+
+	err = t.Deliver(ctx, []byte(d.Payload), inbox)
+	if err == nil {
+		l.Tracef("delivered %s to %s", d.ID, inbox)
+		f.dropDelivery(d)
+		if err := f.markAvailable(inbox.Host); err != nil {
+			l.Errorf("error marking domain %s as available: %s", inbox.Host, err)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		// we're shutting down, so the failure doesn't count; the delivery will be attempted again after the restart
+		return
+	}
+	if respErr, ok := err.(*transport.ResponseError); ok && respErr.Permanent() {
+		// the server is there, it just won't take this delivery, so there's no point trying again
+		l.Infof("dropping delivery to %s, which was rejected: %s", inbox, err)
+		f.dropDelivery(d)
+		return
+	}
+
+	d.Attempts++
+	if d.Attempts >= maxDeliveryAttempts {
+		l.Infof("giving up on delivery to %s after %d attempts, last error was: %s", inbox, d.Attempts, err)
+		f.dropDelivery(d)
+		if err := f.deliveryFailed(inbox.Host); err != nil {
+			l.Errorf("error marking domain %s as unavailable: %s", inbox.Host, err)
+		}
+		return
+	}
+	f.retryDelivery(d, err)
+}
+
+// retryDelivery schedules the next attempt at the given delivery, which failed with the given error, backing off
+// according to how many attempts have been made so far.
+func (f *federator) retryDelivery(d *model.Delivery, err error) {
+	l := f.log.WithField("func", "retryDelivery")
+
+	d.LastError = err.Error()
+	d.NextAttemptAt = f.Now().Add(deliveryBackoff(d.Attempts))
+	l.Debugf("delivery to %s failed (attempt %d), retrying at %s: %s", d.TargetInbox, d.Attempts, d.NextAttemptAt, err)
+	if err := f.db.UpdateByID(d.ID, d); err != nil {
+		l.Errorf("error updating delivery %s: %s", d.ID, err)
+	}
+}
+
+// deliveryTransport returns a transport that signs requests with the key of the account that queued the given delivery.
+func (f *federator) deliveryTransport(d *model.Delivery) (transport.Transport, error) {
+	account := &model.Account{}
+	if err := f.db.GetByID(d.AccountID, account); err != nil {
+		return nil, fmt.Errorf("error getting account %s: %s", d.AccountID, err)
+	}
+	t, err := f.transportController.NewTransport(account.PublicKeyURI, account.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("error creating transport for account %s: %s", account.URI, err)
+	}
+	return t, nil
+}
+
+// dropDelivery removes the given delivery from the queue.
+func (f *federator) dropDelivery(d *model.Delivery) {
+	if err := f.db.DeleteByID(d.ID, &model.Delivery{}); err != nil {
+		f.log.WithField("func", "dropDelivery").Errorf("error deleting delivery %s: %s", d.ID, err)
+	}
+}
+
+// queueingTransport wraps a transport so that deliveries are queued in the database for the delivery worker,
+// instead of being made right away. Dereferencing still happens right away.
+type queueingTransport struct {
+	transport.Transport
+	f       *federator
+	account *model.Account
+}
+
+// Deliver queues a delivery of the given activity to the given inbox.
+func (t *queueingTransport) Deliver(ctx context.Context, b []byte, to *url.URL) error {
+	return t.f.queueDelivery(t.account, b, []*url.URL{to})
+}
+
+// BatchDeliver queues a delivery of the given activity to each of the given inboxes.
+func (t *queueingTransport) BatchDeliver(ctx context.Context, b []byte, recipients []*url.URL) error {
+	return t.f.queueDelivery(t.account, b, recipients)
+}
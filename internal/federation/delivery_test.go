@@ -0,0 +1,305 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/transport"
+)
+
+// flakyTransport stands in for a real transport, and fails to deliver to any of the failing hosts,
+// and has deliveries to any of the rejecting inboxes turned down with the given status code
+type flakyTransport struct {
+	transport.Transport
+	failing   map[string]bool
+	rejecting map[string]int
+	mu        sync.Mutex
+	delivered []string
+}
+
+func (t *flakyTransport) Deliver(ctx context.Context, b []byte, to *url.URL) error {
+	if t.failing[to.Host] {
+		return errors.New("connection refused")
+	}
+	if code, ok := t.rejecting[to.String()]; ok {
+		return &transport.ResponseError{Method: http.MethodPost, URL: to.String(), StatusCode: code, Status: http.StatusText(code)}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.delivered = append(t.delivered, to.String())
+	return nil
+}
+
+func (t *flakyTransport) deliveredTo() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string{}, t.delivered...)
+}
+
+// fakeController hands out the same transport every time
+type fakeController struct {
+	transport transport.Transport
+}
+
+func (c *fakeController) NewTransport(pubKeyID string, privkey crypto.PrivateKey) (transport.Transport, error) {
+	return c.transport, nil
+}
+
+type DeliveryTestSuite struct {
+	suite.Suite
+	log          *logrus.Logger
+	localAccount *model.Account
+	mockDB       *db.MockDB
+	transport    *flakyTransport
+	federator    *federator
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *DeliveryTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	suite.localAccount = &model.Account{
+		ID:           "local-account-id",
+		URI:          "http://localhost:8080/users/local_user",
+		PublicKeyURI: "http://localhost:8080/users/local_user#main-key",
+	}
+}
+
+// SetupTest creates a fresh mock db that knows about the local account, and a federator that delivers
+// through a transport that can't reach down.example, and whose deliveries to a gone account are turned down
+func (suite *DeliveryTestSuite) SetupTest() {
+	suite.mockDB = &db.MockDB{}
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainBlock")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainAllow")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetByID", suite.localAccount.ID, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*model.Account) = *suite.localAccount
+	})
+
+	suite.transport = &flakyTransport{
+		failing:   map[string]bool{"down.example": true},
+		rejecting: map[string]int{"https://remote.example/users/gone/inbox": http.StatusGone},
+	}
+
+	c := config.Empty()
+	c.Host = "localhost:8080"
+	suite.federator = &federator{
+		db:                  suite.mockDB,
+		config:              c,
+		log:                 suite.log,
+		transportController: &fakeController{transport: suite.transport},
+		domains:             newDomainCache(suite.mockDB, domainCacheTTL),
+		deliveries:          newDeliveryQueue(),
+	}
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *DeliveryTestSuite) TestDeliveryBackoff() {
+	assert.Equal(suite.T(), 30*time.Second, deliveryBackoff(1))
+	assert.Equal(suite.T(), 1*time.Minute, deliveryBackoff(2))
+	assert.Equal(suite.T(), 4*time.Minute, deliveryBackoff(4))
+	assert.Equal(suite.T(), deliveryMaxBackoff, deliveryBackoff(maxDeliveryAttempts))
+	assert.Equal(suite.T(), deliveryMaxBackoff, deliveryBackoff(1000))
+}
+
+func (suite *DeliveryTestSuite) TestQueueDelivery() {
+	suite.federator.deliveries.unavailable["gone.example"] = true
+	suite.mockDB.On("GetWhere", "inbox_url", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+
+	queued := []*model.Delivery{}
+	suite.mockDB.On("Put", mock.AnythingOfType("*model.Delivery")).Return(nil).Run(func(args mock.Arguments) {
+		queued = append(queued, args.Get(0).(*model.Delivery))
+	})
+
+	t := &queueingTransport{Transport: suite.transport, f: suite.federator, account: suite.localAccount}
+	err := t.BatchDeliver(context.Background(), []byte(`{"type": "Create"}`), []*url.URL{
+		testURL("https://remote.example/users/someone/inbox"),
+		testURL("https://gone.example/users/someone/inbox"),
+	})
+	assert.NoError(suite.T(), err)
+
+	// nothing is delivered right away
+	assert.Empty(suite.T(), suite.transport.deliveredTo())
+	if assert.Len(suite.T(), queued, 1) {
+		assert.Equal(suite.T(), "https://remote.example/users/someone/inbox", queued[0].TargetInbox)
+		assert.Equal(suite.T(), suite.localAccount.ID, queued[0].AccountID)
+		assert.Equal(suite.T(), `{"type": "Create"}`, queued[0].Payload)
+		assert.Zero(suite.T(), queued[0].Attempts)
+	}
+	// and the worker has been woken up
+	assert.Len(suite.T(), suite.federator.deliveries.wake, 1)
+}
+
+func (suite *DeliveryTestSuite) TestProcessDeliveries() {
+	due := []model.Delivery{
+		{ID: "delivery-up", AccountID: suite.localAccount.ID, TargetInbox: "https://remote.example/users/someone/inbox", Payload: "{}"},
+		{ID: "delivery-down", AccountID: suite.localAccount.ID, TargetInbox: "https://down.example/users/someone/inbox", Payload: "{}", Attempts: 2},
+	}
+	suite.mockDB.On("GetDueDeliveries", mock.AnythingOfType("time.Time"), deliveryBatchSize, mock.AnythingOfType("*[]model.Delivery")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*[]model.Delivery) = due
+	}).Once()
+	suite.mockDB.On("DeleteByID", "delivery-up", mock.AnythingOfType("*model.Delivery")).Return(nil).Once()
+	var updated *model.Delivery
+	suite.mockDB.On("UpdateByID", "delivery-down", mock.AnythingOfType("*model.Delivery")).Return(nil).Run(func(args mock.Arguments) {
+		updated = args.Get(1).(*model.Delivery)
+	}).Once()
+
+	suite.federator.processDeliveries(context.Background())
+
+	suite.mockDB.AssertExpectations(suite.T())
+	assert.Equal(suite.T(), []string{"https://remote.example/users/someone/inbox"}, suite.transport.deliveredTo())
+	if assert.NotNil(suite.T(), updated) {
+		assert.Equal(suite.T(), 3, updated.Attempts)
+		assert.Equal(suite.T(), "connection refused", updated.LastError)
+		assert.WithinDuration(suite.T(), time.Now().Add(2*time.Minute), updated.NextAttemptAt, 5*time.Second)
+	}
+}
+
+func (suite *DeliveryTestSuite) TestGiveUpAfterMaxAttempts() {
+	due := []model.Delivery{
+		{ID: "delivery-down", AccountID: suite.localAccount.ID, TargetInbox: "https://down.example/users/someone/inbox", Payload: "{}", Attempts: maxDeliveryAttempts - 1},
+	}
+	suite.mockDB.On("GetDueDeliveries", mock.AnythingOfType("time.Time"), deliveryBatchSize, mock.AnythingOfType("*[]model.Delivery")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*[]model.Delivery) = due
+	}).Once()
+	suite.mockDB.On("DeleteByID", "delivery-down", mock.AnythingOfType("*model.Delivery")).Return(nil).Once()
+
+	// giving up on one delivery isn't enough to give up on the whole domain
+	suite.federator.processDeliveries(context.Background())
+	suite.mockDB.AssertExpectations(suite.T())
+	assert.False(suite.T(), suite.federator.domainUnavailable("down.example"))
+}
+
+func (suite *DeliveryTestSuite) TestGiveUpOnDomain() {
+	due := []model.Delivery{}
+	for _, id := range []string{"delivery-down-1", "delivery-down-2", "delivery-down-3"} {
+		due = append(due, model.Delivery{ID: id, AccountID: suite.localAccount.ID, TargetInbox: "https://down.example/users/someone/inbox", Payload: "{}", Attempts: maxDeliveryAttempts - 1})
+		suite.mockDB.On("DeleteByID", id, mock.AnythingOfType("*model.Delivery")).Return(nil).Once()
+	}
+	suite.mockDB.On("GetDueDeliveries", mock.AnythingOfType("time.Time"), deliveryBatchSize, mock.AnythingOfType("*[]model.Delivery")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*[]model.Delivery) = due
+	}).Once()
+	suite.mockDB.On("Put", &model.UnavailableDomain{Domain: "down.example"}).Return(nil).Once()
+
+	suite.federator.processDeliveries(context.Background())
+	suite.mockDB.AssertExpectations(suite.T())
+	assert.True(suite.T(), suite.federator.domainUnavailable("down.example"))
+
+	// new deliveries to the domain aren't queued any more
+	suite.mockDB.On("GetWhere", "inbox_url", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+	t := &queueingTransport{Transport: suite.transport, f: suite.federator, account: suite.localAccount}
+	assert.NoError(suite.T(), t.Deliver(context.Background(), []byte("{}"), testURL("https://down.example/users/someone/inbox")))
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.AnythingOfType("*model.Delivery"))
+
+	// until we hear from the domain again
+	suite.mockDB.On("DeleteWhere", "domain", "down.example", mock.AnythingOfType("*model.UnavailableDomain")).Return(nil).Once()
+	assert.NoError(suite.T(), suite.federator.markAvailable("down.example"))
+	assert.False(suite.T(), suite.federator.domainUnavailable("down.example"))
+}
+
+func (suite *DeliveryTestSuite) TestRejectedDeliveryDropped() {
+	due := []model.Delivery{
+		{ID: "delivery-gone", AccountID: suite.localAccount.ID, TargetInbox: "https://remote.example/users/gone/inbox", Payload: "{}"},
+	}
+	suite.mockDB.On("GetDueDeliveries", mock.AnythingOfType("time.Time"), deliveryBatchSize, mock.AnythingOfType("*[]model.Delivery")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*[]model.Delivery) = due
+	}).Once()
+	suite.mockDB.On("DeleteByID", "delivery-gone", mock.AnythingOfType("*model.Delivery")).Return(nil).Once()
+
+	// the inbox is gone, but the rest of the domain is fine
+	suite.federator.processDeliveries(context.Background())
+	suite.mockDB.AssertExpectations(suite.T())
+	suite.mockDB.AssertNotCalled(suite.T(), "UpdateByID", mock.Anything, mock.Anything)
+	assert.False(suite.T(), suite.federator.domainUnavailable("remote.example"))
+}
+
+func (suite *DeliveryTestSuite) TestDeliveryRetriedWhenBlockCheckFails() {
+	blocksDB := &db.MockDB{}
+	blocksDB.On("GetAll", mock.AnythingOfType("*[]model.DomainBlock")).Return(errors.New("database is down"))
+	suite.federator.domains = newDomainCache(blocksDB, domainCacheTTL)
+
+	due := []model.Delivery{
+		{ID: "delivery-up", AccountID: suite.localAccount.ID, TargetInbox: "https://remote.example/users/someone/inbox", Payload: "{}"},
+	}
+	suite.mockDB.On("GetDueDeliveries", mock.AnythingOfType("time.Time"), deliveryBatchSize, mock.AnythingOfType("*[]model.Delivery")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*[]model.Delivery) = due
+	}).Once()
+	var updated *model.Delivery
+	suite.mockDB.On("UpdateByID", "delivery-up", mock.AnythingOfType("*model.Delivery")).Return(nil).Run(func(args mock.Arguments) {
+		updated = args.Get(1).(*model.Delivery)
+	}).Once()
+
+	suite.federator.processDeliveries(context.Background())
+
+	// the delivery isn't due again right away
+	assert.Empty(suite.T(), suite.transport.deliveredTo())
+	if assert.NotNil(suite.T(), updated) {
+		assert.Zero(suite.T(), updated.Attempts)
+		assert.WithinDuration(suite.T(), time.Now().Add(deliveryBaseBackoff), updated.NextAttemptAt, 5*time.Second)
+	}
+}
+
+func (suite *DeliveryTestSuite) TestPendingDeliveriesMadeOnStart() {
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.UnavailableDomain")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*[]model.UnavailableDomain) = []model.UnavailableDomain{{Domain: "gone.example"}}
+	})
+	due := []model.Delivery{
+		{ID: "delivery-from-before", AccountID: suite.localAccount.ID, TargetInbox: "https://remote.example/users/someone/inbox", Payload: "{}"},
+	}
+	suite.mockDB.On("GetDueDeliveries", mock.AnythingOfType("time.Time"), deliveryBatchSize, mock.AnythingOfType("*[]model.Delivery")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*[]model.Delivery) = due
+	}).Once()
+	suite.mockDB.On("GetDueDeliveries", mock.AnythingOfType("time.Time"), deliveryBatchSize, mock.AnythingOfType("*[]model.Delivery")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("DeleteByID", "delivery-from-before", mock.AnythingOfType("*model.Delivery")).Return(nil).Once()
+
+	suite.NoError(suite.federator.Start())
+	assert.Eventually(suite.T(), func() bool {
+		return len(suite.transport.deliveredTo()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	suite.NoError(suite.federator.Stop())
+
+	assert.True(suite.T(), suite.federator.domainUnavailable("gone.example"))
+}
+
+func TestDeliveryTestSuite(t *testing.T) {
+	suite.Run(t, new(DeliveryTestSuite))
+}
@@ -0,0 +1,127 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+// dereference fetches the activitypub representation of the given IRI from its server,
+// and resolves it into an activitystreams type.
+// Nothing will be fetched from blocked domains.
+func (f *federator) dereference(ctx context.Context, iri *url.URL) (vocab.Type, error) {
+	if blocked, err := f.domainBlocked(iri.Host); err != nil {
+		return nil, err
+	} else if blocked {
+		return nil, fmt.Errorf("not dereferencing %s since its domain is blocked", iri)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, iri.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", activityStreamsAccept)
+	req.Header.Set("Date", f.Now().UTC().Format(http.TimeFormat))
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error dereferencing %s: %s", iri, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error dereferencing %s: got status code %d", iri, resp.StatusCode)
+	}
+
+	b, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, maxFetchSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response from %s: %s", iri, err)
+	}
+	return resolve(ctx, iri, b)
+}
+
+// dereferenceSigned is like dereference, but the request is signed with the key of the instance account,
+// for servers that only hand out their objects to other servers that identify themselves.
+func (f *federator) dereferenceSigned(ctx context.Context, iri *url.URL) (vocab.Type, error) {
+	if blocked, err := f.domainBlocked(iri.Host); err != nil {
+		return nil, err
+	} else if blocked {
+		return nil, fmt.Errorf("not dereferencing %s since its domain is blocked", iri)
+	}
+
+	t, err := f.instanceTransport()
+	if err != nil {
+		return nil, fmt.Errorf("error getting transport: %s", err)
+	}
+	b, err := t.Dereference(ctx, iri)
+	if err != nil {
+		return nil, fmt.Errorf("error dereferencing %s: %s", iri, err)
+	}
+	return resolve(ctx, iri, b)
+}
+
+// resolve resolves the given response from dereferencing iri into an activitystreams type.
+func resolve(ctx context.Context, iri *url.URL, b []byte) (vocab.Type, error) {
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("error unmarshalling response from %s: %s", iri, err)
+	}
+
+	t, err := streams.ToType(ctx, m)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving response from %s into activitystreams type: %s", iri, err)
+	}
+	return t, nil
+}
+
+// getOrFetchAccount returns the account with the given activitypub uri from the database.
+// If we don't have the account yet, it will be dereferenced and stored first.
+func (f *federator) getOrFetchAccount(ctx context.Context, iri *url.URL) (*model.Account, error) {
+	account, err := db.AccountForIRI(f.db, iri)
+	if err == nil {
+		return account, nil
+	}
+	if _, ok := err.(db.ErrNoEntries); !ok {
+		return nil, err
+	}
+	if iri.Host == f.config.Host {
+		return nil, fmt.Errorf("account %s would be local but was not found in the database", iri)
+	}
+
+	account, err = f.fetchRemoteAccount(ctx, iri)
+	if err != nil {
+		return nil, err
+	}
+	if account.URI != iri.String() {
+		return nil, fmt.Errorf("dereferenced account %s but got account %s", iri, account.URI)
+	}
+	if err := f.db.Put(account); err != nil {
+		return nil, fmt.Errorf("database error storing account %s: %s", account.URI, err)
+	}
+	return account, nil
+}
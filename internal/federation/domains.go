@@ -0,0 +1,365 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/transport"
+)
+
+// domainCacheTTL is how long we keep using the domain blocks and allows we loaded from the database before loading them again.
+const domainCacheTTL = 1 * time.Minute
+
+// domainIndex is a suffix index of domain blocks or allows. Each level of the index corresponds to one label of a domain,
+// starting from the top level domain, so looking up a host only ever walks as deep as the host has labels, no matter
+// how many entries there are.
+type domainIndex struct {
+	children map[string]*domainIndex
+	entries  []interface{}
+}
+
+// newDomainBlockIndex returns an index of the given blocks.
+func newDomainBlockIndex(blocks []model.DomainBlock) *domainIndex {
+	index := &domainIndex{}
+	for i := range blocks {
+		index.insert(blocks[i].Domain, &blocks[i])
+	}
+	return index
+}
+
+// newDomainAllowIndex returns an index of the given allows.
+func newDomainAllowIndex(allows []model.DomainAllow) *domainIndex {
+	index := &domainIndex{}
+	for i := range allows {
+		index.insert(allows[i].Domain, &allows[i])
+	}
+	return index
+}
+
+// insert adds the given entry to the index, under the labels of the given domain.
+func (i *domainIndex) insert(domain string, entry interface{}) {
+	labels := domainLabels(strings.TrimPrefix(domain, "."))
+	if len(labels) == 0 {
+		return
+	}
+	node := i
+	for _, label := range labels {
+		if node.children == nil {
+			node.children = make(map[string]*domainIndex)
+		}
+		child, ok := node.children[label]
+		if !ok {
+			child = &domainIndex{}
+			node.children[label] = child
+		}
+		node = child
+	}
+	node.entries = append(node.entries, entry)
+}
+
+// match returns all the entries that apply to the given host: those for the host itself, those for any domain
+// that the host is a subdomain of, and any wildcard entries that match either of those.
+func (i *domainIndex) match(host string) []interface{} {
+	matches := []interface{}{}
+	i.walk(domainLabels(host), &matches)
+	return matches
+}
+
+func (i *domainIndex) walk(labels []string, matches *[]interface{}) {
+	// everything at this level applies, since entries include subdomains
+	*matches = append(*matches, i.entries...)
+	if len(labels) == 0 || i.children == nil {
+		return
+	}
+	if child, ok := i.children[labels[0]]; ok {
+		child.walk(labels[1:], matches)
+	}
+	if child, ok := i.children["*"]; ok {
+		child.walk(labels[1:], matches)
+	}
+}
+
+// domainLabels splits the given domain into its lowercased labels, in reverse order, so 'gts.example.org' gives [org example gts].
+// A port and a trailing dot are ignored.
+func domainLabels(domain string) []string {
+	domain = strings.ToLower(strings.TrimSuffix(hostWithoutPort(domain), "."))
+	if domain == "" {
+		return nil
+	}
+	labels := strings.Split(domain, ".")
+	for l, r := 0, len(labels)-1; l < r; l, r = l+1, r-1 {
+		labels[l], labels[r] = labels[r], labels[l]
+	}
+	return labels
+}
+
+// hostWithoutPort strips the port from the given host, if it has one.
+func hostWithoutPort(host string) string {
+	u := url.URL{Host: host}
+	return u.Hostname()
+}
+
+// domainCache keeps an index of all the domain blocks and allows in the database, and reloads them once they've gone stale.
+type domainCache struct {
+	db       db.DB
+	ttl      time.Duration
+	mu       sync.RWMutex
+	blocks   *domainIndex
+	allows   *domainIndex
+	loadedAt time.Time
+}
+
+// newDomainCache returns a domain cache that reloads blocks and allows from the given db once they're older than ttl.
+func newDomainCache(db db.DB, ttl time.Duration) *domainCache {
+	return &domainCache{
+		db:  db,
+		ttl: ttl,
+	}
+}
+
+// indexes returns the current block and allow indexes, reloading them from the database first if they're stale.
+func (c *domainCache) indexes() (*domainIndex, *domainIndex, error) {
+	c.mu.RLock()
+	blocks, allows := c.blocks, c.allows
+	fresh := blocks != nil && time.Since(c.loadedAt) < c.ttl
+	c.mu.RUnlock()
+	if fresh {
+		return blocks, allows, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// someone else might have reloaded the indexes while we were waiting for the lock
+	if c.blocks == nil || time.Since(c.loadedAt) >= c.ttl {
+		domainBlocks := []model.DomainBlock{}
+		if err := c.db.GetAll(&domainBlocks); err != nil {
+			if _, ok := err.(db.ErrNoEntries); !ok {
+				return nil, nil, fmt.Errorf("error getting domain blocks: %s", err)
+			}
+		}
+		domainAllows := []model.DomainAllow{}
+		if err := c.db.GetAll(&domainAllows); err != nil {
+			if _, ok := err.(db.ErrNoEntries); !ok {
+				return nil, nil, fmt.Errorf("error getting domain allows: %s", err)
+			}
+		}
+		c.blocks = newDomainBlockIndex(domainBlocks)
+		c.allows = newDomainAllowIndex(domainAllows)
+		c.loadedAt = time.Now()
+	}
+	return c.blocks, c.allows, nil
+}
+
+// blocksFor returns all the domain blocks that apply to the given host.
+func (c *domainCache) blocksFor(host string) ([]*model.DomainBlock, error) {
+	blocks, _, err := c.indexes()
+	if err != nil {
+		return nil, err
+	}
+	matches := []*model.DomainBlock{}
+	for _, m := range blocks.match(host) {
+		matches = append(matches, m.(*model.DomainBlock))
+	}
+	return matches, nil
+}
+
+// allowed returns true if there's a domain allow that applies to the given host.
+func (c *domainCache) allowed(host string) (bool, error) {
+	_, allows, err := c.indexes()
+	if err != nil {
+		return false, err
+	}
+	return len(allows.match(host)) != 0, nil
+}
+
+// federationMode returns the federation mode this instance is running in. Blocklist mode is the default.
+func (f *federator) federationMode() string {
+	if f.config == nil || f.config.FederationConfig == nil || f.config.FederationConfig.Mode == "" {
+		return config.FederationModeBlocklist
+	}
+	return f.config.FederationConfig.Mode
+}
+
+// domainBlocked returns true if we shouldn't federate with the given host at all. That depends on the federation mode:
+// in open mode nothing is blocked, in blocklist mode only suspended domains are blocked, and in allowlist mode every
+// domain that hasn't been explicitly allowed is blocked too. Our own host is never blocked.
+func (f *federator) domainBlocked(host string) (bool, error) {
+	if f.config != nil && strings.EqualFold(hostWithoutPort(host), hostWithoutPort(f.config.Host)) {
+		return false, nil
+	}
+
+	switch f.federationMode() {
+	case config.FederationModeOpen:
+		return false, nil
+	case config.FederationModeAllowlist:
+		allowed, err := f.domains.allowed(host)
+		if err != nil {
+			return false, err
+		}
+		if !allowed {
+			return true, nil
+		}
+	}
+
+	blocks, err := f.domains.blocksFor(host)
+	if err != nil {
+		return false, err
+	}
+	for _, b := range blocks {
+		if b.Severity == model.DomainBlockSeveritySuspend {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// domainRejectsMedia returns true if we shouldn't keep media from the given host, either because it's been blocked,
+// or because its reputation isn't good enough yet. We don't fetch remote media files ourselves, so rejecting media
+// comes down to stripping the attachments from the statuses we store; see rejectMedia.
+func (f *federator) domainRejectsMedia(host string) (bool, error) {
+	if blocked, err := f.domainBlocked(host); err != nil || blocked {
+		return blocked, err
+	}
+	if rep, err := f.reputationOf(host); err != nil {
+		return false, err
+	} else if rep != nil && rep.StripMedia() {
+		return true, nil
+	}
+	if f.federationMode() == config.FederationModeOpen {
+		return false, nil
+	}
+
+	blocks, err := f.domains.blocksFor(host)
+	if err != nil {
+		return false, err
+	}
+	for _, b := range blocks {
+		if b.RejectMedia {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DomainSilenced returns true if statuses from the given host should be kept off public timelines, because the
+// domain has been silenced or suspended, or isn't allowed at all. Our own host is never silenced.
+func (f *federator) DomainSilenced(host string) (bool, error) {
+	if blocked, err := f.domainBlocked(host); err != nil || blocked {
+		return blocked, err
+	}
+	if f.federationMode() == config.FederationModeOpen {
+		return false, nil
+	}
+	if f.config != nil && strings.EqualFold(hostWithoutPort(host), hostWithoutPort(f.config.Host)) {
+		return false, nil
+	}
+
+	blocks, err := f.domains.blocksFor(host)
+	if err != nil {
+		return false, err
+	}
+	for _, b := range blocks {
+		if b.Severity >= model.DomainBlockSeveritySilence {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// domainRejectsReports returns true if we shouldn't accept reports from the given host, either because it's been
+// blocked, or because reports from it are rejected.
+func (f *federator) domainRejectsReports(host string) (bool, error) {
+	if blocked, err := f.domainBlocked(host); err != nil || blocked {
+		return blocked, err
+	}
+	if f.federationMode() == config.FederationModeOpen {
+		return false, nil
+	}
+
+	blocks, err := f.domains.blocksFor(host)
+	if err != nil {
+		return false, err
+	}
+	for _, b := range blocks {
+		if b.RejectReports {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// blockingTransport wraps a transport so that nothing gets delivered to or fetched from blocked domains.
+type blockingTransport struct {
+	transport.Transport
+	f *federator
+}
+
+// Deliver delivers the given activity to the given inbox, unless its domain is blocked, in which case it's quietly dropped.
+func (t *blockingTransport) Deliver(ctx context.Context, b []byte, to *url.URL) error {
+	blocked, err := t.f.domainBlocked(to.Host)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		t.f.log.WithField("func", "Deliver").Debugf("not delivering to %s since its domain is blocked", to)
+		return nil
+	}
+	return t.Transport.Deliver(ctx, b, to)
+}
+
+// BatchDeliver delivers the given activity to all the given inboxes, apart from those on blocked domains.
+func (t *blockingTransport) BatchDeliver(ctx context.Context, b []byte, recipients []*url.URL) error {
+	allowed := make([]*url.URL, 0, len(recipients))
+	for _, r := range recipients {
+		blocked, err := t.f.domainBlocked(r.Host)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			t.f.log.WithField("func", "BatchDeliver").Debugf("not delivering to %s since its domain is blocked", r)
+			continue
+		}
+		allowed = append(allowed, r)
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	return t.Transport.BatchDeliver(ctx, b, allowed)
+}
+
+// Dereference fetches the given iri, unless its domain is blocked.
+func (t *blockingTransport) Dereference(ctx context.Context, iri *url.URL) ([]byte, error) {
+	blocked, err := t.f.domainBlocked(iri.Host)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, fmt.Errorf("not dereferencing %s since its domain is blocked", iri)
+	}
+	return t.Transport.Dereference(ctx, iri)
+}
@@ -0,0 +1,283 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/transport"
+)
+
+// recordingTransport stands in for a real transport, and keeps track of where things were delivered and fetched from
+type recordingTransport struct {
+	transport.Transport
+	delivered []string
+	fetched   []string
+}
+
+func (t *recordingTransport) BatchDeliver(ctx context.Context, b []byte, recipients []*url.URL) error {
+	for _, r := range recipients {
+		t.delivered = append(t.delivered, r.String())
+	}
+	return nil
+}
+
+func (t *recordingTransport) Dereference(ctx context.Context, iri *url.URL) ([]byte, error) {
+	t.fetched = append(t.fetched, iri.String())
+	return []byte("{}"), nil
+}
+
+type DomainsTestSuite struct {
+	suite.Suite
+	log       *logrus.Logger
+	blocks    []model.DomainBlock
+	allows    []model.DomainAllow
+	mockDB    *db.MockDB
+	federator *federator
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *DomainsTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	suite.blocks = []model.DomainBlock{
+		{Domain: "suspended.example", Severity: model.DomainBlockSeveritySuspend},
+		{Domain: "silenced.example", Severity: model.DomainBlockSeveritySilence},
+		{Domain: "*.wildcard.example", Severity: model.DomainBlockSeveritySuspend},
+		{Domain: "gts.*.example.org", Severity: model.DomainBlockSeveritySuspend},
+		{Domain: "nomedia.example", RejectMedia: true},
+		{Domain: ".badtld", Severity: model.DomainBlockSeveritySuspend},
+	}
+
+	suite.allows = []model.DomainAllow{
+		{Domain: "trusted.example"},
+		{Domain: "*.friends.example"},
+		{Domain: "suspended.example"},
+	}
+}
+
+// SetupTest creates a fresh mock db that has the suite's domain blocks and allows, and a federator that uses it
+func (suite *DomainsTestSuite) SetupTest() {
+	suite.mockDB = &db.MockDB{}
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainBlock")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*[]model.DomainBlock) = append([]model.DomainBlock{}, suite.blocks...)
+	})
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainAllow")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*[]model.DomainAllow) = append([]model.DomainAllow{}, suite.allows...)
+	})
+	c := config.Empty()
+	c.Host = "localhost:8080"
+	suite.federator = &federator{
+		db:      suite.mockDB,
+		config:  c,
+		log:     suite.log,
+		domains: newDomainCache(suite.mockDB, domainCacheTTL),
+	}
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *DomainsTestSuite) TestDomainBlocked() {
+	for host, expected := range map[string]bool{
+		"suspended.example":           true,
+		"SUSPENDED.example.":          true,
+		"suspended.example:8080":      true,
+		"gts.suspended.example":       true,
+		"notsuspended.example":        false,
+		"suspended.example.com":       false,
+		"silenced.example":            false,
+		"wildcard.example":            false,
+		"gts.wildcard.example":        true,
+		"a.b.wildcard.example":        true,
+		"gts.somewhere.example.org":   true,
+		"gts.somewhere.example.com":   false,
+		"gts.a.somewhere.example.org": false,
+		"anything.badtld":             true,
+		"badtld.com":                  false,
+		"example.org":                 false,
+	} {
+		blocked, err := suite.federator.domainBlocked(host)
+		if assert.NoError(suite.T(), err) {
+			assert.Equal(suite.T(), expected, blocked, host)
+		}
+	}
+
+	// the blocks and allows should only have been loaded from the db once
+	suite.mockDB.AssertNumberOfCalls(suite.T(), "GetAll", 2)
+}
+
+func (suite *DomainsTestSuite) TestDomainBlocksReloadedWhenStale() {
+	suite.federator.domains = newDomainCache(suite.mockDB, 0)
+
+	blocked, err := suite.federator.domainBlocked("newly.blocked.example")
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), blocked)
+
+	suite.blocks = append(suite.blocks, model.DomainBlock{Domain: "blocked.example", Severity: model.DomainBlockSeveritySuspend})
+	defer func() { suite.blocks = suite.blocks[:len(suite.blocks)-1] }()
+
+	blocked, err = suite.federator.domainBlocked("newly.blocked.example")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), blocked)
+}
+
+func (suite *DomainsTestSuite) TestAllowlistMode() {
+	suite.federator.config.FederationConfig.Mode = config.FederationModeAllowlist
+
+	for host, expected := range map[string]bool{
+		"trusted.example":         false,
+		"gts.trusted.example":     false,
+		"untrusted.example":       true,
+		"friends.example":         true,
+		"gts.friends.example":     false,
+		"suspended.example":       true,
+		"silenced.example":        true,
+		"localhost:8080":          false,
+		"localhost":               false,
+		"somewhere.else.entirely": true,
+	} {
+		blocked, err := suite.federator.domainBlocked(host)
+		if assert.NoError(suite.T(), err) {
+			assert.Equal(suite.T(), expected, blocked, host)
+		}
+	}
+
+	blocked, err := suite.federator.Blocked(context.Background(), []*url.URL{
+		testURL("https://trusted.example/users/someone"),
+		testURL("https://untrusted.example/users/someone"),
+	})
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), blocked)
+
+	inner := &recordingTransport{}
+	t := &blockingTransport{Transport: inner, f: suite.federator}
+	err = t.BatchDeliver(context.Background(), []byte("{}"), []*url.URL{
+		testURL("https://trusted.example/users/someone/inbox"),
+		testURL("https://untrusted.example/users/someone/inbox"),
+	})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"https://trusted.example/users/someone/inbox"}, inner.delivered)
+
+	_, err = t.Dereference(context.Background(), testURL("https://untrusted.example/users/someone"))
+	assert.Error(suite.T(), err)
+}
+
+func (suite *DomainsTestSuite) TestOpenMode() {
+	suite.federator.config.FederationConfig.Mode = config.FederationModeOpen
+
+	for _, host := range []string{"suspended.example", "gts.wildcard.example", "untrusted.example"} {
+		blocked, err := suite.federator.domainBlocked(host)
+		if assert.NoError(suite.T(), err) {
+			assert.False(suite.T(), blocked, host)
+		}
+	}
+
+	rejected, err := suite.federator.domainRejectsMedia("nomedia.example")
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), rejected)
+}
+
+func (suite *DomainsTestSuite) TestDomainSilenced() {
+	for host, expected := range map[string]bool{
+		"silenced.example":     true,
+		"gts.silenced.example": true,
+		"suspended.example":    true,
+		"nomedia.example":      false,
+		"fine.example":         false,
+		"localhost:8080":       false,
+	} {
+		silenced, err := suite.federator.DomainSilenced(host)
+		if assert.NoError(suite.T(), err) {
+			assert.Equal(suite.T(), expected, silenced, host)
+		}
+	}
+
+	suite.federator.config.FederationConfig.Mode = config.FederationModeOpen
+	silenced, err := suite.federator.DomainSilenced("silenced.example")
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), silenced)
+}
+
+func (suite *DomainsTestSuite) TestBlocked() {
+	blocked, err := suite.federator.Blocked(context.Background(), []*url.URL{
+		testURL("https://fine.example/users/someone"),
+		testURL("https://gts.suspended.example/users/someone"),
+	})
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), blocked)
+
+	blocked, err = suite.federator.Blocked(context.Background(), []*url.URL{
+		testURL("https://fine.example/users/someone"),
+		testURL("https://silenced.example/users/someone"),
+		testURL("https://nomedia.example/users/someone"),
+	})
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), blocked)
+}
+
+func (suite *DomainsTestSuite) TestBlockingTransport() {
+	inner := &recordingTransport{}
+	t := &blockingTransport{Transport: inner, f: suite.federator}
+
+	err := t.BatchDeliver(context.Background(), []byte("{}"), []*url.URL{
+		testURL("https://fine.example/users/someone/inbox"),
+		testURL("https://suspended.example/users/someone/inbox"),
+		testURL("https://silenced.example/inbox"),
+	})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"https://fine.example/users/someone/inbox", "https://silenced.example/inbox"}, inner.delivered)
+
+	_, err = t.Dereference(context.Background(), testURL("https://suspended.example/users/someone"))
+	assert.Error(suite.T(), err)
+	// rejecting media from a domain doesn't stop us fetching its activities
+	_, err = t.Dereference(context.Background(), testURL("https://nomedia.example/users/someone"))
+	assert.NoError(suite.T(), err)
+	_, err = t.Dereference(context.Background(), testURL("https://fine.example/users/someone"))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"https://nomedia.example/users/someone", "https://fine.example/users/someone"}, inner.fetched)
+}
+
+func testURL(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func TestDomainsTestSuite(t *testing.T) {
+	suite.Run(t, new(DomainsTestSuite))
+}
@@ -0,0 +1,500 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+	"github.com/superseriousbusiness/gotosocial/internal/typeutils"
+)
+
+// FederatingCallbacks returns the functions that go-fed should call for incoming activities, once it has
+// done its own side effects (if any) for them.
+//
+// We take care of accepting follows ourselves rather than letting go-fed do it, since whether a follow
+// gets accepted straight away depends on whether the target account is locked. go-fed doesn't have callbacks
+// for Move or Flag, so those are passed as extras.
+func (f *federator) FederatingCallbacks(ctx context.Context) (pub.FederatingWrappedCallbacks, []interface{}, error) {
+	wrapped := pub.FederatingWrappedCallbacks{
+		Create:   f.create,
+		Announce: f.announce,
+		Follow:   f.follow,
+		OnFollow: pub.OnFollowDoNothing,
+		Accept:   f.accept,
+		Reject:   f.reject,
+		Undo:     f.undo,
+		Delete:   f.delete,
+	}
+	other := []interface{}{
+		f.move,
+		f.flag,
+	}
+	return wrapped, other, nil
+}
+
+// create handles an incoming Create, once go-fed has stored the object(s) being created. If any of them is a note
+// replying to a status we don't have yet, the parent gets dereferenced and stored too, so the reply can be threaded.
+// Failing to get hold of the parent isn't fatal: the reply has already been stored, it just won't be threaded.
+//
+// Attachments of notes from domains whose media we reject are removed again here. Once a note is done with, it's sent
+// to the distributor, so that it turns up in the timelines of our accounts that follow its author.
+func (f *federator) create(ctx context.Context, create vocab.ActivityStreamsCreate) error {
+	l := f.log.WithField("func", "create")
+
+	objectProp := create.GetActivityStreamsObject()
+	if objectProp == nil {
+		return nil
+	}
+	for iter := objectProp.Begin(); iter != objectProp.End(); iter = iter.Next() {
+		if !iter.IsActivityStreamsNote() {
+			continue
+		}
+		note := iter.GetActivityStreamsNote()
+		if err := f.rejectMedia(note); err != nil {
+			return err
+		}
+		if err := f.threadReply(ctx, note); err != nil {
+			l.Infof("could not thread reply: %s", err)
+		}
+		if idProp := note.GetJSONLDId(); idProp != nil && idProp.IsIRI() {
+			if err := f.distributeStatus(ctx, idProp.GetIRI()); err != nil {
+				l.Infof("could not distribute status: %s", err)
+			}
+		}
+	}
+	return nil
+}
+
+// announce handles an incoming Announce, once the federating db has stored it as a boost, by sending the boost to the
+// distributor, so that it turns up in the timelines of our accounts that follow the booster.
+func (f *federator) announce(ctx context.Context, announce vocab.ActivityStreamsAnnounce) error {
+	idProp := announce.GetJSONLDId()
+	if idProp == nil || !idProp.IsIRI() {
+		return errors.New("announce had no id")
+	}
+	if err := f.distributeStatus(ctx, idProp.GetIRI()); err != nil {
+		f.log.WithField("func", "announce").Infof("could not distribute boost: %s", err)
+	}
+	return nil
+}
+
+// distributeStatus sends the status with the given uri, which has just come in through federation, to the distributor.
+// Nothing is sent if the status wasn't stored, which is the case if it wasn't allowed for example.
+func (f *federator) distributeStatus(ctx context.Context, uri *url.URL) error {
+	status := &model.Status{}
+	if err := f.db.GetWhere("uri", uri.String(), status); err != nil {
+		if _, ok := err.(db.ErrNoEntries); ok {
+			return nil
+		}
+		return fmt.Errorf("error getting status %s: %s", uri, err)
+	}
+	return f.distributor.Send(ctx, distributor.StatusCreated{Status: status, FromFederation: true})
+}
+
+// follow handles an incoming Follow of one of our accounts. If the account is locked, a follow request is stored
+// for the account owner to deal with; otherwise the follow is stored straight away and an Accept is sent back.
+func (f *federator) follow(ctx context.Context, follow vocab.ActivityStreamsFollow) error {
+	l := f.log.WithField("func", "follow")
+
+	origin, target, uri, err := db.ActivityAccounts(ctx, f.db, follow)
+	if err != nil {
+		return err
+	}
+	if target == nil || target.Domain != "" {
+		l.Debugf("target of follow %s isn't one of our accounts", uri)
+		return nil
+	}
+
+	if target.Locked {
+		requests := []model.FollowRequest{}
+		if err := f.db.GetFollowRequestsForAccountID(target.ID, &requests); err != nil {
+			if _, ok := err.(db.ErrNoEntries); !ok {
+				return fmt.Errorf("error getting follow requests for account %s: %s", target.ID, err)
+			}
+		}
+		for _, existing := range requests {
+			if existing.AccountID == origin.ID {
+				l.Debugf("account %s has already requested to follow account %s", origin.ID, target.ID)
+				return nil
+			}
+		}
+		return f.db.Put(&model.FollowRequest{
+			AccountID:       origin.ID,
+			TargetAccountID: target.ID,
+			URI:             uri.String(),
+		})
+	}
+
+	existing, err := f.getFollow(origin.ID, target.ID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		if err := f.db.Put(&model.Follow{
+			AccountID:       origin.ID,
+			TargetAccountID: target.ID,
+			URI:             uri.String(),
+		}); err != nil {
+			return fmt.Errorf("error putting follow %s: %s", uri, err)
+		}
+	} else {
+		// the remote server might have lost track of the follow, so accept it again anyway
+		l.Debugf("account %s already follows account %s", origin.ID, target.ID)
+	}
+
+	return f.acceptFollow(ctx, follow, origin, target)
+}
+
+// accept handles an Accept of a follow that one of our accounts sent. By the time this is called, go-fed will have
+// checked that the follow is one of ours and added the accepting account to our account's following collection.
+// All that's left to do is to turn the follow request into a follow that has the uri of the original Follow,
+// and to backfill the accepting account if we're being greedy.
+func (f *federator) accept(ctx context.Context, accept vocab.ActivityStreamsAccept) error {
+	l := f.log.WithField("func", "accept")
+
+	acceptor, followIRI, uri, err := db.ActivityActor(ctx, f.db, accept)
+	if err != nil {
+		return err
+	}
+
+	request := &model.FollowRequest{}
+	if err := f.db.GetWhere("uri", followIRI.String(), request); err != nil {
+		if _, ok := err.(db.ErrNoEntries); ok {
+			l.Debugf("accept %s isn't for a follow request we know about", uri)
+			return nil
+		}
+		return fmt.Errorf("error getting follow request %s: %s", followIRI, err)
+	}
+	if request.TargetAccountID != acceptor.ID {
+		return fmt.Errorf("account %s tried to accept follow request %s, which wasn't sent to them", acceptor.URI, followIRI)
+	}
+
+	follow, err := f.getFollow(request.AccountID, request.TargetAccountID)
+	if err != nil {
+		return err
+	}
+	if follow == nil {
+		follow = &model.Follow{
+			AccountID:       request.AccountID,
+			TargetAccountID: request.TargetAccountID,
+			ShowReblogs:     request.ShowReblogs,
+			URI:             request.URI,
+			Notify:          request.Notify,
+		}
+		if err := f.db.Put(follow); err != nil {
+			return fmt.Errorf("error putting follow %s: %s", request.URI, err)
+		}
+	} else if follow.URI != request.URI {
+		if err := f.db.UpdateOneByID(follow.ID, "uri", request.URI, &model.Follow{}); err != nil {
+			return fmt.Errorf("error updating uri of follow %s: %s", follow.ID, err)
+		}
+		follow.URI = request.URI
+	}
+
+	if err := f.db.DeleteByID(request.ID, &model.FollowRequest{}); err != nil {
+		return fmt.Errorf("error deleting follow request %s: %s", request.ID, err)
+	}
+
+	// one of our accounts now follows the acceptor, which the distributor takes care of, for example by backfilling their posts
+	if err := f.distributor.Send(ctx, distributor.FollowAccepted{Follow: follow, FromFederation: true}); err != nil {
+		l.Infof("error sending accepted follow %s to the distributor: %s", follow.URI, err)
+	}
+	return nil
+}
+
+// reject handles a Reject of a follow that one of our accounts sent. The Reject might come before or after
+// the follow was accepted, so both follow requests and follows are removed.
+func (f *federator) reject(ctx context.Context, reject vocab.ActivityStreamsReject) error {
+	rejecter, followIRI, _, err := db.ActivityActor(ctx, f.db, reject)
+	if err != nil {
+		return err
+	}
+
+	request := &model.FollowRequest{}
+	if err := f.db.GetWhere("uri", followIRI.String(), request); err == nil {
+		if request.TargetAccountID != rejecter.ID {
+			return fmt.Errorf("account %s tried to reject follow request %s, which wasn't sent to them", rejecter.URI, followIRI)
+		}
+		if err := f.db.DeleteByID(request.ID, &model.FollowRequest{}); err != nil {
+			return fmt.Errorf("error deleting follow request %s: %s", request.ID, err)
+		}
+	} else if _, ok := err.(db.ErrNoEntries); !ok {
+		return fmt.Errorf("error getting follow request %s: %s", followIRI, err)
+	}
+
+	follow := &model.Follow{}
+	if err := f.db.GetWhere("uri", followIRI.String(), follow); err == nil {
+		if follow.TargetAccountID != rejecter.ID {
+			return fmt.Errorf("account %s tried to reject follow %s, which isn't of them", rejecter.URI, followIRI)
+		}
+		if err := f.db.DeleteByID(follow.ID, &model.Follow{}); err != nil {
+			return fmt.Errorf("error deleting follow %s: %s", follow.ID, err)
+		}
+	} else if _, ok := err.(db.ErrNoEntries); !ok {
+		return fmt.Errorf("error getting follow %s: %s", followIRI, err)
+	}
+
+	return nil
+}
+
+// undo handles an Undo of a Follow, by removing the follow (or follow request, if it wasn't accepted yet).
+// go-fed has already checked that the actor of the Undo is the actor of the thing being undone.
+func (f *federator) undo(ctx context.Context, undo vocab.ActivityStreamsUndo) error {
+	l := f.log.WithField("func", "undo")
+
+	undoer, objectIRI, uri, err := db.ActivityActor(ctx, f.db, undo)
+	if err != nil {
+		return err
+	}
+
+	request := &model.FollowRequest{}
+	if err := f.db.GetWhere("uri", objectIRI.String(), request); err == nil && request.AccountID == undoer.ID {
+		return f.db.DeleteByID(request.ID, &model.FollowRequest{})
+	} else if err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return fmt.Errorf("error getting follow request %s: %s", objectIRI, err)
+		}
+	}
+
+	follow := &model.Follow{}
+	if err := f.db.GetWhere("uri", objectIRI.String(), follow); err == nil && follow.AccountID == undoer.ID {
+		return f.db.DeleteByID(follow.ID, &model.Follow{})
+	} else if err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return fmt.Errorf("error getting follow %s: %s", objectIRI, err)
+		}
+	}
+
+	// we might not have the uri of the follow, for example if it was created before the Accept came in,
+	// so if the Follow is embedded then fall back to looking for a follow from the undoer to its object
+	if objectProp := undo.GetActivityStreamsObject(); objectProp != nil {
+		for iter := objectProp.Begin(); iter != objectProp.End(); iter = iter.Next() {
+			if !iter.IsActivityStreamsFollow() {
+				continue
+			}
+			targetIRI, err := typeutils.ExtractObject(iter.GetActivityStreamsFollow())
+			if err != nil {
+				return fmt.Errorf("error extracting object of undone follow %s: %s", objectIRI, err)
+			}
+			target, err := db.AccountForIRI(f.db, targetIRI)
+			if err != nil {
+				if _, ok := err.(db.ErrNoEntries); ok {
+					continue
+				}
+				return err
+			}
+			existing, err := f.getFollow(undoer.ID, target.ID)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				return f.db.DeleteByID(existing.ID, &model.Follow{})
+			}
+		}
+	}
+
+	l.Debugf("undo %s isn't for a follow we know about", uri)
+	return nil
+}
+
+// rejectMedia removes the attachments of the status stored for the given note, if its author is on a domain whose media we reject.
+func (f *federator) rejectMedia(note typeutils.Statusable) error {
+	authorIRI, err := typeutils.ExtractAttributedTo(note)
+	if err != nil {
+		return nil
+	}
+	rejected, err := f.domainRejectsMedia(authorIRI.Host)
+	if err != nil || !rejected {
+		return err
+	}
+
+	idProp := note.GetJSONLDId()
+	if idProp == nil || !idProp.IsIRI() {
+		return errors.New("note had no id")
+	}
+	status := &model.Status{}
+	if err := f.db.GetWhere("uri", idProp.GetIRI().String(), status); err != nil {
+		return fmt.Errorf("error getting status %s: %s", idProp.GetIRI(), err)
+	}
+	if err := f.db.DeleteWhere("status_id", status.ID, &model.MediaAttachment{}); err != nil {
+		return fmt.Errorf("error deleting attachments of status %s: %s", status.URI, err)
+	}
+	return nil
+}
+
+// threadReply makes sure that the status stored for the given note has its InReplyToID set, if it's a reply,
+// by dereferencing and storing the replied-to status if we don't have it.
+func (f *federator) threadReply(ctx context.Context, note typeutils.Statusable) error {
+	l := f.log.WithField("func", "threadReply")
+
+	inReplyToIRI, err := typeutils.ExtractInReplyTo(note)
+	if err != nil {
+		// not a reply
+		return nil
+	}
+
+	idProp := note.GetJSONLDId()
+	if idProp == nil || !idProp.IsIRI() {
+		return errors.New("note had no id")
+	}
+	status := &model.Status{}
+	if err := f.db.GetWhere("uri", idProp.GetIRI().String(), status); err != nil {
+		return fmt.Errorf("error getting status %s: %s", idProp.GetIRI(), err)
+	}
+	if status.InReplyToID != "" {
+		// already threaded
+		return nil
+	}
+
+	parent := &model.Status{}
+	err = f.db.GetWhere("uri", inReplyToIRI.String(), parent)
+	if err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return fmt.Errorf("error getting status %s: %s", inReplyToIRI, err)
+		}
+		if inReplyToIRI.Host == f.config.Host {
+			l.Debugf("status %s replies to local status %s, which doesn't exist", status.URI, inReplyToIRI)
+			return nil
+		}
+		if parent, err = f.fetchStatus(ctx, inReplyToIRI); err != nil {
+			return err
+		}
+	}
+
+	return f.db.UpdateOneByID(status.ID, "in_reply_to_id", parent.ID, &model.Status{})
+}
+
+// fetchStatus dereferences the remote status with the given uri and stores it, along with its author if need be.
+func (f *federator) fetchStatus(ctx context.Context, iri *url.URL) (*model.Status, error) {
+	t, err := f.dereference(ctx, iri)
+	if err != nil {
+		return nil, err
+	}
+	if id := t.GetJSONLDId(); id == nil || !id.IsIRI() || id.GetIRI().String() != iri.String() {
+		return nil, fmt.Errorf("dereferenced status %s but got something with a different id", iri)
+	}
+	return f.storeStatus(ctx, t)
+}
+
+// storeStatus stores the given remote status, along with its author if need be, the same way go-fed would store
+// a status it received. The status must be attributed to an account on the same server as the status itself.
+func (f *federator) storeStatus(ctx context.Context, t vocab.Type) (*model.Status, error) {
+	statusable, ok := t.(typeutils.Statusable)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a status", t.GetTypeName())
+	}
+	idProp := statusable.GetJSONLDId()
+	if idProp == nil || !idProp.IsIRI() {
+		return nil, errors.New("status had no id")
+	}
+	iri := idProp.GetIRI()
+
+	authorIRI, err := typeutils.ExtractAttributedTo(statusable)
+	if err != nil {
+		return nil, fmt.Errorf("error extracting author of status %s: %s", iri, err)
+	}
+	if authorIRI.Host != iri.Host {
+		return nil, fmt.Errorf("status %s is attributed to %s, which is on a different server", iri, authorIRI)
+	}
+	if _, err := f.getOrFetchAccount(ctx, authorIRI); err != nil {
+		return nil, fmt.Errorf("error getting author %s of status %s: %s", authorIRI, iri, err)
+	}
+
+	// the status came from its own server rather than being delivered to us, so it doesn't have to be from whoever
+	// signed the request that we're handling
+	ctx = context.WithValue(ctx, ctxRequestingAccount, nil)
+	fdb := f.db.Federation()
+	if err := fdb.Lock(ctx, iri); err != nil {
+		return nil, err
+	}
+	err = fdb.Create(ctx, t)
+	fdb.Unlock(ctx, iri)
+	if err != nil {
+		return nil, fmt.Errorf("error storing status %s: %s", iri, err)
+	}
+	if err := f.rejectMedia(statusable); err != nil {
+		return nil, fmt.Errorf("error rejecting media of status %s: %s", iri, err)
+	}
+
+	status := &model.Status{}
+	if err := f.db.GetWhere("uri", iri.String(), status); err != nil {
+		return nil, fmt.Errorf("error getting status %s after storing it: %s", iri, err)
+	}
+	return status, nil
+}
+
+// acceptFollow sends an Accept of the given follow from target to origin.
+func (f *federator) acceptFollow(ctx context.Context, follow vocab.ActivityStreamsFollow, origin *model.Account, target *model.Account) error {
+	originIRI, err := url.Parse(origin.URI)
+	if err != nil {
+		return fmt.Errorf("error parsing uri of account %s: %s", origin.ID, err)
+	}
+	targetIRI, err := url.Parse(target.URI)
+	if err != nil {
+		return fmt.Errorf("error parsing uri of account %s: %s", target.ID, err)
+	}
+	outboxIRI, err := url.Parse(target.OutboxURL)
+	if err != nil {
+		return fmt.Errorf("error parsing outbox of account %s: %s", target.ID, err)
+	}
+
+	accept := streams.NewActivityStreamsAccept()
+
+	actorProp := streams.NewActivityStreamsActorProperty()
+	actorProp.AppendIRI(targetIRI)
+	accept.SetActivityStreamsActor(actorProp)
+
+	objectProp := streams.NewActivityStreamsObjectProperty()
+	objectProp.AppendActivityStreamsFollow(follow)
+	accept.SetActivityStreamsObject(objectProp)
+
+	toProp := streams.NewActivityStreamsToProperty()
+	toProp.AppendIRI(originIRI)
+	accept.SetActivityStreamsTo(toProp)
+
+	if _, err := f.actor.Send(ctx, outboxIRI, accept); err != nil {
+		return fmt.Errorf("error sending accept of follow from %s to %s: %s", origin.URI, target.URI, err)
+	}
+	return nil
+}
+
+// getFollow returns the follow from accountID to targetAccountID, or nil if there isn't one.
+func (f *federator) getFollow(accountID string, targetAccountID string) (*model.Follow, error) {
+	follows := []model.Follow{}
+	if err := f.db.GetFollowingByAccountID(accountID, &follows); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return nil, fmt.Errorf("error getting follows of account %s: %s", accountID, err)
+		}
+	}
+	for i := range follows {
+		if follows[i].TargetAccountID == targetAccountID {
+			return &follows[i], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,494 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+)
+
+// signedBy returns a context as it would be after the given account signed a request
+func signedBy(account *model.Account) context.Context {
+	return context.WithValue(context.Background(), ctxRequestingAccount, account)
+}
+
+// sendRecorder stands in for the go-fed federating actor, and keeps track of everything that's sent through it
+type sendRecorder struct {
+	pub.FederatingActor
+	outboxes []*url.URL
+	sent     []vocab.Type
+}
+
+func (s *sendRecorder) Send(c context.Context, outbox *url.URL, t vocab.Type) (pub.Activity, error) {
+	s.outboxes = append(s.outboxes, outbox)
+	s.sent = append(s.sent, t)
+	return t.(pub.Activity), nil
+}
+
+// recordingDatabase stands in for the federating db, and keeps track of what's locked and created through it
+type recordingDatabase struct {
+	pub.Database
+	locks   []string
+	created []vocab.Type
+}
+
+func (r *recordingDatabase) Lock(c context.Context, id *url.URL) error {
+	r.locks = append(r.locks, "lock "+id.String())
+	return nil
+}
+
+func (r *recordingDatabase) Unlock(c context.Context, id *url.URL) error {
+	r.locks = append(r.locks, "unlock "+id.String())
+	return nil
+}
+
+func (r *recordingDatabase) Create(c context.Context, asType vocab.Type) error {
+	r.created = append(r.created, asType)
+	return nil
+}
+
+type FederatingCallbacksTestSuite struct {
+	suite.Suite
+	log           *logrus.Logger
+	localAccount  *model.Account
+	lockedAccount *model.Account
+	remoteAccount *model.Account
+	mockDB        *db.MockDB
+	// mockDistributor gets the statuses that come in through federation
+	mockDistributor *distributor.MockDistributor
+	actor           *sendRecorder
+	federator       *federator
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *FederatingCallbacksTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	suite.localAccount = &model.Account{
+		ID:        "2b6d3f1c-5d43-4c8b-9c8e-6f5d1c2b3a41",
+		Username:  "local_user",
+		URI:       "http://localhost:8080/users/local_user",
+		OutboxURL: "http://localhost:8080/users/local_user/outbox",
+	}
+	suite.lockedAccount = &model.Account{
+		ID:        "7c1e9a0b-2d3f-4a5b-8c6d-9e0f1a2b3c4d",
+		Username:  "locked_user",
+		URI:       "http://localhost:8080/users/locked_user",
+		OutboxURL: "http://localhost:8080/users/locked_user/outbox",
+		Locked:    true,
+	}
+	suite.remoteAccount = &model.Account{
+		ID:       "8a7c1e2d-3b4f-4e5a-8c9d-0e1f2a3b4c5d",
+		Username: "remote_user",
+		Domain:   "example.org",
+		URI:      "https://example.org/users/remote_user",
+	}
+}
+
+// SetupTest creates a fresh mock db and federator for each test. The mock db knows about the suite's
+// accounts by uri, and has no follows or follow requests.
+func (suite *FederatingCallbacksTestSuite) SetupTest() {
+	suite.mockDB = &db.MockDB{}
+	for _, a := range []*model.Account{suite.localAccount, suite.lockedAccount, suite.remoteAccount} {
+		account := a
+		suite.mockDB.On("GetWhere", "uri", account.URI, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(2).(*model.Account) = *account
+		})
+	}
+	suite.mockDB.On("GetWhere", "uri", mock.AnythingOfType("string"), mock.Anything).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetFollowingByAccountID", mock.AnythingOfType("string"), mock.AnythingOfType("*[]model.Follow")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetFollowRequestsForAccountID", mock.AnythingOfType("string"), mock.AnythingOfType("*[]model.FollowRequest")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("Put", mock.Anything).Return(nil)
+	suite.mockDB.On("DeleteByID", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainBlock")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainAllow")).Return(db.ErrNoEntries{})
+
+	suite.mockDistributor = &distributor.MockDistributor{}
+	suite.mockDistributor.On("Send", mock.Anything, mock.Anything).Return(nil)
+
+	suite.actor = &sendRecorder{}
+	suite.federator = &federator{
+		db:          suite.mockDB,
+		config:      config.Empty(),
+		log:         suite.log,
+		actor:       suite.actor,
+		domains:     newDomainCache(suite.mockDB, domainCacheTTL),
+		distributor: suite.mockDistributor,
+	}
+}
+
+// expectByURI makes the mock db return the given account, status, follow or follow request when it's looked up by the given uri.
+// The expectation is put in front of the catch-all ones from SetupTest, so that it takes precedence.
+func (suite *FederatingCallbacksTestSuite) expectByURI(uri string, i interface{}) {
+	switch entry := i.(type) {
+	case *model.Account:
+		suite.mockDB.On("GetWhere", "uri", uri, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(2).(*model.Account) = *entry
+		})
+	case *model.Status:
+		suite.mockDB.On("GetWhere", "uri", uri, mock.AnythingOfType("*model.Status")).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(2).(*model.Status) = *entry
+		})
+	case *model.Follow:
+		suite.mockDB.On("GetWhere", "uri", uri, mock.AnythingOfType("*model.Follow")).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(2).(*model.Follow) = *entry
+		})
+	case *model.FollowRequest:
+		suite.mockDB.On("GetWhere", "uri", uri, mock.AnythingOfType("*model.FollowRequest")).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(2).(*model.FollowRequest) = *entry
+		})
+	}
+	suite.expectFirst()
+}
+
+// expectFirst moves the most recently added expectation on the mock db in front of all the others
+func (suite *FederatingCallbacksTestSuite) expectFirst() {
+	calls := suite.mockDB.ExpectedCalls
+	suite.mockDB.ExpectedCalls = append([]*mock.Call{calls[len(calls)-1]}, calls[:len(calls)-1]...)
+}
+
+// toType converts the given json into an activitystreams type
+func (suite *FederatingCallbacksTestSuite) toType(j string) vocab.Type {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(j), &m); err != nil {
+		suite.FailNow(err.Error())
+	}
+	t, err := streams.ToType(context.Background(), m)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	return t
+}
+
+// calls returns the first argument of all calls of the given method on the mock db
+func (suite *FederatingCallbacksTestSuite) calls(method string) []interface{} {
+	args := []interface{}{}
+	for _, call := range suite.mockDB.Calls {
+		if call.Method == method {
+			args = append(args, call.Arguments.Get(0))
+		}
+	}
+	return args
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *FederatingCallbacksTestSuite) TestFollowUnlockedAccount() {
+	follow := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/follows/1",
+		"type": "Follow",
+		"actor": "https://example.org/users/remote_user",
+		"object": "http://localhost:8080/users/local_user"
+	}`).(vocab.ActivityStreamsFollow)
+
+	err := suite.federator.follow(signedBy(suite.remoteAccount), follow)
+	assert.NoError(suite.T(), err)
+
+	puts := suite.calls("Put")
+	if assert.Len(suite.T(), puts, 1) {
+		assert.Equal(suite.T(), &model.Follow{
+			AccountID:       suite.remoteAccount.ID,
+			TargetAccountID: suite.localAccount.ID,
+			URI:             "https://example.org/follows/1",
+		}, puts[0])
+	}
+
+	// an accept of the follow should have been sent from the local account's outbox
+	if assert.Len(suite.T(), suite.actor.sent, 1) {
+		assert.Equal(suite.T(), suite.localAccount.OutboxURL, suite.actor.outboxes[0].String())
+		accept, ok := suite.actor.sent[0].(vocab.ActivityStreamsAccept)
+		if assert.True(suite.T(), ok) {
+			assert.Equal(suite.T(), suite.localAccount.URI, accept.GetActivityStreamsActor().At(0).GetIRI().String())
+			assert.Equal(suite.T(), suite.remoteAccount.URI, accept.GetActivityStreamsTo().At(0).GetIRI().String())
+			object := accept.GetActivityStreamsObject().At(0)
+			if assert.True(suite.T(), object.IsActivityStreamsFollow()) {
+				assert.Equal(suite.T(), "https://example.org/follows/1", object.GetActivityStreamsFollow().GetJSONLDId().GetIRI().String())
+			}
+		}
+	}
+}
+
+func (suite *FederatingCallbacksTestSuite) TestFollowLockedAccount() {
+	follow := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/follows/2",
+		"type": "Follow",
+		"actor": "https://example.org/users/remote_user",
+		"object": "http://localhost:8080/users/locked_user"
+	}`).(vocab.ActivityStreamsFollow)
+
+	err := suite.federator.follow(signedBy(suite.remoteAccount), follow)
+	assert.NoError(suite.T(), err)
+
+	puts := suite.calls("Put")
+	if assert.Len(suite.T(), puts, 1) {
+		assert.Equal(suite.T(), &model.FollowRequest{
+			AccountID:       suite.remoteAccount.ID,
+			TargetAccountID: suite.lockedAccount.ID,
+			URI:             "https://example.org/follows/2",
+		}, puts[0])
+	}
+
+	// the owner of the locked account has to approve the request before anything is sent back
+	assert.Empty(suite.T(), suite.actor.sent)
+}
+
+func (suite *FederatingCallbacksTestSuite) TestFollowFromWrongRequester() {
+	follow := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/follows/3",
+		"type": "Follow",
+		"actor": "https://example.org/users/remote_user",
+		"object": "http://localhost:8080/users/local_user"
+	}`).(vocab.ActivityStreamsFollow)
+
+	ctx := signedBy(&model.Account{URI: "https://evil.example.org/users/someone_else"})
+	err := suite.federator.follow(ctx, follow)
+	assert.Error(suite.T(), err)
+	assert.Empty(suite.T(), suite.calls("Put"))
+	assert.Empty(suite.T(), suite.actor.sent)
+}
+
+func (suite *FederatingCallbacksTestSuite) TestAcceptFollowRequest() {
+	request := &model.FollowRequest{
+		ID:              "0d9c8b7a-6f5e-4d3c-2b1a-0f9e8d7c6b5a",
+		AccountID:       suite.localAccount.ID,
+		TargetAccountID: suite.remoteAccount.ID,
+		ShowReblogs:     true,
+		URI:             "http://localhost:8080/users/local_user/follow/1",
+	}
+	suite.expectByURI(request.URI, request)
+
+	accept := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/accepts/1",
+		"type": "Accept",
+		"actor": "https://example.org/users/remote_user",
+		"object": "http://localhost:8080/users/local_user/follow/1"
+	}`).(vocab.ActivityStreamsAccept)
+
+	err := suite.federator.accept(signedBy(suite.remoteAccount), accept)
+	assert.NoError(suite.T(), err)
+
+	puts := suite.calls("Put")
+	if assert.Len(suite.T(), puts, 1) {
+		assert.Equal(suite.T(), &model.Follow{
+			AccountID:       suite.localAccount.ID,
+			TargetAccountID: suite.remoteAccount.ID,
+			ShowReblogs:     true,
+			URI:             request.URI,
+		}, puts[0])
+		suite.mockDistributor.AssertCalled(suite.T(), "Send", mock.Anything, distributor.FollowAccepted{Follow: puts[0].(*model.Follow), FromFederation: true})
+	}
+	suite.mockDB.AssertCalled(suite.T(), "DeleteByID", request.ID, &model.FollowRequest{})
+}
+
+func (suite *FederatingCallbacksTestSuite) TestRejectFollowRequest() {
+	request := &model.FollowRequest{
+		ID:              "0d9c8b7a-6f5e-4d3c-2b1a-0f9e8d7c6b5a",
+		AccountID:       suite.localAccount.ID,
+		TargetAccountID: suite.remoteAccount.ID,
+		URI:             "http://localhost:8080/users/local_user/follow/1",
+	}
+	suite.expectByURI(request.URI, request)
+
+	reject := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/rejects/1",
+		"type": "Reject",
+		"actor": "https://example.org/users/remote_user",
+		"object": "http://localhost:8080/users/local_user/follow/1"
+	}`).(vocab.ActivityStreamsReject)
+
+	err := suite.federator.reject(signedBy(suite.remoteAccount), reject)
+	assert.NoError(suite.T(), err)
+	suite.mockDB.AssertCalled(suite.T(), "DeleteByID", request.ID, &model.FollowRequest{})
+	assert.Empty(suite.T(), suite.calls("Put"))
+}
+
+func (suite *FederatingCallbacksTestSuite) TestUndoFollow() {
+	follow := &model.Follow{
+		ID:              "3e2d1c0b-9a8f-4e7d-6c5b-4a3f2e1d0c9b",
+		AccountID:       suite.remoteAccount.ID,
+		TargetAccountID: suite.localAccount.ID,
+		URI:             "https://example.org/follows/1",
+	}
+	suite.expectByURI(follow.URI, follow)
+
+	undo := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/follows/1/undo",
+		"type": "Undo",
+		"actor": "https://example.org/users/remote_user",
+		"object": {
+			"id": "https://example.org/follows/1",
+			"type": "Follow",
+			"actor": "https://example.org/users/remote_user",
+			"object": "http://localhost:8080/users/local_user"
+		}
+	}`).(vocab.ActivityStreamsUndo)
+
+	err := suite.federator.undo(signedBy(suite.remoteAccount), undo)
+	assert.NoError(suite.T(), err)
+	suite.mockDB.AssertCalled(suite.T(), "DeleteByID", follow.ID, &model.Follow{})
+}
+
+func (suite *FederatingCallbacksTestSuite) TestCreateReplyToUnknownStatus() {
+	// a remote server that has the status being replied to
+	mux := http.NewServeMux()
+	remoteServer := httptest.NewTLSServer(mux)
+	defer remoteServer.Close()
+	parentURI := remoteServer.URL + "/users/parent_author/statuses/1"
+	parentAuthor := &model.Account{
+		ID:     "4f3e2d1c-0b9a-4876-9543-210fedcba987",
+		Domain: strings.TrimPrefix(remoteServer.URL, "https://"),
+		URI:    remoteServer.URL + "/users/parent_author",
+	}
+	parentJSON := fmt.Sprintf(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": %q,
+		"type": "Note",
+		"attributedTo": %q,
+		"content": "i'm the parent",
+		"to": "https://www.w3.org/ns/activitystreams#Public"
+	}`, parentURI, parentAuthor.URI)
+	mux.HandleFunc("/users/parent_author/statuses/1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/activity+json")
+		fmt.Fprint(w, parentJSON)
+	})
+	suite.federator.client = remoteServer.Client()
+
+	reply := &model.Status{
+		ID:        "6b5a4f3e-2d1c-4b0a-9f8e-7d6c5b4a3f2e",
+		URI:       "https://example.org/users/remote_user/statuses/2",
+		AccountID: suite.remoteAccount.ID,
+	}
+	parent := &model.Status{
+		ID:        "9a8b7c6d-5e4f-4a3b-2c1d-0e9f8a7b6c5d",
+		URI:       parentURI,
+		AccountID: parentAuthor.ID,
+	}
+	suite.expectByURI(reply.URI, reply)
+	suite.expectByURI(parentAuthor.URI, parentAuthor)
+	// we don't have the parent until it's been stored
+	suite.expectByURI(parent.URI, parent)
+	suite.mockDB.On("GetWhere", "uri", parent.URI, mock.AnythingOfType("*model.Status")).Return(db.ErrNoEntries{}).Once()
+	suite.expectFirst()
+	suite.mockDB.On("UpdateOneByID", reply.ID, "in_reply_to_id", parent.ID, &model.Status{}).Return(nil)
+
+	fdb := &recordingDatabase{}
+	suite.mockDB.On("Federation").Return(fdb)
+
+	create := suite.toType(fmt.Sprintf(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/users/remote_user/statuses/2/activity",
+		"type": "Create",
+		"actor": "https://example.org/users/remote_user",
+		"object": {
+			"id": "https://example.org/users/remote_user/statuses/2",
+			"type": "Note",
+			"attributedTo": "https://example.org/users/remote_user",
+			"inReplyTo": %q,
+			"content": "i'm the reply",
+			"to": "https://www.w3.org/ns/activitystreams#Public"
+		}
+	}`, parentURI)).(vocab.ActivityStreamsCreate)
+
+	err := suite.federator.create(signedBy(suite.remoteAccount), create)
+	assert.NoError(suite.T(), err)
+
+	// the parent should have been stored through the federating db, under a lock
+	if assert.Len(suite.T(), fdb.created, 1) {
+		assert.Equal(suite.T(), parentURI, fdb.created[0].GetJSONLDId().GetIRI().String())
+	}
+	assert.Equal(suite.T(), []string{"lock " + parentURI, "unlock " + parentURI}, fdb.locks)
+	suite.mockDB.AssertCalled(suite.T(), "UpdateOneByID", reply.ID, "in_reply_to_id", parent.ID, &model.Status{})
+
+	// the reply is passed on to the distributor, but the parent isn't, since it didn't come in by itself
+	suite.mockDistributor.AssertCalled(suite.T(), "Send", mock.Anything, distributor.StatusCreated{Status: reply, FromFederation: true})
+	suite.mockDistributor.AssertNumberOfCalls(suite.T(), "Send", 1)
+}
+
+func (suite *FederatingCallbacksTestSuite) TestAnnounceIsDistributed() {
+	boost := &model.Status{
+		ID:        "6e5d4c3b-2a19-4f08-9e7d-6c5b4a392817",
+		URI:       "https://example.org/users/remote_user/statuses/3/activity",
+		AccountID: suite.remoteAccount.ID,
+		BoostOfID: "9a8b7c6d-5e4f-4a3b-2c1d-0e9f8a7b6c5d",
+	}
+	suite.expectByURI(boost.URI, boost)
+
+	announce := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/users/remote_user/statuses/3/activity",
+		"type": "Announce",
+		"actor": "https://example.org/users/remote_user",
+		"object": "https://example.org/users/someone_else/statuses/1"
+	}`).(vocab.ActivityStreamsAnnounce)
+
+	err := suite.federator.announce(signedBy(suite.remoteAccount), announce)
+	assert.NoError(suite.T(), err)
+	suite.mockDistributor.AssertCalled(suite.T(), "Send", mock.Anything, distributor.StatusCreated{Status: boost, FromFederation: true})
+}
+
+func (suite *FederatingCallbacksTestSuite) TestAnnounceNotStoredIsNotDistributed() {
+	announce := suite.toType(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://example.org/users/remote_user/statuses/4/activity",
+		"type": "Announce",
+		"actor": "https://example.org/users/remote_user",
+		"object": "https://example.org/users/someone_else/statuses/1"
+	}`).(vocab.ActivityStreamsAnnounce)
+
+	err := suite.federator.announce(signedBy(suite.remoteAccount), announce)
+	assert.NoError(suite.T(), err)
+	suite.mockDistributor.AssertNotCalled(suite.T(), "Send", mock.Anything, mock.Anything)
+}
+
+func TestFederatingCallbacksTestSuite(t *testing.T) {
+	suite.Run(t, new(FederatingCallbacksTestSuite))
+}
@@ -21,99 +21,300 @@ package federation
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-fed/activity/pub"
 	"github.com/go-fed/activity/streams/vocab"
 	"github.com/sirupsen/logrus"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
 	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+	"github.com/superseriousbusiness/gotosocial/internal/media"
+	"github.com/superseriousbusiness/gotosocial/internal/reputation"
+	"github.com/superseriousbusiness/gotosocial/internal/transport"
 )
 
-// New returns a go-fed compatible federating actor
-func New(db db.DB, log *logrus.Logger) pub.FederatingActor {
-	f := &Federator{
-		db: db,
+// Federator wraps everything needed to federate with other servers: the go-fed federating actor
+// that handles inboxes and outboxes, and the gotosocial-specific bits of federation that go-fed doesn't cover.
+type Federator interface {
+	// FederatingActor returns the underlying go-fed federating actor.
+	FederatingActor() pub.FederatingActor
+	// FingerRemoteAccount performs a webfinger lookup for a remote account, using the given username and domain.
+	// It returns the ActivityPub URI of the account, as given in the 'self' link of the webfinger response.
+	// If we already have the account in the database, its LastWebfingeredAt field will be updated.
+	FingerRemoteAccount(ctx context.Context, targetUsername string, targetDomain string) (*url.URL, error)
+	// PostSharedInbox handles a delivery to the shared inbox of this instance, by passing it on to the inboxes of
+	// the local accounts that it's for. Like go-fed's PostInbox, it returns false if the request isn't an activitypub
+	// request; otherwise the response has been written, unless an error is returned.
+	PostSharedInbox(ctx context.Context, w http.ResponseWriter, r *http.Request) (bool, error)
+	// AuthenticateGet authenticates a GET request for something that's public, but that may be shown differently depending on who's asking.
+	// It returns the account that signed the request, or nil if the request isn't signed. An error is returned if the request is signed, but
+	// the signature can't be verified.
+	AuthenticateGet(ctx context.Context, r *http.Request) (*model.Account, error)
+	// MoveAccount marks the given local account as moved to the account with the given uri, and lets the followers of the local
+	// account know with a Move. The account being moved to has to list the local account as an alias. It returns the account moved to.
+	MoveAccount(ctx context.Context, account *model.Account, targetIRI *url.URL) (*model.Account, error)
+	// DeleteAccount deletes the given account, leaving a tombstone in its place. If the account is local, a Delete is sent to every
+	// remote inbox we know about. Everything the account left behind, such as its statuses and media, is removed in the background.
+	DeleteAccount(ctx context.Context, account *model.Account) error
+	// Backfill queues the given remote account to have its outbox, featured collection and reply threads fetched
+	// and stored in the background. It does nothing unless greedy federation is enabled.
+	Backfill(account *model.Account)
+	// ReleasePendingActivity processes a delivery that was held for review because of the poor reputation of the domain that
+	// made it, as if it had just come in, and removes it from review.
+	ReleasePendingActivity(ctx context.Context, pending *model.PendingActivity) error
+	// DomainSilenced returns true if statuses from the given host should be kept off public timelines, because the domain has been
+	// silenced or suspended.
+	DomainSilenced(host string) (bool, error)
+	// Start starts any work that the federator does in the background.
+	Start() error
+	// Stop stops any work that the federator does in the background.
+	Stop() error
+}
+
+// federator implements the Federator interface, and also several go-fed interfaces in one convenient location
+type federator struct {
+	db                  db.DB
+	config              *config.Config
+	log                 *logrus.Logger
+	client              pub.HttpClient
+	transportController transport.Controller
+	actor               pub.FederatingActor
+	domains             *domainCache
+	reputation          reputation.Scorer
+	throttle            *inboxThrottle
+	backfiller          *backfiller
+	deliveries          *deliveryQueue
+	refresher           *refresher
+	purger              *purger
+	mediaHandler        media.MediaHandler
+	distributor         distributor.Distributor
+	instanceMu          sync.Mutex
+	instance            *model.Account
+}
+
+// New returns a new Federator that uses the given db, config, media handler and logger. The federator registers handlers with the
+// given distributor for federating out what happens through the client API, and sends what comes in through federation to it.
+// An error will be returned if the configured federation mode isn't one we know about.
+func New(db db.DB, c *config.Config, mediaHandler media.MediaHandler, dist distributor.Distributor, log *logrus.Logger) (Federator, error) {
+	switch c.FederationConfig.Mode {
+	case "", config.FederationModeOpen, config.FederationModeBlocklist, config.FederationModeAllowlist:
+	default:
+		return nil, fmt.Errorf("unknown federation mode %s", c.FederationConfig.Mode)
+	}
+
+	f := &federator{
+		db:           db,
+		config:       c,
+		log:          log,
+		client:       &http.Client{Timeout: 30 * time.Second},
+		domains:      newDomainCache(db, domainCacheTTL),
+		deliveries:   newDeliveryQueue(),
+		refresher:    &refresher{},
+		purger:       newPurger(),
+		mediaHandler: mediaHandler,
+		distributor:  dist,
+	}
+	if c.FederationConfig.SlowFederation {
+		f.reputation = reputation.New(db, log)
+		f.throttle = newInboxThrottle(throttledInboxLimit, throttleWindow)
 	}
-	return pub.NewFederatingActor(f, f, db.Federation(), f)
+	if c.FederationConfig.Greedy {
+		f.backfiller = newBackfiller()
+	}
+	f.transportController = transport.NewController(c, f, nil, log)
+	f.actor = pub.NewFederatingActor(f, f, &distributingDB{Database: db.Federation(), f: f}, f)
+	f.registerHandlers(dist)
+	return f, nil
+}
+
+// FederatingActor returns the underlying go-fed federating actor.
+func (f *federator) FederatingActor() pub.FederatingActor {
+	return f.actor
 }
 
-// Federator implements several go-fed interfaces in one convenient location
-type Federator struct {
-	db db.DB
+// Start starts the delivery worker, the account refresh and purge workers, and the backfill workers if greedy federation is enabled.
+func (f *federator) Start() error {
+	if err := f.startDeliveries(); err != nil {
+		return fmt.Errorf("error starting deliveries: %s", err)
+	}
+	f.startRefresh()
+	f.startPurge()
+	return f.startBackfill()
+}
+
+// Stop stops all background work. Deliveries that are still pending will be picked up again on the next start.
+func (f *federator) Stop() error {
+	if err := f.stopBackfill(); err != nil {
+		return err
+	}
+	f.stopRefresh()
+	f.stopPurge()
+	return f.stopDeliveries()
 }
 
 // AuthenticateGetInbox determines whether the request is for a GET call to the Actor's Inbox.
-func (f *Federator) AuthenticateGetInbox(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
-	// TODO
-	// use context.WithValue() and context.Value() to set and get values through here
-	return nil, false, nil
+// The request must carry a valid http signature, and since we don't expose the contents of inboxes
+// to anyone but their owner, the signing account must own the inbox being requested.
+func (f *federator) AuthenticateGetInbox(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	l := f.log.WithField("func", "AuthenticateGetInbox")
+
+	account, err := f.authenticateRequest(ctx, r)
+	if err != nil {
+		l.Debugf("could not authenticate request: %s", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return ctx, false, nil
+	}
+
+	if inbox, err := url.Parse(account.InboxURL); err != nil || inbox.Host != r.Host || inbox.Path != r.URL.Path {
+		l.Debugf("account %s does not own inbox %s", account.URI, r.URL.Path)
+		w.WriteHeader(http.StatusForbidden)
+		return ctx, false, nil
+	}
+
+	return context.WithValue(ctx, ctxRequestingAccount, account), true, nil
 }
 
 // AuthenticateGetOutbox determines whether the request is for a GET call to the Actor's Outbox.
-func (f *Federator) AuthenticateGetOutbox(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
-	// TODO
-	return nil, false, nil
-}
+// Outboxes are public, so unsigned requests are let through, but if a signature is present then it must be valid.
+func (f *federator) AuthenticateGetOutbox(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	l := f.log.WithField("func", "AuthenticateGetOutbox")
 
-// GetOutbox returns a proper paginated view of the Outbox for serving in a response.
-func (f *Federator) GetOutbox(ctx context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
-	// TODO
-	return nil, nil
+	account, err := f.AuthenticateGet(ctx, r)
+	if err != nil {
+		l.Debugf("could not authenticate request: %s", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return ctx, false, nil
+	}
+	if account == nil {
+		// anonymous request
+		return ctx, true, nil
+	}
+
+	return context.WithValue(ctx, ctxRequestingAccount, account), true, nil
 }
 
 // NewTransport returns a new pub.Transport for federating with peer software.
-func (f *Federator) NewTransport(ctx context.Context, actorBoxIRI *url.URL, gofedAgent string) (pub.Transport, error) {
-	// TODO
-	return nil, nil
-}
+// The actorBoxIRI will be either the inbox or the outbox of a local account, and the returned
+// transport will sign all of its requests using that account's private key.
+func (f *federator) NewTransport(ctx context.Context, actorBoxIRI *url.URL, gofedAgent string) (pub.Transport, error) {
+	l := f.log.WithField("func", "NewTransport")
 
-func (f *Federator) PostInboxRequestBodyHook(ctx context.Context, r *http.Request, activity pub.Activity) (context.Context, error) {
-	// TODO
-	return nil, nil
+	var column string
+	switch {
+	case strings.HasSuffix(actorBoxIRI.Path, "/outbox"):
+		column = "outbox_url"
+	case strings.HasSuffix(actorBoxIRI.Path, "/inbox"):
+		column = "inbox_url"
+	default:
+		return nil, fmt.Errorf("%s was neither an inbox nor an outbox", actorBoxIRI.String())
+	}
+
+	account := &model.Account{}
+	if err := f.db.GetWhere(column, actorBoxIRI.String(), account); err != nil {
+		return nil, fmt.Errorf("error getting account with %s %s: %s", column, actorBoxIRI.String(), err)
+	}
+
+	if account.Domain != "" || account.PrivateKey == nil {
+		return nil, fmt.Errorf("account %s is not a local account with a private key", account.URI)
+	}
+
+	l.Tracef("creating new transport for account %s", account.URI)
+	t, err := f.transportController.NewTransport(account.PublicKeyURI, account.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if f.deliveries != nil {
+		// deliveries are queued in the database and made by the delivery worker, rather than right away
+		t = &queueingTransport{Transport: t, f: f, account: account}
+	}
+	return &blockingTransport{Transport: t, f: f}, nil
 }
 
-func (f *Federator) AuthenticatePostInbox(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+func (f *federator) PostInboxRequestBodyHook(ctx context.Context, r *http.Request, activity pub.Activity) (context.Context, error) {
 	// TODO
-	return nil, false, nil
+	return ctx, nil
 }
 
-func (f *Federator) Blocked(ctx context.Context, actorIRIs []*url.URL) (bool, error) {
-	// TODO
-	return false, nil
+// AuthenticatePostInbox verifies the http signature of a POST to an inbox. If the signature checks out,
+// the account that made the request will be set on the returned context for use further down the line.
+func (f *federator) AuthenticatePostInbox(ctx context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	l := f.log.WithField("func", "AuthenticatePostInbox")
+
+	if account, ok := ctx.Value(ctxSharedInboxAccount).(*model.Account); ok {
+		// passed on from the shared inbox, which has already authenticated the request
+		return context.WithValue(ctx, ctxRequestingAccount, account), true, nil
+	}
+
+	account, err := f.authenticateRequest(ctx, r)
+	if err != nil {
+		l.Debugf("could not authenticate request: %s", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return ctx, false, nil
+	}
+	l.Tracef("authenticated POST to %s from account %s", r.URL.Path, account.URI)
+
+	// whatever went wrong with delivering to this domain before, it's evidently back now
+	if err := f.markAvailable(account.Domain); err != nil {
+		l.Errorf("error marking domain %s as available: %s", account.Domain, err)
+	}
+
+	if ok, err := f.slowDelivery(ctx, w, r, account); err != nil || !ok {
+		return ctx, false, err
+	}
+
+	return context.WithValue(ctx, ctxRequestingAccount, account), true, nil
 }
 
-func (f *Federator) FederatingCallbacks(ctx context.Context) (pub.FederatingWrappedCallbacks, []interface{}, error) {
-	// TODO
-	return pub.FederatingWrappedCallbacks{}, nil, nil
+// Blocked determines whether any of the given actors are on a domain that we don't federate with, in which case
+// go-fed will refuse the activity that they're the actors of.
+func (f *federator) Blocked(ctx context.Context, actorIRIs []*url.URL) (bool, error) {
+	l := f.log.WithField("func", "Blocked")
+
+	for _, iri := range actorIRIs {
+		blocked, err := f.domainBlocked(iri.Host)
+		if err != nil {
+			return false, err
+		}
+		if blocked {
+			l.Debugf("actor %s is on a blocked domain", iri)
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
-func (f *Federator) DefaultCallback(ctx context.Context, activity pub.Activity) error {
+func (f *federator) DefaultCallback(ctx context.Context, activity pub.Activity) error {
 	// TODO
 	return nil
 }
 
-func (f *Federator) MaxInboxForwardingRecursionDepth(ctx context.Context) int {
+func (f *federator) MaxInboxForwardingRecursionDepth(ctx context.Context) int {
 	// TODO
 	return 0
 }
 
-func (f *Federator) MaxDeliveryRecursionDepth(ctx context.Context) int {
+func (f *federator) MaxDeliveryRecursionDepth(ctx context.Context) int {
 	// TODO
 	return 0
 }
 
-func (f *Federator) FilterForwarding(ctx context.Context, potentialRecipients []*url.URL, a pub.Activity) ([]*url.URL, error) {
+func (f *federator) FilterForwarding(ctx context.Context, potentialRecipients []*url.URL, a pub.Activity) ([]*url.URL, error) {
 	// TODO
 	return nil, nil
 }
 
-func (f *Federator) GetInbox(ctx context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
+func (f *federator) GetInbox(ctx context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
 	// TODO
 	return nil, nil
 }
 
-func (f *Federator) Now() time.Time {
+func (f *federator) Now() time.Time {
 	return time.Now()
 }
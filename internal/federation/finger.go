@@ -0,0 +1,130 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/pkg/mastotypes"
+)
+
+const (
+	webfingerPath  = "/.well-known/webfinger"
+	jrdContentType = "application/jrd+json"
+)
+
+// FingerRemoteAccount performs a webfinger lookup for a remote account, using the given username and domain.
+// It returns the ActivityPub URI of the account, as given in the 'self' link of the webfinger response.
+// If we already have the account in the database, its LastWebfingeredAt field will be updated.
+func (f *federator) FingerRemoteAccount(ctx context.Context, targetUsername string, targetDomain string) (*url.URL, error) {
+	l := f.log.WithField("func", "FingerRemoteAccount")
+
+	if targetUsername == "" || targetDomain == "" {
+		return nil, errors.New("username and domain must both be set")
+	}
+
+	if blocked, err := f.domainBlocked(targetDomain); err != nil {
+		return nil, err
+	} else if blocked {
+		return nil, fmt.Errorf("not webfingering %s since its domain is blocked", targetDomain)
+	}
+
+	target := fmt.Sprintf("https://%s%s?resource=acct:%s@%s", targetDomain, webfingerPath, url.QueryEscape(targetUsername), targetDomain)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating webfinger request: %s", err)
+	}
+	req.Header.Add("Accept", jrdContentType)
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error doing webfinger request to %s: %s", targetDomain, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("webfinger request to %s returned status %s", targetDomain, resp.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading webfinger response from %s: %s", targetDomain, err)
+	}
+	wkr := &mastotypes.WellKnownResponse{}
+	if err := json.Unmarshal(b, wkr); err != nil {
+		return nil, fmt.Errorf("error parsing webfinger response from %s: %s", targetDomain, err)
+	}
+
+	accountURI, err := selfLink(wkr)
+	if err != nil {
+		return nil, fmt.Errorf("bad webfinger response from %s: %s", targetDomain, err)
+	}
+	// the account might live on a different host to the one we webfingered, and that one needs to be allowed too
+	if accountURI.Host != targetDomain {
+		if blocked, err := f.domainBlocked(accountURI.Host); err != nil {
+			return nil, err
+		} else if blocked {
+			return nil, fmt.Errorf("webfinger response from %s points to %s, which is on a blocked domain", targetDomain, accountURI)
+		}
+	}
+
+	// if we already know about this account, mark that we just webfingered it
+	acct := &model.Account{}
+	if err := f.db.GetWhere("uri", accountURI.String(), acct); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return nil, fmt.Errorf("error getting account with uri %s from the database: %s", accountURI, err)
+		}
+		return accountURI, nil
+	}
+	if err := f.db.UpdateOneByID(acct.ID, "last_webfingered_at", time.Now(), &model.Account{}); err != nil {
+		l.Errorf("error updating last_webfingered_at for account %s: %s", acct.ID, err)
+	}
+	return accountURI, nil
+}
+
+// selfLink returns the href of the first 'self' link in the given webfinger response that points to an ActivityPub representation.
+func selfLink(wkr *mastotypes.WellKnownResponse) (*url.URL, error) {
+	for _, link := range wkr.Links {
+		if link.Rel != "self" {
+			continue
+		}
+		if !strings.HasPrefix(link.Type, "application/activity+json") && !strings.HasPrefix(link.Type, "application/ld+json") {
+			continue
+		}
+		uri, err := url.Parse(link.Href)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse self link %s: %s", link.Href, err)
+		}
+		if !uri.IsAbs() {
+			return nil, fmt.Errorf("self link %s is not absolute", link.Href)
+		}
+		return uri, nil
+	}
+	return nil, errors.New("no activitypub self link found")
+}
@@ -0,0 +1,148 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+type FingerTestSuite struct {
+	suite.Suite
+	log          *logrus.Logger
+	remoteServer *httptest.Server
+	remoteDomain string
+	remoteActor  string
+	jrd          string
+	mockDB       *db.MockDB
+	federator    *federator
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupTest starts a stand-in remote server with a webfinger endpoint, and a fresh federator
+func (suite *FingerTestSuite) SetupTest() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	mux := http.NewServeMux()
+	suite.remoteServer = httptest.NewTLSServer(mux)
+	suite.remoteDomain = strings.TrimPrefix(suite.remoteServer.URL, "https://")
+	suite.remoteActor = suite.remoteServer.URL + "/users/remote_user"
+	suite.jrd = fmt.Sprintf(`{
+		"subject": "acct:remote_user@%s",
+		"links": [
+			{"rel": "http://webfinger.net/rel/profile-page", "type": "text/html", "href": "%s/@remote_user"},
+			{"rel": "self", "type": "application/activity+json", "href": %q}
+		]
+	}`, suite.remoteDomain, suite.remoteServer.URL, suite.remoteActor)
+	mux.HandleFunc(webfingerPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("resource") != "acct:remote_user@"+suite.remoteDomain {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", jrdContentType)
+		fmt.Fprint(w, suite.jrd)
+	})
+
+	suite.mockDB = &db.MockDB{}
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainBlock")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainAllow")).Return(db.ErrNoEntries{})
+	suite.federator = &federator{
+		db:      suite.mockDB,
+		config:  config.Empty(),
+		log:     suite.log,
+		client:  suite.remoteServer.Client(),
+		domains: newDomainCache(suite.mockDB, domainCacheTTL),
+	}
+}
+
+// TearDownTest shuts down the stand-in remote server
+func (suite *FingerTestSuite) TearDownTest() {
+	suite.remoteServer.Close()
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *FingerTestSuite) TestFingerUnknownAccount() {
+	suite.mockDB.On("GetWhere", "uri", suite.remoteActor, mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+
+	uri, err := suite.federator.FingerRemoteAccount(context.Background(), "remote_user", suite.remoteDomain)
+	if assert.NoError(suite.T(), err) {
+		assert.Equal(suite.T(), suite.remoteActor, uri.String())
+	}
+	suite.mockDB.AssertNotCalled(suite.T(), "UpdateOneByID", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (suite *FingerTestSuite) TestFingerKnownAccountUpdatesLastWebfingeredAt() {
+	suite.mockDB.On("GetWhere", "uri", suite.remoteActor, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(2).(*model.Account).ID = "some-account-id"
+	})
+	suite.mockDB.On("UpdateOneByID", "some-account-id", "last_webfingered_at", mock.AnythingOfType("time.Time"), mock.AnythingOfType("*model.Account")).Return(nil)
+
+	before := time.Now()
+	uri, err := suite.federator.FingerRemoteAccount(context.Background(), "remote_user", suite.remoteDomain)
+	if assert.NoError(suite.T(), err) {
+		assert.Equal(suite.T(), suite.remoteActor, uri.String())
+	}
+	suite.mockDB.AssertCalled(suite.T(), "UpdateOneByID", "some-account-id", "last_webfingered_at", mock.MatchedBy(func(t time.Time) bool {
+		return !t.Before(before)
+	}), mock.AnythingOfType("*model.Account"))
+}
+
+func (suite *FingerTestSuite) TestFingerNotFound() {
+	_, err := suite.federator.FingerRemoteAccount(context.Background(), "someone_else", suite.remoteDomain)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *FingerTestSuite) TestFingerNoSelfLink() {
+	suite.jrd = fmt.Sprintf(`{"subject": "acct:remote_user@%s", "links": [{"rel": "http://webfinger.net/rel/profile-page", "type": "text/html", "href": "%s/@remote_user"}]}`, suite.remoteDomain, suite.remoteServer.URL)
+	_, err := suite.federator.FingerRemoteAccount(context.Background(), "remote_user", suite.remoteDomain)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *FingerTestSuite) TestFingerNotAllowed() {
+	suite.federator.config.FederationConfig.Mode = config.FederationModeAllowlist
+
+	_, err := suite.federator.FingerRemoteAccount(context.Background(), "remote_user", suite.remoteDomain)
+	assert.Error(suite.T(), err)
+	suite.mockDB.AssertNotCalled(suite.T(), "GetWhere", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestFingerTestSuite(t *testing.T) {
+	suite.Run(t, new(FingerTestSuite))
+}
@@ -0,0 +1,89 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/transport"
+	"github.com/superseriousbusiness/gotosocial/internal/util"
+)
+
+// instanceAccount returns the local account that represents this instance as a whole. It signs the requests that we don't make on
+// behalf of any one local account, such as fetching remote accounts. Its username is the host of this instance, which isn't a valid
+// username for anyone signing up, and it's created the first time it's needed.
+func (f *federator) instanceAccount() (*model.Account, error) {
+	f.instanceMu.Lock()
+	defer f.instanceMu.Unlock()
+	if f.instance != nil {
+		return f.instance, nil
+	}
+
+	account := &model.Account{}
+	err := f.db.GetLocalAccountByUsername(f.config.Host, account)
+	if err == nil {
+		f.instance = account
+		return account, nil
+	}
+	if _, ok := err.(db.ErrNoEntries); !ok {
+		return nil, fmt.Errorf("error getting instance account: %s", err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("error creating key for instance account: %s", err)
+	}
+	uris := util.GenerateURIs(f.config.Host, f.config.Protocol, f.config.Host)
+	account = &model.Account{
+		ID:           uuid.NewString(),
+		Username:     f.config.Host,
+		DisplayName:  f.config.Host,
+		URL:          uris.UserURL,
+		PrivateKey:   key,
+		PublicKey:    &key.PublicKey,
+		PublicKeyURI: uris.PublicKeyURI,
+		ActorType:    "Application",
+		Bot:          true,
+		Locked:       true,
+		URI:          uris.UserURI,
+		InboxURL:     uris.InboxURL,
+		OutboxURL:    uris.OutboxURL,
+		FollowersURL: uris.FollowersURL,
+		FollowingURL: uris.FollowingURL,
+	}
+	if err := f.db.Put(account); err != nil {
+		return nil, fmt.Errorf("error storing instance account: %s", err)
+	}
+	f.instance = account
+	return account, nil
+}
+
+// instanceTransport returns a transport that signs its requests with the key of the instance account.
+func (f *federator) instanceTransport() (transport.Transport, error) {
+	account, err := f.instanceAccount()
+	if err != nil {
+		return nil, err
+	}
+	return f.transportController.NewTransport(account.PublicKeyURI, account.PrivateKey)
+}
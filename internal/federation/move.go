@@ -0,0 +1,226 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/typeutils"
+)
+
+// MoveAccount marks the given local account as moved to the account with the given uri, and sends a Move to the
+// followers of the local account, so that they can follow the new account instead. The account being moved to has to
+// list the local account among its aliases. The account that was moved to is returned.
+func (f *federator) MoveAccount(ctx context.Context, account *model.Account, targetIRI *url.URL) (*model.Account, error) {
+	if account.Domain != "" {
+		return nil, fmt.Errorf("account %s is not local", account.URI)
+	}
+	if targetIRI.String() == account.URI {
+		return nil, errors.New("an account can't move to itself")
+	}
+
+	target, err := f.aliasedAccount(ctx, targetIRI, account)
+	if err != nil {
+		return nil, err
+	}
+	if target.MovedToAccountID != "" {
+		return nil, fmt.Errorf("account %s has moved away itself", target.URI)
+	}
+
+	if err := f.db.UpdateOneByID(account.ID, "moved_to_account_id", target.ID, &model.Account{}); err != nil {
+		return nil, fmt.Errorf("error marking account %s as moved: %s", account.ID, err)
+	}
+	account.MovedToAccountID = target.ID
+
+	move, err := typeutils.MoveToAS(account, target)
+	if err != nil {
+		return nil, fmt.Errorf("error converting move of account %s to activitystreams: %s", account.ID, err)
+	}
+	outboxIRI, err := url.Parse(account.OutboxURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing outbox of account %s: %s", account.ID, err)
+	}
+	if _, err := f.actor.Send(ctx, outboxIRI, move); err != nil {
+		return nil, fmt.Errorf("error sending move of %s to %s: %s", account.URI, target.URI, err)
+	}
+	return target, nil
+}
+
+// move handles a Move of an account to another account. As long as the account that was moved to lists the moved
+// account among its aliases, the moved account is marked as moved, and any of our accounts that follow it are made
+// to follow the account it moved to instead.
+func (f *federator) move(ctx context.Context, move vocab.ActivityStreamsMove) error {
+	l := f.log.WithField("func", "move")
+
+	origin, objectIRI, id, err := db.ActivityActor(ctx, f.db, move)
+	if err != nil {
+		return err
+	}
+	if objectIRI.String() != origin.URI {
+		return fmt.Errorf("move %s is of %s, but its actor is %s", id, objectIRI, origin.URI)
+	}
+	targetIRI, err := typeutils.ExtractTarget(move)
+	if err != nil {
+		return fmt.Errorf("error extracting target of move %s: %s", id, err)
+	}
+	if targetIRI.String() == origin.URI {
+		return fmt.Errorf("move %s is of %s to itself", id, origin.URI)
+	}
+
+	target, err := f.aliasedAccount(ctx, targetIRI, origin)
+	if err != nil {
+		return fmt.Errorf("not processing move %s: %s", id, err)
+	}
+
+	if origin.MovedToAccountID != target.ID {
+		if err := f.db.UpdateOneByID(origin.ID, "moved_to_account_id", target.ID, &model.Account{}); err != nil {
+			return fmt.Errorf("error marking account %s as moved: %s", origin.ID, err)
+		}
+	}
+
+	follows := []model.Follow{}
+	if err := f.db.GetFollowersByAccountID(origin.ID, &follows); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return fmt.Errorf("error getting followers of account %s: %s", origin.ID, err)
+		}
+	}
+	for i := range follows {
+		follower := &model.Account{}
+		if err := f.db.GetByID(follows[i].AccountID, follower); err != nil {
+			l.Infof("couldn't get follower %s of account %s: %s", follows[i].AccountID, origin.ID, err)
+			continue
+		}
+		if follower.Domain != "" || follower.ID == target.ID {
+			// remote followers will have been sent the move by the server of the account themselves
+			continue
+		}
+		if err := f.moveFollow(ctx, &follows[i], follower, origin, target); err != nil {
+			l.Infof("couldn't move follow of account %s from %s to %s: %s", follower.ID, origin.URI, target.URI, err)
+		}
+	}
+	return nil
+}
+
+// moveFollow makes the local follower follow target, unless it does already, and undoes its follow of origin.
+func (f *federator) moveFollow(ctx context.Context, follow *model.Follow, follower *model.Account, origin *model.Account, target *model.Account) error {
+	outboxIRI, err := url.Parse(follower.OutboxURL)
+	if err != nil {
+		return fmt.Errorf("error parsing outbox of account %s: %s", follower.ID, err)
+	}
+
+	existing, err := f.getFollow(follower.ID, target.ID)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		// storing the follow request is taken care of by the federating db when go-fed creates the Follow
+		newFollow, err := followToAS("", follower, target)
+		if err != nil {
+			return err
+		}
+		if _, err := f.actor.Send(ctx, outboxIRI, newFollow); err != nil {
+			return fmt.Errorf("error sending follow of %s: %s", target.URI, err)
+		}
+	}
+
+	oldFollow, err := followToAS(follow.URI, follower, origin)
+	if err != nil {
+		return err
+	}
+	undo := streams.NewActivityStreamsUndo()
+	undo.SetActivityStreamsActor(oldFollow.GetActivityStreamsActor())
+	undo.SetActivityStreamsTo(oldFollow.GetActivityStreamsTo())
+
+	objectProp := streams.NewActivityStreamsObjectProperty()
+	objectProp.AppendActivityStreamsFollow(oldFollow)
+	undo.SetActivityStreamsObject(objectProp)
+
+	if _, err := f.actor.Send(ctx, outboxIRI, undo); err != nil {
+		return fmt.Errorf("error sending undo of follow of %s: %s", origin.URI, err)
+	}
+	return f.db.DeleteByID(follow.ID, &model.Follow{})
+}
+
+// followToAS returns a Follow of target by origin, addressed to target. The id of the follow is only set if uri isn't empty.
+func followToAS(uri string, origin *model.Account, target *model.Account) (vocab.ActivityStreamsFollow, error) {
+	originIRI, err := url.Parse(origin.URI)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing uri of account %s: %s", origin.ID, err)
+	}
+	targetIRI, err := url.Parse(target.URI)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing uri of account %s: %s", target.ID, err)
+	}
+
+	follow := streams.NewActivityStreamsFollow()
+	if uri != "" {
+		id, err := url.Parse(uri)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing follow uri %s: %s", uri, err)
+		}
+		idProp := streams.NewJSONLDIdProperty()
+		idProp.SetIRI(id)
+		follow.SetJSONLDId(idProp)
+	}
+
+	actorProp := streams.NewActivityStreamsActorProperty()
+	actorProp.AppendIRI(originIRI)
+	follow.SetActivityStreamsActor(actorProp)
+
+	objectProp := streams.NewActivityStreamsObjectProperty()
+	objectProp.AppendIRI(targetIRI)
+	follow.SetActivityStreamsObject(objectProp)
+
+	toProp := streams.NewActivityStreamsToProperty()
+	toProp.AppendIRI(targetIRI)
+	follow.SetActivityStreamsTo(toProp)
+
+	return follow, nil
+}
+
+// aliasedAccount returns the account with the given uri as it is right now, which for a remote account means fetching
+// it again, and makes sure that it lists alias among its aliases.
+func (f *federator) aliasedAccount(ctx context.Context, iri *url.URL, alias *model.Account) (*model.Account, error) {
+	account, err := db.AccountForIRI(f.db, iri)
+	if err == nil {
+		if account.Domain != "" {
+			// what we have stored may well be from before the alias was added
+			account, err = f.refreshAccount(ctx, account)
+		}
+	} else if _, ok := err.(db.ErrNoEntries); ok {
+		account, err = f.getOrFetchAccount(ctx, iri)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, uri := range account.AlsoKnownAs {
+		if uri == alias.URI {
+			return account, nil
+		}
+	}
+	return nil, fmt.Errorf("account %s doesn't list %s as an alias", account.URI, alias.URI)
+}
@@ -0,0 +1,232 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/typeutils"
+)
+
+type MoveTestSuite struct {
+	suite.Suite
+	log           *logrus.Logger
+	remoteAccount *model.Account
+	follower      *model.Account
+	aliasedTarget *model.Account
+	otherTarget   *model.Account
+	mockDB        *db.MockDB
+	actor         *sendRecorder
+	federator     *federator
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *MoveTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	suite.remoteAccount = &model.Account{
+		ID:           "8a7c1e2d-3b4f-4e5a-8c9d-0e1f2a3b4c5d",
+		Username:     "remote_user",
+		Domain:       "example.org",
+		URI:          "https://example.org/users/remote_user",
+		FollowersURL: "https://example.org/users/remote_user/followers",
+	}
+	suite.follower = &model.Account{
+		ID:        "2b6d3f1c-5d43-4c8b-9c8e-6f5d1c2b3a41",
+		Username:  "local_user",
+		URI:       "http://localhost:8080/users/local_user",
+		OutboxURL: "http://localhost:8080/users/local_user/outbox",
+	}
+	suite.aliasedTarget = &model.Account{
+		ID:           "7c1e9a0b-2d3f-4a5b-8c6d-9e0f1a2b3c4d",
+		Username:     "new_user",
+		URI:          "http://localhost:8080/users/new_user",
+		OutboxURL:    "http://localhost:8080/users/new_user/outbox",
+		FollowersURL: "http://localhost:8080/users/new_user/followers",
+		AlsoKnownAs:  []string{"https://example.org/users/remote_user", "http://localhost:8080/users/moving_user"},
+	}
+	suite.otherTarget = &model.Account{
+		ID:          "5e4d3c2b-1a09-4f8e-8d7c-6b5a49382716",
+		Username:    "other_user",
+		URI:         "http://localhost:8080/users/other_user",
+		AlsoKnownAs: []string{"https://example.org/users/someone_else"},
+	}
+}
+
+// SetupTest creates a fresh mock db and federator for each test. The mock db knows about the suite's accounts,
+// and the local follower follows the remote account.
+func (suite *MoveTestSuite) SetupTest() {
+	suite.mockDB = &db.MockDB{}
+	for _, a := range []*model.Account{suite.remoteAccount, suite.follower, suite.aliasedTarget, suite.otherTarget} {
+		account := a
+		suite.mockDB.On("GetWhere", "uri", account.URI, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(2).(*model.Account) = *account
+		})
+		suite.mockDB.On("GetByID", account.ID, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(1).(*model.Account) = *account
+		})
+	}
+	suite.mockDB.On("GetFollowersByAccountID", suite.remoteAccount.ID, mock.AnythingOfType("*[]model.Follow")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*[]model.Follow) = []model.Follow{{
+			ID:              "old-follow-id",
+			AccountID:       suite.follower.ID,
+			TargetAccountID: suite.remoteAccount.ID,
+			URI:             "http://localhost:8080/users/local_user/follow/1",
+		}}
+	})
+	suite.mockDB.On("GetFollowingByAccountID", mock.AnythingOfType("string"), mock.AnythingOfType("*[]model.Follow")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("UpdateOneByID", mock.AnythingOfType("string"), "moved_to_account_id", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	suite.mockDB.On("DeleteByID", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+
+	suite.actor = &sendRecorder{}
+	suite.federator = &federator{
+		db:     suite.mockDB,
+		config: config.Empty(),
+		log:    suite.log,
+		actor:  suite.actor,
+	}
+}
+
+// moveTo returns a Move of the remote account to the given target
+func (suite *MoveTestSuite) moveTo(target *model.Account) vocab.ActivityStreamsMove {
+	move, err := typeutils.MoveToAS(suite.remoteAccount, target)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	id, _ := url.Parse("https://example.org/users/remote_user/move/1")
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(id)
+	move.SetJSONLDId(idProp)
+	return move
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *MoveTestSuite) TestMoveToAlias() {
+	err := suite.federator.move(signedBy(suite.remoteAccount), suite.moveTo(suite.aliasedTarget))
+	suite.NoError(err)
+
+	suite.mockDB.AssertCalled(suite.T(), "UpdateOneByID", suite.remoteAccount.ID, "moved_to_account_id", suite.aliasedTarget.ID, &model.Account{})
+
+	// the follower follows the new account, and unfollows the old one
+	if assert.Len(suite.T(), suite.actor.sent, 2) {
+		follow, ok := suite.actor.sent[0].(vocab.ActivityStreamsFollow)
+		if assert.True(suite.T(), ok) {
+			assert.Equal(suite.T(), suite.follower.OutboxURL, suite.actor.outboxes[0].String())
+			actor, _ := typeutils.ExtractActor(follow)
+			object, _ := typeutils.ExtractObject(follow)
+			assert.Equal(suite.T(), suite.follower.URI, actor.String())
+			assert.Equal(suite.T(), suite.aliasedTarget.URI, object.String())
+		}
+		undo, ok := suite.actor.sent[1].(vocab.ActivityStreamsUndo)
+		if assert.True(suite.T(), ok) {
+			undone := undo.GetActivityStreamsObject().Begin().GetActivityStreamsFollow()
+			if assert.NotNil(suite.T(), undone) {
+				assert.Equal(suite.T(), "http://localhost:8080/users/local_user/follow/1", undone.GetJSONLDId().GetIRI().String())
+			}
+		}
+	}
+	suite.mockDB.AssertCalled(suite.T(), "DeleteByID", "old-follow-id", &model.Follow{})
+}
+
+func (suite *MoveTestSuite) TestMoveToNonAlias() {
+	err := suite.federator.move(signedBy(suite.remoteAccount), suite.moveTo(suite.otherTarget))
+	suite.Error(err)
+
+	suite.mockDB.AssertNotCalled(suite.T(), "UpdateOneByID", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	suite.Empty(suite.actor.sent)
+}
+
+func (suite *MoveTestSuite) TestMoveFromWrongRequester() {
+	ctx := signedBy(suite.follower)
+	err := suite.federator.move(ctx, suite.moveTo(suite.aliasedTarget))
+	suite.Error(err)
+
+	suite.mockDB.AssertNotCalled(suite.T(), "UpdateOneByID", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	suite.Empty(suite.actor.sent)
+}
+
+func (suite *MoveTestSuite) TestMoveAccount() {
+	account := &model.Account{
+		ID:           "0f1e2d3c-4b5a-4968-8776-a5b4c3d2e1f0",
+		Username:     "moving_user",
+		URI:          "http://localhost:8080/users/moving_user",
+		OutboxURL:    "http://localhost:8080/users/moving_user/outbox",
+		FollowersURL: "http://localhost:8080/users/moving_user/followers",
+	}
+	targetIRI, _ := url.Parse(suite.aliasedTarget.URI)
+
+	target, err := suite.federator.MoveAccount(context.Background(), account, targetIRI)
+	suite.NoError(err)
+	if assert.NotNil(suite.T(), target) {
+		suite.Equal(suite.aliasedTarget.ID, target.ID)
+	}
+	suite.Equal(suite.aliasedTarget.ID, account.MovedToAccountID)
+	suite.mockDB.AssertCalled(suite.T(), "UpdateOneByID", account.ID, "moved_to_account_id", suite.aliasedTarget.ID, &model.Account{})
+
+	if assert.Len(suite.T(), suite.actor.sent, 1) {
+		assert.Equal(suite.T(), account.OutboxURL, suite.actor.outboxes[0].String())
+		move, ok := suite.actor.sent[0].(vocab.ActivityStreamsMove)
+		if assert.True(suite.T(), ok) {
+			target, _ := typeutils.ExtractTarget(move)
+			object, _ := typeutils.ExtractObject(move)
+			assert.Equal(suite.T(), suite.aliasedTarget.URI, target.String())
+			assert.Equal(suite.T(), account.URI, object.String())
+			assert.Equal(suite.T(), account.FollowersURL, move.GetActivityStreamsTo().Begin().GetIRI().String())
+		}
+	}
+}
+
+func (suite *MoveTestSuite) TestMoveAccountToNonAlias() {
+	account := &model.Account{
+		ID:        "0f1e2d3c-4b5a-4968-8776-a5b4c3d2e1f0",
+		Username:  "moving_user",
+		URI:       "http://localhost:8080/users/moving_user",
+		OutboxURL: "http://localhost:8080/users/moving_user/outbox",
+	}
+	targetIRI, _ := url.Parse(suite.otherTarget.URI)
+
+	_, err := suite.federator.MoveAccount(context.Background(), account, targetIRI)
+	suite.Error(err)
+	suite.Empty(account.MovedToAccountID)
+	suite.Empty(suite.actor.sent)
+}
+
+func TestMoveTestSuite(t *testing.T) {
+	suite.Run(t, new(MoveTestSuite))
+}
@@ -0,0 +1,171 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/typeutils"
+)
+
+// outboxPageSize is the most activities that a page of an outbox will contain.
+const outboxPageSize = 20
+
+// GetOutbox returns a page of the outbox of a local account, for serving to remote servers. The outbox contains a Create
+// for each public or unlisted status of the account, and an Announce for each public or unlisted boost, newest first.
+// Like timelines in the client API, the page is picked with the max_id and min_id query parameters of the request.
+func (f *federator) GetOutbox(ctx context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
+	outboxURL := fmt.Sprintf("%s://%s%s", f.config.Protocol, f.config.Host, r.URL.Path)
+	account := &model.Account{}
+	if err := f.db.GetWhere("outbox_url", outboxURL, account); err != nil {
+		return nil, fmt.Errorf("error getting account with outbox %s: %s", outboxURL, err)
+	}
+
+	statuses, err := f.outboxStatuses(account.ID, r.URL.Query().Get("max_id"), r.URL.Query().Get("min_id"))
+	if err != nil {
+		return nil, err
+	}
+	items := make([]vocab.Type, 0, len(statuses))
+	for i := range statuses {
+		item, err := f.outboxItem(&statuses[i], account)
+		if err != nil {
+			return nil, err
+		}
+		if item != nil {
+			items = append(items, item)
+		}
+	}
+
+	outbox, err := url.Parse(outboxURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing outbox url %s: %s", outboxURL, err)
+	}
+	id := *outbox
+	id.RawQuery = r.URL.RawQuery
+	var next, prev *url.URL
+	if len(statuses) != 0 {
+		// next goes back in time, and prev forward
+		next = outboxPageIRI(outbox, "max_id", statuses[len(statuses)-1].ID)
+		prev = outboxPageIRI(outbox, "min_id", statuses[0].ID)
+	}
+	return typeutils.OrderedCollectionPageToAS(&id, outbox, next, prev, items)
+}
+
+// outboxStatuses returns up to a page of the public and unlisted statuses of the given account, newest first. If maxID is set, the page
+// is made of the statuses that come right before the status with that id, and if minID is set, the ones that come right after it.
+func (f *federator) outboxStatuses(accountID string, maxID string, minID string) ([]model.Status, error) {
+	statuses := []model.Status{}
+	for len(statuses) < outboxPageSize {
+		batch := []model.Status{}
+		if err := f.db.GetStatusesByTimeDescending(accountID, &batch, outboxPageSize, maxID, minID); err != nil {
+			if _, ok := err.(db.ErrNoEntries); ok {
+				break
+			}
+			return nil, fmt.Errorf("error getting statuses of account %s: %s", accountID, err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		visible := []model.Status{}
+		for _, s := range batch {
+			if outboxVisible(&s) {
+				visible = append(visible, s)
+			}
+		}
+		if minID != "" {
+			// going forward in time, so each batch is newer than the last
+			statuses = append(visible, statuses...)
+			minID = batch[0].ID
+		} else {
+			statuses = append(statuses, visible...)
+			maxID = batch[len(batch)-1].ID
+		}
+
+		if len(batch) < outboxPageSize {
+			break
+		}
+	}
+
+	if len(statuses) > outboxPageSize {
+		if minID != "" {
+			// keep the ones closest to where we started
+			statuses = statuses[len(statuses)-outboxPageSize:]
+		} else {
+			statuses = statuses[:outboxPageSize]
+		}
+	}
+	return statuses, nil
+}
+
+// outboxItem returns the activity that the given status of the given account appears as in its outbox: a Create of a Note,
+// or an Announce if the status is a boost. If the boosted status is gone, or isn't public or unlisted, nil is returned.
+func (f *federator) outboxItem(status *model.Status, account *model.Account) (vocab.Type, error) {
+	if status.BoostOfID != "" {
+		boosted := &model.Status{}
+		if err := f.db.GetByID(status.BoostOfID, boosted); err != nil {
+			if _, ok := err.(db.ErrNoEntries); ok {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("error getting boosted status of %s: %s", status.URI, err)
+		}
+		if !outboxVisible(boosted) {
+			return nil, nil
+		}
+		return typeutils.BoostToAS(status, account, boosted)
+	}
+
+	var inReplyTo *model.Status
+	if status.InReplyToID != "" {
+		inReplyTo = &model.Status{}
+		if err := f.db.GetByID(status.InReplyToID, inReplyTo); err != nil {
+			if _, ok := err.(db.ErrNoEntries); !ok {
+				return nil, fmt.Errorf("error getting replied-to status of %s: %s", status.URI, err)
+			}
+			inReplyTo = nil
+		}
+	}
+	note, err := typeutils.StatusToAS(status, account, inReplyTo)
+	if err != nil {
+		return nil, fmt.Errorf("error converting status %s: %s", status.URI, err)
+	}
+	return typeutils.CreateToAS(status, account, note)
+}
+
+// outboxVisible returns true if the given status is one that can be shown in an outbox, ie., it's public or unlisted,
+// and it isn't local-only.
+func outboxVisible(s *model.Status) bool {
+	return s.Visibility != nil && !s.Visibility.LocalOnly && !s.Visibility.Direct && (s.Visibility.Public || s.Visibility.Unlisted)
+}
+
+// outboxPageIRI returns the iri of the page of the given outbox that's found with the given paging parameter.
+func outboxPageIRI(outbox *url.URL, key string, id string) *url.URL {
+	page := *outbox
+	q := url.Values{}
+	q.Set("page", "true")
+	q.Set(key, id)
+	page.RawQuery = q.Encode()
+	return &page
+}
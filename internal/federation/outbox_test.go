@@ -0,0 +1,214 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+type OutboxTestSuite struct {
+	suite.Suite
+	log       *logrus.Logger
+	account   *model.Account
+	boosted   *model.Status
+	statuses  []model.Status
+	mockDB    *db.MockDB
+	federator *federator
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *OutboxTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	suite.account = &model.Account{
+		ID:           "local-account-id",
+		Username:     "someone",
+		URI:          "http://localhost:8080/users/someone",
+		OutboxURL:    "http://localhost:8080/users/someone/outbox",
+		FollowersURL: "http://localhost:8080/users/someone/followers",
+	}
+	suite.boosted = &model.Status{
+		ID:         "boosted-status-id",
+		URI:        "https://remote.example/users/someone_else/statuses/1",
+		Visibility: &model.Visibility{Public: true},
+	}
+
+	// 30 statuses, newest first: every fifth one is followers only, and the newest one is a boost
+	now := time.Now()
+	for i := 0; i < 30; i++ {
+		s := model.Status{
+			ID:         fmt.Sprintf("status-%02d", i),
+			URI:        fmt.Sprintf("http://localhost:8080/users/someone/statuses/%02d", i),
+			AccountID:  suite.account.ID,
+			CreatedAt:  now.Add(-time.Duration(i) * time.Minute),
+			Content:    "hello",
+			Visibility: &model.Visibility{Public: true},
+		}
+		switch {
+		case i == 0:
+			s.BoostOfID = suite.boosted.ID
+		case i%5 == 1:
+			s.Visibility = &model.Visibility{Followers: true}
+		case i%2 == 0:
+			s.Visibility = &model.Visibility{Unlisted: true}
+		}
+		suite.statuses = append(suite.statuses, s)
+	}
+}
+
+// SetupTest creates a fresh mock db that pages through the statuses of the suite the way the real db does
+func (suite *OutboxTestSuite) SetupTest() {
+	suite.mockDB = &db.MockDB{}
+	suite.mockDB.On("GetWhere", "outbox_url", suite.account.OutboxURL, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*model.Account) = *suite.account
+	})
+	suite.mockDB.On("GetByID", suite.boosted.ID, mock.AnythingOfType("*model.Status")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*model.Status) = *suite.boosted
+	})
+	suite.mockDB.On("GetStatusesByTimeDescending", suite.account.ID, mock.AnythingOfType("*[]model.Status"), mock.AnythingOfType("int"), mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil).Run(func(args mock.Arguments) {
+		limit := args.Int(2)
+		maxID := args.String(3)
+		minID := args.String(4)
+		start, end := 0, len(suite.statuses)
+		for i, s := range suite.statuses {
+			if s.ID == maxID {
+				start = i + 1
+			}
+			if s.ID == minID {
+				end = i
+			}
+		}
+		if minID != "" && end-start > limit {
+			start = end - limit
+		} else if end-start > limit {
+			end = start + limit
+		}
+		*args.Get(1).(*[]model.Status) = append([]model.Status{}, suite.statuses[start:end]...)
+	})
+
+	c := config.Empty()
+	c.Protocol = "http"
+	c.Host = "localhost:8080"
+	suite.federator = &federator{
+		db:     suite.mockDB,
+		config: c,
+		log:    suite.log,
+	}
+}
+
+func (suite *OutboxTestSuite) getOutbox(query string) (vocab.ActivityStreamsOrderedCollectionPage, []string) {
+	r := httptest.NewRequest(http.MethodGet, suite.account.OutboxURL+"?"+query, nil)
+	page, err := suite.federator.GetOutbox(context.Background(), r)
+	suite.NoError(err)
+	suite.NotNil(page)
+
+	ids := []string{}
+	for iter := page.GetActivityStreamsOrderedItems().Begin(); iter != nil; iter = iter.Next() {
+		t := iter.GetType()
+		id := t.GetJSONLDId().Get().String()
+		ids = append(ids, t.GetTypeName()+" "+id)
+	}
+	return page, ids
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *OutboxTestSuite) TestGetOutboxFirstPage() {
+	page, ids := suite.getOutbox("page=true")
+
+	assert.Equal(suite.T(), suite.account.OutboxURL+"?page=true", page.GetJSONLDId().Get().String())
+	assert.Equal(suite.T(), suite.account.OutboxURL, page.GetActivityStreamsPartOf().GetIRI().String())
+
+	// a full page, leaving out the followers only statuses
+	assert.Len(suite.T(), ids, outboxPageSize)
+	assert.Equal(suite.T(), "Announce http://localhost:8080/users/someone/statuses/00", ids[0])
+	assert.Equal(suite.T(), "Create http://localhost:8080/users/someone/statuses/02/activity", ids[1])
+	assert.NotContains(suite.T(), ids, "Create http://localhost:8080/users/someone/statuses/06/activity")
+	assert.Equal(suite.T(), "Create http://localhost:8080/users/someone/statuses/24/activity", ids[19])
+
+	assert.Equal(suite.T(), suite.account.OutboxURL+"?max_id=status-24&page=true", page.GetActivityStreamsNext().GetIRI().String())
+	assert.Equal(suite.T(), suite.account.OutboxURL+"?min_id=status-00&page=true", page.GetActivityStreamsPrev().GetIRI().String())
+}
+
+func (suite *OutboxTestSuite) TestGetOutboxMaxID() {
+	page, ids := suite.getOutbox("page=true&max_id=status-24")
+
+	assert.Equal(suite.T(), []string{
+		"Create http://localhost:8080/users/someone/statuses/25/activity",
+		"Create http://localhost:8080/users/someone/statuses/27/activity",
+		"Create http://localhost:8080/users/someone/statuses/28/activity",
+		"Create http://localhost:8080/users/someone/statuses/29/activity",
+	}, ids)
+	assert.Equal(suite.T(), suite.account.OutboxURL+"?max_id=status-29&page=true", page.GetActivityStreamsNext().GetIRI().String())
+	assert.Equal(suite.T(), suite.account.OutboxURL+"?min_id=status-25&page=true", page.GetActivityStreamsPrev().GetIRI().String())
+}
+
+func (suite *OutboxTestSuite) TestGetOutboxMinID() {
+	page, ids := suite.getOutbox("page=true&min_id=status-24")
+
+	// everything newer than the oldest status, which takes more than one trip to the db since some are left out
+	assert.Len(suite.T(), ids, 19)
+	assert.Equal(suite.T(), "Announce http://localhost:8080/users/someone/statuses/00", ids[0])
+	assert.Equal(suite.T(), "Create http://localhost:8080/users/someone/statuses/23/activity", ids[18])
+	assert.Equal(suite.T(), suite.account.OutboxURL+"?max_id=status-23&page=true", page.GetActivityStreamsNext().GetIRI().String())
+	assert.Equal(suite.T(), suite.account.OutboxURL+"?min_id=status-00&page=true", page.GetActivityStreamsPrev().GetIRI().String())
+}
+
+func (suite *OutboxTestSuite) TestGetOutboxMinIDFullPage() {
+	_, ids := suite.getOutbox("page=true&min_id=status-29")
+
+	// more than a page is newer than status-29, so the page is made of the ones closest to it
+	assert.Len(suite.T(), ids, outboxPageSize)
+	assert.Equal(suite.T(), "Create http://localhost:8080/users/someone/statuses/04/activity", ids[0])
+	assert.Equal(suite.T(), "Create http://localhost:8080/users/someone/statuses/28/activity", ids[19])
+}
+
+func (suite *OutboxTestSuite) TestGetOutboxEmptyPage() {
+	page, ids := suite.getOutbox("page=true&max_id=status-29")
+
+	assert.Empty(suite.T(), ids)
+	assert.Nil(suite.T(), page.GetActivityStreamsNext())
+	assert.Nil(suite.T(), page.GetActivityStreamsPrev())
+}
+
+func TestOutboxTestSuite(t *testing.T) {
+	suite.Run(t, new(OutboxTestSuite))
+}
@@ -0,0 +1,140 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/typeutils"
+)
+
+const (
+	// accountStaleAfter is how long we keep using what we know about a remote account before fetching it again.
+	accountStaleAfter = 24 * time.Hour
+	// accountRefreshPollInterval is how often we look for stale remote accounts.
+	accountRefreshPollInterval = 10 * time.Minute
+	// accountRefreshBatchSize is how many stale accounts are refreshed each time we look for them.
+	accountRefreshBatchSize = 50
+	// minKeyRefreshInterval is how long we wait before fetching an account again, when a signature made with
+	// its key doesn't verify. This stops bad signatures from making us fetch the account over and over.
+	minKeyRefreshInterval = 1 * time.Minute
+)
+
+// refresher keeps track of the worker that refreshes stale remote accounts in the background.
+type refresher struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// startRefresh starts the worker that refreshes stale remote accounts.
+func (f *federator) startRefresh() {
+	if f.refresher == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	f.refresher.cancel = cancel
+	f.refresher.wg.Add(1)
+	go func() {
+		defer f.refresher.wg.Done()
+		ticker := time.NewTicker(accountRefreshPollInterval)
+		defer ticker.Stop()
+		for {
+			f.refreshStaleAccounts(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stopRefresh stops the refresh worker, abandoning any refresh in progress.
+func (f *federator) stopRefresh() {
+	if f.refresher == nil || f.refresher.cancel == nil {
+		return
+	}
+	f.refresher.cancel()
+	f.refresher.wg.Wait()
+}
+
+// refreshStaleAccounts refreshes a batch of the remote accounts that haven't been fetched for longer than accountStaleAfter.
+// Failures are logged rather than returned, since there's nobody waiting on the result.
+func (f *federator) refreshStaleAccounts(ctx context.Context) {
+	l := f.log.WithField("func", "refreshStaleAccounts")
+
+	accounts := []model.Account{}
+	if err := f.db.GetStaleRemoteAccounts(f.Now().Add(-accountStaleAfter), accountRefreshBatchSize, &accounts); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			l.Errorf("error getting stale accounts: %s", err)
+		}
+		return
+	}
+
+	for i := range accounts {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := f.refreshAccount(ctx, &accounts[i]); err != nil {
+			l.Infof("couldn't refresh account %s: %s", accounts[i].URI, err)
+		}
+	}
+}
+
+// refreshAccount fetches the given remote account from its server again, and updates the stored account with what it says now,
+// including any new public key. The updated account is returned. If the fetch fails, the account is left as it was, but it's still
+// marked as fetched so that we don't keep trying straight away.
+func (f *federator) refreshAccount(ctx context.Context, account *model.Account) (*model.Account, error) {
+	if account.Domain == "" {
+		return nil, fmt.Errorf("account %s is local", account.URI)
+	}
+	l := f.log.WithField("func", "refreshAccount")
+
+	iri, err := url.Parse(account.URI)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing account uri %s: %s", account.URI, err)
+	}
+
+	fetched, fetchErr := f.fetchRemoteAccount(ctx, iri)
+	if fetchErr == nil && fetched.URI != account.URI {
+		fetchErr = fmt.Errorf("dereferenced account %s but got account %s", account.URI, fetched.URI)
+	}
+
+	updated := *account
+	if fetchErr == nil && typeutils.UpdateRemoteAccount(&updated, fetched) {
+		l.Debugf("account %s has a new public key %s", updated.URI, updated.PublicKeyURI)
+	}
+	updated.LastFetchedAt = f.Now()
+	if fetchErr == nil {
+		updated.UpdatedAt = updated.LastFetchedAt
+	}
+	if err := f.db.UpdateByID(updated.ID, &updated); err != nil {
+		return nil, fmt.Errorf("database error updating account %s: %s", updated.URI, err)
+	}
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+	return &updated, nil
+}
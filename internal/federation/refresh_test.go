@@ -0,0 +1,255 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-fed/httpsig"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/transport"
+)
+
+type RefreshTestSuite struct {
+	suite.Suite
+	log          *logrus.Logger
+	config       *config.Config
+	remoteKey    *rsa.PrivateKey
+	instanceKey  *rsa.PrivateKey
+	remoteServer *httptest.Server
+	remoteActor  string
+	fetches      int
+	mockDB       *db.MockDB
+	federator    *federator
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *RefreshTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	c := config.Empty()
+	c.Protocol = "http"
+	c.Host = "localhost:8080"
+	suite.config = c
+
+	remoteKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	suite.remoteKey = remoteKey
+	instanceKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	suite.instanceKey = instanceKey
+}
+
+// SetupTest starts a stand-in remote server serving an actor that's changed since we last saw it, and a fresh federator
+// whose mock db already knows about the instance account
+func (suite *RefreshTestSuite) SetupTest() {
+	pubBytes, err := x509.MarshalPKIXPublicKey(&suite.remoteKey.PublicKey)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	pubPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes})
+
+	suite.fetches = 0
+	mux := http.NewServeMux()
+	suite.remoteServer = httptest.NewServer(mux)
+	suite.remoteActor = suite.remoteServer.URL + "/users/remote_user"
+	mux.HandleFunc("/users/remote_user", func(w http.ResponseWriter, r *http.Request) {
+		suite.fetches++
+		verifier, err := httpsig.NewVerifier(r)
+		if err != nil || verifier.Verify(&suite.instanceKey.PublicKey, httpsig.RSA_SHA256) != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/activity+json")
+		fmt.Fprintf(w, `{
+			"@context": ["https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"],
+			"id": %q,
+			"type": "Person",
+			"preferredUsername": "remote_user",
+			"name": "New Name",
+			"summary": "new bio",
+			"manuallyApprovesFollowers": true,
+			"inbox": %q,
+			"outbox": %q,
+			"icon": {"type": "Image", "mediaType": "image/png", "url": %q},
+			"attachment": [{"type": "PropertyValue", "name": "pronouns", "value": "they/them"}],
+			"publicKey": {"id": %q, "owner": %q, "publicKeyPem": %q}
+		}`, suite.remoteActor, suite.remoteActor+"/inbox", suite.remoteActor+"/outbox", suite.remoteServer.URL+"/avatar.png",
+			suite.remoteActor+"#new-key", suite.remoteActor, string(pubPem))
+	})
+
+	suite.mockDB = &db.MockDB{}
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainBlock")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainAllow")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetLocalAccountByUsername", "localhost:8080", mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		a := args.Get(1).(*model.Account)
+		a.ID = "instance-account-id"
+		a.Username = "localhost:8080"
+		a.PublicKeyURI = "http://localhost:8080/users/localhost:8080#main-key"
+		a.PrivateKey = suite.instanceKey
+		a.PublicKey = &suite.instanceKey.PublicKey
+	})
+
+	suite.federator = &federator{
+		db:        suite.mockDB,
+		config:    suite.config,
+		log:       suite.log,
+		client:    suite.remoteServer.Client(),
+		domains:   newDomainCache(suite.mockDB, domainCacheTTL),
+		refresher: &refresher{},
+	}
+	suite.federator.transportController = transport.NewController(suite.config, suite.federator, suite.remoteServer.Client(), suite.log)
+}
+
+// TearDownTest shuts down the stand-in remote server
+func (suite *RefreshTestSuite) TearDownTest() {
+	suite.remoteServer.Close()
+}
+
+// staleAccount returns the remote account as we knew it a couple of days ago
+func (suite *RefreshTestSuite) staleAccount() model.Account {
+	return model.Account{
+		ID:            "remote-account-id",
+		Username:      "remote_user",
+		Domain:        "remote.example",
+		DisplayName:   "Old Name",
+		URI:           suite.remoteActor,
+		InboxURL:      suite.remoteActor + "/inbox",
+		PublicKeyURI:  suite.remoteActor + "#main-key",
+		PublicKey:     &suite.instanceKey.PublicKey,
+		LastFetchedAt: time.Now().Add(-48 * time.Hour),
+		SilencedAt:    time.Now().Add(-72 * time.Hour),
+	}
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *RefreshTestSuite) TestRefreshStaleAccounts() {
+	suite.mockDB.On("GetStaleRemoteAccounts", mock.AnythingOfType("time.Time"), accountRefreshBatchSize, mock.AnythingOfType("*[]model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		assert.WithinDuration(suite.T(), time.Now().Add(-accountStaleAfter), args.Get(0).(time.Time), time.Minute)
+		*args.Get(2).(*[]model.Account) = []model.Account{suite.staleAccount()}
+	})
+	var updated *model.Account
+	suite.mockDB.On("UpdateByID", "remote-account-id", mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		updated = args.Get(1).(*model.Account)
+	})
+
+	suite.federator.refreshStaleAccounts(context.Background())
+
+	suite.Equal(1, suite.fetches)
+	if assert.NotNil(suite.T(), updated) {
+		suite.Equal("New Name", updated.DisplayName)
+		suite.Equal("new bio", updated.Note)
+		suite.True(updated.Locked)
+		suite.Equal([]model.Field{{Name: "pronouns", Value: "they/them"}}, updated.Fields)
+		if assert.NotNil(suite.T(), updated.AvatarRemoteURL) {
+			suite.Equal(suite.remoteServer.URL+"/avatar.png", updated.AvatarRemoteURL.String())
+		}
+
+		// the key was rotated
+		suite.Equal(suite.remoteActor+"#new-key", updated.PublicKeyURI)
+		suite.True(suite.remoteKey.PublicKey.Equal(updated.PublicKey))
+
+		// but our own business with the account is untouched
+		suite.Equal("remote-account-id", updated.ID)
+		suite.False(updated.SilencedAt.IsZero())
+		suite.WithinDuration(time.Now(), updated.LastFetchedAt, time.Minute)
+	}
+}
+
+func (suite *RefreshTestSuite) TestRefreshAccountFails() {
+	suite.remoteServer.Close()
+	var updated *model.Account
+	suite.mockDB.On("UpdateByID", "remote-account-id", mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		updated = args.Get(1).(*model.Account)
+	})
+
+	stale := suite.staleAccount()
+	_, err := suite.federator.refreshAccount(context.Background(), &stale)
+	suite.Error(err)
+
+	// nothing changes except that we won't try again for a while
+	if assert.NotNil(suite.T(), updated) {
+		suite.Equal("Old Name", updated.DisplayName)
+		suite.Equal(suite.remoteActor+"#main-key", updated.PublicKeyURI)
+		suite.WithinDuration(time.Now(), updated.LastFetchedAt, time.Minute)
+	}
+}
+
+func (suite *RefreshTestSuite) TestRefreshLocalAccount() {
+	_, err := suite.federator.refreshAccount(context.Background(), &model.Account{ID: "local-account-id", URI: "http://localhost:8080/users/local_user"})
+	suite.Error(err)
+	suite.Equal(0, suite.fetches)
+	suite.mockDB.AssertNotCalled(suite.T(), "UpdateByID", mock.Anything, mock.Anything)
+}
+
+func (suite *RefreshTestSuite) TestInstanceAccountCreated() {
+	suite.mockDB = &db.MockDB{}
+	suite.mockDB.On("GetLocalAccountByUsername", "localhost:8080", mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+	var stored *model.Account
+	suite.mockDB.On("Put", mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		stored = args.Get(0).(*model.Account)
+	})
+	suite.federator.db = suite.mockDB
+
+	account, err := suite.federator.instanceAccount()
+	suite.NoError(err)
+	suite.Equal(stored, account)
+	suite.Equal("localhost:8080", account.Username)
+	suite.Equal("http://localhost:8080/users/localhost:8080", account.URI)
+	suite.Equal("http://localhost:8080/users/localhost:8080#main-key", account.PublicKeyURI)
+	suite.NotNil(account.PrivateKey)
+
+	// it's only made once
+	again, err := suite.federator.instanceAccount()
+	suite.NoError(err)
+	suite.Equal(account, again)
+	suite.mockDB.AssertNumberOfCalls(suite.T(), "Put", 1)
+}
+
+func TestRefreshTestSuite(t *testing.T) {
+	suite.Run(t, new(RefreshTestSuite))
+}
@@ -0,0 +1,112 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/google/uuid"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/typeutils"
+)
+
+// flag handles an incoming Flag, which reports one of our accounts, and optionally some of its statuses, to our admins.
+// The objects of the Flag are the reported account and statuses; any that aren't ours are ignored, since the report
+// is only of interest to us for what's on this instance. Reports from domains whose reports we reject are dropped.
+func (f *federator) flag(ctx context.Context, flag vocab.ActivityStreamsFlag) error {
+	l := f.log.WithField("func", "flag")
+
+	reporter, _, id, err := db.ActivityActor(ctx, f.db, flag)
+	if err != nil {
+		return err
+	}
+	rejected, err := f.domainRejectsReports(reporter.Domain)
+	if err != nil {
+		return err
+	}
+	if rejected {
+		l.Debugf("dropping report %s since reports from %s are rejected", id, reporter.Domain)
+		return nil
+	}
+
+	if err := f.db.GetWhere("uri", id.String(), &model.Report{}); err == nil {
+		l.Debugf("already have report %s", id)
+		return nil
+	} else if _, ok := err.(db.ErrNoEntries); !ok {
+		return fmt.Errorf("error checking for existing report %s: %s", id, err)
+	}
+
+	targetAccountID := ""
+	statuses := []*model.Status{}
+	for _, iri := range typeutils.ExtractObjects(flag) {
+		account, err := db.AccountForIRI(f.db, iri)
+		if err == nil {
+			if account.Domain == "" && targetAccountID == "" {
+				targetAccountID = account.ID
+			}
+			continue
+		}
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return err
+		}
+
+		status := &model.Status{}
+		if err := f.db.GetWhere("uri", iri.String(), status); err != nil {
+			if _, ok := err.(db.ErrNoEntries); !ok {
+				return fmt.Errorf("error getting status %s: %s", iri, err)
+			}
+			continue
+		}
+		if status.Local {
+			statuses = append(statuses, status)
+		}
+	}
+	if targetAccountID == "" && len(statuses) != 0 {
+		targetAccountID = statuses[0].AccountID
+	}
+	if targetAccountID == "" {
+		l.Debugf("report %s isn't of any of our accounts", id)
+		return nil
+	}
+
+	report := &model.Report{
+		ID:              uuid.NewString(),
+		AccountID:       reporter.ID,
+		TargetAccountID: targetAccountID,
+		StatusIDs:       []string{},
+		URI:             id.String(),
+	}
+	for _, s := range statuses {
+		// a report is of one account, so statuses by anyone else don't belong in it
+		if s.AccountID == targetAccountID {
+			report.StatusIDs = append(report.StatusIDs, s.ID)
+		}
+	}
+	if comment, err := typeutils.ExtractContent(flag); err == nil {
+		report.Comment = comment
+	}
+
+	if err := f.db.Put(report); err != nil {
+		return fmt.Errorf("error storing report %s: %s", id, err)
+	}
+	return nil
+}
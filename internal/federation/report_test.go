@@ -0,0 +1,210 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+type ReportTestSuite struct {
+	suite.Suite
+	log          *logrus.Logger
+	reporter     *model.Account
+	muzzled      *model.Account
+	localAccount *model.Account
+	otherAccount *model.Account
+	status       *model.Status
+	otherStatus  *model.Status
+	mockDB       *db.MockDB
+	federator    *federator
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *ReportTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	suite.reporter = &model.Account{
+		ID:       "8a7c1e2d-3b4f-4e5a-8c9d-0e1f2a3b4c5d",
+		Username: "example.org",
+		Domain:   "example.org",
+		URI:      "https://example.org/actor",
+	}
+	suite.muzzled = &model.Account{
+		ID:       "7c1e9a0b-2d3f-4a5b-8c6d-9e0f1a2b3c4d",
+		Username: "noreports.example",
+		Domain:   "noreports.example",
+		URI:      "https://noreports.example/actor",
+	}
+	suite.localAccount = &model.Account{
+		ID:       "2b6d3f1c-5d43-4c8b-9c8e-6f5d1c2b3a41",
+		Username: "local_user",
+		URI:      "http://localhost:8080/users/local_user",
+	}
+	suite.otherAccount = &model.Account{
+		ID:       "5e4d3c2b-1a09-4f8e-8d7c-6b5a49382716",
+		Username: "other_user",
+		URI:      "http://localhost:8080/users/other_user",
+	}
+	suite.status = &model.Status{
+		ID:        "0f1e2d3c-4b5a-4968-8776-a5b4c3d2e1f0",
+		URI:       "http://localhost:8080/users/local_user/statuses/0f1e2d3c-4b5a-4968-8776-a5b4c3d2e1f0",
+		AccountID: suite.localAccount.ID,
+		Local:     true,
+	}
+	suite.otherStatus = &model.Status{
+		ID:        "3e4f5a6b-7c8d-4e9f-a0b1-c2d3e4f5a6b7",
+		URI:       "http://localhost:8080/users/other_user/statuses/3e4f5a6b-7c8d-4e9f-a0b1-c2d3e4f5a6b7",
+		AccountID: suite.otherAccount.ID,
+		Local:     true,
+	}
+}
+
+// SetupTest creates a fresh mock db that knows about the suite's accounts and statuses, and a federator that uses it.
+// Reports from noreports.example are rejected.
+func (suite *ReportTestSuite) SetupTest() {
+	suite.mockDB = &db.MockDB{}
+	for _, a := range []*model.Account{suite.reporter, suite.muzzled, suite.localAccount, suite.otherAccount} {
+		account := a
+		suite.mockDB.On("GetWhere", "uri", account.URI, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(2).(*model.Account) = *account
+		})
+	}
+	for _, s := range []*model.Status{suite.status, suite.otherStatus} {
+		status := s
+		suite.mockDB.On("GetWhere", "uri", status.URI, mock.AnythingOfType("*model.Status")).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(2).(*model.Status) = *status
+		})
+	}
+	suite.mockDB.On("GetWhere", "uri", mock.AnythingOfType("string"), mock.Anything).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainBlock")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(0).(*[]model.DomainBlock) = []model.DomainBlock{{Domain: "noreports.example", RejectReports: true}}
+	})
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainAllow")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("Put", mock.AnythingOfType("*model.Report")).Return(nil)
+
+	c := config.Empty()
+	c.Host = "localhost:8080"
+	suite.federator = &federator{
+		db:      suite.mockDB,
+		config:  c,
+		log:     suite.log,
+		domains: newDomainCache(suite.mockDB, domainCacheTTL),
+	}
+}
+
+// flagBy returns a Flag by the given account of the given objects, with the given comment
+func (suite *ReportTestSuite) flagBy(reporter *model.Account, comment string, objects ...string) vocab.ActivityStreamsFlag {
+	flag := streams.NewActivityStreamsFlag()
+
+	id, _ := url.Parse(reporter.URI + "/flags/1")
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(id)
+	flag.SetJSONLDId(idProp)
+
+	actorIRI, _ := url.Parse(reporter.URI)
+	actorProp := streams.NewActivityStreamsActorProperty()
+	actorProp.AppendIRI(actorIRI)
+	flag.SetActivityStreamsActor(actorProp)
+
+	objectProp := streams.NewActivityStreamsObjectProperty()
+	for _, o := range objects {
+		iri, _ := url.Parse(o)
+		objectProp.AppendIRI(iri)
+	}
+	flag.SetActivityStreamsObject(objectProp)
+
+	contentProp := streams.NewActivityStreamsContentProperty()
+	contentProp.AppendXMLSchemaString(comment)
+	flag.SetActivityStreamsContent(contentProp)
+	return flag
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *ReportTestSuite) TestFlag() {
+	flag := suite.flagBy(suite.reporter, "spam", suite.localAccount.URI, suite.status.URI, suite.otherStatus.URI, "https://example.org/users/someone")
+	err := suite.federator.flag(signedBy(suite.reporter), flag)
+	suite.NoError(err)
+
+	// the status by the other account isn't part of the report
+	suite.mockDB.AssertCalled(suite.T(), "Put", mock.MatchedBy(func(r *model.Report) bool {
+		return assert.Equal(suite.T(), suite.reporter.ID, r.AccountID) &&
+			assert.Equal(suite.T(), suite.localAccount.ID, r.TargetAccountID) &&
+			assert.Equal(suite.T(), []string{suite.status.ID}, r.StatusIDs) &&
+			assert.Equal(suite.T(), "spam", r.Comment) &&
+			assert.Equal(suite.T(), "https://example.org/actor/flags/1", r.URI)
+	}))
+}
+
+func (suite *ReportTestSuite) TestFlagOfStatusOnly() {
+	flag := suite.flagBy(suite.reporter, "", suite.otherStatus.URI)
+	err := suite.federator.flag(signedBy(suite.reporter), flag)
+	suite.NoError(err)
+
+	suite.mockDB.AssertCalled(suite.T(), "Put", mock.MatchedBy(func(r *model.Report) bool {
+		return r.TargetAccountID == suite.otherAccount.ID && len(r.StatusIDs) == 1 && r.StatusIDs[0] == suite.otherStatus.ID
+	}))
+}
+
+func (suite *ReportTestSuite) TestFlagFromDomainWithReportsRejected() {
+	flag := suite.flagBy(suite.muzzled, "spam", suite.localAccount.URI)
+	err := suite.federator.flag(signedBy(suite.muzzled), flag)
+	suite.NoError(err)
+
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+}
+
+func (suite *ReportTestSuite) TestFlagOfRemoteAccount() {
+	flag := suite.flagBy(suite.reporter, "spam", suite.muzzled.URI)
+	err := suite.federator.flag(signedBy(suite.reporter), flag)
+	suite.NoError(err)
+
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+}
+
+func (suite *ReportTestSuite) TestFlagSignedBySomeoneElse() {
+	flag := suite.flagBy(suite.reporter, "spam", suite.localAccount.URI)
+	err := suite.federator.flag(signedBy(suite.muzzled), flag)
+	suite.Error(err)
+
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+}
+
+func TestReportTestSuite(t *testing.T) {
+	suite.Run(t, new(ReportTestSuite))
+}
@@ -0,0 +1,289 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+// PostSharedInbox handles a delivery to the shared inbox of this instance. The request is authenticated once,
+// and the activity is then passed on to the inboxes of the local accounts that it's for.
+func (f *federator) PostSharedInbox(ctx context.Context, w http.ResponseWriter, r *http.Request) (bool, error) {
+	l := f.log.WithField("func", "PostSharedInbox")
+
+	if r.Method != http.MethodPost || !isActivityPubContentType(r.Header.Get("Content-Type")) {
+		return false, nil
+	}
+
+	ctx, authenticated, err := f.AuthenticatePostInbox(ctx, w, r)
+	if err != nil || !authenticated {
+		return true, err
+	}
+	sender, ok := ctx.Value(ctxRequestingAccount).(*model.Account)
+	if !ok {
+		return true, fmt.Errorf("no requesting account set on context after authenticating %s", r.URL.Path)
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return true, fmt.Errorf("error reading body of delivery from %s: %s", sender.URI, err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return true, nil
+	}
+	t, err := streams.ToType(ctx, m)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return true, nil
+	}
+	activity, ok := t.(pub.Activity)
+	if !ok || activity.GetJSONLDId() == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return true, nil
+	}
+	id := activity.GetJSONLDId().Get()
+
+	// go-fed would check this for each inbox, but there's no point passing the activity on at all if it's blocked
+	actors := []*url.URL{}
+	if actorProp := activity.GetActivityStreamsActor(); actorProp != nil {
+		for iter := actorProp.Begin(); iter != actorProp.End(); iter = iter.Next() {
+			if actor, err := pub.ToId(iter); err == nil {
+				actors = append(actors, actor)
+			}
+		}
+	}
+	blocked, err := f.Blocked(ctx, actors)
+	if err != nil {
+		return true, err
+	}
+	if blocked {
+		w.WriteHeader(http.StatusForbidden)
+		return true, nil
+	}
+
+	inboxes, err := f.sharedInboxRecipients(activity, sender)
+	if err != nil {
+		return true, err
+	}
+	if len(inboxes) == 0 {
+		l.Debugf("activity %s from %s isn't for any local accounts", id, sender.URI)
+		w.WriteHeader(http.StatusAccepted)
+		return true, nil
+	}
+
+	// the request has been authenticated already, so it doesn't need to be authenticated again for each inbox
+	ctx = context.WithValue(ctx, ctxSharedInboxAccount, sender)
+	for _, inbox := range inboxes {
+		req := r.Clone(ctx)
+		req.URL.Path = inbox.Path
+		req.URL.RawPath = ""
+		req.Body = ioutil.NopCloser(bytes.NewReader(b))
+		rw := &discardResponseWriter{header: http.Header{}}
+		if _, err := f.actor.PostInbox(ctx, rw, req); err != nil {
+			l.Errorf("error passing activity %s from %s on to inbox %s: %s", id, sender.URI, inbox, err)
+			continue
+		}
+		l.Tracef("passed activity %s from %s on to inbox %s, status %d", id, sender.URI, inbox, rw.status)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	return true, nil
+}
+
+// sharedInboxRecipients works out which local inboxes an activity delivered to the shared inbox should be passed on to.
+//
+// Each local account that the activity is addressed to, or that is its object (eg. the target of a Follow), gets it in its
+// own inbox. If the activity is addressed to the followers of its sender or to the public, it's passed on to the inbox of
+// just one local follower of the sender: whatever the activity creates is stored once for all local followers to see,
+// so there's no need to process it for each of them.
+func (f *federator) sharedInboxRecipients(activity pub.Activity, sender *model.Account) ([]*url.URL, error) {
+	addressed := []*url.URL{}
+	add := func(iter pub.IdProperty) {
+		if iri, err := pub.ToId(iter); err == nil {
+			addressed = append(addressed, iri)
+		}
+	}
+	if to := activity.GetActivityStreamsTo(); to != nil {
+		for iter := to.Begin(); iter != to.End(); iter = iter.Next() {
+			add(iter)
+		}
+	}
+	if cc := activity.GetActivityStreamsCc(); cc != nil {
+		for iter := cc.Begin(); iter != cc.End(); iter = iter.Next() {
+			add(iter)
+		}
+	}
+	if bto := activity.GetActivityStreamsBto(); bto != nil {
+		for iter := bto.Begin(); iter != bto.End(); iter = iter.Next() {
+			add(iter)
+		}
+	}
+	if bcc := activity.GetActivityStreamsBcc(); bcc != nil {
+		for iter := bcc.Begin(); iter != bcc.End(); iter = iter.Next() {
+			add(iter)
+		}
+	}
+	if audience := activity.GetActivityStreamsAudience(); audience != nil {
+		for iter := audience.Begin(); iter != audience.End(); iter = iter.Next() {
+			add(iter)
+		}
+	}
+	if object := activity.GetActivityStreamsObject(); object != nil {
+		for iter := object.Begin(); iter != object.End(); iter = iter.Next() {
+			if iter.IsIRI() {
+				add(iter)
+			}
+		}
+	}
+
+	inboxes := []*url.URL{}
+	seen := map[string]bool{}
+	addInbox := func(inbox string) {
+		if inbox == "" || seen[inbox] {
+			return
+		}
+		if iri, err := url.Parse(inbox); err == nil {
+			seen[inbox] = true
+			inboxes = append(inboxes, iri)
+		}
+	}
+
+	toFollowers := false
+	for _, iri := range addressed {
+		if pub.IsPublic(iri.String()) || (sender.FollowersURL != "" && iri.String() == sender.FollowersURL) {
+			toFollowers = true
+			continue
+		}
+		if iri.Host != f.config.Host {
+			continue
+		}
+		account := &model.Account{}
+		if err := f.db.GetWhere("uri", iri.String(), account); err != nil {
+			if _, ok := err.(db.ErrNoEntries); ok {
+				// probably a status or a collection of ours rather than an account
+				continue
+			}
+			return nil, fmt.Errorf("error getting account %s: %s", iri, err)
+		}
+		if account.Domain == "" {
+			addInbox(account.InboxURL)
+		}
+	}
+
+	if toFollowers {
+		follower, err := f.localFollower(sender)
+		if err != nil {
+			return nil, err
+		}
+		if follower != nil {
+			addInbox(follower.InboxURL)
+		}
+	}
+
+	return inboxes, nil
+}
+
+// localFollower returns a local account that follows the given account, or nil if there's none.
+func (f *federator) localFollower(account *model.Account) (*model.Account, error) {
+	follows := []model.Follow{}
+	if err := f.db.GetFollowersByAccountID(account.ID, &follows); err != nil {
+		if _, ok := err.(db.ErrNoEntries); ok {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting followers of account %s: %s", account.URI, err)
+	}
+	for _, follow := range follows {
+		follower := &model.Account{}
+		if err := f.db.GetByID(follow.AccountID, follower); err != nil {
+			if _, ok := err.(db.ErrNoEntries); ok {
+				continue
+			}
+			return nil, fmt.Errorf("error getting account %s: %s", follow.AccountID, err)
+		}
+		if follower.Domain == "" {
+			return follower, nil
+		}
+	}
+	return nil, nil
+}
+
+// groupBySharedInbox replaces the inboxes of remote accounts that we know to have a shared inbox with that shared inbox,
+// so that an activity going to many accounts on the same instance is delivered there just once. The receiving instance
+// works out which of its accounts the activity is for from its addressing.
+func (f *federator) groupBySharedInbox(recipients []*url.URL) []*url.URL {
+	grouped := make([]*url.URL, 0, len(recipients))
+	seen := make(map[string]bool, len(recipients))
+	for _, r := range recipients {
+		target := r
+		account := &model.Account{}
+		if err := f.db.GetWhere("inbox_url", r.String(), account); err == nil && account.SharedInboxURL != "" {
+			if shared, err := url.Parse(account.SharedInboxURL); err == nil && shared.Host == r.Host {
+				target = shared
+			}
+		}
+		if seen[target.String()] {
+			continue
+		}
+		seen[target.String()] = true
+		grouped = append(grouped, target)
+	}
+	return grouped
+}
+
+// isActivityPubContentType returns true if the given content type is one that activitypub requests are sent with.
+func isActivityPubContentType(contentType string) bool {
+	return strings.Contains(contentType, "application/activity+json") ||
+		(strings.Contains(contentType, "application/ld+json") && strings.Contains(contentType, "https://www.w3.org/ns/activitystreams"))
+}
+
+// discardResponseWriter stands in for the response writer when passing a shared inbox delivery on to the inbox
+// of a local account. The response to the remote server is written once, by PostSharedInbox itself.
+type discardResponseWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (w *discardResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
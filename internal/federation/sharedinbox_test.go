@@ -0,0 +1,264 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+// inboxRecorder stands in for the go-fed federating actor, and keeps track of the inboxes that activities are posted to
+type inboxRecorder struct {
+	pub.FederatingActor
+	inboxes []string
+	bodies  []string
+	senders []*model.Account
+}
+
+func (i *inboxRecorder) PostInbox(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error) {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return true, err
+	}
+	i.inboxes = append(i.inboxes, r.URL.Path)
+	i.bodies = append(i.bodies, string(b))
+	sender, _ := c.Value(ctxSharedInboxAccount).(*model.Account)
+	i.senders = append(i.senders, sender)
+	w.WriteHeader(http.StatusOK)
+	return true, nil
+}
+
+type SharedInboxTestSuite struct {
+	suite.Suite
+	log       *logrus.Logger
+	sender    *model.Account
+	mentioned *model.Account
+	follower  *model.Account
+	mockDB    *db.MockDB
+	actor     *inboxRecorder
+	federator *federator
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *SharedInboxTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	suite.sender = &model.Account{
+		ID:           "remote-account-id",
+		URI:          "https://remote.example/users/someone",
+		FollowersURL: "https://remote.example/users/someone/followers",
+		Domain:       "remote.example",
+	}
+	suite.mentioned = &model.Account{
+		ID:       "mentioned-account-id",
+		URI:      "http://localhost:8080/users/mentioned",
+		InboxURL: "http://localhost:8080/users/mentioned/inbox",
+	}
+	suite.follower = &model.Account{
+		ID:       "follower-account-id",
+		URI:      "http://localhost:8080/users/follower",
+		InboxURL: "http://localhost:8080/users/follower/inbox",
+	}
+}
+
+// SetupTest creates a fresh mock db that knows about a local account that's mentioned, and a local account that
+// follows the sender, along with a remote account that follows the sender too.
+func (suite *SharedInboxTestSuite) SetupTest() {
+	suite.mockDB = &db.MockDB{}
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainBlock")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainAllow")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetWhere", "uri", suite.mentioned.URI, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*model.Account) = *suite.mentioned
+	})
+	suite.mockDB.On("GetWhere", "uri", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetFollowersByAccountID", suite.sender.ID, mock.AnythingOfType("*[]model.Follow")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*[]model.Follow) = []model.Follow{
+			{AccountID: "remote-follower-id", TargetAccountID: suite.sender.ID},
+			{AccountID: suite.follower.ID, TargetAccountID: suite.sender.ID},
+		}
+	})
+	suite.mockDB.On("GetByID", "remote-follower-id", mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*model.Account) = model.Account{ID: "remote-follower-id", Domain: "elsewhere.example"}
+	})
+	suite.mockDB.On("GetByID", suite.follower.ID, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*model.Account) = *suite.follower
+	})
+
+	suite.actor = &inboxRecorder{}
+
+	c := config.Empty()
+	c.Host = "localhost:8080"
+	suite.federator = &federator{
+		db:      suite.mockDB,
+		config:  c,
+		log:     suite.log,
+		actor:   suite.actor,
+		domains: newDomainCache(suite.mockDB, domainCacheTTL),
+	}
+}
+
+// post returns a request posting the given activity to the shared inbox, along with a context as if the request
+// had already been authenticated as coming from the sender
+func (suite *SharedInboxTestSuite) post(activity string) (context.Context, *http.Request) {
+	r := httptest.NewRequest(http.MethodPost, "http://localhost:8080/inbox", strings.NewReader(activity))
+	r.Header.Set("Content-Type", "application/activity+json")
+	return context.WithValue(context.Background(), ctxSharedInboxAccount, suite.sender), r
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *SharedInboxTestSuite) TestPostSharedInbox() {
+	activity := fmt.Sprintf(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://remote.example/users/someone/statuses/1/activity",
+		"type": "Create",
+		"actor": %q,
+		"to": ["https://www.w3.org/ns/activitystreams#Public"],
+		"cc": [%q, %q],
+		"object": "https://remote.example/users/someone/statuses/1"
+	}`, suite.sender.URI, suite.sender.FollowersURL, suite.mentioned.URI)
+	ctx, r := suite.post(activity)
+	w := httptest.NewRecorder()
+
+	handled, err := suite.federator.PostSharedInbox(ctx, w, r)
+	suite.NoError(err)
+	assert.True(suite.T(), handled)
+	assert.Equal(suite.T(), http.StatusOK, w.Code)
+
+	// the mentioned account gets the activity, and so does one local follower on behalf of all of them
+	assert.Equal(suite.T(), []string{"/users/mentioned/inbox", "/users/follower/inbox"}, suite.actor.inboxes)
+	for i := range suite.actor.inboxes {
+		assert.Equal(suite.T(), activity, suite.actor.bodies[i])
+		assert.Equal(suite.T(), suite.sender, suite.actor.senders[i])
+	}
+}
+
+func (suite *SharedInboxTestSuite) TestPostSharedInboxNotForUs() {
+	activity := fmt.Sprintf(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://remote.example/users/someone/statuses/1/activity",
+		"type": "Create",
+		"actor": %q,
+		"to": ["https://elsewhere.example/users/someone_else"],
+		"object": "https://remote.example/users/someone/statuses/1"
+	}`, suite.sender.URI)
+	ctx, r := suite.post(activity)
+	w := httptest.NewRecorder()
+
+	handled, err := suite.federator.PostSharedInbox(ctx, w, r)
+	suite.NoError(err)
+	assert.True(suite.T(), handled)
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code)
+	assert.Empty(suite.T(), suite.actor.inboxes)
+}
+
+func (suite *SharedInboxTestSuite) TestPostSharedInboxFollow() {
+	activity := fmt.Sprintf(`{
+		"@context": "https://www.w3.org/ns/activitystreams",
+		"id": "https://remote.example/users/someone/follows/1",
+		"type": "Follow",
+		"actor": %q,
+		"object": %q
+	}`, suite.sender.URI, suite.mentioned.URI)
+	ctx, r := suite.post(activity)
+	w := httptest.NewRecorder()
+
+	handled, err := suite.federator.PostSharedInbox(ctx, w, r)
+	suite.NoError(err)
+	assert.True(suite.T(), handled)
+	assert.Equal(suite.T(), []string{"/users/mentioned/inbox"}, suite.actor.inboxes)
+}
+
+func (suite *SharedInboxTestSuite) TestPostSharedInboxBadRequest() {
+	ctx, r := suite.post(`{"type": "Create"}`)
+	w := httptest.NewRecorder()
+	handled, err := suite.federator.PostSharedInbox(ctx, w, r)
+	suite.NoError(err)
+	assert.True(suite.T(), handled)
+	assert.Equal(suite.T(), http.StatusBadRequest, w.Code)
+
+	// not activitypub at all
+	r = httptest.NewRequest(http.MethodPost, "http://localhost:8080/inbox", strings.NewReader("hello"))
+	r.Header.Set("Content-Type", "text/plain")
+	handled, err = suite.federator.PostSharedInbox(context.Background(), httptest.NewRecorder(), r)
+	suite.NoError(err)
+	assert.False(suite.T(), handled)
+	assert.Empty(suite.T(), suite.actor.inboxes)
+}
+
+func (suite *SharedInboxTestSuite) TestGroupBySharedInbox() {
+	for _, a := range []model.Account{
+		{InboxURL: "https://big.example/users/one/inbox", SharedInboxURL: "https://big.example/inbox"},
+		{InboxURL: "https://big.example/users/two/inbox", SharedInboxURL: "https://big.example/inbox"},
+		{InboxURL: "https://small.example/users/three/inbox"},
+		{InboxURL: "https://sneaky.example/users/four/inbox", SharedInboxURL: "https://big.example/inbox"},
+	} {
+		account := a
+		suite.mockDB.On("GetWhere", "inbox_url", account.InboxURL, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(2).(*model.Account) = account
+		})
+	}
+	suite.mockDB.On("GetWhere", "inbox_url", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+
+	grouped := suite.federator.groupBySharedInbox([]*url.URL{
+		testURL("https://big.example/users/one/inbox"),
+		testURL("https://big.example/users/two/inbox"),
+		testURL("https://small.example/users/three/inbox"),
+		testURL("https://sneaky.example/users/four/inbox"),
+		testURL("https://unknown.example/users/five/inbox"),
+	})
+	strs := []string{}
+	for _, g := range grouped {
+		strs = append(strs, g.String())
+	}
+	assert.Equal(suite.T(), []string{
+		"https://big.example/inbox",
+		"https://small.example/users/three/inbox",
+		// a shared inbox on another host isn't trusted
+		"https://sneaky.example/users/four/inbox",
+		"https://unknown.example/users/five/inbox",
+	}, strs)
+}
+
+func TestSharedInboxTestSuite(t *testing.T) {
+	suite.Run(t, new(SharedInboxTestSuite))
+}
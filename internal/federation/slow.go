@@ -0,0 +1,186 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/reputation"
+)
+
+const (
+	// sharedInboxPath is the path of the shared inbox of this instance.
+	sharedInboxPath = "/inbox"
+	// throttledInboxLimit is how many deliveries a throttled domain can make to our inboxes per throttleWindow.
+	throttledInboxLimit = 10
+	// throttleWindow is the window over which deliveries from throttled domains are counted.
+	throttleWindow = 1 * time.Minute
+)
+
+// inboxThrottle counts deliveries to our inboxes per domain, in fixed windows.
+type inboxThrottle struct {
+	limit  int
+	window time.Duration
+	mu     sync.Mutex
+	counts map[string]*throttleCount
+}
+
+type throttleCount struct {
+	start time.Time
+	n     int
+}
+
+// newInboxThrottle returns a throttle that allows limit deliveries from each domain per window.
+func newInboxThrottle(limit int, window time.Duration) *inboxThrottle {
+	return &inboxThrottle{
+		limit:  limit,
+		window: window,
+		counts: make(map[string]*throttleCount),
+	}
+}
+
+// allow records a delivery from the given domain at the given time, and returns false if the domain has already
+// used up its deliveries for the current window.
+func (t *inboxThrottle) allow(domain string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.counts[domain]
+	if !ok || now.Sub(c.start) >= t.window {
+		// drop anything from previous windows while we're here so the map doesn't grow forever
+		for d, old := range t.counts {
+			if now.Sub(old.start) >= t.window {
+				delete(t.counts, d)
+			}
+		}
+		c = &throttleCount{start: now}
+		t.counts[domain] = c
+	}
+
+	if c.n >= t.limit {
+		return false
+	}
+	c.n++
+	return true
+}
+
+// reputationOf returns the reputation of the given host, or nil if slow federation isn't enabled
+// or the host is our own.
+func (f *federator) reputationOf(host string) (*reputation.Reputation, error) {
+	if f.reputation == nil {
+		return nil, nil
+	}
+	if f.config != nil && strings.EqualFold(hostWithoutPort(host), hostWithoutPort(f.config.Host)) {
+		return nil, nil
+	}
+	return f.reputation.Reputation(host)
+}
+
+// slowDelivery applies slow federation to a delivery to one of our inboxes from the given, already authenticated, account.
+// If the account's domain has a poor enough reputation, the delivery will either be refused because the domain has made
+// too many deliveries recently, or it will be stored for an admin to review instead of being processed. Admins can then release
+// the delivery with ReleasePendingActivity, or reject it.
+//
+// If false is returned, a response has already been written, and the delivery should not be processed any further.
+func (f *federator) slowDelivery(ctx context.Context, w http.ResponseWriter, r *http.Request, account *model.Account) (bool, error) {
+	l := f.log.WithField("func", "slowDelivery")
+
+	rep, err := f.reputationOf(account.Domain)
+	if err != nil {
+		return false, err
+	}
+	if rep == nil {
+		return true, nil
+	}
+
+	if rep.Throttled() && f.throttle != nil && !f.throttle.allow(rep.Domain, f.Now()) {
+		l.Debugf("refusing delivery to %s from %s since its domain is throttled", r.URL.Path, account.URI)
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(throttleWindow.Seconds())))
+		w.WriteHeader(http.StatusTooManyRequests)
+		return false, nil
+	}
+
+	if rep.NeedsReview() {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return false, fmt.Errorf("error reading body of delivery from %s: %s", account.URI, err)
+		}
+		pending := &model.PendingActivity{
+			ID:        uuid.NewString(),
+			Domain:    rep.Domain,
+			AccountID: account.ID,
+			InboxPath: r.URL.Path,
+			Activity:  string(b),
+		}
+		if err := f.db.Put(pending); err != nil {
+			return false, fmt.Errorf("error storing delivery from %s for review: %s", account.URI, err)
+		}
+		l.Infof("holding delivery to %s from %s for review since its domain has a reputation of %d", r.URL.Path, account.URI, rep.Score)
+		w.WriteHeader(http.StatusAccepted)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// ReleasePendingActivity processes a delivery that was held for review as if it had just been made, and removes it from review.
+// The delivery was authenticated when it came in, so it isn't authenticated again, and since an admin has let it through, slow
+// federation isn't applied to it either.
+func (f *federator) ReleasePendingActivity(ctx context.Context, pending *model.PendingActivity) error {
+	sender := &model.Account{}
+	if err := f.db.GetByID(pending.AccountID, sender); err != nil {
+		return fmt.Errorf("error getting account %s that made delivery %s: %s", pending.AccountID, pending.ID, err)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s://%s%s", f.config.Protocol, f.config.Host, pending.InboxPath), strings.NewReader(pending.Activity))
+	if err != nil {
+		return fmt.Errorf("error creating request for delivery %s: %s", pending.ID, err)
+	}
+	r.Header.Set("Content-Type", "application/activity+json")
+
+	ctx = context.WithValue(ctx, ctxSharedInboxAccount, sender)
+	w := &discardResponseWriter{header: http.Header{}}
+	if pending.InboxPath == sharedInboxPath {
+		_, err = f.PostSharedInbox(ctx, w, r)
+	} else {
+		_, err = f.actor.PostInbox(ctx, w, r)
+	}
+	if err != nil {
+		return fmt.Errorf("error processing delivery %s: %s", pending.ID, err)
+	}
+	if w.status >= http.StatusBadRequest {
+		return fmt.Errorf("delivery %s was refused with status %d", pending.ID, w.status)
+	}
+
+	if err := f.db.DeleteByID(pending.ID, &model.PendingActivity{}); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return fmt.Errorf("error removing delivery %s from review: %s", pending.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/reputation"
+)
+
+type SlowFederationTestSuite struct {
+	suite.Suite
+	log        *logrus.Logger
+	account    *model.Account
+	mockDB     *db.MockDB
+	mockScorer *reputation.MockScorer
+	federator  *federator
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *SlowFederationTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	suite.account = &model.Account{
+		ID:     "remote-account-id",
+		URI:    "https://remote.example/users/someone",
+		Domain: "remote.example",
+	}
+}
+
+// SetupTest creates a fresh mock db and mock scorer, and a federator with slow federation enabled that uses them
+func (suite *SlowFederationTestSuite) SetupTest() {
+	suite.mockDB = &db.MockDB{}
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainBlock")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetAll", mock.AnythingOfType("*[]model.DomainAllow")).Return(db.ErrNoEntries{})
+	suite.mockScorer = &reputation.MockScorer{}
+
+	c := config.Empty()
+	c.Protocol = "http"
+	c.Host = "localhost:8080"
+	c.FederationConfig.SlowFederation = true
+	suite.federator = &federator{
+		db:         suite.mockDB,
+		config:     c,
+		log:        suite.log,
+		domains:    newDomainCache(suite.mockDB, domainCacheTTL),
+		reputation: suite.mockScorer,
+		throttle:   newInboxThrottle(2, throttleWindow),
+	}
+}
+
+// withScore makes the mock scorer give the given score to the given domain
+func (suite *SlowFederationTestSuite) withScore(domain string, score int) {
+	suite.mockScorer.On("Reputation", domain).Return(&reputation.Reputation{Domain: domain, Score: score}, nil)
+}
+
+func (suite *SlowFederationTestSuite) delivery() (*httptest.ResponseRecorder, *http.Request) {
+	r := httptest.NewRequest(http.MethodPost, "http://localhost:8080/users/local_user/inbox", strings.NewReader(`{"type":"Create"}`))
+	return httptest.NewRecorder(), r
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *SlowFederationTestSuite) TestInboxThrottle() {
+	throttle := newInboxThrottle(2, time.Minute)
+	start := time.Now()
+
+	assert.True(suite.T(), throttle.allow("a.example", start))
+	assert.True(suite.T(), throttle.allow("a.example", start.Add(time.Second)))
+	assert.False(suite.T(), throttle.allow("a.example", start.Add(2*time.Second)))
+	// other domains have their own count
+	assert.True(suite.T(), throttle.allow("b.example", start.Add(2*time.Second)))
+	// and the count starts again in the next window
+	assert.True(suite.T(), throttle.allow("a.example", start.Add(2*time.Minute)))
+	// stale windows are cleared out
+	assert.NotContains(suite.T(), throttle.counts, "b.example")
+}
+
+func (suite *SlowFederationTestSuite) TestTrustedDomainNotSlowed() {
+	suite.withScore("remote.example", reputation.ThrottleBelow)
+
+	for i := 0; i < 5; i++ {
+		w, r := suite.delivery()
+		ok, err := suite.federator.slowDelivery(context.Background(), w, r, suite.account)
+		assert.NoError(suite.T(), err)
+		assert.True(suite.T(), ok)
+	}
+	suite.mockDB.AssertNotCalled(suite.T(), "Put", mock.Anything)
+}
+
+func (suite *SlowFederationTestSuite) TestThrottledDomain() {
+	suite.withScore("remote.example", 20)
+
+	for i := 0; i < 2; i++ {
+		w, r := suite.delivery()
+		ok, err := suite.federator.slowDelivery(context.Background(), w, r, suite.account)
+		assert.NoError(suite.T(), err)
+		assert.True(suite.T(), ok)
+	}
+
+	w, r := suite.delivery()
+	ok, err := suite.federator.slowDelivery(context.Background(), w, r, suite.account)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+	assert.Equal(suite.T(), http.StatusTooManyRequests, w.Code)
+	assert.Equal(suite.T(), "60", w.Header().Get("Retry-After"))
+}
+
+func (suite *SlowFederationTestSuite) TestDeliveryHeldForReview() {
+	suite.withScore("remote.example", 0)
+	suite.mockDB.On("Put", mock.AnythingOfType("*model.PendingActivity")).Return(nil)
+
+	w, r := suite.delivery()
+	ok, err := suite.federator.slowDelivery(context.Background(), w, r, suite.account)
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), ok)
+	assert.Equal(suite.T(), http.StatusAccepted, w.Code)
+
+	suite.mockDB.AssertCalled(suite.T(), "Put", mock.MatchedBy(func(p *model.PendingActivity) bool {
+		return p.ID != "" &&
+			p.Domain == "remote.example" &&
+			p.AccountID == "remote-account-id" &&
+			p.InboxPath == "/users/local_user/inbox" &&
+			p.Activity == `{"type":"Create"}`
+	}))
+}
+
+func (suite *SlowFederationTestSuite) TestReleasePendingActivity() {
+	actor := &inboxRecorder{}
+	suite.federator.actor = actor
+	suite.mockDB.On("GetByID", suite.account.ID, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*model.Account) = *suite.account
+	})
+	suite.mockDB.On("DeleteByID", "pending-id", &model.PendingActivity{}).Return(nil)
+
+	err := suite.federator.ReleasePendingActivity(context.Background(), &model.PendingActivity{
+		ID:        "pending-id",
+		Domain:    "remote.example",
+		AccountID: suite.account.ID,
+		InboxPath: "/users/local_user/inbox",
+		Activity:  `{"type":"Create"}`,
+	})
+	assert.NoError(suite.T(), err)
+
+	// it goes to the inbox it was delivered to, without being authenticated or held for review again
+	assert.Equal(suite.T(), []string{"/users/local_user/inbox"}, actor.inboxes)
+	assert.Equal(suite.T(), []string{`{"type":"Create"}`}, actor.bodies)
+	assert.Equal(suite.T(), suite.account.ID, actor.senders[0].ID)
+	suite.mockScorer.AssertNotCalled(suite.T(), "Reputation", mock.Anything)
+	suite.mockDB.AssertCalled(suite.T(), "DeleteByID", "pending-id", &model.PendingActivity{})
+}
+
+func (suite *SlowFederationTestSuite) TestMediaStripped() {
+	suite.withScore("new.example", 20)
+	suite.withScore("old.example", reputation.StripMediaBelow)
+
+	rejected, err := suite.federator.domainRejectsMedia("new.example")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), rejected)
+
+	rejected, err = suite.federator.domainRejectsMedia("old.example")
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), rejected)
+
+	// we never score ourselves
+	rejected, err = suite.federator.domainRejectsMedia("localhost:8080")
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), rejected)
+	suite.mockScorer.AssertNotCalled(suite.T(), "Reputation", "localhost:8080")
+}
+
+func (suite *SlowFederationTestSuite) TestSlowFederationDisabled() {
+	suite.federator.reputation = nil
+
+	w, r := suite.delivery()
+	ok, err := suite.federator.slowDelivery(context.Background(), w, r, suite.account)
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), ok)
+	suite.mockScorer.AssertNotCalled(suite.T(), "Reputation", mock.Anything)
+}
+
+func TestSlowFederationTestSuite(t *testing.T) {
+	suite.Run(t, new(SlowFederationTestSuite))
+}
@@ -0,0 +1,187 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+	"github.com/superseriousbusiness/gotosocial/internal/typeutils"
+)
+
+// registerHandlers registers the federator's handlers for the messages that it federates out, or that it fetches things for, with the given distributor.
+func (f *federator) registerHandlers(d distributor.Distributor) {
+	d.Register(distributor.ActivityStatusCreated, f.federateStatusCreated)
+	d.Register(distributor.ActivityStatusDeleted, f.federateStatusDeleted)
+	d.Register(distributor.ActivityFollowAccepted, f.backfillFollowed)
+	d.Register(distributor.ActivityAccountUpdated, f.federateAccountUpdated)
+}
+
+// federateStatusCreated queues a Create of a status that was posted through the client API, or an Announce if the status
+// is a boost, for delivery to the inboxes of everyone who should get it.
+func (f *federator) federateStatusCreated(ctx context.Context, msg distributor.Message) error {
+	created, ok := msg.(distributor.StatusCreated)
+	if !ok {
+		return fmt.Errorf("expected StatusCreated but got %T", msg)
+	}
+	if created.FromFederation || !created.Status.Local || !federated(created.Status) {
+		return nil
+	}
+
+	author := &model.Account{}
+	if err := f.db.GetByID(created.Status.AccountID, author); err != nil {
+		return fmt.Errorf("error getting author of status %s: %s", created.Status.ID, err)
+	}
+	activity, err := f.outboxItem(created.Status, author)
+	if err != nil {
+		return err
+	}
+	if activity == nil {
+		// the status boosts something that's gone, or that can't be boosted
+		return nil
+	}
+	return f.federateStatusActivity(created.Status, author, activity)
+}
+
+// federateStatusDeleted queues a Delete of a status that was deleted through the client API, for delivery to the inboxes of
+// everyone who got the status in the first place. Once that's done, what the status left behind, like its media, is removed.
+func (f *federator) federateStatusDeleted(ctx context.Context, msg distributor.Message) error {
+	deleted, ok := msg.(distributor.StatusDeleted)
+	if !ok {
+		return fmt.Errorf("expected StatusDeleted but got %T", msg)
+	}
+	if deleted.FromFederation || !deleted.Status.Local {
+		return nil
+	}
+	if !federated(deleted.Status) {
+		// nobody else ever got it, so there's nobody to tell
+		return f.purgeStatus(deleted.Status)
+	}
+
+	author := &model.Account{}
+	if err := f.db.GetByID(deleted.Status.AccountID, author); err != nil {
+		return fmt.Errorf("error getting author of status %s: %s", deleted.Status.ID, err)
+	}
+	del, err := typeutils.StatusDeleteToAS(deleted.Status, author)
+	if err != nil {
+		return fmt.Errorf("error converting delete of status %s: %s", deleted.Status.ID, err)
+	}
+	// the recipients are worked out from the mentions of the status, so it's only purged once the delete is queued
+	if err := f.federateStatusActivity(deleted.Status, author, del); err != nil {
+		return err
+	}
+	return f.purgeStatus(deleted.Status)
+}
+
+// federateStatusActivity queues the given activity, which is about the given status of the given local author, for delivery to
+// the remote accounts that the status is for.
+func (f *federator) federateStatusActivity(status *model.Status, author *model.Account, activity vocab.Type) error {
+	recipients, err := f.statusRecipients(status)
+	if err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	m, err := streams.Serialize(activity)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return f.queueDelivery(author, b, recipients)
+}
+
+// statusRecipients returns the inboxes of the remote accounts that should get the given status: the followers of its author,
+// unless it's a direct message, the accounts it mentions, and the author of the status that it replies to.
+func (f *federator) statusRecipients(status *model.Status) ([]*url.URL, error) {
+	accountIDs := []string{}
+	if status.Visibility == nil || !status.Visibility.Direct {
+		followers := []model.Follow{}
+		if err := f.db.GetFollowersByAccountID(status.AccountID, &followers); err != nil {
+			if _, ok := err.(db.ErrNoEntries); !ok {
+				return nil, fmt.Errorf("error getting followers of %s: %s", status.AccountID, err)
+			}
+		}
+		for _, follow := range followers {
+			accountIDs = append(accountIDs, follow.AccountID)
+		}
+	}
+
+	mentions := []model.Mention{}
+	if err := f.db.GetWhere("status_id", status.ID, &mentions); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return nil, fmt.Errorf("error getting mentions of status %s: %s", status.ID, err)
+		}
+	}
+	for _, mention := range mentions {
+		accountIDs = append(accountIDs, mention.TargetAccountID)
+	}
+
+	if status.InReplyToAccountID != "" {
+		accountIDs = append(accountIDs, status.InReplyToAccountID)
+	}
+	return f.remoteInboxes(accountIDs)
+}
+
+// remoteInboxes returns the inboxes of the remote accounts among the accounts with the given ids. Local accounts, and accounts
+// that are gone or have no inbox, are left out.
+func (f *federator) remoteInboxes(accountIDs []string) ([]*url.URL, error) {
+	recipients := []*url.URL{}
+	seen := make(map[string]bool, len(accountIDs))
+	for _, id := range accountIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		account := &model.Account{}
+		if err := f.db.GetByID(id, account); err != nil {
+			if _, ok := err.(db.ErrNoEntries); ok {
+				continue
+			}
+			return nil, fmt.Errorf("error getting account %s: %s", id, err)
+		}
+		if account.Domain == "" || account.InboxURL == "" || !account.DeletedAt.IsZero() {
+			// local accounts get everything straight from the database
+			continue
+		}
+		inbox, err := url.Parse(account.InboxURL)
+		if err != nil {
+			continue
+		}
+		recipients = append(recipients, inbox)
+	}
+	return recipients, nil
+}
+
+// federated returns true if the given status can be handed to other servers, which isn't the case for local-only statuses.
+func federated(status *model.Status) bool {
+	return status.Visibility == nil || !status.Visibility.LocalOnly
+}
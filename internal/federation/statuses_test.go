@@ -0,0 +1,300 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+	"github.com/superseriousbusiness/gotosocial/internal/media"
+)
+
+type StatusesTestSuite struct {
+	suite.Suite
+	log              *logrus.Logger
+	author           *model.Account
+	localFollower    *model.Account
+	remoteFollower   *model.Account
+	repliedTo        *model.Account
+	mentioned        *model.Account
+	mockDB           *db.MockDB
+	mockMediaHandler *media.MockMediaHandler
+	federator        *federator
+}
+
+// personDB is a federating db that only knows how to get one thing
+type personDB struct {
+	pub.Database
+	person vocab.Type
+}
+
+func (d *personDB) Get(ctx context.Context, id *url.URL) (vocab.Type, error) {
+	return d.person, nil
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *StatusesTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	suite.author = &model.Account{
+		ID:           "2b6d3f1c-5d43-4c8b-9c8e-6f5d1c2b3a41",
+		Username:     "local_user",
+		URI:          "http://localhost:8080/users/local_user",
+		FollowersURL: "http://localhost:8080/users/local_user/followers",
+	}
+	suite.localFollower = &model.Account{
+		ID:       "0f1e2d3c-4b5a-4968-8776-a5b4c3d2e1f0",
+		Username: "other_local_user",
+		URI:      "http://localhost:8080/users/other_local_user",
+		InboxURL: "http://localhost:8080/users/other_local_user/inbox",
+	}
+	suite.remoteFollower = &model.Account{
+		ID:       "8a7c1e2d-3b4f-4e5a-8c9d-0e1f2a3b4c5d",
+		Username: "remote_user",
+		Domain:   "example.org",
+		URI:      "https://example.org/users/remote_user",
+		InboxURL: "https://example.org/users/remote_user/inbox",
+	}
+	suite.repliedTo = &model.Account{
+		ID:       "7c1e9a0b-2d3f-4a5b-8c6d-9e0f1a2b3c4d",
+		Username: "replied_to",
+		Domain:   "another.example.org",
+		URI:      "https://another.example.org/users/replied_to",
+		InboxURL: "https://another.example.org/users/replied_to/inbox",
+	}
+	suite.mentioned = &model.Account{
+		ID:       "5e4d3c2b-1a09-4f8e-8d7c-6b5a49382716",
+		Username: "mentioned",
+		Domain:   "third.example.org",
+		URI:      "https://third.example.org/users/mentioned",
+		InboxURL: "https://third.example.org/users/mentioned/inbox",
+	}
+}
+
+// SetupTest creates a fresh mock db and federator for each test. Both the local and the remote follower follow the author.
+func (suite *StatusesTestSuite) SetupTest() {
+	suite.mockDB = &db.MockDB{}
+	for _, a := range []*model.Account{suite.author, suite.localFollower, suite.remoteFollower, suite.repliedTo, suite.mentioned} {
+		account := a
+		suite.mockDB.On("GetByID", account.ID, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+			*args.Get(1).(*model.Account) = *account
+		})
+	}
+	suite.mockDB.On("GetFollowersByAccountID", suite.author.ID, mock.AnythingOfType("*[]model.Follow")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*[]model.Follow) = []model.Follow{
+			{AccountID: suite.localFollower.ID, TargetAccountID: suite.author.ID},
+			{AccountID: suite.remoteFollower.ID, TargetAccountID: suite.author.ID},
+		}
+	})
+	suite.mockDB.On("GetWhere", "status_id", mock.AnythingOfType("string"), mock.AnythingOfType("*[]model.Mention")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*[]model.Mention) = []model.Mention{{TargetAccountID: suite.mentioned.ID}}
+	})
+	suite.mockDB.On("GetWhere", "status_id", mock.AnythingOfType("string"), mock.AnythingOfType("*[]model.MediaAttachment")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetWhere", "inbox_url", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("Put", mock.AnythingOfType("*model.Delivery")).Return(nil)
+	suite.mockDB.On("DeleteWhere", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	suite.mockDB.On("DeleteByID", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+
+	suite.mockMediaHandler = &media.MockMediaHandler{}
+
+	suite.federator = &federator{
+		db:           suite.mockDB,
+		config:       config.Empty(),
+		log:          suite.log,
+		mediaHandler: suite.mockMediaHandler,
+		deliveries:   newDeliveryQueue(),
+	}
+}
+
+// status returns a local status by the author with the given visibility
+func (suite *StatusesTestSuite) status(visibility *model.Visibility) *model.Status {
+	return &model.Status{
+		ID:         "5f4e3d2c-1b0a-4f9e-8d7c-6b5a4f3e2d1c",
+		URI:        "http://localhost:8080/users/local_user/statuses/5f4e3d2c-1b0a-4f9e-8d7c-6b5a4f3e2d1c",
+		Content:    "<p>hello</p>",
+		CreatedAt:  time.Now(),
+		Local:      true,
+		AccountID:  suite.author.ID,
+		Visibility: visibility,
+	}
+}
+
+// deliveries returns the deliveries that were put in the mock db
+func (suite *StatusesTestSuite) deliveries() []*model.Delivery {
+	deliveries := []*model.Delivery{}
+	for _, c := range suite.mockDB.Calls {
+		if c.Method == "Put" {
+			deliveries = append(deliveries, c.Arguments.Get(0).(*model.Delivery))
+		}
+	}
+	return deliveries
+}
+
+// targetInboxes returns the inboxes that the given deliveries go to
+func targetInboxes(deliveries []*model.Delivery) []string {
+	inboxes := []string{}
+	for _, d := range deliveries {
+		inboxes = append(inboxes, d.TargetInbox)
+	}
+	return inboxes
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *StatusesTestSuite) TestFederateStatusCreated() {
+	status := suite.status(&model.Visibility{Public: true, Followers: true})
+	status.InReplyToAccountID = suite.repliedTo.ID
+
+	err := suite.federator.federateStatusCreated(context.Background(), distributor.StatusCreated{Status: status})
+	suite.NoError(err)
+
+	deliveries := suite.deliveries()
+	suite.ElementsMatch([]string{
+		suite.remoteFollower.InboxURL,
+		suite.mentioned.InboxURL,
+		suite.repliedTo.InboxURL,
+	}, targetInboxes(deliveries))
+	for _, d := range deliveries {
+		suite.Equal(suite.author.ID, d.AccountID)
+		suite.Contains(d.Payload, `"type":"Create"`)
+		suite.Contains(d.Payload, `"id":"http://localhost:8080/users/local_user/statuses/5f4e3d2c-1b0a-4f9e-8d7c-6b5a4f3e2d1c/activity"`)
+	}
+}
+
+func (suite *StatusesTestSuite) TestFederateDirectStatusCreated() {
+	status := suite.status(&model.Visibility{Direct: true})
+
+	err := suite.federator.federateStatusCreated(context.Background(), distributor.StatusCreated{Status: status})
+	suite.NoError(err)
+
+	// direct statuses only go to the accounts they mention
+	suite.Equal([]string{suite.mentioned.InboxURL}, targetInboxes(suite.deliveries()))
+	suite.mockDB.AssertNotCalled(suite.T(), "GetFollowersByAccountID", mock.Anything, mock.Anything)
+}
+
+func (suite *StatusesTestSuite) TestStatusCreatedFromFederationIsNotFederated() {
+	status := suite.status(&model.Visibility{Public: true, Followers: true})
+
+	err := suite.federator.federateStatusCreated(context.Background(), distributor.StatusCreated{Status: status, FromFederation: true})
+	suite.NoError(err)
+	suite.Empty(suite.deliveries())
+}
+
+func (suite *StatusesTestSuite) TestLocalOnlyStatusIsNotFederated() {
+	status := suite.status(&model.Visibility{Public: true, Local: true, Followers: true, LocalOnly: true})
+
+	err := suite.federator.federateStatusCreated(context.Background(), distributor.StatusCreated{Status: status})
+	suite.NoError(err)
+	suite.Empty(suite.deliveries())
+
+	// deleting it doesn't get federated either, but it's still cleaned up after
+	err = suite.federator.federateStatusDeleted(context.Background(), distributor.StatusDeleted{Status: status})
+	suite.NoError(err)
+	suite.Empty(suite.deliveries())
+	suite.mockDB.AssertCalled(suite.T(), "DeleteByID", status.ID, &model.Status{})
+}
+
+func (suite *StatusesTestSuite) TestStatusStoredBeforeLocalOnlyIsFederated() {
+	// this is the visibility of a status stored before there were local-only statuses, as it comes out of the database
+	visibility := &model.Visibility{}
+	err := json.Unmarshal([]byte(`{"Direct":false,"Followers":true,"Local":true,"Unlisted":false,"Public":true}`), visibility)
+	suite.NoError(err)
+	status := suite.status(visibility)
+
+	err = suite.federator.federateStatusCreated(context.Background(), distributor.StatusCreated{Status: status})
+	suite.NoError(err)
+	suite.ElementsMatch([]string{
+		suite.remoteFollower.InboxURL,
+		suite.mentioned.InboxURL,
+	}, targetInboxes(suite.deliveries()))
+}
+
+func (suite *StatusesTestSuite) TestFederateStatusDeleted() {
+	status := suite.status(&model.Visibility{Unlisted: true, Followers: true})
+
+	err := suite.federator.federateStatusDeleted(context.Background(), distributor.StatusDeleted{Status: status})
+	suite.NoError(err)
+
+	deliveries := suite.deliveries()
+	suite.ElementsMatch([]string{
+		suite.remoteFollower.InboxURL,
+		suite.mentioned.InboxURL,
+	}, targetInboxes(deliveries))
+	for _, d := range deliveries {
+		suite.Contains(d.Payload, `"type":"Delete"`)
+		suite.Contains(d.Payload, `"object":"http://localhost:8080/users/local_user/statuses/5f4e3d2c-1b0a-4f9e-8d7c-6b5a4f3e2d1c"`)
+	}
+
+	// what the status left behind is gone too
+	suite.mockDB.AssertCalled(suite.T(), "DeleteWhere", "status_id", status.ID, &model.Mention{})
+	suite.mockDB.AssertCalled(suite.T(), "DeleteByID", status.ID, &model.Status{})
+}
+
+func (suite *StatusesTestSuite) TestFederateAccountUpdated() {
+	accountIRI, _ := url.Parse(suite.author.URI)
+	person := streams.NewActivityStreamsPerson()
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(accountIRI)
+	person.SetJSONLDId(idProp)
+	suite.mockDB.On("Federation").Return(&personDB{person: person})
+
+	err := suite.federator.federateAccountUpdated(context.Background(), distributor.AccountUpdated{Account: suite.author})
+	suite.NoError(err)
+
+	// only the remote follower needs to hear about it
+	deliveries := suite.deliveries()
+	suite.Equal([]string{suite.remoteFollower.InboxURL}, targetInboxes(deliveries))
+	for _, d := range deliveries {
+		suite.Equal(suite.author.ID, d.AccountID)
+		suite.Contains(d.Payload, `"type":"Update"`)
+		suite.Contains(d.Payload, `"id":"http://localhost:8080/users/local_user#updates/`)
+		suite.Contains(d.Payload, `"id":"http://localhost:8080/users/local_user","type":"Person"`)
+	}
+}
+
+func (suite *StatusesTestSuite) TestAccountUpdatedFromFederationIsNotFederated() {
+	err := suite.federator.federateAccountUpdated(context.Background(), distributor.AccountUpdated{Account: suite.remoteFollower, FromFederation: true})
+	suite.NoError(err)
+	suite.Empty(suite.deliveries())
+}
+
+func TestStatusesTestSuite(t *testing.T) {
+	suite.Run(t, new(StatusesTestSuite))
+}
@@ -0,0 +1,249 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package formatter
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/russross/blackfriday/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	nethtml "golang.org/x/net/html"
+)
+
+// linkPattern matches urls, @mentions (either @username or @username@domain) and #hashtags in plain text.
+// Mentions and hashtags have to start at the beginning of the text or after something that isn't part of a word,
+// so that email addresses and the like aren't picked up. Urls can't end in punctuation, since that's much more
+// likely to belong to the sentence around the url than to the url itself.
+//
+// The groups are: 1 the character before the match, 2 a url, 3 a mention, 4 the mentioned username, 5 the domain
+// of the mentioned account, 6 a hashtag, 7 the name of the hashtag.
+var linkPattern = regexp.MustCompile(`(^|[^\p{L}\p{N}_/@#&])(?:` +
+	`(https?://[^\s<>"]*[^\s<>".,;:!?'()\[\]])` + `|` +
+	`(@([a-zA-Z0-9_]+)(?:@([a-zA-Z0-9.-]*[a-zA-Z0-9]))?)` + `|` +
+	`(#([\p{L}\p{N}_]*[\p{L}_][\p{L}\p{N}_]*))` +
+	`)`)
+
+// markdownExtensions are the blackfriday extensions used to render markdown. Blackfriday's own autolinking is left
+// out, since urls are linked the same way for markdown as for plain text.
+const markdownExtensions = blackfriday.NoIntraEmphasis | blackfriday.FencedCode | blackfriday.Strikethrough | blackfriday.BackslashLineBreak
+
+// AccountDB is the part of the database that the formatter needs, to look up the accounts that statuses mention.
+// It's satisfied by db.DB: the formatter can't depend on the db package directly, since the db package converts
+// incoming statuses with typeutils, which uses the formatter to sanitize them.
+type AccountDB interface {
+	// GetLocalAccountByUsername is used for mentions of accounts on this instance.
+	GetLocalAccountByUsername(username string, account *model.Account) error
+	// GetRemoteAccountByUsername is used for mentions of accounts on other instances.
+	GetRemoteAccountByUsername(username string, domain string, account *model.Account) error
+}
+
+// Formatted is the result of formatting the text of a status.
+type Formatted struct {
+	// HTML is the sanitized html content of the status.
+	HTML string
+	// Mentions are the accounts mentioned in the status, in the order they were first mentioned.
+	Mentions []*model.Account
+	// Tags are the names of the hashtags used in the status, lowercased, in the order they were first used.
+	Tags []string
+}
+
+// Formatter turns the text that users write into html content for statuses: urls are linked, @mentions of accounts
+// we know about are linked to their profiles, #hashtags are linked to their tag pages, and the result is sanitized.
+type Formatter interface {
+	// FromPlain formats the given plain text. Paragraphs are separated by blank lines, and single line breaks are kept.
+	FromPlain(text string) *Formatted
+	// FromMarkdown formats the given markdown. Any html in the markdown that isn't allowed in statuses is removed.
+	FromMarkdown(text string) *Formatted
+}
+
+// formatter just implements the Formatter interface
+type formatter struct {
+	config *config.Config
+	db     AccountDB
+	log    *logrus.Logger
+}
+
+// New returns a new Formatter, which uses the given database to look up mentioned accounts.
+func New(config *config.Config, db AccountDB, log *logrus.Logger) Formatter {
+	return &formatter{
+		config: config,
+		db:     db,
+		log:    log,
+	}
+}
+
+func (f *formatter) FromPlain(text string) *Formatted {
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	paragraphs := []string{}
+	for _, p := range strings.Split(text, "\n\n") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		paragraphs = append(paragraphs, "<p>"+strings.ReplaceAll(html.EscapeString(p), "\n", "<br />")+"</p>")
+	}
+	return f.format(strings.Join(paragraphs, ""))
+}
+
+func (f *formatter) FromMarkdown(text string) *Formatted {
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	rendered := blackfriday.Run([]byte(text), blackfriday.WithExtensions(markdownExtensions))
+	return f.format(string(rendered))
+}
+
+// format links the urls, mentions and hashtags in the text of the given html, and sanitizes the result.
+// Text that's already inside a link, or that's code, is left as it is.
+func (f *formatter) format(in string) *Formatted {
+	result := &Formatted{
+		Mentions: []*model.Account{},
+		Tags:     []string{},
+	}
+
+	b := &strings.Builder{}
+	// how many links and code elements we're inside of
+	skipDepth := 0
+	z := nethtml.NewTokenizer(strings.NewReader(in))
+	for tt := z.Next(); tt != nethtml.ErrorToken; tt = z.Next() {
+		switch tt {
+		case nethtml.StartTagToken, nethtml.EndTagToken:
+			if name, _ := z.TagName(); skipsLinking(string(name)) {
+				if tt == nethtml.StartTagToken {
+					skipDepth++
+				} else if skipDepth > 0 {
+					skipDepth--
+				}
+			}
+		case nethtml.TextToken:
+			if skipDepth == 0 {
+				b.WriteString(f.linkText(string(z.Text()), result))
+				continue
+			}
+		}
+		b.Write(z.Raw())
+	}
+
+	result.HTML = strings.TrimSpace(SanitizeHTML(b.String()))
+	return result
+}
+
+// skipsLinking returns true if the text inside elements with the given name shouldn't have anything linked in it.
+func skipsLinking(name string) bool {
+	return name == "a" || name == "code" || name == "pre"
+}
+
+// linkText escapes the given text, linking any urls, mentions and hashtags in it. The accounts mentioned and tags used
+// are added to the given result. Mentions of accounts that can't be found are left as they are.
+func (f *formatter) linkText(text string, result *Formatted) string {
+	b := &strings.Builder{}
+	last := 0
+	for _, m := range linkPattern.FindAllStringSubmatchIndex(text, -1) {
+		// m[2]:m[3] is the character before the match, so the match itself starts where that ends
+		start, end := m[3], m[1]
+		var link string
+		switch {
+		case m[4] != -1:
+			link = urlLink(text[m[4]:m[5]])
+		case m[6] != -1:
+			domain := ""
+			if m[10] != -1 {
+				domain = text[m[10]:m[11]]
+			}
+			link = f.mentionLink(text[m[8]:m[9]], domain, result)
+		case m[12] != -1:
+			link = f.hashtagLink(text[m[14]:m[15]], result)
+		}
+		if link == "" {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[last:start]))
+		b.WriteString(link)
+		last = end
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
+
+// urlLink returns a link to the given url.
+func urlLink(url string) string {
+	escaped := html.EscapeString(url)
+	return fmt.Sprintf(`<a href="%s" rel="nofollow noopener noreferrer">%s</a>`, escaped, escaped)
+}
+
+// mentionLink returns a link to the profile of the account with the given username and domain, and adds the
+// account to the mentions of the given result. If there's no such account, an empty string is returned.
+func (f *formatter) mentionLink(username string, domain string, result *Formatted) string {
+	l := f.log.WithField("func", "mentionLink")
+
+	account := &model.Account{}
+	if domain == "" || strings.EqualFold(domain, f.config.Host) {
+		if err := f.db.GetLocalAccountByUsername(username, account); err != nil {
+			l.Debugf("couldn't get mentioned local account %s: %s", username, err)
+			return ""
+		}
+	} else {
+		if err := f.db.GetRemoteAccountByUsername(username, strings.ToLower(domain), account); err != nil {
+			l.Debugf("couldn't get mentioned account %s@%s: %s", username, domain, err)
+			return ""
+		}
+	}
+
+	known := false
+	for _, a := range result.Mentions {
+		if a.ID == account.ID {
+			known = true
+			break
+		}
+	}
+	if !known {
+		result.Mentions = append(result.Mentions, account)
+	}
+
+	href := account.URL
+	if href == "" {
+		href = account.URI
+	}
+	return fmt.Sprintf(`<span class="h-card"><a href="%s" class="u-url mention">@<span>%s</span></a></span>`, html.EscapeString(href), html.EscapeString(account.Username))
+}
+
+// hashtagLink returns a link to the page of the hashtag with the given name, and adds the tag to the tags of the given result.
+func (f *formatter) hashtagLink(name string, result *Formatted) string {
+	tag := strings.ToLower(name)
+	known := false
+	for _, t := range result.Tags {
+		if t == tag {
+			known = true
+			break
+		}
+	}
+	if !known {
+		result.Tags = append(result.Tags, tag)
+	}
+
+	href := TagURL(f.config, tag)
+	return fmt.Sprintf(`<a href="%s" class="mention hashtag" rel="tag">#<span>%s</span></a>`, html.EscapeString(href), html.EscapeString(name))
+}
+
+// TagURL returns the url of the page on this instance for the hashtag with the given name.
+func TagURL(c *config.Config, name string) string {
+	return fmt.Sprintf("%s://%s/tags/%s", c.Protocol, c.Host, strings.ToLower(name))
+}
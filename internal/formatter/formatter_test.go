@@ -0,0 +1,145 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package formatter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+// testAccountDB looks accounts up in a slice. The db package can't be used here, since it depends on this package.
+type testAccountDB struct {
+	accounts []*model.Account
+}
+
+func (t *testAccountDB) GetLocalAccountByUsername(username string, account *model.Account) error {
+	return t.GetRemoteAccountByUsername(username, "", account)
+}
+
+func (t *testAccountDB) GetRemoteAccountByUsername(username string, domain string, account *model.Account) error {
+	for _, a := range t.accounts {
+		if a.Username == username && a.Domain == domain {
+			*account = *a
+			return nil
+		}
+	}
+	return errors.New("no entries")
+}
+
+type FormatterTestSuite struct {
+	suite.Suite
+	config        *config.Config
+	log           *logrus.Logger
+	localAccount  *model.Account
+	remoteAccount *model.Account
+	formatter     Formatter
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *FormatterTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	c := config.Empty()
+	c.Protocol = "https"
+	c.Host = "example.org"
+	suite.config = c
+
+	suite.localAccount = &model.Account{
+		ID:       "c2e1bb4d-8d29-4ab6-bde4-1e5c4e2f2a4b",
+		Username: "local_user",
+		URI:      "https://example.org/users/local_user",
+		URL:      "https://example.org/@local_user",
+	}
+	suite.remoteAccount = &model.Account{
+		ID:       "1a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d",
+		Username: "remote_user",
+		Domain:   "remote.example",
+		URI:      "https://remote.example/users/remote_user",
+	}
+}
+
+// SetupTest creates a fresh formatter for each test
+func (suite *FormatterTestSuite) SetupTest() {
+	suite.formatter = New(suite.config, &testAccountDB{accounts: []*model.Account{suite.localAccount, suite.remoteAccount}}, suite.log)
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *FormatterTestSuite) TestPlainParagraphs() {
+	f := suite.formatter.FromPlain("hello <world>\r\nhi\n\n\n  second & last  \n")
+	assert.Equal(suite.T(), "<p>hello &lt;world&gt;<br />hi</p><p>second &amp; last</p>", f.HTML)
+	assert.Empty(suite.T(), f.Mentions)
+	assert.Empty(suite.T(), f.Tags)
+}
+
+func (suite *FormatterTestSuite) TestPlainLinks() {
+	f := suite.formatter.FromPlain("see https://example.com/a?b=c&d=e, or (https://example.com/x) but not javascript:alert(1)")
+	assert.Equal(suite.T(), `<p>see <a href="https://example.com/a?b=c&amp;d=e" rel="nofollow noopener noreferrer">https://example.com/a?b=c&amp;d=e</a>, `+
+		`or (<a href="https://example.com/x" rel="nofollow noopener noreferrer">https://example.com/x</a>) but not javascript:alert(1)</p>`, f.HTML)
+}
+
+func (suite *FormatterTestSuite) TestPlainMentions() {
+	f := suite.formatter.FromPlain("hi @local_user and @remote_user@Remote.example, and @local_user@example.org again, but not @nobody or someone@local_user.com")
+	assert.Equal(suite.T(), `<p>hi <span class="h-card"><a href="https://example.org/@local_user" class="u-url mention" rel="nofollow noopener noreferrer">@<span>local_user</span></a></span> `+
+		`and <span class="h-card"><a href="https://remote.example/users/remote_user" class="u-url mention" rel="nofollow noopener noreferrer">@<span>remote_user</span></a></span>, `+
+		`and <span class="h-card"><a href="https://example.org/@local_user" class="u-url mention" rel="nofollow noopener noreferrer">@<span>local_user</span></a></span> again, `+
+		`but not @nobody or someone@local_user.com</p>`, f.HTML)
+	if assert.Len(suite.T(), f.Mentions, 2) {
+		assert.Equal(suite.T(), suite.localAccount.ID, f.Mentions[0].ID)
+		assert.Equal(suite.T(), suite.remoteAccount.ID, f.Mentions[1].ID)
+	}
+}
+
+func (suite *FormatterTestSuite) TestPlainHashtags() {
+	f := suite.formatter.FromPlain("#GoToSocial is #great, #gotosocial! but not #123 or https://example.com/#anchor or a#b")
+	assert.Equal(suite.T(), `<p><a href="https://example.org/tags/gotosocial" class="mention hashtag" rel="tag nofollow noopener noreferrer">#<span>GoToSocial</span></a> `+
+		`is <a href="https://example.org/tags/great" class="mention hashtag" rel="tag nofollow noopener noreferrer">#<span>great</span></a>, `+
+		`<a href="https://example.org/tags/gotosocial" class="mention hashtag" rel="tag nofollow noopener noreferrer">#<span>gotosocial</span></a>! `+
+		`but not #123 or <a href="https://example.com/#anchor" rel="nofollow noopener noreferrer">https://example.com/#anchor</a> or a#b</p>`, f.HTML)
+	assert.Equal(suite.T(), []string{"gotosocial", "great"}, f.Tags)
+}
+
+func (suite *FormatterTestSuite) TestMarkdown() {
+	f := suite.formatter.FromMarkdown("# heading\n\nsome *emphasis* and **strong**, ~~gone~~\\\na line break and `code with #tag`\n\n> quote @local_user\n\n- one\n- [two](https://example.com)\n\n<script>alert(1)</script><b onclick=\"x\">bold</b>")
+	assert.Equal(suite.T(), "heading\n\n"+
+		"<p>some <em>emphasis</em> and <strong>strong</strong>, <del>gone</del><br />\na line break and <code>code with #tag</code></p>\n\n"+
+		`<blockquote>`+"\n"+`<p>quote <span class="h-card"><a href="https://example.org/@local_user" class="u-url mention" rel="nofollow noopener noreferrer">@<span>local_user</span></a></span></p>`+"\n"+`</blockquote>`+"\n\n"+
+		"<ul>\n<li>one</li>\n"+`<li><a href="https://example.com" rel="nofollow noopener noreferrer">two</a></li>`+"\n</ul>\n\n"+
+		"<p>bold</p>", f.HTML)
+	assert.Len(suite.T(), f.Mentions, 1)
+	assert.Empty(suite.T(), f.Tags)
+}
+
+func TestFormatterTestSuite(t *testing.T) {
+	suite.Run(t, new(FormatterTestSuite))
+}
@@ -0,0 +1,220 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package formatter
+
+import (
+	"html"
+	"net/url"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+)
+
+// allowedElements are the html elements that can be used in the content of statuses. Other elements are removed,
+// but the text inside them is kept.
+var allowedElements = map[string]bool{
+	"p":          true,
+	"br":         true,
+	"a":          true,
+	"span":       true,
+	"em":         true,
+	"strong":     true,
+	"del":        true,
+	"code":       true,
+	"pre":        true,
+	"blockquote": true,
+	"ul":         true,
+	"ol":         true,
+	"li":         true,
+}
+
+// droppedElements are the html elements that are removed from the content of statuses along with everything inside them.
+var droppedElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"head":     true,
+	"title":    true,
+	"iframe":   true,
+	"object":   true,
+	"embed":    true,
+	"noscript": true,
+	"template": true,
+	"textarea": true,
+	"select":   true,
+	"svg":      true,
+	"math":     true,
+}
+
+// allowedClasses are the classes that can be used on links and spans, on top of microformats classes. They're the ones
+// that mastodon and friends use to mark up mentions and hashtags.
+var allowedClasses = map[string]bool{
+	"mention":   true,
+	"hashtag":   true,
+	"ellipsis":  true,
+	"invisible": true,
+}
+
+// microformatsPrefixes are the prefixes of microformats classes, eg h-card or u-url.
+var microformatsPrefixes = []string{"h-", "p-", "u-", "dt-", "e-"}
+
+// linkRel is the rel given to all links in statuses.
+const linkRel = "nofollow noopener noreferrer"
+
+// SanitizeHTML cleans up the given html so that it's safe to serve as the content of a status. Only a small set of
+// elements is allowed, and the only attributes that are kept are the href of links, which has to be an http or https
+// url, and a few classes used to mark up mentions and hashtags. Elements that aren't allowed are removed, keeping their
+// text, except for things like scripts and styles, which are removed entirely. Every element is closed.
+//
+// This is used both for the content of statuses written on this instance and for the content of remote statuses.
+func SanitizeHTML(in string) string {
+	b := &strings.Builder{}
+	// names of the allowed elements that are open, innermost last
+	open := []string{}
+	// name and nesting depth of the dropped element we're inside of, if any
+	dropping := ""
+	dropDepth := 0
+
+	z := nethtml.NewTokenizer(strings.NewReader(in))
+	for {
+		tt := z.Next()
+		switch tt {
+		case nethtml.ErrorToken:
+			for i := len(open) - 1; i >= 0; i-- {
+				b.WriteString("</" + open[i] + ">")
+			}
+			return b.String()
+		case nethtml.TextToken:
+			if dropping == "" {
+				b.WriteString(html.EscapeString(string(z.Text())))
+			}
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			t := z.Token()
+			if dropping != "" {
+				if t.Data == dropping && tt == nethtml.StartTagToken {
+					dropDepth++
+				}
+				continue
+			}
+			if droppedElements[t.Data] {
+				if tt == nethtml.StartTagToken {
+					dropping = t.Data
+					dropDepth = 1
+				}
+				continue
+			}
+			if !allowedElements[t.Data] {
+				continue
+			}
+			attrs, ok := sanitizeAttributes(t)
+			if !ok {
+				continue
+			}
+			if t.Data == "br" {
+				b.WriteString("<br />")
+				continue
+			}
+			b.WriteString("<" + t.Data + attrs + ">")
+			if tt == nethtml.SelfClosingTagToken {
+				b.WriteString("</" + t.Data + ">")
+				continue
+			}
+			open = append(open, t.Data)
+		case nethtml.EndTagToken:
+			t := z.Token()
+			if dropping != "" {
+				if t.Data == dropping {
+					if dropDepth--; dropDepth == 0 {
+						dropping = ""
+					}
+				}
+				continue
+			}
+			// close the element, along with anything left open inside it; end tags of elements that aren't open are dropped
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != t.Data {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					b.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+				break
+			}
+		}
+	}
+}
+
+// sanitizeAttributes returns the allowed attributes of the given element, ready to be written after its name.
+// If the element can't be kept without an attribute that isn't allowed, eg a link with a javascript href, false is returned.
+func sanitizeAttributes(t nethtml.Token) (string, bool) {
+	var href, class, rel string
+	for _, a := range t.Attr {
+		switch strings.ToLower(a.Key) {
+		case "href":
+			href = a.Val
+		case "class":
+			class = sanitizeClass(a.Val)
+		case "rel":
+			rel = a.Val
+		}
+	}
+
+	b := &strings.Builder{}
+	switch t.Data {
+	case "a":
+		u, err := url.Parse(strings.TrimSpace(href))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "", false
+		}
+		b.WriteString(` href="` + html.EscapeString(u.String()) + `"`)
+		if class != "" {
+			b.WriteString(` class="` + html.EscapeString(class) + `"`)
+		}
+		linkRelation := linkRel
+		for _, r := range strings.Fields(rel) {
+			if strings.EqualFold(r, "tag") {
+				linkRelation = "tag " + linkRel
+			}
+		}
+		b.WriteString(` rel="` + linkRelation + `"`)
+	case "span":
+		if class != "" {
+			b.WriteString(` class="` + html.EscapeString(class) + `"`)
+		}
+	}
+	return b.String(), true
+}
+
+// sanitizeClass returns the allowed classes of the given class attribute.
+func sanitizeClass(class string) string {
+	kept := []string{}
+	for _, c := range strings.Fields(class) {
+		if allowedClasses[c] {
+			kept = append(kept, c)
+			continue
+		}
+		for _, prefix := range microformatsPrefixes {
+			if strings.HasPrefix(c, prefix) {
+				kept = append(kept, c)
+				break
+			}
+		}
+	}
+	return strings.Join(kept, " ")
+}
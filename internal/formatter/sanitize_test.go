@@ -0,0 +1,68 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package formatter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SanitizeTestSuite struct {
+	suite.Suite
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *SanitizeTestSuite) TestKeepsMastodonContent() {
+	in := `<p><span class="h-card"><a href="https://mastodon.example/@someone" class="u-url mention">@<span>someone</span></a></span> ` +
+		`<a href="https://mastodon.example/tags/tag" class="mention hashtag" rel="tag">#<span>tag</span></a><br>` +
+		`<a href="https://example.com/a-long-path" rel="nofollow noopener noreferrer" target="_blank"><span class="invisible">https://</span>` +
+		`<span class="ellipsis">example.com/a-long</span><span class="invisible">-path</span></a></p>`
+	assert.Equal(suite.T(), `<p><span class="h-card"><a href="https://mastodon.example/@someone" class="u-url mention" rel="nofollow noopener noreferrer">@<span>someone</span></a></span> `+
+		`<a href="https://mastodon.example/tags/tag" class="mention hashtag" rel="tag nofollow noopener noreferrer">#<span>tag</span></a><br />`+
+		`<a href="https://example.com/a-long-path" rel="nofollow noopener noreferrer"><span class="invisible">https://</span>`+
+		`<span class="ellipsis">example.com/a-long</span><span class="invisible">-path</span></a></p>`, SanitizeHTML(in))
+}
+
+func (suite *SanitizeTestSuite) TestRemovesDangerousContent() {
+	in := `<p style="color: red" onclick="steal()">hi <a href="javascript:alert(1)">there</a> <a href="/relative">you</a>` +
+		`<script>alert("<p>nested</p>")</script><img src="https://example.com/x.png" onerror="steal()">` +
+		`<iframe src="https://example.com">framed</iframe><svg><svg><text>drawn</text></svg>drawn</svg>` +
+		`<span class="evil h-card">&lt;b&gt; &amp; stuff</span></p>`
+	assert.Equal(suite.T(), `<p>hi there you<span class="h-card">&lt;b&gt; &amp; stuff</span></p>`, SanitizeHTML(in))
+}
+
+func (suite *SanitizeTestSuite) TestBalancesElements() {
+	assert.Equal(suite.T(), "<p><em>unclosed <strong>tags</strong></em></p>", SanitizeHTML("<p><em>unclosed <strong>tags"))
+	assert.Equal(suite.T(), "<p>stray </p>closing tags", SanitizeHTML("</em><p>stray </li></p>closing tags</p>"))
+	assert.Equal(suite.T(), "<blockquote><p>crossed</p></blockquote> tags", SanitizeHTML("<blockquote><p>crossed</blockquote> tags</p>"))
+}
+
+func (suite *SanitizeTestSuite) TestPlainText() {
+	assert.Equal(suite.T(), "", SanitizeHTML(""))
+	assert.Equal(suite.T(), "just &lt;3 text &amp; more", SanitizeHTML("just &lt;3 text & more"))
+}
+
+func TestSanitizeTestSuite(t *testing.T) {
+	suite.Run(t, new(SanitizeTestSuite))
+}
@@ -29,16 +29,24 @@ import (
 	"github.com/superseriousbusiness/gotosocial/internal/action"
 	"github.com/superseriousbusiness/gotosocial/internal/apimodule"
 	"github.com/superseriousbusiness/gotosocial/internal/apimodule/account"
+	"github.com/superseriousbusiness/gotosocial/internal/apimodule/admin"
 	"github.com/superseriousbusiness/gotosocial/internal/apimodule/app"
 	"github.com/superseriousbusiness/gotosocial/internal/apimodule/auth"
+	"github.com/superseriousbusiness/gotosocial/internal/apimodule/status"
+	timelineapi "github.com/superseriousbusiness/gotosocial/internal/apimodule/timeline"
+	"github.com/superseriousbusiness/gotosocial/internal/apimodule/user"
+	"github.com/superseriousbusiness/gotosocial/internal/apimodule/webfinger"
 	"github.com/superseriousbusiness/gotosocial/internal/cache"
 	"github.com/superseriousbusiness/gotosocial/internal/config"
 	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
 	"github.com/superseriousbusiness/gotosocial/internal/federation"
+	"github.com/superseriousbusiness/gotosocial/internal/formatter"
 	"github.com/superseriousbusiness/gotosocial/internal/media"
 	"github.com/superseriousbusiness/gotosocial/internal/oauth"
 	"github.com/superseriousbusiness/gotosocial/internal/router"
 	"github.com/superseriousbusiness/gotosocial/internal/storage"
+	"github.com/superseriousbusiness/gotosocial/internal/timeline"
 )
 
 // Run creates and starts a gotosocial server
@@ -61,16 +69,39 @@ var Run action.GTSAction = func(ctx context.Context, c *config.Config, log *logr
 	// build backend handlers
 	mediaHandler := media.New(c, dbService, storageBackend, log)
 	oauthServer := oauth.New(dbService, log)
+	formatter := formatter.New(c, dbService, log)
+
+	// build the distributor, which takes care of the side effects of everything that happens
+	distributor := distributor.New(c, log)
+
+	// build backend federation handlers
+	federator, err := federation.New(dbService, c, mediaHandler, distributor, log)
+	if err != nil {
+		return fmt.Errorf("error creating federator: %s", err)
+	}
+
+	// build the timeline manager, which keeps track of what's in everyone's timelines
+	timelineManager := timeline.New(dbService, distributor, federator, log)
 
 	// build client api modules
 	authModule := auth.New(oauthServer, dbService, log)
-	accountModule := account.New(c, dbService, oauthServer, mediaHandler, log)
+	accountModule := account.New(c, dbService, oauthServer, mediaHandler, federator, distributor, log)
 	appsModule := app.New(oauthServer, dbService, log)
+	webfingerModule := webfinger.New(c, dbService, log)
+	userModule := user.New(c, dbService, federator, log)
+	adminModule := admin.New(c, dbService, federator, log)
+	statusModule := status.New(c, dbService, distributor, formatter, log)
+	timelineModule := timelineapi.New(c, dbService, timelineManager, log)
 
 	apiModules := []apimodule.ClientAPIModule{
 		authModule, // this one has to go first so the other modules use its middleware
 		accountModule,
 		appsModule,
+		webfingerModule,
+		userModule,
+		adminModule,
+		statusModule,
+		timelineModule,
 	}
 
 	for _, m := range apiModules {
@@ -82,7 +113,7 @@ var Run action.GTSAction = func(ctx context.Context, c *config.Config, log *logr
 		}
 	}
 
-	gts, err := New(dbService, &cache.MockCache{}, router, federation.New(dbService, log), c)
+	gts, err := New(dbService, &cache.MockCache{}, router, federator, distributor, c)
 	if err != nil {
 		return fmt.Errorf("error creating gotosocial service: %s", err)
 	}
@@ -21,10 +21,11 @@ package gotosocial
 import (
 	"context"
 
-	"github.com/go-fed/activity/pub"
 	"github.com/superseriousbusiness/gotosocial/internal/cache"
 	"github.com/superseriousbusiness/gotosocial/internal/config"
 	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+	"github.com/superseriousbusiness/gotosocial/internal/federation"
 	"github.com/superseriousbusiness/gotosocial/internal/router"
 )
 
@@ -38,28 +39,36 @@ type Gotosocial interface {
 // New returns a new gotosocial server, initialized with the given configuration.
 // An error will be returned the caller if something goes wrong during initialization
 // eg., no db or storage connection, port for router already in use, etc.
-func New(db db.DB, cache cache.Cache, apiRouter router.Router, federationAPI pub.FederatingActor, config *config.Config) (Gotosocial, error) {
+func New(db db.DB, cache cache.Cache, apiRouter router.Router, federator federation.Federator, distributor distributor.Distributor, config *config.Config) (Gotosocial, error) {
 	return &gotosocial{
-		db:            db,
-		cache:         cache,
-		apiRouter:     apiRouter,
-		federationAPI: federationAPI,
-		config:        config,
+		db:          db,
+		cache:       cache,
+		apiRouter:   apiRouter,
+		federator:   federator,
+		distributor: distributor,
+		config:      config,
 	}, nil
 }
 
 // gotosocial fulfils the gotosocial interface.
 type gotosocial struct {
-	db            db.DB
-	cache         cache.Cache
-	apiRouter     router.Router
-	federationAPI pub.FederatingActor
-	config        *config.Config
+	db          db.DB
+	cache       cache.Cache
+	apiRouter   router.Router
+	federator   federation.Federator
+	distributor distributor.Distributor
+	config      *config.Config
 }
 
 // Start starts up the gotosocial server. If something goes wrong
 // while starting the server, then an error will be returned.
 func (gts *gotosocial) Start(ctx context.Context) error {
+	if err := gts.federator.Start(); err != nil {
+		return err
+	}
+	if err := gts.distributor.Start(); err != nil {
+		return err
+	}
 	gts.apiRouter.Start()
 	return nil
 }
@@ -68,6 +77,13 @@ func (gts *gotosocial) Stop(ctx context.Context) error {
 	if err := gts.apiRouter.Stop(ctx); err != nil {
 		return err
 	}
+	// the distributor drains its queue before stopping, and its handlers may still need the federator and the db
+	if err := gts.distributor.Stop(); err != nil {
+		return err
+	}
+	if err := gts.federator.Stop(); err != nil {
+		return err
+	}
 	if err := gts.db.Stop(ctx); err != nil {
 		return err
 	}
@@ -38,6 +38,10 @@ type MediaHandler interface {
 	// puts it in whatever storage backend we're using, sets the relevant fields in the database for the new image,
 	// and then returns information to the caller about the new header.
 	SetHeaderOrAvatarForAccountID(img []byte, accountID string, headerOrAvi string) (*model.MediaAttachment, error)
+
+	// DeleteAttachment removes the files of the given attachment, and its thumbnail, from storage, and then removes
+	// the attachment itself from the database.
+	DeleteAttachment(attachment *model.MediaAttachment) error
 }
 
 type mediaHandler struct {
@@ -103,6 +107,21 @@ func (mh *mediaHandler) SetHeaderOrAvatarForAccountID(img []byte, accountID stri
 	return ma, nil
 }
 
+func (mh *mediaHandler) DeleteAttachment(attachment *model.MediaAttachment) error {
+	for _, path := range []string{attachment.File.Path, attachment.Thumbnail.Path} {
+		if path == "" {
+			continue
+		}
+		if err := mh.storage.RemoveFileAt(path); err != nil {
+			return fmt.Errorf("storage error removing %s: %s", path, err)
+		}
+	}
+	if err := mh.db.DeleteByID(attachment.ID, &model.MediaAttachment{}); err != nil {
+		return fmt.Errorf("error deleting attachment %s from database: %s", attachment.ID, err)
+	}
+	return nil
+}
+
 /*
 	HELPER FUNCTIONS
 */
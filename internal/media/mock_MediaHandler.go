@@ -12,6 +12,20 @@ type MockMediaHandler struct {
 	mock.Mock
 }
 
+// DeleteAttachment provides a mock function with given fields: attachment
+func (_m *MockMediaHandler) DeleteAttachment(attachment *model.MediaAttachment) error {
+	ret := _m.Called(attachment)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*model.MediaAttachment) error); ok {
+		r0 = rf(attachment)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // SetHeaderOrAvatarForAccountID provides a mock function with given fields: img, accountID, headerOrAvi
 func (_m *MockMediaHandler) SetHeaderOrAvatarForAccountID(img []byte, accountID string, headerOrAvi string) (*model.MediaAttachment, error) {
 	ret := _m.Called(img, accountID, headerOrAvi)
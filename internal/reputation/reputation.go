@@ -0,0 +1,232 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+// Package reputation scores remote instances on how much we trust them, so that new or poorly behaved
+// instances can be let in to federate with us slowly, rather than it being all or nothing.
+package reputation
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+const (
+	// MinScore is the lowest score a domain can have.
+	MinScore = 0
+	// MaxScore is the highest score a domain can have.
+	MaxScore = 100
+	// ReviewBelow is the score below which activities from a domain are held for an admin to review.
+	ReviewBelow = 10
+	// StripMediaBelow is the score below which we strip the media from statuses from a domain.
+	StripMediaBelow = 30
+	// ThrottleBelow is the score below which deliveries from a domain are rate limited.
+	ThrottleBelow = 50
+
+	// baseScore is the score of a domain we know nothing about, so that brand new domains start out throttled and without media.
+	baseScore = 20
+	// agePointsPerDay is how many points a domain earns for each day since we first came into contact with it.
+	agePointsPerDay = 1
+	// maxAgePoints is the most points a domain can earn from age alone.
+	maxAgePoints = 30
+	// followPoints is how many points a domain earns for each local account following one of its accounts.
+	followPoints = 5
+	// maxFollowPoints is the most points a domain can earn from follows.
+	maxFollowPoints = 40
+	// blockPenalty is how many points a domain loses for each local account blocking one of its accounts.
+	blockPenalty = 10
+	// mutePenalty is how many points a domain loses for each local account muting one of its accounts.
+	mutePenalty = 3
+	// reportPenalty is how many points a domain loses for each report of one of its accounts by a local account.
+	reportPenalty = 15
+
+	// cacheTTL is how long a calculated reputation is used for before it's calculated again.
+	cacheTTL = 10 * time.Minute
+)
+
+// Scorer works out the reputation of remote domains.
+type Scorer interface {
+	// Reputation returns the current reputation of the given domain, which should be a host as stored on remote accounts,
+	// eg 'example.org'. Reputations are cached for a while, so recent changes might not be reflected straight away.
+	Reputation(domain string) (*Reputation, error)
+}
+
+// Signals are the things we know about a domain that its reputation is calculated from.
+type Signals struct {
+	// When did we first come into contact with the domain? Zero if we never have.
+	FirstContact time.Time
+	// How many follows do local accounts have of accounts on the domain?
+	Follows int
+	// How many blocks do local accounts have of accounts on the domain?
+	Blocks int
+	// How many mutes do local accounts have of accounts on the domain?
+	Mutes int
+	// How many reports have local accounts made about accounts on the domain?
+	Reports int
+}
+
+// Reputation is the calculated reputation of a domain.
+type Reputation struct {
+	// Domain that this reputation is for
+	Domain string
+	// Score of the domain, from MinScore to MaxScore
+	Score int
+	// Overridden is true if the score was pinned by an admin rather than calculated from signals
+	Overridden bool
+	// Signals that the score was calculated from. Empty if the score was overridden.
+	Signals Signals
+}
+
+// Throttled returns true if deliveries from the domain should be rate limited.
+func (r *Reputation) Throttled() bool {
+	return r.Score < ThrottleBelow
+}
+
+// StripMedia returns true if media should be stripped from statuses from the domain.
+func (r *Reputation) StripMedia() bool {
+	return r.Score < StripMediaBelow
+}
+
+// NeedsReview returns true if activities from the domain should be held for an admin to review.
+func (r *Reputation) NeedsReview() bool {
+	return r.Score < ReviewBelow
+}
+
+// Score calculates a score for a domain from the given signals, as of the given time.
+func Score(s Signals, now time.Time) int {
+	score := baseScore
+
+	if !s.FirstContact.IsZero() && now.After(s.FirstContact) {
+		days := int(now.Sub(s.FirstContact) / (24 * time.Hour))
+		score += min(days*agePointsPerDay, maxAgePoints)
+	}
+	score += min(s.Follows*followPoints, maxFollowPoints)
+	score -= s.Blocks * blockPenalty
+	score -= s.Mutes * mutePenalty
+	score -= s.Reports * reportPenalty
+
+	if score < MinScore {
+		return MinScore
+	}
+	if score > MaxScore {
+		return MaxScore
+	}
+	return score
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+type cachedReputation struct {
+	reputation   *Reputation
+	calculatedAt time.Time
+}
+
+// scorer implements the Scorer interface
+type scorer struct {
+	db    db.DB
+	log   *logrus.Logger
+	ttl   time.Duration
+	mu    sync.Mutex
+	cache map[string]*cachedReputation
+}
+
+// New returns a new Scorer that works out reputations from the given db.
+func New(db db.DB, log *logrus.Logger) Scorer {
+	return &scorer{
+		db:    db,
+		log:   log,
+		ttl:   cacheTTL,
+		cache: make(map[string]*cachedReputation),
+	}
+}
+
+// Reputation returns the current reputation of the given domain.
+func (s *scorer) Reputation(domain string) (*Reputation, error) {
+	domain = strings.ToLower(domain)
+
+	s.mu.Lock()
+	cached, ok := s.cache[domain]
+	s.mu.Unlock()
+	if ok && time.Since(cached.calculatedAt) < s.ttl {
+		return cached.reputation, nil
+	}
+
+	r, err := s.calculate(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	// drop anything stale while we're here so the cache doesn't grow forever
+	for d, c := range s.cache {
+		if now.Sub(c.calculatedAt) >= s.ttl {
+			delete(s.cache, d)
+		}
+	}
+	s.cache[domain] = &cachedReputation{reputation: r, calculatedAt: now}
+	return r, nil
+}
+
+// calculate works out the reputation of the given domain from scratch, using an admin override if there is one.
+func (s *scorer) calculate(domain string) (*Reputation, error) {
+	l := s.log.WithField("func", "calculate")
+
+	override := &model.ReputationOverride{}
+	if err := s.db.GetWhere("domain", domain, override); err == nil {
+		return &Reputation{Domain: domain, Score: override.Score, Overridden: true}, nil
+	} else if _, ok := err.(db.ErrNoEntries); !ok {
+		return nil, fmt.Errorf("error getting reputation override for %s: %s", domain, err)
+	}
+
+	signals := Signals{}
+	first := &model.Account{}
+	if err := s.db.GetFirstAccountForDomain(domain, first); err == nil {
+		signals.FirstContact = first.CreatedAt
+	} else if _, ok := err.(db.ErrNoEntries); !ok {
+		return nil, fmt.Errorf("error getting first account for %s: %s", domain, err)
+	}
+
+	var err error
+	if signals.Follows, err = s.db.CountLocalInteractionsWithDomain(domain, &model.Follow{}); err != nil {
+		return nil, fmt.Errorf("error counting follows of %s: %s", domain, err)
+	}
+	if signals.Blocks, err = s.db.CountLocalInteractionsWithDomain(domain, &model.Block{}); err != nil {
+		return nil, fmt.Errorf("error counting blocks of %s: %s", domain, err)
+	}
+	if signals.Mutes, err = s.db.CountLocalInteractionsWithDomain(domain, &model.Mute{}); err != nil {
+		return nil, fmt.Errorf("error counting mutes of %s: %s", domain, err)
+	}
+	if signals.Reports, err = s.db.CountLocalInteractionsWithDomain(domain, &model.Report{}); err != nil {
+		return nil, fmt.Errorf("error counting reports of %s: %s", domain, err)
+	}
+
+	r := &Reputation{Domain: domain, Score: Score(signals, time.Now()), Signals: signals}
+	l.Debugf("calculated reputation %d for %s from %+v", r.Score, domain, signals)
+	return r, nil
+}
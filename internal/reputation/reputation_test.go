@@ -0,0 +1,173 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package reputation
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+type ReputationTestSuite struct {
+	suite.Suite
+	log    *logrus.Logger
+	mockDB *db.MockDB
+	scorer *scorer
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *ReputationTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+}
+
+// SetupTest creates a fresh mock db and a scorer that uses it
+func (suite *ReputationTestSuite) SetupTest() {
+	suite.mockDB = &db.MockDB{}
+	suite.scorer = New(suite.mockDB, suite.log).(*scorer)
+}
+
+// expectSignals makes the mock db return the given signals for the given domain, with no override
+func (suite *ReputationTestSuite) expectSignals(domain string, s Signals) {
+	suite.mockDB.On("GetWhere", "domain", domain, mock.AnythingOfType("*model.ReputationOverride")).Return(db.ErrNoEntries{})
+	if s.FirstContact.IsZero() {
+		suite.mockDB.On("GetFirstAccountForDomain", domain, mock.AnythingOfType("*model.Account")).Return(db.ErrNoEntries{})
+	} else {
+		suite.mockDB.On("GetFirstAccountForDomain", domain, mock.AnythingOfType("*model.Account")).Return(nil).Run(func(args mock.Arguments) {
+			args.Get(1).(*model.Account).CreatedAt = s.FirstContact
+		})
+	}
+	suite.mockDB.On("CountLocalInteractionsWithDomain", domain, mock.AnythingOfType("*model.Follow")).Return(s.Follows, nil)
+	suite.mockDB.On("CountLocalInteractionsWithDomain", domain, mock.AnythingOfType("*model.Block")).Return(s.Blocks, nil)
+	suite.mockDB.On("CountLocalInteractionsWithDomain", domain, mock.AnythingOfType("*model.Mute")).Return(s.Mutes, nil)
+	suite.mockDB.On("CountLocalInteractionsWithDomain", domain, mock.AnythingOfType("*model.Report")).Return(s.Reports, nil)
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *ReputationTestSuite) TestScore() {
+	now := time.Now()
+	for name, tc := range map[string]struct {
+		signals  Signals
+		expected int
+	}{
+		"never seen before":         {Signals{}, 20},
+		"first contact just now":    {Signals{FirstContact: now}, 20},
+		"known for a week":          {Signals{FirstContact: now.Add(-7 * 24 * time.Hour)}, 27},
+		"known for a year":          {Signals{FirstContact: now.Add(-365 * 24 * time.Hour)}, 50},
+		"a couple of follows":       {Signals{Follows: 2}, 30},
+		"loads of follows":          {Signals{Follows: 1000}, 60},
+		"old and followed":          {Signals{FirstContact: now.Add(-365 * 24 * time.Hour), Follows: 1000}, 90},
+		"one report":                {Signals{Reports: 1}, 5},
+		"blocked and muted":         {Signals{Blocks: 1, Mutes: 2}, 4},
+		"followed but blocked":      {Signals{Follows: 4, Blocks: 2}, 20},
+		"can't go below the bottom": {Signals{Reports: 10, Blocks: 10}, MinScore},
+		"first contact in future":   {Signals{FirstContact: now.Add(time.Hour)}, 20},
+	} {
+		assert.Equal(suite.T(), tc.expected, Score(tc.signals, now), name)
+	}
+}
+
+func (suite *ReputationTestSuite) TestReputationThresholds() {
+	newcomer := &Reputation{Score: baseScore}
+	assert.True(suite.T(), newcomer.Throttled())
+	assert.True(suite.T(), newcomer.StripMedia())
+	assert.False(suite.T(), newcomer.NeedsReview())
+
+	reported := &Reputation{Score: 5}
+	assert.True(suite.T(), reported.NeedsReview())
+
+	trusted := &Reputation{Score: ThrottleBelow}
+	assert.False(suite.T(), trusted.Throttled())
+	assert.False(suite.T(), trusted.StripMedia())
+	assert.False(suite.T(), trusted.NeedsReview())
+}
+
+func (suite *ReputationTestSuite) TestReputationFromSignals() {
+	suite.expectSignals("example.org", Signals{FirstContact: time.Now().Add(-10 * 24 * time.Hour), Follows: 3, Mutes: 1})
+
+	r, err := suite.scorer.Reputation("Example.org")
+	if assert.NoError(suite.T(), err) {
+		assert.Equal(suite.T(), "example.org", r.Domain)
+		assert.Equal(suite.T(), 42, r.Score)
+		assert.False(suite.T(), r.Overridden)
+		assert.Equal(suite.T(), 3, r.Signals.Follows)
+	}
+
+	// the second lookup should come from the cache
+	_, err = suite.scorer.Reputation("example.org")
+	assert.NoError(suite.T(), err)
+	suite.mockDB.AssertNumberOfCalls(suite.T(), "GetFirstAccountForDomain", 1)
+}
+
+func (suite *ReputationTestSuite) TestReputationRecalculatedWhenStale() {
+	suite.scorer.ttl = 0
+	suite.expectSignals("example.org", Signals{})
+
+	_, err := suite.scorer.Reputation("example.org")
+	assert.NoError(suite.T(), err)
+	_, err = suite.scorer.Reputation("example.org")
+	assert.NoError(suite.T(), err)
+	suite.mockDB.AssertNumberOfCalls(suite.T(), "GetFirstAccountForDomain", 2)
+}
+
+func (suite *ReputationTestSuite) TestOverride() {
+	suite.mockDB.On("GetWhere", "domain", "example.org", mock.AnythingOfType("*model.ReputationOverride")).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(2).(*model.ReputationOverride).Score = 0
+	})
+
+	r, err := suite.scorer.Reputation("example.org")
+	if assert.NoError(suite.T(), err) {
+		assert.True(suite.T(), r.Overridden)
+		assert.Equal(suite.T(), 0, r.Score)
+		assert.True(suite.T(), r.NeedsReview())
+	}
+	suite.mockDB.AssertNotCalled(suite.T(), "CountLocalInteractionsWithDomain", mock.Anything, mock.Anything)
+}
+
+func (suite *ReputationTestSuite) TestDBError() {
+	suite.mockDB.On("GetWhere", "domain", "example.org", mock.AnythingOfType("*model.ReputationOverride")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetFirstAccountForDomain", "example.org", mock.AnythingOfType("*model.Account")).Return(errors.New("database is on fire"))
+
+	_, err := suite.scorer.Reputation("example.org")
+	assert.Error(suite.T(), err)
+
+	// errors shouldn't be cached
+	_, err = suite.scorer.Reputation("example.org")
+	assert.Error(suite.T(), err)
+	suite.mockDB.AssertNumberOfCalls(suite.T(), "GetFirstAccountForDomain", 2)
+}
+
+func TestReputationTestSuite(t *testing.T) {
+	suite.Run(t, new(ReputationTestSuite))
+}
@@ -29,3 +29,8 @@ func (s *inMemStorage) RetrieveFileFrom(path string) ([]byte, error) {
 	}
 	return d, nil
 }
+
+func (s *inMemStorage) RemoveFileAt(path string) error {
+	delete(s.stored, path)
+	return nil
+}
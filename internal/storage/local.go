@@ -19,3 +19,7 @@ func (s *localStorage) StoreFileAt(path string, data []byte) error {
 func (s *localStorage) RetrieveFileFrom(path string) ([]byte, error) {
 	return nil, nil
 }
+
+func (s *localStorage) RemoveFileAt(path string) error {
+	return nil
+}
@@ -9,6 +9,20 @@ type MockStorage struct {
 	mock.Mock
 }
 
+// RemoveFileAt provides a mock function with given fields: path
+func (_m *MockStorage) RemoveFileAt(path string) error {
+	ret := _m.Called(path)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(path)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // RetrieveFileFrom provides a mock function with given fields: path
 func (_m *MockStorage) RetrieveFileFrom(path string) ([]byte, error) {
 	ret := _m.Called(path)
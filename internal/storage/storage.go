@@ -21,4 +21,5 @@ package storage
 type Storage interface {
 	StoreFileAt(path string, data []byte) error
 	RetrieveFileFrom(path string) ([]byte, error)
+	RemoveFileAt(path string) error
 }
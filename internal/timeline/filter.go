@@ -0,0 +1,238 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package timeline
+
+import (
+	"fmt"
+
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+// relations are who an account follows, and who it shouldn't see statuses from, at the time a timeline is requested.
+type relations struct {
+	following map[string]bool
+	// hidden holds the ids of accounts that the account has blocked or muted, or that have blocked it
+	hidden map[string]bool
+}
+
+// relationsOf loads the relations of the given account.
+func (m *manager) relationsOf(account *model.Account) (*relations, error) {
+	r := &relations{
+		following: make(map[string]bool),
+		hidden:    make(map[string]bool),
+	}
+
+	following := []model.Follow{}
+	if err := m.db.GetFollowingByAccountID(account.ID, &following); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return nil, fmt.Errorf("error getting follows of account %s: %s", account.ID, err)
+		}
+	}
+	for _, follow := range following {
+		r.following[follow.TargetAccountID] = true
+	}
+
+	blocks := []model.Block{}
+	if err := m.db.GetWhere("account_id", account.ID, &blocks); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return nil, fmt.Errorf("error getting blocks by account %s: %s", account.ID, err)
+		}
+	}
+	for _, block := range blocks {
+		r.hidden[block.TargetAccountID] = true
+	}
+
+	blockedBy := []model.Block{}
+	if err := m.db.GetWhere("target_account_id", account.ID, &blockedBy); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return nil, fmt.Errorf("error getting blocks of account %s: %s", account.ID, err)
+		}
+	}
+	for _, block := range blockedBy {
+		r.hidden[block.AccountID] = true
+	}
+
+	mutes := []model.Mute{}
+	if err := m.db.GetWhere("account_id", account.ID, &mutes); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return nil, fmt.Errorf("error getting mutes by account %s: %s", account.ID, err)
+		}
+	}
+	for _, mute := range mutes {
+		r.hidden[mute.TargetAccountID] = true
+	}
+
+	return r, nil
+}
+
+// homeFilter decides which statuses are shown in the home timeline of one account, based on who the account follows,
+// blocks and mutes at the time the timeline is requested.
+type homeFilter struct {
+	*relations
+	db        db.DB
+	accountID string
+}
+
+// newHomeFilter returns a filter for the home timeline of the given account.
+func (m *manager) newHomeFilter(account *model.Account) (*homeFilter, error) {
+	r, err := m.relationsOf(account)
+	if err != nil {
+		return nil, err
+	}
+	return &homeFilter{
+		relations: r,
+		db:        m.db,
+		accountID: account.ID,
+	}, nil
+}
+
+// show returns true if the given status should be shown in the home timeline. Only statuses by the account itself and by
+// accounts it follows are shown, since the cached timeline may still hold statuses of accounts that have been unfollowed
+// since. Statuses by, boosting, or replying to hidden accounts aren't shown; nor are replies to accounts that aren't followed,
+// unless they're replies to the account itself or the author is replying to themself. Direct statuses are only shown to
+// their author and the accounts they mention.
+func (f *homeFilter) show(s *model.Status) (bool, error) {
+	if s.AccountID != f.accountID && !f.following[s.AccountID] {
+		return false, nil
+	}
+	if f.hidden[s.AccountID] {
+		return false, nil
+	}
+
+	if s.BoostOfID != "" {
+		boosted := &model.Status{}
+		if err := f.db.GetByID(s.BoostOfID, boosted); err != nil {
+			if _, ok := err.(db.ErrNoEntries); ok {
+				return false, nil
+			}
+			return false, fmt.Errorf("error getting status %s boosted by status %s: %s", s.BoostOfID, s.ID, err)
+		}
+		if f.hidden[boosted.AccountID] {
+			return false, nil
+		}
+		// only public and unlisted statuses can be boosted
+		v := boosted.Visibility
+		return v != nil && !v.Direct && (v.Public || v.Unlisted), nil
+	}
+
+	if r := s.InReplyToAccountID; r != "" && r != s.AccountID && r != f.accountID {
+		if f.hidden[r] || !f.following[r] {
+			return false, nil
+		}
+	}
+
+	if s.Visibility != nil && s.Visibility.Direct && s.AccountID != f.accountID {
+		mentions := []model.Mention{}
+		if err := f.db.GetWhere("status_id", s.ID, &mentions); err != nil {
+			if _, ok := err.(db.ErrNoEntries); !ok {
+				return false, fmt.Errorf("error getting mentions of status %s: %s", s.ID, err)
+			}
+		}
+		for _, mention := range mentions {
+			if mention.TargetAccountID == f.accountID {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// publicFilter decides which statuses are shown in the public timeline to the account viewing it. Statuses by silenced
+// accounts, or by accounts on silenced domains, are only shown to their followers, and replies to other accounts aren't
+// shown at all.
+type publicFilter struct {
+	db      db.DB
+	domains Domains
+	// account is viewing the timeline, and is nil if nobody is logged in, in which case relations is nil too
+	account   *model.Account
+	relations *relations
+	// silenced caches whether the authors seen so far are silenced
+	silenced map[string]bool
+}
+
+// newPublicFilter returns a filter for the public timeline as seen by the given account, which is nil if nobody is logged in.
+func (m *manager) newPublicFilter(account *model.Account) (*publicFilter, error) {
+	f := &publicFilter{
+		db:       m.db,
+		domains:  m.domains,
+		account:  account,
+		silenced: make(map[string]bool),
+	}
+	if account != nil {
+		r, err := m.relationsOf(account)
+		if err != nil {
+			return nil, err
+		}
+		f.relations = r
+	}
+	return f, nil
+}
+
+// show returns true if the given status should be shown in the public timeline. Local-only statuses aren't shown to
+// anyone who isn't logged in, and statuses by hidden accounts aren't shown to the account they're hidden from, even if
+// it follows them. Accounts can always see their own statuses.
+func (f *publicFilter) show(s *model.Status) (bool, error) {
+	if s.InReplyToID != "" && s.InReplyToAccountID != s.AccountID {
+		return false, nil
+	}
+
+	if f.account == nil {
+		if s.Local && s.Visibility != nil && s.Visibility.LocalOnly {
+			return false, nil
+		}
+		return f.notSilenced(s.AccountID)
+	}
+
+	// hidden accounts stay hidden even if they're followed
+	if f.relations.hidden[s.AccountID] {
+		return false, nil
+	}
+	if s.AccountID == f.account.ID || f.relations.following[s.AccountID] {
+		return true, nil
+	}
+	return f.notSilenced(s.AccountID)
+}
+
+// notSilenced returns true if the account with the given id exists, and neither it nor its domain has been silenced.
+func (f *publicFilter) notSilenced(accountID string) (bool, error) {
+	if silenced, ok := f.silenced[accountID]; ok {
+		return !silenced, nil
+	}
+	author := &model.Account{}
+	if err := f.db.GetByID(accountID, author); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return false, fmt.Errorf("error getting account %s: %s", accountID, err)
+		}
+		// the author is gone, so there's no point showing what's left of them
+		f.silenced[accountID] = true
+		return false, nil
+	}
+	silenced := !author.SilencedAt.IsZero()
+	if !silenced && author.Domain != "" {
+		domainSilenced, err := f.domains.DomainSilenced(author.Domain)
+		if err != nil {
+			return false, fmt.Errorf("error checking whether domain %s is silenced: %s", author.Domain, err)
+		}
+		silenced = domainSilenced
+	}
+	f.silenced[accountID] = silenced
+	return !silenced, nil
+}
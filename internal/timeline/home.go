@@ -0,0 +1,250 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package timeline
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+func (m *manager) HomeTimeline(account *model.Account, maxID string, sinceID string, minID string, limit int) ([]*model.Status, error) {
+	upper, lower, err := m.resolveCursors(maxID, sinceID, minID)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := m.newHomeFilter(account)
+	if err != nil {
+		return nil, err
+	}
+
+	t := m.homeTimeline(account.ID)
+	t.Lock()
+	defer t.Unlock()
+	t.lastUsed = time.Now()
+
+	if t.loaded && !sameAccounts(t.following, f.following) {
+		// the statuses of accounts that have just been followed aren't cached, so start over
+		t.reset()
+	}
+	if !t.loaded {
+		if err := m.extendHome(t, account.ID); err != nil {
+			return nil, err
+		}
+		t.loaded = true
+		t.following = f.following
+	}
+	if minID != "" {
+		return m.homeUpFrom(t, account.ID, f, upper, lower, limit)
+	}
+	return m.homeDownFrom(t, account.ID, f, upper, lower, limit)
+}
+
+// homeDownFrom returns up to limit statuses of the given home timeline that are older than upper and newer than lower,
+// starting from the newest. The timeline is extended from the database as needed, up to maxCachedStatuses, after which
+// the rest of the statuses are read from the database directly.
+//
+// Where upper and lower are cached, the statuses between them are picked by position rather than by time, so that statuses
+// created at the same time as upper or lower aren't skipped.
+func (m *manager) homeDownFrom(t *homeTimeline, accountID string, f *homeFilter, upper *model.Status, lower *model.Status, limit int) ([]*model.Status, error) {
+	statuses := []*model.Status{}
+	i := 0
+	upperCached, lowerCached := false, false
+	if upper != nil {
+		if j := t.indexOf(upper.ID); j >= 0 {
+			i = j + 1
+			upperCached = true
+		}
+	}
+	if lower != nil {
+		lowerCached = t.indexOf(lower.ID) >= 0
+	}
+	for len(statuses) < limit {
+		if i == len(t.statuses) {
+			if t.exhausted {
+				break
+			}
+			if len(t.statuses) < maxCachedStatuses {
+				if err := m.extendHome(t, accountID); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			// the cache is full, so carry on from the database, below whichever is older of upper and the oldest cached status
+			maxID := ""
+			if len(t.statuses) > 0 {
+				maxID = t.statuses[len(t.statuses)-1].ID
+			}
+			if upper != nil && (maxID == "" || upper.CreatedAt.Before(t.statuses[len(t.statuses)-1].CreatedAt)) {
+				maxID = upper.ID
+			}
+			rest, err := downFromDB(m.homeFetch(accountID), f, maxID, lower, limit-len(statuses))
+			if err != nil {
+				return nil, err
+			}
+			statuses = append(statuses, rest...)
+			break
+		}
+
+		s := t.statuses[i]
+		i++
+		if upper != nil && !upperCached && !s.CreatedAt.Before(upper.CreatedAt) {
+			continue
+		}
+		if lowerCached && s.ID == lower.ID {
+			break
+		}
+		if lower != nil && !lowerCached && !s.CreatedAt.After(lower.CreatedAt) {
+			break
+		}
+		show, err := f.show(s)
+		if err != nil {
+			return nil, err
+		}
+		if show {
+			statuses = append(statuses, s)
+		}
+	}
+	return statuses, nil
+}
+
+// homeUpFrom returns up to limit statuses of the given home timeline that are newer than lower and older than upper,
+// starting from the ones immediately newer than lower, but still with the newest first. If lower is older than anything
+// in the cached timeline, the statuses are read from the database directly.
+func (m *manager) homeUpFrom(t *homeTimeline, accountID string, f *homeFilter, upper *model.Status, lower *model.Status, limit int) ([]*model.Status, error) {
+	// find the oldest cached status that's newer than lower
+	i := t.indexOf(lower.ID) - 1
+	if i < -1 {
+		i = len(t.statuses) - 1
+		for i >= 0 && !t.statuses[i].CreatedAt.After(lower.CreatedAt) {
+			i--
+		}
+		if i == len(t.statuses)-1 && !t.exhausted {
+			// lower is older than everything cached, so we don't know what's between them
+			return upFromDB(m.homeFetch(accountID), f, upper, lower, limit)
+		}
+	}
+	top := -1
+	if upper != nil {
+		top = t.indexOf(upper.ID)
+	}
+
+	statuses := []*model.Status{}
+	for ; i > top && len(statuses) < limit; i-- {
+		s := t.statuses[i]
+		if upper != nil && top < 0 && !s.CreatedAt.Before(upper.CreatedAt) {
+			break
+		}
+		show, err := f.show(s)
+		if err != nil {
+			return nil, err
+		}
+		if show {
+			statuses = append(statuses, s)
+		}
+	}
+	reverse(statuses)
+	return statuses, nil
+}
+
+// insert puts the given status into the timeline, in order of creation, unless it's there already. A status older than
+// everything cached is left for extendHome to read from the database, unless there's nothing more to read. Nothing is
+// inserted into a timeline that hasn't been loaded yet, since loading it will get the status from the database anyway.
+func (t *homeTimeline) insert(s *model.Status) {
+	if !t.loaded || t.indexOf(s.ID) >= 0 {
+		return
+	}
+	i := 0
+	for i < len(t.statuses) && t.statuses[i].CreatedAt.After(s.CreatedAt) {
+		i++
+	}
+	if i == len(t.statuses) && !t.exhausted {
+		return
+	}
+
+	t.statuses = append(t.statuses, nil)
+	copy(t.statuses[i+1:], t.statuses[i:])
+	t.statuses[i] = s
+	if len(t.statuses) > maxCachedStatuses {
+		t.statuses = t.statuses[:maxCachedStatuses]
+		t.exhausted = false
+	}
+}
+
+// reset empties the timeline, so that it's read from the database again the next time it's used.
+func (t *homeTimeline) reset() {
+	t.statuses = nil
+	t.exhausted = false
+	t.loaded = false
+	t.following = nil
+}
+
+// sameAccounts returns true if the given sets of account ids are the same.
+func sameAccounts(a map[string]bool, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id := range a {
+		if !b[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// indexOf returns the position of the status with the given id in the timeline, or -1 if it isn't cached.
+func (t *homeTimeline) indexOf(id string) int {
+	for i, s := range t.statuses {
+		if s.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// extendHome adds the statuses that come after the oldest one of the given home timeline to the bottom of it.
+func (m *manager) extendHome(t *homeTimeline, accountID string) error {
+	maxID := ""
+	if len(t.statuses) > 0 {
+		maxID = t.statuses[len(t.statuses)-1].ID
+	}
+	older := []model.Status{}
+	if err := m.db.GetHomeTimelineStatuses(accountID, &older, fetchSize, maxID, ""); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return fmt.Errorf("error getting home timeline of account %s: %s", accountID, err)
+		}
+	}
+	t.statuses = append(t.statuses, pointers(older)...)
+	t.exhausted = len(older) < fetchSize
+	return nil
+}
+
+// homeFetch returns a fetchFunc that reads the home timeline of the account with the given id from the database.
+func (m *manager) homeFetch(accountID string) fetchFunc {
+	return func(statuses *[]model.Status, limit int, maxID string, minID string) error {
+		err := m.db.GetHomeTimelineStatuses(accountID, statuses, limit, maxID, minID)
+		if _, ok := err.(db.ErrNoEntries); err != nil && !ok {
+			return fmt.Errorf("error getting home timeline of account %s: %s", accountID, err)
+		}
+		return err
+	}
+}
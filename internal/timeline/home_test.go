@@ -0,0 +1,474 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package timeline
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+)
+
+type HomeTestSuite struct {
+	suite.Suite
+	log      *logrus.Logger
+	account  *model.Account
+	followed *model.Account
+	stranger *model.Account
+	blocked  *model.Account
+	muted    *model.Account
+	// statuses that the mock db has for the home timeline of account, newest first
+	statuses []*model.Status
+	// mentions that the mock db has, by status id
+	mentions map[string][]model.Mention
+	// follows of account that the mock db has
+	following       []model.Follow
+	mockDB          *db.MockDB
+	mockDistributor *distributor.MockDistributor
+	manager         *manager
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *HomeTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	suite.account = &model.Account{ID: "2b6d3f1c-5d43-4c8b-9c8e-6f5d1c2b3a41", Username: "local_user"}
+	suite.followed = &model.Account{ID: "0f1e2d3c-4b5a-4968-8776-a5b4c3d2e1f0", Username: "followed"}
+	suite.stranger = &model.Account{ID: "8a7c1e2d-3b4f-4e5a-8c9d-0e1f2a3b4c5d", Username: "stranger"}
+	suite.blocked = &model.Account{ID: "7c1e9a0b-2d3f-4a5b-8c6d-9e0f1a2b3c4d", Username: "blocked"}
+	suite.muted = &model.Account{ID: "5f4e3d2c-1b0a-4f9e-8d7c-6b5a4f3e2d1c", Username: "muted"}
+}
+
+// SetupTest creates a fresh mock db with no statuses in it, and a fresh manager, for each test
+func (suite *HomeTestSuite) SetupTest() {
+	suite.statuses = []*model.Status{}
+	suite.mentions = make(map[string][]model.Mention)
+	suite.following = []model.Follow{{AccountID: suite.account.ID, TargetAccountID: suite.followed.ID}}
+
+	suite.mockDB = &db.MockDB{}
+	suite.mockDB.On("GetHomeTimelineStatuses", suite.account.ID, mock.AnythingOfType("*[]model.Status"), mock.AnythingOfType("int"), mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(suite.getHomeTimelineStatuses)
+	suite.mockDB.On("GetByID", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Status")).Return(func(id string, i interface{}) error {
+		for _, s := range suite.statuses {
+			if s.ID == id {
+				*i.(*model.Status) = *s
+				return nil
+			}
+		}
+		return db.ErrNoEntries{}
+	})
+	suite.mockDB.On("GetFollowingByAccountID", suite.account.ID, mock.AnythingOfType("*[]model.Follow")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*[]model.Follow) = suite.following
+	})
+	suite.mockDB.On("GetFollowersByAccountID", suite.followed.ID, mock.AnythingOfType("*[]model.Follow")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*[]model.Follow) = []model.Follow{{AccountID: suite.account.ID, TargetAccountID: suite.followed.ID}}
+	})
+	suite.mockDB.On("GetFollowersByAccountID", mock.AnythingOfType("string"), mock.AnythingOfType("*[]model.Follow")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetWhere", "account_id", suite.account.ID, mock.AnythingOfType("*[]model.Block")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*[]model.Block) = []model.Block{{AccountID: suite.account.ID, TargetAccountID: suite.blocked.ID}}
+	})
+	suite.mockDB.On("GetWhere", "target_account_id", suite.account.ID, mock.AnythingOfType("*[]model.Block")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetWhere", "account_id", suite.account.ID, mock.AnythingOfType("*[]model.Mute")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*[]model.Mute) = []model.Mute{{AccountID: suite.account.ID, TargetAccountID: suite.muted.ID}}
+	})
+	suite.mockDB.On("GetWhere", "status_id", mock.AnythingOfType("string"), mock.AnythingOfType("*[]model.Mention")).Return(func(key string, value interface{}, i interface{}) error {
+		mentions, ok := suite.mentions[value.(string)]
+		if !ok {
+			return db.ErrNoEntries{}
+		}
+		*i.(*[]model.Mention) = mentions
+		return nil
+	})
+
+	suite.mockDistributor = &distributor.MockDistributor{}
+	suite.mockDistributor.On("Register", mock.Anything, mock.Anything).Return()
+
+	suite.manager = New(suite.mockDB, suite.mockDistributor, silencedDomains{}, suite.log).(*manager)
+}
+
+// getHomeTimelineStatuses pages through the statuses of the suite the way the database does.
+func (suite *HomeTestSuite) getHomeTimelineStatuses(accountID string, statuses *[]model.Status, limit int, maxID string, minID string) error {
+	return page(suite.statuses, statuses, limit, maxID, minID)
+}
+
+// page puts up to limit of the given statuses, which are newest first, into the given slice, paging through them with
+// maxID and minID the way the database does.
+func page(all []*model.Status, statuses *[]model.Status, limit int, maxID string, minID string) error {
+	find := func(id string) *model.Status {
+		for _, s := range all {
+			if s.ID == id {
+				return s
+			}
+		}
+		return nil
+	}
+
+	candidates := []model.Status{}
+	for _, s := range all {
+		if maxID != "" {
+			max := find(maxID)
+			if max == nil || !s.CreatedAt.Before(max.CreatedAt) {
+				continue
+			}
+		}
+		if minID != "" {
+			min := find(minID)
+			if min == nil || !s.CreatedAt.After(min.CreatedAt) {
+				continue
+			}
+		}
+		candidates = append(candidates, *s)
+	}
+	if limit != 0 && len(candidates) > limit {
+		if minID != "" {
+			candidates = candidates[len(candidates)-limit:]
+		} else {
+			candidates = candidates[:limit]
+		}
+	}
+	*statuses = candidates
+	return nil
+}
+
+// post adds a new status by the given account to the top of the statuses of the suite, and returns it
+func (suite *HomeTestSuite) post(account *model.Account, visibility *model.Visibility) *model.Status {
+	s := &model.Status{
+		ID:         fmt.Sprintf("00000000-0000-4000-8000-%012d", len(suite.statuses)),
+		AccountID:  account.ID,
+		CreatedAt:  time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(len(suite.statuses)) * time.Minute),
+		Visibility: visibility,
+	}
+	suite.statuses = append([]*model.Status{s}, suite.statuses...)
+	return s
+}
+
+// postPublic posts the given number of public statuses by the followed account, and returns them newest first
+func (suite *HomeTestSuite) postPublic(n int) []*model.Status {
+	for i := 0; i < n; i++ {
+		suite.post(suite.followed, &model.Visibility{Public: true, Followers: true})
+	}
+	return suite.statuses[:n]
+}
+
+// create lets the manager know that the given statuses have been created, oldest first, the way the distributor would
+func (suite *HomeTestSuite) create(statuses ...*model.Status) {
+	for i := len(statuses) - 1; i >= 0; i-- {
+		err := suite.manager.addCreatedStatus(context.Background(), distributor.StatusCreated{Status: statuses[i]})
+		suite.NoError(err)
+	}
+}
+
+// ids returns the ids of the given statuses
+func ids(statuses []*model.Status) []string {
+	ids := []string{}
+	for _, s := range statuses {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *HomeTestSuite) TestFirstPage() {
+	posted := suite.postPublic(30)
+
+	statuses, err := suite.manager.HomeTimeline(suite.account, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids(posted[:20]), ids(statuses))
+}
+
+func (suite *HomeTestSuite) TestPageDown() {
+	posted := suite.postPublic(100)
+
+	seen := []*model.Status{}
+	maxID := ""
+	for i := 0; i < 10; i++ {
+		statuses, err := suite.manager.HomeTimeline(suite.account, maxID, "", "", 30)
+		assert.NoError(suite.T(), err)
+		if len(statuses) == 0 {
+			break
+		}
+		seen = append(seen, statuses...)
+		maxID = statuses[len(statuses)-1].ID
+	}
+	assert.Equal(suite.T(), ids(posted), ids(seen))
+	// the whole timeline fits in the cache
+	assert.Len(suite.T(), suite.manager.home[suite.account.ID].statuses, 100)
+	assert.True(suite.T(), suite.manager.home[suite.account.ID].exhausted)
+}
+
+func (suite *HomeTestSuite) TestPageDownPastCache() {
+	posted := suite.postPublic(maxCachedStatuses + 50)
+
+	seen := []*model.Status{}
+	maxID := ""
+	for i := 0; i < 20; i++ {
+		statuses, err := suite.manager.HomeTimeline(suite.account, maxID, "", "", 40)
+		assert.NoError(suite.T(), err)
+		if len(statuses) == 0 {
+			break
+		}
+		seen = append(seen, statuses...)
+		maxID = statuses[len(statuses)-1].ID
+	}
+	assert.Equal(suite.T(), ids(posted), ids(seen))
+	assert.Len(suite.T(), suite.manager.home[suite.account.ID].statuses, maxCachedStatuses)
+}
+
+func (suite *HomeTestSuite) TestNewStatusesShowUp() {
+	suite.postPublic(10)
+	_, err := suite.manager.HomeTimeline(suite.account, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+
+	newer := suite.postPublic(3)
+	suite.create(newer...)
+	statuses, err := suite.manager.HomeTimeline(suite.account, "", "", "", 2)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids(newer[:2]), ids(statuses))
+	assert.Len(suite.T(), suite.manager.home[suite.account.ID].statuses, 13)
+
+	// the new statuses came from the distributor, so the database was only read the first time
+	suite.mockDB.AssertNumberOfCalls(suite.T(), "GetHomeTimelineStatuses", 1)
+}
+
+func (suite *HomeTestSuite) TestNewBoostShowsUp() {
+	posted := suite.postPublic(5)
+	_, err := suite.manager.HomeTimeline(suite.account, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+
+	boost := suite.post(suite.followed, &model.Visibility{Public: true, Followers: true})
+	boost.BoostOfID = posted[3].ID
+	suite.create(boost)
+	statuses, err := suite.manager.HomeTimeline(suite.account, "", "", "", 1)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{boost.ID}, ids(statuses))
+}
+
+func (suite *HomeTestSuite) TestNewStatusOfStrangerNotAdded() {
+	suite.postPublic(5)
+	_, err := suite.manager.HomeTimeline(suite.account, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+
+	suite.create(suite.post(suite.stranger, &model.Visibility{Public: true, Followers: true}))
+	assert.Len(suite.T(), suite.manager.home[suite.account.ID].statuses, 5)
+
+	// it's not added twice either
+	own := suite.post(suite.account, &model.Visibility{Public: true, Followers: true})
+	suite.create(own, own)
+	assert.Equal(suite.T(), own.ID, suite.manager.home[suite.account.ID].statuses[0].ID)
+	assert.Len(suite.T(), suite.manager.home[suite.account.ID].statuses, 6)
+}
+
+func (suite *HomeTestSuite) TestStatusesCreatedAtTheSameTime() {
+	posted := suite.postPublic(10)
+	for _, s := range posted {
+		s.CreatedAt = posted[0].CreatedAt
+	}
+	_, err := suite.manager.HomeTimeline(suite.account, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+
+	// new statuses at the same time as the others still get added
+	newer := suite.postPublic(2)
+	for _, s := range newer {
+		s.CreatedAt = posted[0].CreatedAt
+	}
+	suite.create(newer...)
+
+	// and paging through them by id doesn't skip any
+	seen := []*model.Status{}
+	maxID := ""
+	for i := 0; i < 10; i++ {
+		statuses, err := suite.manager.HomeTimeline(suite.account, maxID, "", "", 5)
+		assert.NoError(suite.T(), err)
+		if len(statuses) == 0 {
+			break
+		}
+		seen = append(seen, statuses...)
+		maxID = statuses[len(statuses)-1].ID
+	}
+	assert.Len(suite.T(), seen, 12)
+	assert.ElementsMatch(suite.T(), ids(suite.statuses), ids(seen))
+}
+
+func (suite *HomeTestSuite) TestSinceAndMinID() {
+	posted := suite.postPublic(50)
+
+	// since_id gets the newest statuses
+	statuses, err := suite.manager.HomeTimeline(suite.account, "", posted[30].ID, "", 5)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids(posted[:5]), ids(statuses))
+
+	// min_id gets the statuses just above it, still newest first
+	statuses, err = suite.manager.HomeTimeline(suite.account, "", "", posted[30].ID, 5)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids(posted[25:30]), ids(statuses))
+
+	// with max_id too, only what's in between
+	statuses, err = suite.manager.HomeTimeline(suite.account, posted[27].ID, "", posted[30].ID, 5)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids(posted[28:30]), ids(statuses))
+}
+
+func (suite *HomeTestSuite) TestMaxIDBelowCache() {
+	posted := suite.postPublic(100)
+
+	// only the first fetch is cached, and max_id is well below it
+	statuses, err := suite.manager.HomeTimeline(suite.account, posted[90].ID, "", "", 5)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids(posted[91:96]), ids(statuses))
+}
+
+func (suite *HomeTestSuite) TestMinIDBelowCache() {
+	posted := suite.postPublic(100)
+
+	// only the first fetch is cached, and min_id is well below it
+	statuses, err := suite.manager.HomeTimeline(suite.account, "", "", posted[90].ID, 5)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids(posted[85:90]), ids(statuses))
+	assert.Len(suite.T(), suite.manager.home[suite.account.ID].statuses, fetchSize)
+}
+
+func (suite *HomeTestSuite) TestUnknownCursor() {
+	suite.postPublic(5)
+	_, err := suite.manager.HomeTimeline(suite.account, "9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b", "", "", 20)
+	assert.IsType(suite.T(), db.ErrNoEntries{}, err)
+}
+
+func (suite *HomeTestSuite) TestFiltering() {
+	public := &model.Visibility{Public: true, Followers: true}
+	boostedByBlocked := suite.post(suite.blocked, public)
+	followersOnly := suite.post(suite.stranger, &model.Visibility{Followers: true})
+
+	shown := []*model.Status{}
+	hidden := []*model.Status{}
+	shown = append(shown, suite.post(suite.account, public))
+	shown = append(shown, suite.post(suite.followed, &model.Visibility{Followers: true}))
+	hidden = append(hidden, suite.post(suite.blocked, public))
+	hidden = append(hidden, suite.post(suite.muted, public))
+
+	replyToStranger := suite.post(suite.followed, public)
+	replyToStranger.InReplyToAccountID = suite.stranger.ID
+	hidden = append(hidden, replyToStranger)
+	replyToMe := suite.post(suite.followed, public)
+	replyToMe.InReplyToAccountID = suite.account.ID
+	shown = append(shown, replyToMe)
+	thread := suite.post(suite.followed, public)
+	thread.InReplyToAccountID = suite.followed.ID
+	shown = append(shown, thread)
+
+	boostOfBlocked := suite.post(suite.followed, public)
+	boostOfBlocked.BoostOfID = boostedByBlocked.ID
+	hidden = append(hidden, boostOfBlocked)
+	boostOfPrivate := suite.post(suite.followed, public)
+	boostOfPrivate.BoostOfID = followersOnly.ID
+	hidden = append(hidden, boostOfPrivate)
+
+	directToSomeoneElse := suite.post(suite.followed, &model.Visibility{Direct: true})
+	hidden = append(hidden, directToSomeoneElse)
+	directToMe := suite.post(suite.followed, &model.Visibility{Direct: true})
+	suite.mentions[directToMe.ID] = []model.Mention{{StatusID: directToMe.ID, TargetAccountID: suite.account.ID}}
+	shown = append(shown, directToMe)
+
+	statuses, err := suite.manager.HomeTimeline(suite.account, "", "", "", 40)
+	assert.NoError(suite.T(), err)
+	got := ids(statuses)
+	for _, s := range shown {
+		assert.Contains(suite.T(), got, s.ID)
+	}
+	for _, s := range hidden {
+		assert.NotContains(suite.T(), got, s.ID)
+	}
+}
+
+func (suite *HomeTestSuite) TestDeletedStatusRemoved() {
+	posted := suite.postPublic(5)
+	boost := suite.post(suite.followed, &model.Visibility{Public: true, Followers: true})
+	boost.BoostOfID = posted[2].ID
+	_, err := suite.manager.HomeTimeline(suite.account, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+
+	err = suite.manager.removeDeletedStatus(context.Background(), distributor.StatusDeleted{Status: posted[2]})
+	assert.NoError(suite.T(), err)
+	cached := ids(suite.manager.home[suite.account.ID].statuses)
+	assert.Len(suite.T(), cached, 4)
+	assert.NotContains(suite.T(), cached, posted[2].ID)
+	assert.NotContains(suite.T(), cached, boost.ID)
+}
+
+func (suite *HomeTestSuite) TestUnfollowedStatusesHidden() {
+	posted := suite.postPublic(5)
+	own := suite.post(suite.account, &model.Visibility{Public: true, Followers: true})
+	boost := suite.post(suite.followed, &model.Visibility{Public: true, Followers: true})
+	boost.BoostOfID = own.ID
+	_, err := suite.manager.HomeTimeline(suite.account, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+
+	// the cached statuses of the followed account stop showing as soon as it's unfollowed
+	suite.following = []model.Follow{}
+	statuses, err := suite.manager.HomeTimeline(suite.account, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{own.ID}, ids(statuses))
+	assert.Len(suite.T(), suite.manager.home[suite.account.ID].statuses, len(posted)+2)
+}
+
+func (suite *HomeTestSuite) TestNewlyFollowedStatusesShowUp() {
+	// the stranger posted before being followed, so the database doesn't have it in the home timeline yet
+	old := suite.post(suite.stranger, &model.Visibility{Public: true, Followers: true})
+	suite.statuses = suite.statuses[1:]
+	posted := suite.postPublic(5)
+	statuses, err := suite.manager.HomeTimeline(suite.account, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids(posted), ids(statuses))
+
+	suite.following = append(suite.following, model.Follow{AccountID: suite.account.ID, TargetAccountID: suite.stranger.ID})
+	suite.statuses = append(suite.statuses, old)
+	statuses, err = suite.manager.HomeTimeline(suite.account, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), append(ids(posted), old.ID), ids(statuses))
+}
+
+func (suite *HomeTestSuite) TestIdleTimelinesDropped() {
+	suite.postPublic(5)
+	_, err := suite.manager.HomeTimeline(suite.account, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+
+	suite.manager.home[suite.account.ID].lastUsed = time.Now().Add(-2 * homeTimelineIdle)
+	suite.manager.lastSweep = time.Time{}
+	suite.manager.homeTimeline(suite.followed.ID)
+	assert.NotContains(suite.T(), suite.manager.home, suite.account.ID)
+}
+
+func TestHomeTestSuite(t *testing.T) {
+	suite.Run(t, new(HomeTestSuite))
+}
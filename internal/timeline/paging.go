@@ -0,0 +1,145 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package timeline
+
+import (
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+// fetchFunc reads a batch of up to limit statuses of a timeline from the database, newest first. maxID and minID page
+// through the timeline the same way they do for db.GetStatusesByTimeDescending.
+type fetchFunc func(statuses *[]model.Status, limit int, maxID string, minID string) error
+
+// filter decides which of the statuses read from the database for a timeline are shown to the account viewing it.
+type filter interface {
+	show(s *model.Status) (bool, error)
+}
+
+// resolveCursors gets the statuses with the given maxID and sinceID or minID, so we know where they fall in the timeline
+// being paged through. upper is the status with maxID, and lower the one with minID if that's set, or sinceID otherwise;
+// either is nil if its id isn't set.
+func (m *manager) resolveCursors(maxID string, sinceID string, minID string) (upper *model.Status, lower *model.Status, err error) {
+	if maxID != "" {
+		upper = &model.Status{}
+		if err := m.db.GetByID(maxID, upper); err != nil {
+			return nil, nil, err
+		}
+	}
+	lowerID := sinceID
+	if minID != "" {
+		lowerID = minID
+	}
+	if lowerID != "" {
+		lower = &model.Status{}
+		if err := m.db.GetByID(lowerID, lower); err != nil {
+			return nil, nil, err
+		}
+	}
+	return upper, lower, nil
+}
+
+// downFromDB reads up to limit statuses of a timeline that are older than the status with the given id, if it's set, and
+// newer than lower, straight from the database, newest first.
+func downFromDB(fetch fetchFunc, f filter, maxID string, lower *model.Status, limit int) ([]*model.Status, error) {
+	statuses := []*model.Status{}
+	for len(statuses) < limit {
+		batch := []model.Status{}
+		if err := fetch(&batch, fetchSize, maxID, ""); err != nil {
+			if _, ok := err.(db.ErrNoEntries); ok {
+				break
+			}
+			return nil, err
+		}
+		for _, s := range pointers(batch) {
+			if lower != nil && !s.CreatedAt.After(lower.CreatedAt) {
+				return statuses, nil
+			}
+			show, err := f.show(s)
+			if err != nil {
+				return nil, err
+			}
+			if show {
+				statuses = append(statuses, s)
+				if len(statuses) == limit {
+					return statuses, nil
+				}
+			}
+		}
+		if len(batch) < fetchSize {
+			break
+		}
+		maxID = batch[len(batch)-1].ID
+	}
+	return statuses, nil
+}
+
+// upFromDB reads up to limit statuses of a timeline that are immediately newer than lower, and older than upper,
+// straight from the database, newest first.
+func upFromDB(fetch fetchFunc, f filter, upper *model.Status, lower *model.Status, limit int) ([]*model.Status, error) {
+	statuses := []*model.Status{}
+	minID := lower.ID
+	for len(statuses) < limit {
+		batch := []model.Status{}
+		if err := fetch(&batch, fetchSize, "", minID); err != nil {
+			if _, ok := err.(db.ErrNoEntries); ok {
+				break
+			}
+			return nil, err
+		}
+		done := len(batch) < fetchSize
+		// the batch is newest first, but we're working our way up from lower
+		for i := len(batch) - 1; i >= 0 && len(statuses) < limit; i-- {
+			s := &batch[i]
+			if upper != nil && !s.CreatedAt.Before(upper.CreatedAt) {
+				done = true
+				break
+			}
+			show, err := f.show(s)
+			if err != nil {
+				return nil, err
+			}
+			if show {
+				statuses = append(statuses, s)
+			}
+		}
+		if done || len(batch) == 0 {
+			break
+		}
+		minID = batch[0].ID
+	}
+	reverse(statuses)
+	return statuses, nil
+}
+
+// pointers returns pointers to the statuses in the given slice.
+func pointers(statuses []model.Status) []*model.Status {
+	ptrs := make([]*model.Status, 0, len(statuses))
+	for i := range statuses {
+		ptrs = append(ptrs, &statuses[i])
+	}
+	return ptrs
+}
+
+// reverse reverses the given slice of statuses in place.
+func reverse(statuses []*model.Status) {
+	for i, j := 0, len(statuses)-1; i < j; i, j = i+1, j-1 {
+		statuses[i], statuses[j] = statuses[j], statuses[i]
+	}
+}
@@ -0,0 +1,55 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package timeline
+
+import (
+	"fmt"
+
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+func (m *manager) PublicTimeline(account *model.Account, local bool, onlyMedia bool, maxID string, sinceID string, minID string, limit int) ([]*model.Status, error) {
+	upper, lower, err := m.resolveCursors(maxID, sinceID, minID)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := m.newPublicFilter(account)
+	if err != nil {
+		return nil, err
+	}
+
+	// the public timeline isn't cached, since there's only the one for everyone and it's mostly paged through from the top
+	fetch := func(statuses *[]model.Status, limit int, maxID string, minID string) error {
+		err := m.db.GetPublicTimelineStatuses(local, onlyMedia, statuses, limit, maxID, minID)
+		if _, ok := err.(db.ErrNoEntries); err != nil && !ok {
+			return fmt.Errorf("error getting public timeline: %s", err)
+		}
+		return err
+	}
+	if minID != "" {
+		return upFromDB(fetch, f, upper, lower, limit)
+	}
+	upperID := ""
+	if upper != nil {
+		upperID = upper.ID
+	}
+	return downFromDB(fetch, f, upperID, lower, limit)
+}
@@ -0,0 +1,314 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package timeline
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+)
+
+type PublicTestSuite struct {
+	suite.Suite
+	log      *logrus.Logger
+	account  *model.Account
+	followed *model.Account
+	author   *model.Account
+	silenced *model.Account
+	blocked  *model.Account
+	muted    *model.Account
+	// mutedFollowed is followed by account, but muted by it too
+	mutedFollowed *model.Account
+	// quiet is on a silenced domain, and followed by account
+	quiet *model.Account
+	// loud is on a domain that isn't silenced
+	loud *model.Account
+	// accounts that the mock db has, by id
+	accounts map[string]*model.Account
+	// statuses that the mock db has, newest first
+	statuses []*model.Status
+	// media holds the ids of the statuses that have media attached
+	media           map[string]bool
+	mockDB          *db.MockDB
+	mockDistributor *distributor.MockDistributor
+	manager         *manager
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *PublicTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	suite.account = &model.Account{ID: "2b6d3f1c-5d43-4c8b-9c8e-6f5d1c2b3a41", Username: "local_user"}
+	suite.followed = &model.Account{ID: "0f1e2d3c-4b5a-4968-8776-a5b4c3d2e1f0", Username: "followed", SilencedAt: time.Now()}
+	suite.author = &model.Account{ID: "8a7c1e2d-3b4f-4e5a-8c9d-0e1f2a3b4c5d", Username: "author"}
+	suite.silenced = &model.Account{ID: "3e4f5a6b-7c8d-4e9f-a0b1-c2d3e4f5a6b7", Username: "silenced", SilencedAt: time.Now()}
+	suite.blocked = &model.Account{ID: "7c1e9a0b-2d3f-4a5b-8c6d-9e0f1a2b3c4d", Username: "blocked"}
+	suite.muted = &model.Account{ID: "5f4e3d2c-1b0a-4f9e-8d7c-6b5a4f3e2d1c", Username: "muted"}
+	suite.mutedFollowed = &model.Account{ID: "6a5b4c3d-2e1f-4a0b-9c8d-7e6f5a4b3c2d", Username: "muted_followed"}
+	suite.quiet = &model.Account{ID: "9d8c7b6a-5f4e-4d3c-8b2a-1f0e9d8c7b6a", Username: "quiet", Domain: "silenced.example"}
+	suite.loud = &model.Account{ID: "1a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d", Username: "loud", Domain: "example.org"}
+	suite.accounts = make(map[string]*model.Account)
+	for _, a := range []*model.Account{suite.account, suite.followed, suite.author, suite.silenced, suite.blocked, suite.muted, suite.mutedFollowed, suite.quiet, suite.loud} {
+		suite.accounts[a.ID] = a
+	}
+}
+
+// SetupTest creates a fresh mock db with no statuses in it, and a fresh manager, for each test
+func (suite *PublicTestSuite) SetupTest() {
+	suite.statuses = []*model.Status{}
+	suite.media = make(map[string]bool)
+
+	suite.mockDB = &db.MockDB{}
+	suite.mockDB.On("GetPublicTimelineStatuses", mock.AnythingOfType("bool"), mock.AnythingOfType("bool"), mock.AnythingOfType("*[]model.Status"), mock.AnythingOfType("int"), mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(suite.getPublicTimelineStatuses)
+	suite.mockDB.On("GetByID", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Status")).Return(func(id string, i interface{}) error {
+		for _, s := range suite.statuses {
+			if s.ID == id {
+				*i.(*model.Status) = *s
+				return nil
+			}
+		}
+		return db.ErrNoEntries{}
+	})
+	suite.mockDB.On("GetByID", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Account")).Return(func(id string, i interface{}) error {
+		a, ok := suite.accounts[id]
+		if !ok {
+			return db.ErrNoEntries{}
+		}
+		*i.(*model.Account) = *a
+		return nil
+	})
+	suite.mockDB.On("GetFollowingByAccountID", suite.account.ID, mock.AnythingOfType("*[]model.Follow")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(1).(*[]model.Follow) = []model.Follow{
+			{AccountID: suite.account.ID, TargetAccountID: suite.followed.ID},
+			{AccountID: suite.account.ID, TargetAccountID: suite.quiet.ID},
+			{AccountID: suite.account.ID, TargetAccountID: suite.mutedFollowed.ID},
+		}
+	})
+	suite.mockDB.On("GetWhere", "account_id", suite.account.ID, mock.AnythingOfType("*[]model.Block")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*[]model.Block) = []model.Block{{AccountID: suite.account.ID, TargetAccountID: suite.blocked.ID}}
+	})
+	suite.mockDB.On("GetWhere", "target_account_id", suite.account.ID, mock.AnythingOfType("*[]model.Block")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetWhere", "account_id", suite.account.ID, mock.AnythingOfType("*[]model.Mute")).Return(nil).Run(func(args mock.Arguments) {
+		*args.Get(2).(*[]model.Mute) = []model.Mute{
+			{AccountID: suite.account.ID, TargetAccountID: suite.muted.ID},
+			{AccountID: suite.account.ID, TargetAccountID: suite.mutedFollowed.ID},
+		}
+	})
+	// nobody else follows, blocks or mutes anyone
+	suite.mockDB.On("GetFollowingByAccountID", mock.AnythingOfType("string"), mock.AnythingOfType("*[]model.Follow")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetWhere", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("*[]model.Block")).Return(db.ErrNoEntries{})
+	suite.mockDB.On("GetWhere", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("*[]model.Mute")).Return(db.ErrNoEntries{})
+
+	suite.mockDistributor = &distributor.MockDistributor{}
+	suite.mockDistributor.On("Register", mock.Anything, mock.Anything).Return()
+
+	suite.manager = New(suite.mockDB, suite.mockDistributor, silencedDomains{"silenced.example": true}, suite.log).(*manager)
+}
+
+// getPublicTimelineStatuses picks the statuses of the suite that are in the public timeline, and pages through them the way the database does.
+func (suite *PublicTestSuite) getPublicTimelineStatuses(local bool, onlyMedia bool, statuses *[]model.Status, limit int, maxID string, minID string) error {
+	public := []*model.Status{}
+	for _, s := range suite.statuses {
+		if !s.Visibility.Public || s.BoostOfID != "" {
+			continue
+		}
+		if local && !(s.Local && s.Visibility.Local) {
+			continue
+		}
+		if onlyMedia && !suite.media[s.ID] {
+			continue
+		}
+		public = append(public, s)
+	}
+	return page(public, statuses, limit, maxID, minID)
+}
+
+// silencedDomains is a Domains that silences the domains that are true in it.
+type silencedDomains map[string]bool
+
+func (d silencedDomains) DomainSilenced(host string) (bool, error) {
+	return d[host], nil
+}
+
+// post adds a new public status by the given account to the top of the statuses of the suite, and returns it
+func (suite *PublicTestSuite) post(account *model.Account, local bool) *model.Status {
+	s := &model.Status{
+		ID:         fmt.Sprintf("00000000-0000-4000-8000-%012d", len(suite.statuses)),
+		AccountID:  account.ID,
+		Local:      local,
+		CreatedAt:  time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(len(suite.statuses)) * time.Minute),
+		Visibility: &model.Visibility{Public: true, Local: local, Followers: true},
+	}
+	suite.statuses = append([]*model.Status{s}, suite.statuses...)
+	return s
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *PublicTestSuite) TestLocalAndFederated() {
+	remote := suite.post(suite.author, false)
+	local := suite.post(suite.author, true)
+	unlisted := suite.post(suite.author, true)
+	unlisted.Visibility = &model.Visibility{Unlisted: true, Followers: true}
+	boost := suite.post(suite.author, true)
+	boost.BoostOfID = local.ID
+
+	statuses, err := suite.manager.PublicTimeline(nil, false, false, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids([]*model.Status{local, remote}), ids(statuses))
+
+	statuses, err = suite.manager.PublicTimeline(nil, true, false, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids([]*model.Status{local}), ids(statuses))
+}
+
+func (suite *PublicTestSuite) TestOnlyMedia() {
+	withMedia := suite.post(suite.author, true)
+	suite.media[withMedia.ID] = true
+	suite.post(suite.author, true)
+
+	statuses, err := suite.manager.PublicTimeline(nil, false, true, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids([]*model.Status{withMedia}), ids(statuses))
+}
+
+func (suite *PublicTestSuite) TestLocalOnlyNeedsLogin() {
+	localOnly := suite.post(suite.author, true)
+	localOnly.Visibility.LocalOnly = true
+	federated := suite.post(suite.author, true)
+
+	statuses, err := suite.manager.PublicTimeline(nil, true, false, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids([]*model.Status{federated}), ids(statuses))
+
+	statuses, err = suite.manager.PublicTimeline(suite.account, true, false, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids([]*model.Status{federated, localOnly}), ids(statuses))
+}
+
+func (suite *PublicTestSuite) TestSilencedAccounts() {
+	bySilenced := suite.post(suite.silenced, false)
+	byFollowed := suite.post(suite.followed, false)
+	byAuthor := suite.post(suite.author, false)
+
+	// silenced accounts are only seen by their followers
+	statuses, err := suite.manager.PublicTimeline(nil, false, false, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids([]*model.Status{byAuthor}), ids(statuses))
+
+	statuses, err = suite.manager.PublicTimeline(suite.account, false, false, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids([]*model.Status{byAuthor, byFollowed}), ids(statuses))
+
+	// and by themselves
+	statuses, err = suite.manager.PublicTimeline(suite.silenced, false, false, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids([]*model.Status{byAuthor, bySilenced}), ids(statuses))
+}
+
+func (suite *PublicTestSuite) TestSilencedDomains() {
+	byQuiet := suite.post(suite.quiet, false)
+	byLoud := suite.post(suite.loud, false)
+
+	// statuses from silenced domains are only seen by the followers of their authors
+	statuses, err := suite.manager.PublicTimeline(nil, false, false, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids([]*model.Status{byLoud}), ids(statuses))
+
+	statuses, err = suite.manager.PublicTimeline(suite.author, false, false, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids([]*model.Status{byLoud}), ids(statuses))
+
+	statuses, err = suite.manager.PublicTimeline(suite.account, false, false, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids([]*model.Status{byLoud, byQuiet}), ids(statuses))
+}
+
+func (suite *PublicTestSuite) TestBlocksMutesAndReplies() {
+	suite.post(suite.blocked, false)
+	suite.post(suite.muted, false)
+	reply := suite.post(suite.author, false)
+	reply.InReplyToID = "some-status"
+	reply.InReplyToAccountID = suite.followed.ID
+	thread := suite.post(suite.author, false)
+	thread.InReplyToID = "some-other-status"
+	thread.InReplyToAccountID = suite.author.ID
+	own := suite.post(suite.account, true)
+
+	statuses, err := suite.manager.PublicTimeline(suite.account, false, false, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids([]*model.Status{own, thread}), ids(statuses))
+}
+
+func (suite *PublicTestSuite) TestMutedEvenIfFollowed() {
+	suite.post(suite.mutedFollowed, false)
+	byFollowed := suite.post(suite.followed, false)
+
+	statuses, err := suite.manager.PublicTimeline(suite.account, false, false, "", "", "", 20)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids([]*model.Status{byFollowed}), ids(statuses))
+}
+
+func (suite *PublicTestSuite) TestPaging() {
+	for i := 0; i < 60; i++ {
+		s := suite.post(suite.author, true)
+		if i%2 == 0 {
+			s.AccountID = suite.silenced.ID
+		}
+	}
+	// the statuses by author, newest first
+	shown := []*model.Status{}
+	for _, s := range suite.statuses {
+		if s.AccountID == suite.author.ID {
+			shown = append(shown, s)
+		}
+	}
+
+	statuses, err := suite.manager.PublicTimeline(nil, false, false, shown[9].ID, "", "", 10)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids(shown[10:20]), ids(statuses))
+
+	statuses, err = suite.manager.PublicTimeline(nil, false, false, "", "", shown[25].ID, 10)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids(shown[15:25]), ids(statuses))
+
+	statuses, err = suite.manager.PublicTimeline(nil, false, false, shown[5].ID, shown[9].ID, "", 10)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), ids(shown[6:9]), ids(statuses))
+}
+
+func TestPublicTestSuite(t *testing.T) {
+	suite.Run(t, new(PublicTestSuite))
+}
@@ -0,0 +1,213 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package timeline assembles the timelines of statuses that accounts on this instance see through the client API.
+package timeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/superseriousbusiness/gotosocial/internal/db"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/distributor"
+)
+
+const (
+	// fetchSize is how many statuses are fetched from the database at a time to fill a timeline
+	fetchSize = 40
+	// maxCachedStatuses is the most statuses kept in memory for one home timeline; older ones are read from the database
+	maxCachedStatuses = 400
+	// homeTimelineIdle is how long a home timeline is kept in memory after it was last used
+	homeTimelineIdle = 10 * time.Minute
+	// sweepInterval is how often home timelines that haven't been used for a while are looked for
+	sweepInterval = time.Minute
+)
+
+// Manager assembles timelines for accounts on this instance, applying the visibility of statuses and the blocks and
+// mutes of the account viewing them.
+//
+// Home timelines are cached in memory per account, so that clients paging through them don't hit the database for every
+// page. Once a timeline is cached, new statuses are added to it as they're created, and the database is only read again
+// once paging goes past the end of what's cached, or the account has followed or unfollowed someone since the cache was
+// read. The cache only holds the statuses that could be in the timeline: which of them are actually shown is worked out
+// whenever a page is requested, so follows, blocks and mutes take effect straight away.
+type Manager interface {
+	// HomeTimeline returns up to limit statuses from the home timeline of the given account, newest first: statuses posted
+	// by the account itself and by the accounts it follows, along with the boosts they've made.
+	//
+	// maxID, sinceID and minID are optional, and page through the timeline the way the mastodon api does: only statuses
+	// older than maxID and newer than sinceID or minID are returned. If minID is set, the statuses immediately newer than it
+	// are returned, rather than the newest ones. If the status with one of the ids doesn't exist, db.ErrNoEntries is returned.
+	HomeTimeline(account *model.Account, maxID string, sinceID string, minID string, limit int) ([]*model.Status, error)
+
+	// PublicTimeline returns up to limit statuses from the public timeline, newest first: the public statuses known to this
+	// instance, leaving out boosts and replies to other accounts. If local is true, only statuses posted on this instance
+	// are returned, and if onlyMedia is true, only statuses with media attached. account is the account viewing the
+	// timeline, or nil if nobody is logged in. maxID, sinceID and minID page through the timeline the same way they do for
+	// HomeTimeline.
+	PublicTimeline(account *model.Account, local bool, onlyMedia bool, maxID string, sinceID string, minID string, limit int) ([]*model.Status, error)
+}
+
+// Domains tells the timeline manager which remote domains have been silenced, so that statuses from them can be kept off
+// the public timeline. It's implemented by the federator.
+type Domains interface {
+	// DomainSilenced returns true if statuses from the given host should be kept off public timelines.
+	DomainSilenced(host string) (bool, error)
+}
+
+// manager just implements the Manager interface
+type manager struct {
+	db      db.DB
+	domains Domains
+	log     *logrus.Logger
+
+	// homeMu guards home and lastSweep
+	homeMu    sync.Mutex
+	home      map[string]*homeTimeline
+	lastSweep time.Time
+}
+
+// homeTimeline is the cached home timeline of one account: a window of the newest statuses that could be in it.
+type homeTimeline struct {
+	sync.Mutex
+	// statuses could be in the timeline, newest first, with no gaps between them
+	statuses []*model.Status
+	// exhausted is true if there are no statuses older than the last one of statuses
+	exhausted bool
+	// loaded is true once the newest statuses have been read from the database; from then on new ones are added as they're created
+	loaded bool
+	// following holds the ids of the accounts that the account followed when the statuses were read from the database
+	following map[string]bool
+	// lastUsed is when a page of the timeline was last requested
+	lastUsed time.Time
+}
+
+// New returns a new timeline Manager, which registers handlers with the given distributor to keep its cached timelines up to date,
+// and checks with domains whether statuses from remote domains can be shown on the public timeline.
+func New(db db.DB, dist distributor.Distributor, domains Domains, log *logrus.Logger) Manager {
+	m := &manager{
+		db:      db,
+		domains: domains,
+		log:     log,
+		home:    make(map[string]*homeTimeline),
+	}
+	dist.Register(distributor.ActivityStatusCreated, m.addCreatedStatus)
+	dist.Register(distributor.ActivityStatusDeleted, m.removeDeletedStatus)
+	return m
+}
+
+// homeTimeline returns the cached home timeline of the account with the given id, creating an empty one if there isn't one yet.
+// Timelines that haven't been used for a while are dropped along the way.
+func (m *manager) homeTimeline(accountID string) *homeTimeline {
+	m.homeMu.Lock()
+	defer m.homeMu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) > sweepInterval {
+		for id, t := range m.home {
+			t.Lock()
+			idle := now.Sub(t.lastUsed) > homeTimelineIdle
+			t.Unlock()
+			if idle {
+				delete(m.home, id)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	t, ok := m.home[accountID]
+	if !ok {
+		t = &homeTimeline{}
+		m.home[accountID] = t
+	}
+	return t
+}
+
+// cachedHomeTimelines returns the home timelines that are currently cached, by account id.
+func (m *manager) cachedHomeTimelines() map[string]*homeTimeline {
+	m.homeMu.Lock()
+	defer m.homeMu.Unlock()
+	timelines := make(map[string]*homeTimeline, len(m.home))
+	for id, t := range m.home {
+		timelines[id] = t
+	}
+	return timelines
+}
+
+// addCreatedStatus adds a new status, or boost, to the cached home timelines of its author and of the accounts that follow
+// its author. Whether it's actually shown in them is still worked out when a page is requested.
+func (m *manager) addCreatedStatus(ctx context.Context, msg distributor.Message) error {
+	created, ok := msg.(distributor.StatusCreated)
+	if !ok {
+		return fmt.Errorf("expected StatusCreated but got %T", msg)
+	}
+	cached := m.cachedHomeTimelines()
+	if len(cached) == 0 {
+		return nil
+	}
+
+	timelines := []*homeTimeline{}
+	if t, ok := cached[created.Status.AccountID]; ok {
+		timelines = append(timelines, t)
+	}
+	followers := []model.Follow{}
+	if err := m.db.GetFollowersByAccountID(created.Status.AccountID, &followers); err != nil {
+		if _, ok := err.(db.ErrNoEntries); !ok {
+			return fmt.Errorf("error getting followers of account %s: %s", created.Status.AccountID, err)
+		}
+	}
+	for _, follow := range followers {
+		if t, ok := cached[follow.AccountID]; ok {
+			timelines = append(timelines, t)
+		}
+	}
+
+	// the timelines share one copy of the status, which nobody changes
+	status := *created.Status
+	for _, t := range timelines {
+		t.Lock()
+		t.insert(&status)
+		t.Unlock()
+	}
+	return nil
+}
+
+// removeDeletedStatus removes a deleted status, and any boosts of it, from the cached home timelines.
+func (m *manager) removeDeletedStatus(ctx context.Context, msg distributor.Message) error {
+	deleted, ok := msg.(distributor.StatusDeleted)
+	if !ok {
+		return fmt.Errorf("expected StatusDeleted but got %T", msg)
+	}
+
+	for _, t := range m.cachedHomeTimelines() {
+		t.Lock()
+		kept := t.statuses[:0]
+		for _, s := range t.statuses {
+			if s.ID != deleted.Status.ID && s.BoostOfID != deleted.Status.ID {
+				kept = append(kept, s)
+			}
+		}
+		t.statuses = kept
+		t.Unlock()
+	}
+	return nil
+}
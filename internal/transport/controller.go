@@ -0,0 +1,90 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package transport
+
+import (
+	"crypto"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/sirupsen/logrus"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+)
+
+const (
+	// requestTimeout is the maximum amount of time a single request made by a transport may take, including reading the response.
+	requestTimeout = 30 * time.Second
+	// maxResponseSize is the maximum size in bytes of a response body that a transport will accept.
+	maxResponseSize = 2 << 20 // 2mb
+	// maxConcurrentDeliveries is the maximum number of deliveries that a single BatchDeliver call will have in flight at once.
+	maxConcurrentDeliveries = 10
+)
+
+// Controller generates transports for use in making federation requests to other servers.
+type Controller interface {
+	// NewTransport returns a new Transport that signs requests with the given private key, using pubKeyID as the keyId of the signature.
+	NewTransport(pubKeyID string, privkey crypto.PrivateKey) (Transport, error)
+}
+
+type controller struct {
+	config *config.Config
+	clock  pub.Clock
+	client pub.HttpClient
+	log    *logrus.Logger
+}
+
+// NewController returns an implementation of the Controller interface for creating new transports.
+// If client is nil, a default http client with a sensible timeout will be used.
+func NewController(config *config.Config, clock pub.Clock, client pub.HttpClient, log *logrus.Logger) Controller {
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+	return &controller{
+		config: config,
+		clock:  clock,
+		client: client,
+		log:    log,
+	}
+}
+
+// NewTransport returns a new Transport that signs requests with the given private key, using pubKeyID as the keyId of the signature.
+func (c *controller) NewTransport(pubKeyID string, privkey crypto.PrivateKey) (Transport, error) {
+	getSigner, postSigner, err := newSigners()
+	if err != nil {
+		return nil, err
+	}
+
+	return &transport{
+		client:          c.client,
+		clock:           c.clock,
+		userAgent:       fmt.Sprintf("%s (+%s://%s/)", c.config.ApplicationName, c.config.Protocol, c.config.Host),
+		pubKeyID:        pubKeyID,
+		privkey:         privkey,
+		getSigner:       getSigner,
+		getSignerMu:     &sync.Mutex{},
+		postSigner:      postSigner,
+		postSignerMu:    &sync.Mutex{},
+		maxResponseSize: maxResponseSize,
+		maxConcurrency:  maxConcurrentDeliveries,
+		log:             c.log,
+	}, nil
+}
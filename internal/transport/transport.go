@@ -0,0 +1,217 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package transport provides signed http transports for federating with other servers on behalf of local accounts.
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/httpsig"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	acceptHeaderValue      = `application/activity+json, application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+	contentTypeHeaderValue = `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+)
+
+// Transport wraps the go-fed pub.Transport interface, so that it can be extended with gts-specific functionality later on.
+type Transport interface {
+	pub.Transport
+}
+
+// ResponseError is returned when a remote server answers a request with a status code that means it wasn't successful.
+type ResponseError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("%s request to %s failed (%d): %s", e.Method, e.URL, e.StatusCode, e.Status)
+}
+
+// Permanent returns true if trying the same request again won't help: the server rejected the request itself,
+// rather than being unable to deal with it right now.
+func (e *ResponseError) Permanent() bool {
+	return e.StatusCode >= 400 && e.StatusCode < 500 && e.StatusCode != http.StatusRequestTimeout && e.StatusCode != http.StatusTooManyRequests
+}
+
+// transport implements the Transport interface, signing every request it makes with the key of a single local account.
+// Signers aren't safe to use from multiple goroutines, so access to them is guarded by a mutex.
+type transport struct {
+	client          pub.HttpClient
+	clock           pub.Clock
+	userAgent       string
+	pubKeyID        string
+	privkey         crypto.PrivateKey
+	getSigner       httpsig.Signer
+	getSignerMu     *sync.Mutex
+	postSigner      httpsig.Signer
+	postSignerMu    *sync.Mutex
+	maxResponseSize int64
+	maxConcurrency  int
+	log             *logrus.Logger
+}
+
+// Dereference sends a GET request signed with an http signature to obtain an ActivityStreams value.
+// Responses bigger than maxResponseSize will be rejected.
+func (t *transport) Dereference(ctx context.Context, iri *url.URL) ([]byte, error) {
+	l := t.log.WithField("func", "Dereference")
+	l.Debugf("performing GET to %s", iri.String())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, iri.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", acceptHeaderValue)
+	req.Header.Set("Accept-Charset", "utf-8")
+	t.setCommonHeaders(req)
+
+	t.getSignerMu.Lock()
+	err = t.getSigner.SignRequest(t.privkey, t.pubKeyID, req, nil)
+	t.getSignerMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("error signing GET request to %s: %s", iri.String(), err)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GET request to %s failed: %s", iri.String(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &ResponseError{Method: http.MethodGet, URL: iri.String(), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	// read one byte more than we allow, so we can tell if the response was too big
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, t.maxResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response from %s: %s", iri.String(), err)
+	}
+	if int64(len(b)) > t.maxResponseSize {
+		return nil, fmt.Errorf("response from %s exceeded max size of %d bytes", iri.String(), t.maxResponseSize)
+	}
+	return b, nil
+}
+
+// Deliver sends a POST request signed with an http signature, containing the given ActivityStreams value.
+func (t *transport) Deliver(ctx context.Context, b []byte, to *url.URL) error {
+	l := t.log.WithField("func", "Deliver")
+	l.Debugf("performing POST to %s", to.String())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, to.String(), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypeHeaderValue)
+	req.Header.Set("Accept-Charset", "utf-8")
+	t.setCommonHeaders(req)
+
+	t.postSignerMu.Lock()
+	err = t.postSigner.SignRequest(t.privkey, t.pubKeyID, req, b)
+	t.postSignerMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error signing POST request to %s: %s", to.String(), err)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("POST request to %s failed: %s", to.String(), err)
+	}
+	defer resp.Body.Close()
+
+	// drain a limited amount of the body so the underlying connection can be reused
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, t.maxResponseSize))
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusAccepted {
+		return &ResponseError{Method: http.MethodPost, URL: to.String(), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
+
+// BatchDeliver sends the given ActivityStreams value to all recipients, with at most maxConcurrency
+// deliveries in flight at any one time. An error will be returned if any of the deliveries failed.
+func (t *transport) BatchDeliver(ctx context.Context, b []byte, recipients []*url.URL) error {
+	var (
+		wg     sync.WaitGroup
+		errsMu sync.Mutex
+		errs   []string
+		sem    = make(chan struct{}, t.maxConcurrency)
+	)
+
+	for _, recipient := range recipients {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(r *url.URL) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := t.Deliver(ctx, b, r); err != nil {
+				errsMu.Lock()
+				errs = append(errs, err.Error())
+				errsMu.Unlock()
+			}
+		}(recipient)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return fmt.Errorf("batch deliver had %d failure(s): %s", len(errs), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// setCommonHeaders sets the headers that every request made by this transport should carry.
+func (t *transport) setCommonHeaders(req *http.Request) {
+	req.Header.Set("Date", t.clock.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("User-Agent", t.userAgent)
+	// the host header isn't in the header map by default, but we need it there to sign it
+	req.Header.Set("Host", req.URL.Host)
+}
+
+// newSigners returns a signer for GET requests and a signer for POST requests.
+func newSigners() (getSigner httpsig.Signer, postSigner httpsig.Signer, err error) {
+	prefs := []httpsig.Algorithm{httpsig.RSA_SHA256}
+
+	getSigner, _, err = httpsig.NewSigner(prefs, httpsig.DigestSha256, []string{httpsig.RequestTarget, "host", "date"}, httpsig.Signature, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating get signer: %s", err)
+	}
+
+	postSigner, _, err = httpsig.NewSigner(prefs, httpsig.DigestSha256, []string{httpsig.RequestTarget, "host", "date", "digest"}, httpsig.Signature, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating post signer: %s", err)
+	}
+
+	return getSigner, postSigner, nil
+}
@@ -0,0 +1,223 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-fed/httpsig"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/config"
+)
+
+type TransportTestSuite struct {
+	suite.Suite
+	log        *logrus.Logger
+	config     *config.Config
+	privkey    *rsa.PrivateKey
+	pubKeyID   string
+	controller Controller
+}
+
+type testClock struct{}
+
+func (c testClock) Now() time.Time {
+	return time.Now()
+}
+
+/*
+	TEST INFRASTRUCTURE
+*/
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *TransportTestSuite) SetupSuite() {
+	log := logrus.New()
+	log.SetLevel(logrus.TraceLevel)
+	suite.log = log
+
+	c := config.Empty()
+	c.ApplicationName = "gotosocial"
+	c.Protocol = "https"
+	c.Host = "example.org"
+	suite.config = c
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	suite.privkey = key
+	suite.pubKeyID = "https://example.org/users/test_user#main-key"
+
+	suite.controller = NewController(c, testClock{}, nil, log)
+}
+
+// newTransport returns a concrete transport so that tests can tweak its limits
+func (suite *TransportTestSuite) newTransport() *transport {
+	t, err := suite.controller.NewTransport(suite.pubKeyID, suite.privkey)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	return t.(*transport)
+}
+
+// verify checks the http signature on the given request against our test key
+func (suite *TransportTestSuite) verify(r *http.Request) error {
+	v, err := httpsig.NewVerifier(r)
+	if err != nil {
+		return err
+	}
+	if v.KeyId() != suite.pubKeyID {
+		return fmt.Errorf("unexpected key id %s", v.KeyId())
+	}
+	return v.Verify(&suite.privkey.PublicKey, httpsig.RSA_SHA256)
+}
+
+/*
+	ACTUAL TESTS
+*/
+
+func (suite *TransportTestSuite) TestDeliverSigned() {
+	var verifyErr error
+	var userAgent, digest string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verifyErr = suite.verify(r)
+		userAgent = r.Header.Get("User-Agent")
+		digest = r.Header.Get("Digest")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	to, _ := url.Parse(server.URL + "/users/someone/inbox")
+	err := suite.newTransport().Deliver(context.Background(), []byte(`{"type":"Create"}`), to)
+	suite.NoError(err)
+	suite.NoError(verifyErr)
+	suite.Equal("gotosocial (+https://example.org/)", userAgent)
+	suite.True(strings.HasPrefix(digest, "SHA-256="))
+}
+
+func (suite *TransportTestSuite) TestDeliverFailure() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	to, _ := url.Parse(server.URL + "/users/someone/inbox")
+	err := suite.newTransport().Deliver(context.Background(), []byte(`{"type":"Create"}`), to)
+	suite.Error(err)
+}
+
+func (suite *TransportTestSuite) TestDereferenceSigned() {
+	var verifyErr error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verifyErr = suite.verify(r)
+		w.Write([]byte(`{"type":"Note"}`))
+	}))
+	defer server.Close()
+
+	iri, _ := url.Parse(server.URL + "/notes/1")
+	b, err := suite.newTransport().Dereference(context.Background(), iri)
+	suite.NoError(err)
+	suite.NoError(verifyErr)
+	suite.Equal(`{"type":"Note"}`, string(b))
+}
+
+func (suite *TransportTestSuite) TestDereferenceTooBig() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 1025)))
+	}))
+	defer server.Close()
+
+	t := suite.newTransport()
+	t.maxResponseSize = 1024
+
+	iri, _ := url.Parse(server.URL + "/notes/1")
+	_, err := t.Dereference(context.Background(), iri)
+	suite.Error(err)
+}
+
+func (suite *TransportTestSuite) TestBatchDeliverBoundedConcurrency() {
+	var (
+		mu          sync.Mutex
+		inFlight    int
+		maxInFlight int
+		delivered   int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		delivered++
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	recipients := []*url.URL{}
+	for i := 0; i < 20; i++ {
+		r, _ := url.Parse(fmt.Sprintf("%s/users/someone_%d/inbox", server.URL, i))
+		recipients = append(recipients, r)
+	}
+
+	t := suite.newTransport()
+	t.maxConcurrency = 3
+	err := t.BatchDeliver(context.Background(), []byte(`{"type":"Create"}`), recipients)
+	suite.NoError(err)
+	suite.Equal(20, delivered)
+	suite.LessOrEqual(maxInFlight, 3)
+}
+
+func (suite *TransportTestSuite) TestBatchDeliverPartialFailure() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "broken") {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ok, _ := url.Parse(server.URL + "/users/fine/inbox")
+	broken, _ := url.Parse(server.URL + "/users/broken/inbox")
+	err := suite.newTransport().BatchDeliver(context.Background(), []byte(`{"type":"Create"}`), []*url.URL{ok, broken})
+	suite.Error(err)
+	suite.Contains(err.Error(), "broken")
+}
+
+func TestTransportTestSuite(t *testing.T) {
+	suite.Run(t, new(TransportTestSuite))
+}
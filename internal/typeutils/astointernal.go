@@ -0,0 +1,319 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package typeutils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/formatter"
+)
+
+// ASRepresentationToAccount converts a remote account/person/application representation into a gts model account.
+// The returned account will not yet have an ID, and it will not have been put in the database.
+func ASRepresentationToAccount(accountable Accountable) (*model.Account, error) {
+	// the id of the account is the one thing we really can't do without
+	uriProp := accountable.GetJSONLDId()
+	if uriProp == nil || !uriProp.IsIRI() {
+		return nil, errors.New("no id property found on person, or id was not an iri")
+	}
+	uri := uriProp.GetIRI()
+
+	acct := &model.Account{}
+	acct.URI = uri.String()
+
+	// Username aka preferredUsername
+	// We need this one so bail if it's not set.
+	username, err := extractPreferredUsername(accountable)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't extract username: %s", err)
+	}
+	acct.Username = username
+
+	// Domain
+	acct.Domain = uri.Host
+
+	// avatar aka icon
+	// header aka image
+	// we only keep track of where they are; the files themselves are fetched separately
+	if avatarURL, err := extractIconURL(accountable); err == nil {
+		acct.AvatarRemoteURL = avatarURL
+	}
+	if headerURL, err := extractImageURL(accountable); err == nil {
+		acct.HeaderRemoteURL = headerURL
+	}
+
+	// DisplayName aka name
+	// we default to the username, but take the more nuanced name property if it exists
+	acct.DisplayName = username
+	if displayName, err := extractName(accountable); err == nil {
+		acct.DisplayName = displayName
+	}
+
+	// Note aka summary
+	if note, err := extractSummary(accountable); err == nil {
+		acct.Note = note
+	}
+
+	// Fields aka PropertyValue attachments
+	acct.Fields = extractFields(accountable)
+
+	// Locked aka manuallyApprovesFollowers
+	acct.Locked = extractManuallyApprovesFollowers(accountable)
+
+	// Discoverable
+	acct.Discoverable = extractDiscoverable(accountable)
+
+	// check for bot and actor type
+	switch accountable.GetTypeName() {
+	case "Person", "Group", "Organization":
+		// people, groups, and organizations aren't bots
+		acct.Bot = false
+	case "Application", "Service":
+		// apps and services are
+		acct.Bot = true
+	default:
+		// we don't know what this is!
+		return nil, fmt.Errorf("type name %s not recognised or not convertible to an account", accountable.GetTypeName())
+	}
+	acct.ActorType = accountable.GetTypeName()
+
+	// URL
+	if url, err := extractURL(accountable); err == nil {
+		acct.URL = url.String()
+	}
+
+	// InboxURL
+	if accountable.GetActivityStreamsInbox() != nil && accountable.GetActivityStreamsInbox().GetIRI() != nil {
+		acct.InboxURL = accountable.GetActivityStreamsInbox().GetIRI().String()
+	}
+
+	// OutboxURL
+	if accountable.GetActivityStreamsOutbox() != nil && accountable.GetActivityStreamsOutbox().GetIRI() != nil {
+		acct.OutboxURL = accountable.GetActivityStreamsOutbox().GetIRI().String()
+	}
+
+	// SharedInboxURL aka endpoints.sharedInbox
+	// only trust a shared inbox on the account's own host, otherwise deliveries meant for the
+	// account could be redirected to some other server
+	if sharedInbox, err := extractSharedInbox(accountable); err == nil && sharedInbox.Host == uri.Host {
+		acct.SharedInboxURL = sharedInbox.String()
+	}
+
+	// FollowersURL
+	if accountable.GetActivityStreamsFollowers() != nil && accountable.GetActivityStreamsFollowers().GetIRI() != nil {
+		acct.FollowersURL = accountable.GetActivityStreamsFollowers().GetIRI().String()
+	}
+
+	// FollowingURL
+	if accountable.GetActivityStreamsFollowing() != nil && accountable.GetActivityStreamsFollowing().GetIRI() != nil {
+		acct.FollowingURL = accountable.GetActivityStreamsFollowing().GetIRI().String()
+	}
+
+	// FeaturedURL aka featured
+	if accountable.GetTootFeatured() != nil && accountable.GetTootFeatured().GetIRI() != nil {
+		acct.FeaturedCollectionURL = accountable.GetTootFeatured().GetIRI().String()
+	}
+
+	// publicKey
+	pkey, pkeyURL, err := ExtractPublicKeyForOwner(accountable, uri)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get public key for person %s: %s", uri.String(), err)
+	}
+	acct.PublicKey = pkey
+	acct.PublicKeyURI = pkeyURL.String()
+
+	// alsoKnownAs
+	acct.AlsoKnownAs = extractAlsoKnownAs(accountable)
+
+	return acct, nil
+}
+
+// UpdateRemoteAccount copies everything that the server of a remote account tells us about it from fetched, which should have come
+// from ASRepresentationToAccount, onto the existing account. What's ours rather than theirs, such as the id of the account and any
+// moderation of it, is left alone. It returns true if the public key of the account has changed.
+func UpdateRemoteAccount(existing *model.Account, fetched *model.Account) bool {
+	keyChanged := existing.PublicKeyURI != fetched.PublicKeyURI ||
+		existing.PublicKey == nil ||
+		fetched.PublicKey == nil ||
+		!existing.PublicKey.Equal(fetched.PublicKey)
+
+	existing.DisplayName = fetched.DisplayName
+	existing.Note = fetched.Note
+	existing.Fields = fetched.Fields
+	existing.URL = fetched.URL
+	existing.Bot = fetched.Bot
+	existing.ActorType = fetched.ActorType
+	existing.Locked = fetched.Locked
+	existing.Discoverable = fetched.Discoverable
+	existing.AvatarRemoteURL = fetched.AvatarRemoteURL
+	existing.HeaderRemoteURL = fetched.HeaderRemoteURL
+	existing.InboxURL = fetched.InboxURL
+	existing.OutboxURL = fetched.OutboxURL
+	existing.SharedInboxURL = fetched.SharedInboxURL
+	existing.FollowersURL = fetched.FollowersURL
+	existing.FollowingURL = fetched.FollowingURL
+	existing.FeaturedCollectionURL = fetched.FeaturedCollectionURL
+	existing.AlsoKnownAs = fetched.AlsoKnownAs
+	existing.PublicKey = fetched.PublicKey
+	existing.PublicKeyURI = fetched.PublicKeyURI
+	return keyChanged
+}
+
+// ASStatusToStatus converts a remote activitystreams 'status' representation into a gts model status, posted by the given author.
+// The returned status will not yet have an ID, and it will not have been put in the database.
+// The caller is responsible for resolving the status it replies to, and setting InReplyToID on the returned status.
+func ASStatusToStatus(statusable Statusable, author *model.Account) (*model.Status, error) {
+	uriProp := statusable.GetJSONLDId()
+	if uriProp == nil || !uriProp.IsIRI() {
+		return nil, errors.New("no id property found on status, or id was not an iri")
+	}
+
+	status := &model.Status{}
+	status.URI = uriProp.GetIRI().String()
+
+	// URL
+	if url, err := extractURL(statusable); err == nil {
+		status.URL = url.String()
+	}
+
+	// Content, which we can't trust to be safe to serve
+	if content, err := ExtractContent(statusable); err == nil {
+		status.Content = formatter.SanitizeHTML(content)
+	}
+
+	// ContentWarning aka summary
+	if cw, err := extractSummary(statusable); err == nil {
+		status.ContentWarning = cw
+	}
+
+	// CreatedAt aka published
+	// if this isn't set we just assume the status was created when we first saw it
+	status.CreatedAt = time.Now()
+	if published, err := extractPublished(statusable); err == nil {
+		status.CreatedAt = published
+	}
+	status.UpdatedAt = status.CreatedAt
+
+	// Author
+	status.AccountID = author.ID
+	status.Local = author.Domain == ""
+
+	// Visibility
+	status.Visibility = visibilityFromAddressing(extractTo(statusable), extractCC(statusable), author.FollowersURL)
+
+	return status, nil
+}
+
+// ASAttachmentToAttachment converts a remote activitystreams attachment of a status into a gts model media attachment.
+// Only the remote url and metadata of the attachment are filled in: the media itself hasn't been fetched yet,
+// so the returned attachment will be in the 'received' processing state. The returned attachment will not yet
+// have an ID, and the caller is responsible for setting StatusID and AccountID on it.
+func ASAttachmentToAttachment(attachmentable Attachmentable) (*model.MediaAttachment, error) {
+	remoteURL, err := extractURL(attachmentable)
+	if err != nil {
+		return nil, fmt.Errorf("could not extract url of attachment: %s", err)
+	}
+
+	attachment := &model.MediaAttachment{
+		RemoteURL:  remoteURL.String(),
+		Processing: model.ProcessingStatusReceived,
+	}
+
+	// Description aka name
+	if name, err := extractName(attachmentable); err == nil {
+		attachment.Description = name
+	}
+
+	// Type, from the media type if we've got it, otherwise from the activitystreams type
+	mediaType, _ := extractMediaType(attachmentable)
+	attachment.File.ContentType = mediaType
+	switch {
+	case mediaType == "image/gif":
+		attachment.Type = model.FileTypeGif
+	case strings.HasPrefix(mediaType, "image/"), attachmentable.GetTypeName() == "Image":
+		attachment.Type = model.FileTypeImage
+	case strings.HasPrefix(mediaType, "video/"), attachmentable.GetTypeName() == "Video":
+		attachment.Type = model.FileTypeVideo
+	case strings.HasPrefix(mediaType, "audio/"), attachmentable.GetTypeName() == "Audio":
+		attachment.Type = model.FileTypeAudio
+	default:
+		return nil, fmt.Errorf("attachment %s with media type %q is not a type of media we support", attachment.RemoteURL, mediaType)
+	}
+
+	return attachment, nil
+}
+
+// ASBoostToStatus converts a remote activitystreams Announce into a gts model status that boosts another status.
+// The returned status will not yet have an ID, and it will not have been put in the database.
+// The caller is responsible for resolving the boosting account and the boosted status, and setting
+// AccountID and BoostOfID on the returned status.
+func ASBoostToStatus(announce vocab.ActivityStreamsAnnounce) (*model.Status, error) {
+	uriProp := announce.GetJSONLDId()
+	if uriProp == nil || !uriProp.IsIRI() {
+		return nil, errors.New("no id property found on announce, or id was not an iri")
+	}
+
+	status := &model.Status{}
+	status.URI = uriProp.GetIRI().String()
+
+	// CreatedAt aka published
+	status.CreatedAt = time.Now()
+	if published, err := extractPublished(announce); err == nil {
+		status.CreatedAt = published
+	}
+	status.UpdatedAt = status.CreatedAt
+
+	// Visibility
+	status.Visibility = visibilityFromAddressing(extractTo(announce), extractCC(announce), "")
+
+	return status, nil
+}
+
+// visibilityFromAddressing works out the visibility of a status from who it's addressed to.
+// Public statuses are addressed to the public collection directly, unlisted ones just cc it, and followers-only
+// ones are addressed to the author's followers collection. Anything else is a direct message to whoever is in to and cc.
+// If followersURI is empty, we can't tell followers-only and direct apart, so followers-only is assumed.
+func visibilityFromAddressing(to []*url.URL, cc []*url.URL, followersURI string) *model.Visibility {
+	switch {
+	case containsPublic(to):
+		return &model.Visibility{
+			Public:    true,
+			Followers: true,
+		}
+	case containsPublic(cc):
+		return &model.Visibility{
+			Unlisted:  true,
+			Followers: true,
+		}
+	case followersURI == "", containsIRI(to, followersURI), containsIRI(cc, followersURI):
+		return &model.Visibility{
+			Followers: true,
+		}
+	default:
+		return &model.Visibility{
+			Direct: true,
+		}
+	}
+}
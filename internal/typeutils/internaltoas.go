@@ -0,0 +1,745 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package typeutils
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+// AccountToAS converts a gts model account into an activitystreams Person, or a Service if the account is a bot,
+// suitable for serving to remote servers. Avatar and header are optional and may be nil, and sharedInboxURL will be
+// set as the sharedInbox of the account's endpoints if it's not empty. If the account has moved, movedToURI should be the
+// uri of the account it moved to.
+func AccountToAS(a *model.Account, avatar *model.MediaAttachment, header *model.MediaAttachment, sharedInboxURL string, movedToURI string) (vocab.Type, error) {
+	var person accountableBuilder
+	if a.Bot {
+		person = streams.NewActivityStreamsService()
+	} else {
+		person = streams.NewActivityStreamsPerson()
+	}
+
+	// id
+	uri, err := url.Parse(a.URI)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing account uri %s: %s", a.URI, err)
+	}
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(uri)
+	person.SetJSONLDId(idProp)
+
+	// preferredUsername
+	usernameProp := streams.NewActivityStreamsPreferredUsernameProperty()
+	usernameProp.SetXMLSchemaString(a.Username)
+	person.SetActivityStreamsPreferredUsername(usernameProp)
+
+	// name aka display name
+	if a.DisplayName != "" {
+		nameProp := streams.NewActivityStreamsNameProperty()
+		nameProp.AppendXMLSchemaString(a.DisplayName)
+		person.SetActivityStreamsName(nameProp)
+	}
+
+	// summary aka note
+	if a.Note != "" {
+		summaryProp := streams.NewActivityStreamsSummaryProperty()
+		summaryProp.AppendXMLSchemaString(a.Note)
+		person.SetActivityStreamsSummary(summaryProp)
+	}
+
+	// url
+	if a.URL != "" {
+		u, err := url.Parse(a.URL)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing account url %s: %s", a.URL, err)
+		}
+		urlProp := streams.NewActivityStreamsUrlProperty()
+		urlProp.AppendIRI(u)
+		person.SetActivityStreamsUrl(urlProp)
+	}
+
+	// inbox, outbox, followers, following and featured
+	collections := []struct {
+		name string
+		uri  string
+		set  func(*url.URL)
+	}{
+		{"inbox", a.InboxURL, func(u *url.URL) {
+			p := streams.NewActivityStreamsInboxProperty()
+			p.SetIRI(u)
+			person.SetActivityStreamsInbox(p)
+		}},
+		{"outbox", a.OutboxURL, func(u *url.URL) {
+			p := streams.NewActivityStreamsOutboxProperty()
+			p.SetIRI(u)
+			person.SetActivityStreamsOutbox(p)
+		}},
+		{"followers", a.FollowersURL, func(u *url.URL) {
+			p := streams.NewActivityStreamsFollowersProperty()
+			p.SetIRI(u)
+			person.SetActivityStreamsFollowers(p)
+		}},
+		{"following", a.FollowingURL, func(u *url.URL) {
+			p := streams.NewActivityStreamsFollowingProperty()
+			p.SetIRI(u)
+			person.SetActivityStreamsFollowing(p)
+		}},
+		{"featured", a.FeaturedCollectionURL, func(u *url.URL) {
+			p := streams.NewTootFeaturedProperty()
+			p.SetIRI(u)
+			person.SetTootFeatured(p)
+		}},
+	}
+	for _, c := range collections {
+		if c.uri == "" {
+			continue
+		}
+		u, err := url.Parse(c.uri)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s url %s: %s", c.name, c.uri, err)
+		}
+		c.set(u)
+	}
+
+	// publicKey
+	if a.PublicKey == nil {
+		return nil, errors.New("account has no public key")
+	}
+	publicKeyProp, err := publicKeyToAS(a, uri)
+	if err != nil {
+		return nil, err
+	}
+	person.SetW3IDSecurityV1PublicKey(publicKeyProp)
+
+	// icon aka avatar
+	if avatar != nil && avatar.File.Path != "" {
+		image, err := imageToAS(avatar)
+		if err != nil {
+			return nil, fmt.Errorf("error converting avatar: %s", err)
+		}
+		iconProp := streams.NewActivityStreamsIconProperty()
+		iconProp.AppendActivityStreamsImage(image)
+		person.SetActivityStreamsIcon(iconProp)
+	}
+
+	// image aka header
+	if header != nil && header.File.Path != "" {
+		image, err := imageToAS(header)
+		if err != nil {
+			return nil, fmt.Errorf("error converting header: %s", err)
+		}
+		imageProp := streams.NewActivityStreamsImageProperty()
+		imageProp.AppendActivityStreamsImage(image)
+		person.SetActivityStreamsImage(imageProp)
+	}
+
+	// go-fed doesn't know about manuallyApprovesFollowers, endpoints, alsoKnownAs or movedTo, so we set them as
+	// unknown properties, which will still be included when the person is serialized
+	unknown := person.GetUnknownProperties()
+	unknown["manuallyApprovesFollowers"] = a.Locked
+	if sharedInboxURL != "" {
+		unknown["endpoints"] = map[string]interface{}{
+			"sharedInbox": sharedInboxURL,
+		}
+	}
+	if len(a.AlsoKnownAs) != 0 {
+		alsoKnownAs := make([]interface{}, 0, len(a.AlsoKnownAs))
+		for _, uri := range a.AlsoKnownAs {
+			alsoKnownAs = append(alsoKnownAs, uri)
+		}
+		unknown["alsoKnownAs"] = alsoKnownAs
+	}
+	if movedToURI != "" {
+		unknown["movedTo"] = movedToURI
+	}
+
+	return person, nil
+}
+
+// publicKeyToAS returns a publicKey property for the given account, owned by the given account uri.
+func publicKeyToAS(a *model.Account, owner *url.URL) (vocab.W3IDSecurityV1PublicKeyProperty, error) {
+	keyURI, err := url.Parse(a.PublicKeyURI)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing public key uri %s: %s", a.PublicKeyURI, err)
+	}
+	keyBytes, err := x509.MarshalPKIXPublicKey(a.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling public key: %s", err)
+	}
+	keyPem := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: keyBytes,
+	})
+
+	publicKey := streams.NewW3IDSecurityV1PublicKey()
+
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(keyURI)
+	publicKey.SetJSONLDId(idProp)
+
+	ownerProp := streams.NewW3IDSecurityV1OwnerProperty()
+	ownerProp.SetIRI(owner)
+	publicKey.SetW3IDSecurityV1Owner(ownerProp)
+
+	pemProp := streams.NewW3IDSecurityV1PublicKeyPemProperty()
+	pemProp.Set(string(keyPem))
+	publicKey.SetW3IDSecurityV1PublicKeyPem(pemProp)
+
+	publicKeyProp := streams.NewW3IDSecurityV1PublicKeyProperty()
+	publicKeyProp.AppendW3IDSecurityV1PublicKey(publicKey)
+	return publicKeyProp, nil
+}
+
+// imageToAS returns an activitystreams Image pointing to the original file of the given media attachment.
+func imageToAS(m *model.MediaAttachment) (vocab.ActivityStreamsImage, error) {
+	u, err := url.Parse(m.File.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing url %s: %s", m.File.Path, err)
+	}
+
+	image := streams.NewActivityStreamsImage()
+
+	if m.File.ContentType != "" {
+		mediaTypeProp := streams.NewActivityStreamsMediaTypeProperty()
+		mediaTypeProp.Set(m.File.ContentType)
+		image.SetActivityStreamsMediaType(mediaTypeProp)
+	}
+
+	urlProp := streams.NewActivityStreamsUrlProperty()
+	urlProp.AppendIRI(u)
+	image.SetActivityStreamsUrl(urlProp)
+
+	return image, nil
+}
+
+// StatusToAS converts a gts model status into an activitystreams Note, suitable for serving to remote servers.
+// The account that authored the status must be provided. If the status is a reply, the status it replies to
+// should be provided as inReplyTo, otherwise inReplyTo can be nil.
+func StatusToAS(s *model.Status, author *model.Account, inReplyTo *model.Status) (vocab.ActivityStreamsNote, error) {
+	note := streams.NewActivityStreamsNote()
+
+	// id
+	uri, err := parseIRI(s.URI)
+	if err != nil {
+		return nil, err
+	}
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(uri)
+	note.SetJSONLDId(idProp)
+
+	// url
+	if s.URL != "" {
+		u, err := parseIRI(s.URL)
+		if err != nil {
+			return nil, err
+		}
+		urlProp := streams.NewActivityStreamsUrlProperty()
+		urlProp.AppendIRI(u)
+		note.SetActivityStreamsUrl(urlProp)
+	}
+
+	// attributedTo
+	authorURI, err := parseIRI(author.URI)
+	if err != nil {
+		return nil, err
+	}
+	attributedToProp := streams.NewActivityStreamsAttributedToProperty()
+	attributedToProp.AppendIRI(authorURI)
+	note.SetActivityStreamsAttributedTo(attributedToProp)
+
+	// inReplyTo
+	if inReplyTo != nil {
+		inReplyToURI, err := parseIRI(inReplyTo.URI)
+		if err != nil {
+			return nil, err
+		}
+		inReplyToProp := streams.NewActivityStreamsInReplyToProperty()
+		inReplyToProp.AppendIRI(inReplyToURI)
+		note.SetActivityStreamsInReplyTo(inReplyToProp)
+	}
+
+	// content
+	contentProp := streams.NewActivityStreamsContentProperty()
+	contentProp.AppendXMLSchemaString(s.Content)
+	note.SetActivityStreamsContent(contentProp)
+
+	// summary aka content warning
+	if s.ContentWarning != "" {
+		summaryProp := streams.NewActivityStreamsSummaryProperty()
+		summaryProp.AppendXMLSchemaString(s.ContentWarning)
+		note.SetActivityStreamsSummary(summaryProp)
+	}
+
+	// published
+	publishedProp := streams.NewActivityStreamsPublishedProperty()
+	publishedProp.Set(s.CreatedAt)
+	note.SetActivityStreamsPublished(publishedProp)
+
+	// to and cc
+	to, cc, err := addressingForVisibility(s.Visibility, author)
+	if err != nil {
+		return nil, err
+	}
+	toProp := streams.NewActivityStreamsToProperty()
+	for _, iri := range to {
+		toProp.AppendIRI(iri)
+	}
+	note.SetActivityStreamsTo(toProp)
+	ccProp := streams.NewActivityStreamsCcProperty()
+	for _, iri := range cc {
+		ccProp.AppendIRI(iri)
+	}
+	note.SetActivityStreamsCc(ccProp)
+
+	return note, nil
+}
+
+// CreateToAS wraps the given note, converted from the given status by StatusToAS, in an activitystreams Create
+// by the author of the status. The Create is addressed the same way as the note.
+func CreateToAS(s *model.Status, author *model.Account, note vocab.ActivityStreamsNote) (vocab.ActivityStreamsCreate, error) {
+	create := streams.NewActivityStreamsCreate()
+
+	// id
+	uri, err := parseIRI(s.URI + "/activity")
+	if err != nil {
+		return nil, err
+	}
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(uri)
+	create.SetJSONLDId(idProp)
+
+	// actor
+	authorURI, err := parseIRI(author.URI)
+	if err != nil {
+		return nil, err
+	}
+	actorProp := streams.NewActivityStreamsActorProperty()
+	actorProp.AppendIRI(authorURI)
+	create.SetActivityStreamsActor(actorProp)
+
+	// published
+	publishedProp := streams.NewActivityStreamsPublishedProperty()
+	publishedProp.Set(s.CreatedAt)
+	create.SetActivityStreamsPublished(publishedProp)
+
+	// to and cc
+	if to := note.GetActivityStreamsTo(); to != nil {
+		create.SetActivityStreamsTo(to)
+	}
+	if cc := note.GetActivityStreamsCc(); cc != nil {
+		create.SetActivityStreamsCc(cc)
+	}
+
+	// object
+	objectProp := streams.NewActivityStreamsObjectProperty()
+	objectProp.AppendActivityStreamsNote(note)
+	create.SetActivityStreamsObject(objectProp)
+
+	return create, nil
+}
+
+// BoostToAS converts a gts model status that boosts another status into an activitystreams Announce.
+// The account that did the boost, and the status that was boosted, must be provided.
+func BoostToAS(boost *model.Status, booster *model.Account, boosted *model.Status) (vocab.ActivityStreamsAnnounce, error) {
+	announce := streams.NewActivityStreamsAnnounce()
+
+	if err := setActivityIDs(announce, boost.URI, booster.URI, boosted.URI); err != nil {
+		return nil, err
+	}
+
+	// published
+	publishedProp := streams.NewActivityStreamsPublishedProperty()
+	publishedProp.Set(boost.CreatedAt)
+	announce.SetActivityStreamsPublished(publishedProp)
+
+	// to and cc
+	to, cc, err := addressingForVisibility(boost.Visibility, booster)
+	if err != nil {
+		return nil, err
+	}
+	toProp := streams.NewActivityStreamsToProperty()
+	for _, iri := range to {
+		toProp.AppendIRI(iri)
+	}
+	announce.SetActivityStreamsTo(toProp)
+	ccProp := streams.NewActivityStreamsCcProperty()
+	for _, iri := range cc {
+		ccProp.AppendIRI(iri)
+	}
+	announce.SetActivityStreamsCc(ccProp)
+
+	return announce, nil
+}
+
+// FollowToAS converts a gts model follow into an activitystreams Follow, from the origin account to the target account.
+func FollowToAS(f *model.Follow, origin *model.Account, target *model.Account) (vocab.ActivityStreamsFollow, error) {
+	follow := streams.NewActivityStreamsFollow()
+	if err := setActivityIDs(follow, f.URI, origin.URI, target.URI); err != nil {
+		return nil, err
+	}
+	return follow, nil
+}
+
+// FaveToAS converts a gts model fave into an activitystreams Like, from the origin account targeting the given status.
+func FaveToAS(fave *model.StatusFave, origin *model.Account, status *model.Status) (vocab.ActivityStreamsLike, error) {
+	like := streams.NewActivityStreamsLike()
+	if err := setActivityIDs(like, fave.URI, origin.URI, status.URI); err != nil {
+		return nil, err
+	}
+	return like, nil
+}
+
+// AccountDeleteToAS returns an activitystreams Delete of the given account by itself, addressed to the public.
+func AccountDeleteToAS(a *model.Account) (vocab.ActivityStreamsDelete, error) {
+	del := streams.NewActivityStreamsDelete()
+	if err := setActivityIDs(del, a.URI+"#delete", a.URI, a.URI); err != nil {
+		return nil, err
+	}
+
+	public, err := url.Parse(pub.PublicActivityPubIRI)
+	if err != nil {
+		return nil, err
+	}
+	toProp := streams.NewActivityStreamsToProperty()
+	toProp.AppendIRI(public)
+	del.SetActivityStreamsTo(toProp)
+
+	return del, nil
+}
+
+// StatusDeleteToAS returns an activitystreams Delete of the given status by its author. The Delete is addressed
+// the same way as the status was, so that it reaches everyone who got the status in the first place.
+func StatusDeleteToAS(s *model.Status, author *model.Account) (vocab.ActivityStreamsDelete, error) {
+	del := streams.NewActivityStreamsDelete()
+	if err := setActivityIDs(del, s.URI+"#delete", author.URI, s.URI); err != nil {
+		return nil, err
+	}
+
+	// to and cc
+	to, cc, err := addressingForVisibility(s.Visibility, author)
+	if err != nil {
+		return nil, err
+	}
+	toProp := streams.NewActivityStreamsToProperty()
+	for _, iri := range to {
+		toProp.AppendIRI(iri)
+	}
+	del.SetActivityStreamsTo(toProp)
+	ccProp := streams.NewActivityStreamsCcProperty()
+	for _, iri := range cc {
+		ccProp.AppendIRI(iri)
+	}
+	del.SetActivityStreamsCc(ccProp)
+
+	return del, nil
+}
+
+// MoveToAS returns an activitystreams Move of the origin account to the target account, addressed to the followers of the
+// origin account. It has no id, since go-fed will give it one when it's sent.
+func MoveToAS(origin *model.Account, target *model.Account) (vocab.ActivityStreamsMove, error) {
+	originIRI, err := parseIRI(origin.URI)
+	if err != nil {
+		return nil, err
+	}
+	targetIRI, err := parseIRI(target.URI)
+	if err != nil {
+		return nil, err
+	}
+	followersIRI, err := parseIRI(origin.FollowersURL)
+	if err != nil {
+		return nil, err
+	}
+
+	move := streams.NewActivityStreamsMove()
+
+	actorProp := streams.NewActivityStreamsActorProperty()
+	actorProp.AppendIRI(originIRI)
+	move.SetActivityStreamsActor(actorProp)
+
+	objectProp := streams.NewActivityStreamsObjectProperty()
+	objectProp.AppendIRI(originIRI)
+	move.SetActivityStreamsObject(objectProp)
+
+	targetProp := streams.NewActivityStreamsTargetProperty()
+	targetProp.AppendIRI(targetIRI)
+	move.SetActivityStreamsTarget(targetProp)
+
+	toProp := streams.NewActivityStreamsToProperty()
+	toProp.AppendIRI(followersIRI)
+	move.SetActivityStreamsTo(toProp)
+
+	return move, nil
+}
+
+// AccountUpdateToAS returns an activitystreams Update of the given account, made at the given time, by itself. The object of the
+// Update is person, which should be the account as it is now, and the Update is addressed to the followers of the account.
+func AccountUpdateToAS(a *model.Account, person vocab.Type, updated time.Time) (vocab.ActivityStreamsUpdate, error) {
+	id, err := parseIRI(fmt.Sprintf("%s#updates/%d", a.URI, updated.Unix()))
+	if err != nil {
+		return nil, err
+	}
+	accountIRI, err := parseIRI(a.URI)
+	if err != nil {
+		return nil, err
+	}
+	followersIRI, err := parseIRI(a.FollowersURL)
+	if err != nil {
+		return nil, err
+	}
+
+	update := streams.NewActivityStreamsUpdate()
+
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(id)
+	update.SetJSONLDId(idProp)
+
+	actorProp := streams.NewActivityStreamsActorProperty()
+	actorProp.AppendIRI(accountIRI)
+	update.SetActivityStreamsActor(actorProp)
+
+	objectProp := streams.NewActivityStreamsObjectProperty()
+	if err := objectProp.AppendType(person); err != nil {
+		return nil, fmt.Errorf("could not set %s as object of update: %s", person.GetTypeName(), err)
+	}
+	update.SetActivityStreamsObject(objectProp)
+
+	toProp := streams.NewActivityStreamsToProperty()
+	toProp.AppendIRI(followersIRI)
+	update.SetActivityStreamsTo(toProp)
+
+	return update, nil
+}
+
+// CollectionToAS returns an activitystreams Collection with the given id, containing the given items.
+func CollectionToAS(id *url.URL, items []*url.URL) vocab.ActivityStreamsCollection {
+	collection := streams.NewActivityStreamsCollection()
+
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(id)
+	collection.SetJSONLDId(idProp)
+
+	itemsProp := streams.NewActivityStreamsItemsProperty()
+	for _, item := range items {
+		itemsProp.AppendIRI(item)
+	}
+	collection.SetActivityStreamsItems(itemsProp)
+
+	totalItemsProp := streams.NewActivityStreamsTotalItemsProperty()
+	totalItemsProp.Set(len(items))
+	collection.SetActivityStreamsTotalItems(totalItemsProp)
+
+	return collection
+}
+
+// OrderedCollectionToAS returns an activitystreams OrderedCollection with the given id, whose items can be found by
+// following first. The collection itself doesn't contain any items.
+func OrderedCollectionToAS(id *url.URL, first *url.URL) vocab.ActivityStreamsOrderedCollection {
+	collection := streams.NewActivityStreamsOrderedCollection()
+
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(id)
+	collection.SetJSONLDId(idProp)
+
+	firstProp := streams.NewActivityStreamsFirstProperty()
+	firstProp.SetIRI(first)
+	collection.SetActivityStreamsFirst(firstProp)
+
+	return collection
+}
+
+// AccountsCollectionToAS returns an activitystreams OrderedCollection of accounts with the given id, such as the followers
+// of an account, that has totalItems accounts in it. first is the first page of the collection, and should be nil if the
+// accounts in it aren't to be shown, in which case only the number of them is given.
+func AccountsCollectionToAS(id *url.URL, first *url.URL, totalItems int) vocab.ActivityStreamsOrderedCollection {
+	collection := streams.NewActivityStreamsOrderedCollection()
+
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(id)
+	collection.SetJSONLDId(idProp)
+
+	if first != nil {
+		firstProp := streams.NewActivityStreamsFirstProperty()
+		firstProp.SetIRI(first)
+		collection.SetActivityStreamsFirst(firstProp)
+	}
+
+	totalItemsProp := streams.NewActivityStreamsTotalItemsProperty()
+	totalItemsProp.Set(totalItems)
+	collection.SetActivityStreamsTotalItems(totalItemsProp)
+
+	return collection
+}
+
+// OrderedCollectionPageToAS returns an activitystreams OrderedCollectionPage with the given id, that's part of the given collection
+// and contains the given items. next and prev are optional, and should be nil if there's no next or previous page.
+func OrderedCollectionPageToAS(id *url.URL, partOf *url.URL, next *url.URL, prev *url.URL, items []vocab.Type) (vocab.ActivityStreamsOrderedCollectionPage, error) {
+	page := orderedCollectionPage(id, partOf, next, prev)
+
+	itemsProp := streams.NewActivityStreamsOrderedItemsProperty()
+	for _, item := range items {
+		if err := itemsProp.AppendType(item); err != nil {
+			return nil, fmt.Errorf("error adding item to page: %s", err)
+		}
+	}
+	page.SetActivityStreamsOrderedItems(itemsProp)
+
+	return page, nil
+}
+
+// AccountsCollectionPageToAS returns a page of a collection of accounts made by AccountsCollectionToAS, containing the accounts
+// with the given uris. next and prev are optional, and should be nil if there's no next or previous page.
+func AccountsCollectionPageToAS(id *url.URL, partOf *url.URL, next *url.URL, prev *url.URL, totalItems int, accountURIs []*url.URL) vocab.ActivityStreamsOrderedCollectionPage {
+	page := orderedCollectionPage(id, partOf, next, prev)
+
+	totalItemsProp := streams.NewActivityStreamsTotalItemsProperty()
+	totalItemsProp.Set(totalItems)
+	page.SetActivityStreamsTotalItems(totalItemsProp)
+
+	itemsProp := streams.NewActivityStreamsOrderedItemsProperty()
+	for _, uri := range accountURIs {
+		itemsProp.AppendIRI(uri)
+	}
+	page.SetActivityStreamsOrderedItems(itemsProp)
+
+	return page
+}
+
+// orderedCollectionPage returns an activitystreams OrderedCollectionPage with the given id, that's part of the given collection,
+// and that links to the given next and prev pages if they're not nil. It's up to the caller to add the items.
+func orderedCollectionPage(id *url.URL, partOf *url.URL, next *url.URL, prev *url.URL) vocab.ActivityStreamsOrderedCollectionPage {
+	page := streams.NewActivityStreamsOrderedCollectionPage()
+
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(id)
+	page.SetJSONLDId(idProp)
+
+	partOfProp := streams.NewActivityStreamsPartOfProperty()
+	partOfProp.SetIRI(partOf)
+	page.SetActivityStreamsPartOf(partOfProp)
+
+	if next != nil {
+		nextProp := streams.NewActivityStreamsNextProperty()
+		nextProp.SetIRI(next)
+		page.SetActivityStreamsNext(nextProp)
+	}
+
+	if prev != nil {
+		prevProp := streams.NewActivityStreamsPrevProperty()
+		prevProp.SetIRI(prev)
+		page.SetActivityStreamsPrev(prevProp)
+	}
+
+	return page
+}
+
+// activityBuilder represents the setters needed to build a simple activity with an actor and an object.
+type activityBuilder interface {
+	SetJSONLDId(vocab.JSONLDIdProperty)
+	SetActivityStreamsActor(vocab.ActivityStreamsActorProperty)
+	SetActivityStreamsObject(vocab.ActivityStreamsObjectProperty)
+}
+
+// setActivityIDs sets the id, actor, and object of the given activity to the given uris.
+func setActivityIDs(activity activityBuilder, id string, actor string, object string) error {
+	idIRI, err := parseIRI(id)
+	if err != nil {
+		return err
+	}
+	actorIRI, err := parseIRI(actor)
+	if err != nil {
+		return err
+	}
+	objectIRI, err := parseIRI(object)
+	if err != nil {
+		return err
+	}
+
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.SetIRI(idIRI)
+	activity.SetJSONLDId(idProp)
+
+	actorProp := streams.NewActivityStreamsActorProperty()
+	actorProp.AppendIRI(actorIRI)
+	activity.SetActivityStreamsActor(actorProp)
+
+	objectProp := streams.NewActivityStreamsObjectProperty()
+	objectProp.AppendIRI(objectIRI)
+	activity.SetActivityStreamsObject(objectProp)
+
+	return nil
+}
+
+// addressingForVisibility returns the to and cc iris for something posted by the given account with the given visibility.
+// Public things are addressed to the public collection and cc'd to followers, unlisted things the other way around,
+// and everything else just goes to followers. A nil visibility is treated as followers-only.
+func addressingForVisibility(v *model.Visibility, account *model.Account) (to []*url.URL, cc []*url.URL, err error) {
+	public, err := url.Parse(pub.PublicActivityPubIRI)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var followers *url.URL
+	if account.FollowersURL != "" {
+		followers, err = parseIRI(account.FollowersURL)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	switch {
+	case v != nil && v.Direct:
+		// mentions aren't stored yet, so there's nobody to address this to
+	case v != nil && v.Public:
+		to = append(to, public)
+		if followers != nil {
+			cc = append(cc, followers)
+		}
+	case v != nil && v.Unlisted:
+		if followers != nil {
+			to = append(to, followers)
+		}
+		cc = append(cc, public)
+	default:
+		if followers != nil {
+			to = append(to, followers)
+		}
+	}
+	return to, cc, nil
+}
+
+// parseIRI parses the given string as an absolute iri.
+func parseIRI(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing iri %s: %s", s, err)
+	}
+	if !u.IsAbs() {
+		return nil, fmt.Errorf("iri %s was not absolute", s)
+	}
+	return u, nil
+}
@@ -0,0 +1,265 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package typeutils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+	"github.com/superseriousbusiness/gotosocial/internal/util"
+)
+
+type InternalToASTestSuite struct {
+	suite.Suite
+	testAccount *model.Account
+}
+
+// SetupSuite sets some variables on the suite that we can use as consts (more or less) throughout
+func (suite *InternalToASTestSuite) SetupSuite() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	uris := util.GenerateURIs("test_user", "https", "example.org")
+	suite.testAccount = &model.Account{
+		Username:              "test_user",
+		DisplayName:           "Test User",
+		Note:                  "a test account",
+		URI:                   uris.UserURI,
+		URL:                   uris.UserURL,
+		InboxURL:              uris.InboxURL,
+		OutboxURL:             uris.OutboxURL,
+		FollowersURL:          uris.FollowersURL,
+		FollowingURL:          uris.FollowingURL,
+		FeaturedCollectionURL: uris.CollectionURL,
+		PublicKey:             &key.PublicKey,
+		PublicKeyURI:          uris.PublicKeyURI,
+	}
+}
+
+func (suite *InternalToASTestSuite) TestAccountToASRoundTrip() {
+	person, err := AccountToAS(suite.testAccount, nil, nil, "https://example.org/inbox", "")
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+
+	// serialize and deserialize it again, as if it had been sent over the wire
+	m, err := streams.Serialize(person)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	t, err := streams.ToType(context.Background(), m)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	accountable, ok := t.(Accountable)
+	if !ok {
+		suite.FailNow("deserialized type was not accountable")
+	}
+
+	acct, err := ASRepresentationToAccount(accountable)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	assert.Equal(suite.T(), suite.testAccount.URI, acct.URI)
+	assert.Equal(suite.T(), suite.testAccount.Username, acct.Username)
+	assert.Equal(suite.T(), "example.org", acct.Domain)
+	assert.Equal(suite.T(), suite.testAccount.DisplayName, acct.DisplayName)
+	assert.Equal(suite.T(), suite.testAccount.Note, acct.Note)
+	assert.Equal(suite.T(), suite.testAccount.InboxURL, acct.InboxURL)
+	assert.Equal(suite.T(), "https://example.org/inbox", acct.SharedInboxURL)
+	assert.Equal(suite.T(), suite.testAccount.FollowingURL, acct.FollowingURL)
+	assert.Equal(suite.T(), suite.testAccount.FeaturedCollectionURL, acct.FeaturedCollectionURL)
+	assert.Equal(suite.T(), suite.testAccount.PublicKeyURI, acct.PublicKeyURI)
+	assert.True(suite.T(), suite.testAccount.PublicKey.Equal(acct.PublicKey))
+	assert.False(suite.T(), acct.Bot)
+}
+
+func (suite *InternalToASTestSuite) TestAccountProfileFromAS() {
+	acct := *suite.testAccount
+	acct.Locked = true
+	avatar := &model.MediaAttachment{}
+	avatar.File.Path = "https://example.org/fileserver/avatar.png"
+	avatar.File.ContentType = "image/png"
+	person, err := AccountToAS(&acct, avatar, nil, "", "")
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	m, err := streams.Serialize(person)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+
+	// add the things that other servers send along, but that we don't serve ourselves (yet)
+	m["@context"] = []interface{}{m["@context"], map[string]interface{}{"toot": "http://joinmastodon.org/ns#", "discoverable": "toot:discoverable"}}
+	m["discoverable"] = true
+	m["image"] = map[string]interface{}{"type": "Image", "url": "https://example.org/fileserver/header.png"}
+	m["attachment"] = []interface{}{
+		map[string]interface{}{"type": "PropertyValue", "name": "pronouns", "value": "they/them"},
+		map[string]interface{}{"type": "Document", "url": "https://example.org/fileserver/something.png"},
+		map[string]interface{}{"type": "PropertyValue", "name": "website", "value": "<a href=\"https://example.org\">example.org</a>"},
+	}
+
+	t, err := streams.ToType(context.Background(), m)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	converted, err := ASRepresentationToAccount(t.(Accountable))
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	assert.True(suite.T(), converted.Locked)
+	assert.True(suite.T(), converted.Discoverable)
+	if assert.NotNil(suite.T(), converted.AvatarRemoteURL) {
+		assert.Equal(suite.T(), "https://example.org/fileserver/avatar.png", converted.AvatarRemoteURL.String())
+	}
+	if assert.NotNil(suite.T(), converted.HeaderRemoteURL) {
+		assert.Equal(suite.T(), "https://example.org/fileserver/header.png", converted.HeaderRemoteURL.String())
+	}
+	assert.Equal(suite.T(), []model.Field{
+		{Name: "pronouns", Value: "they/them"},
+		{Name: "website", Value: `<a href="https://example.org">example.org</a>`},
+	}, converted.Fields)
+}
+
+func (suite *InternalToASTestSuite) TestAccountAliasesToAS() {
+	acct := *suite.testAccount
+	acct.AlsoKnownAs = []string{"https://old.example/users/someone", "https://older.example/users/someone"}
+	person, err := AccountToAS(&acct, nil, nil, "", "https://new.example/users/someone")
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	m, err := streams.Serialize(person)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	assert.Equal(suite.T(), "https://new.example/users/someone", m["movedTo"])
+
+	t, err := streams.ToType(context.Background(), m)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	converted, err := ASRepresentationToAccount(t.(Accountable))
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	assert.Equal(suite.T(), acct.AlsoKnownAs, converted.AlsoKnownAs)
+
+	// other servers may send a single alias rather than an array, and anything that isn't an iri is skipped
+	m["alsoKnownAs"] = "https://old.example/users/someone"
+	t, err = streams.ToType(context.Background(), m)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	converted, err = ASRepresentationToAccount(t.(Accountable))
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	assert.Equal(suite.T(), []string{"https://old.example/users/someone"}, converted.AlsoKnownAs)
+
+	m["alsoKnownAs"] = []interface{}{"not an iri", 3}
+	t, err = streams.ToType(context.Background(), m)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	converted, err = ASRepresentationToAccount(t.(Accountable))
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	assert.Empty(suite.T(), converted.AlsoKnownAs)
+}
+
+func (suite *InternalToASTestSuite) TestUpdateRemoteAccount() {
+	existing := *suite.testAccount
+	existing.ID = "some-id"
+	existing.SilencedAt = time.Now()
+
+	fetched := *suite.testAccount
+	fetched.DisplayName = "New Name"
+	assert.False(suite.T(), UpdateRemoteAccount(&existing, &fetched))
+	assert.Equal(suite.T(), "New Name", existing.DisplayName)
+	assert.Equal(suite.T(), "some-id", existing.ID)
+	assert.False(suite.T(), existing.SilencedAt.IsZero())
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	fetched.PublicKey = &key.PublicKey
+	assert.True(suite.T(), UpdateRemoteAccount(&existing, &fetched))
+	assert.True(suite.T(), key.PublicKey.Equal(existing.PublicKey))
+}
+
+func (suite *InternalToASTestSuite) TestSharedInboxOnOtherHostIgnored() {
+	person, err := AccountToAS(suite.testAccount, nil, nil, "https://somewhere.else/inbox", "")
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	m, err := streams.Serialize(person)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	t, err := streams.ToType(context.Background(), m)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+
+	acct, err := ASRepresentationToAccount(t.(Accountable))
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	assert.Empty(suite.T(), acct.SharedInboxURL)
+}
+
+func (suite *InternalToASTestSuite) TestStatusContentSanitizedFromAS() {
+	status := &model.Status{
+		URI:        suite.testAccount.URI + "/statuses/some-status",
+		Content:    `<p onclick="steal()">hello <a href="javascript:alert(1)">there</a><script>alert(1)</script></p>`,
+		CreatedAt:  time.Now(),
+		Visibility: &model.Visibility{Public: true, Followers: true},
+	}
+	note, err := StatusToAS(status, suite.testAccount, nil)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+
+	converted, err := ASStatusToStatus(note, suite.testAccount)
+	if err != nil {
+		suite.FailNow(err.Error())
+	}
+	assert.Equal(suite.T(), "<p>hello there</p>", converted.Content)
+}
+
+func (suite *InternalToASTestSuite) TestAccountToASNoPublicKey() {
+	acct := *suite.testAccount
+	acct.PublicKey = nil
+	_, err := AccountToAS(&acct, nil, nil, "", "")
+	assert.Error(suite.T(), err)
+}
+
+func TestInternalToASTestSuite(t *testing.T) {
+	suite.Run(t, new(InternalToASTestSuite))
+}
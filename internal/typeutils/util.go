@@ -0,0 +1,488 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package typeutils
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/superseriousbusiness/gotosocial/internal/db/model"
+)
+
+// extractPreferredUsername returns a string representation of an interface's preferredUsername property.
+func extractPreferredUsername(i withPreferredUsername) (string, error) {
+	u := i.GetActivityStreamsPreferredUsername()
+	if u == nil || !u.IsXMLSchemaString() {
+		return "", errors.New("preferredUsername was not a string")
+	}
+	if u.GetXMLSchemaString() == "" {
+		return "", errors.New("preferredUsername was empty")
+	}
+	return u.GetXMLSchemaString(), nil
+}
+
+// extractName returns the first string value of an interface's name property.
+func extractName(i withName) (string, error) {
+	nameProp := i.GetActivityStreamsName()
+	if nameProp == nil {
+		return "", errors.New("name property was nil")
+	}
+	for iter := nameProp.Begin(); iter != nameProp.End(); iter = iter.Next() {
+		if iter.IsXMLSchemaString() && iter.GetXMLSchemaString() != "" {
+			return iter.GetXMLSchemaString(), nil
+		}
+	}
+	return "", errors.New("could not find string name")
+}
+
+// extractSummary returns the first string value of an interface's summary property.
+func extractSummary(i withSummary) (string, error) {
+	summaryProp := i.GetActivityStreamsSummary()
+	if summaryProp == nil {
+		return "", errors.New("summary property was nil")
+	}
+	for iter := summaryProp.Begin(); iter != summaryProp.End(); iter = iter.Next() {
+		if iter.IsXMLSchemaString() && iter.GetXMLSchemaString() != "" {
+			return iter.GetXMLSchemaString(), nil
+		}
+	}
+	return "", errors.New("could not find string summary")
+}
+
+// extractURL returns the first IRI or anyURI value of an interface's url property.
+func extractURL(i withURL) (*url.URL, error) {
+	urlProp := i.GetActivityStreamsUrl()
+	if urlProp == nil {
+		return nil, errors.New("url property was nil")
+	}
+	for iter := urlProp.Begin(); iter != urlProp.End(); iter = iter.Next() {
+		if iter.IsIRI() && iter.GetIRI() != nil {
+			return iter.GetIRI(), nil
+		}
+		if iter.IsXMLSchemaAnyURI() && iter.GetXMLSchemaAnyURI() != nil {
+			return iter.GetXMLSchemaAnyURI(), nil
+		}
+	}
+	return nil, errors.New("could not find url")
+}
+
+// extractSharedInbox returns the sharedInbox of an interface's endpoints. Since go-fed doesn't know about endpoints,
+// they end up among the unknown properties.
+func extractSharedInbox(i withUnknownProperties) (*url.URL, error) {
+	endpoints, ok := i.GetUnknownProperties()["endpoints"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("no endpoints found")
+	}
+	sharedInbox, ok := endpoints["sharedInbox"].(string)
+	if !ok {
+		return nil, errors.New("no sharedInbox found in endpoints")
+	}
+	return url.Parse(sharedInbox)
+}
+
+// extractIconURL returns the url of the first Image of an interface's icon property, or the first plain IRI if there's no Image.
+func extractIconURL(i withIcon) (*url.URL, error) {
+	iconProp := i.GetActivityStreamsIcon()
+	if iconProp == nil {
+		return nil, errors.New("icon property was nil")
+	}
+	for iter := iconProp.Begin(); iter != iconProp.End(); iter = iter.Next() {
+		if iter.IsActivityStreamsImage() {
+			return extractURL(iter.GetActivityStreamsImage())
+		}
+		if iter.IsIRI() && iter.GetIRI() != nil {
+			return iter.GetIRI(), nil
+		}
+	}
+	return nil, errors.New("could not find icon url")
+}
+
+// extractImageURL returns the url of the first Image of an interface's image property, or the first plain IRI if there's no Image.
+func extractImageURL(i withImage) (*url.URL, error) {
+	imageProp := i.GetActivityStreamsImage()
+	if imageProp == nil {
+		return nil, errors.New("image property was nil")
+	}
+	for iter := imageProp.Begin(); iter != imageProp.End(); iter = iter.Next() {
+		if iter.IsActivityStreamsImage() {
+			return extractURL(iter.GetActivityStreamsImage())
+		}
+		if iter.IsIRI() && iter.GetIRI() != nil {
+			return iter.GetIRI(), nil
+		}
+	}
+	return nil, errors.New("could not find image url")
+}
+
+// extractFields returns the profile fields of an interface, which are the PropertyValue entries of its attachment property.
+// go-fed doesn't know about PropertyValue, so we have to pick them out of the serialized property.
+func extractFields(i withAttachment) []model.Field {
+	fields := []model.Field{}
+	attachmentProp := i.GetActivityStreamsAttachment()
+	if attachmentProp == nil {
+		return fields
+	}
+	serialized, err := attachmentProp.Serialize()
+	if err != nil {
+		return fields
+	}
+	entries, ok := serialized.([]interface{})
+	if !ok {
+		entries = []interface{}{serialized}
+	}
+	for _, e := range entries {
+		m, ok := e.(map[string]interface{})
+		if !ok || m["type"] != "PropertyValue" {
+			continue
+		}
+		name, _ := m["name"].(string)
+		value, _ := m["value"].(string)
+		if name == "" {
+			continue
+		}
+		fields = append(fields, model.Field{Name: name, Value: value})
+	}
+	return fields
+}
+
+// extractManuallyApprovesFollowers returns the value of an interface's manuallyApprovesFollowers property, which go-fed
+// doesn't know about, so it ends up among the unknown properties. Accounts that don't say are taken not to.
+func extractManuallyApprovesFollowers(i withUnknownProperties) bool {
+	locked, _ := i.GetUnknownProperties()["manuallyApprovesFollowers"].(bool)
+	return locked
+}
+
+// extractAlsoKnownAs returns the uris in an interface's alsoKnownAs property, which go-fed doesn't know about, so it ends
+// up among the unknown properties. It may be a single uri or an array of them; anything that isn't a uri is skipped.
+func extractAlsoKnownAs(i withUnknownProperties) []string {
+	var values []interface{}
+	switch v := i.GetUnknownProperties()["alsoKnownAs"].(type) {
+	case string:
+		values = []interface{}{v}
+	case []interface{}:
+		values = v
+	}
+
+	alsoKnownAs := []string{}
+	for _, value := range values {
+		uri, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if _, err := parseIRI(uri); err != nil {
+			continue
+		}
+		alsoKnownAs = append(alsoKnownAs, uri)
+	}
+	return alsoKnownAs
+}
+
+// extractDiscoverable returns the value of an interface's discoverable property, or false if it's not set.
+func extractDiscoverable(i withDiscoverable) bool {
+	discoverableProp := i.GetTootDiscoverable()
+	if discoverableProp == nil || !discoverableProp.IsXMLSchemaBoolean() {
+		return false
+	}
+	return discoverableProp.Get()
+}
+
+// ExtractContent returns the first string value of an interface's content property.
+func ExtractContent(i withContent) (string, error) {
+	contentProp := i.GetActivityStreamsContent()
+	if contentProp == nil {
+		return "", errors.New("content property was nil")
+	}
+	for iter := contentProp.Begin(); iter != contentProp.End(); iter = iter.Next() {
+		if iter.IsXMLSchemaString() && iter.GetXMLSchemaString() != "" {
+			return iter.GetXMLSchemaString(), nil
+		}
+	}
+	return "", errors.New("could not find string content")
+}
+
+// extractPublished returns the time value of an interface's published property.
+func extractPublished(i withPublished) (time.Time, error) {
+	publishedProp := i.GetActivityStreamsPublished()
+	if publishedProp == nil || !publishedProp.IsXMLSchemaDateTime() {
+		return time.Time{}, errors.New("published property was not a datetime")
+	}
+	if publishedProp.Get().IsZero() {
+		return time.Time{}, errors.New("published time was zero")
+	}
+	return publishedProp.Get(), nil
+}
+
+// ExtractAttributedTo returns the id of the first entry of an interface's attributedTo property.
+func ExtractAttributedTo(i withAttributedTo) (*url.URL, error) {
+	attributedToProp := i.GetActivityStreamsAttributedTo()
+	if attributedToProp == nil {
+		return nil, errors.New("attributedTo property was nil")
+	}
+	for iter := attributedToProp.Begin(); iter != attributedToProp.End(); iter = iter.Next() {
+		if id, err := pub.ToId(iter); err == nil {
+			return id, nil
+		}
+	}
+	return nil, errors.New("could not find attributedTo id")
+}
+
+// ExtractInReplyTo returns the id of the first entry of an interface's inReplyTo property.
+func ExtractInReplyTo(i withInReplyTo) (*url.URL, error) {
+	inReplyToProp := i.GetActivityStreamsInReplyTo()
+	if inReplyToProp == nil {
+		return nil, errors.New("inReplyTo property was nil")
+	}
+	for iter := inReplyToProp.Begin(); iter != inReplyToProp.End(); iter = iter.Next() {
+		if id, err := pub.ToId(iter); err == nil {
+			return id, nil
+		}
+	}
+	return nil, errors.New("could not find inReplyTo id")
+}
+
+// ExtractActor returns the id of the first entry of an interface's actor property.
+func ExtractActor(i withActor) (*url.URL, error) {
+	actorProp := i.GetActivityStreamsActor()
+	if actorProp == nil {
+		return nil, errors.New("actor property was nil")
+	}
+	for iter := actorProp.Begin(); iter != actorProp.End(); iter = iter.Next() {
+		if id, err := pub.ToId(iter); err == nil {
+			return id, nil
+		}
+	}
+	return nil, errors.New("could not find actor id")
+}
+
+// ExtractObject returns the id of the first entry of an interface's object property.
+func ExtractObject(i withObject) (*url.URL, error) {
+	objectProp := i.GetActivityStreamsObject()
+	if objectProp == nil {
+		return nil, errors.New("object property was nil")
+	}
+	for iter := objectProp.Begin(); iter != objectProp.End(); iter = iter.Next() {
+		if id, err := pub.ToId(iter); err == nil {
+			return id, nil
+		}
+	}
+	return nil, errors.New("could not find object id")
+}
+
+// ExtractObjects returns the ids of all entries of an interface's object property.
+func ExtractObjects(i withObject) []*url.URL {
+	ids := []*url.URL{}
+	objectProp := i.GetActivityStreamsObject()
+	if objectProp == nil {
+		return ids
+	}
+	for iter := objectProp.Begin(); iter != objectProp.End(); iter = iter.Next() {
+		if id, err := pub.ToId(iter); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// ExtractTarget returns the id of the first entry of an interface's target property.
+func ExtractTarget(i withTarget) (*url.URL, error) {
+	targetProp := i.GetActivityStreamsTarget()
+	if targetProp == nil {
+		return nil, errors.New("target property was nil")
+	}
+	for iter := targetProp.Begin(); iter != targetProp.End(); iter = iter.Next() {
+		if id, err := pub.ToId(iter); err == nil {
+			return id, nil
+		}
+	}
+	return nil, errors.New("could not find target id")
+}
+
+// extractTo returns the ids of all entries of an interface's to property.
+func extractTo(i withTo) []*url.URL {
+	ids := []*url.URL{}
+	toProp := i.GetActivityStreamsTo()
+	if toProp == nil {
+		return ids
+	}
+	for iter := toProp.Begin(); iter != toProp.End(); iter = iter.Next() {
+		if id, err := pub.ToId(iter); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// extractCC returns the ids of all entries of an interface's cc property.
+func extractCC(i withCC) []*url.URL {
+	ids := []*url.URL{}
+	ccProp := i.GetActivityStreamsCc()
+	if ccProp == nil {
+		return ids
+	}
+	for iter := ccProp.Begin(); iter != ccProp.End(); iter = iter.Next() {
+		if id, err := pub.ToId(iter); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// ExtractMentions returns the hrefs of all the Mention entries of an interface's tag property.
+func ExtractMentions(i withTag) []*url.URL {
+	hrefs := []*url.URL{}
+	tagProp := i.GetActivityStreamsTag()
+	if tagProp == nil {
+		return hrefs
+	}
+	for iter := tagProp.Begin(); iter != tagProp.End(); iter = iter.Next() {
+		if !iter.IsActivityStreamsMention() {
+			continue
+		}
+		hrefProp := iter.GetActivityStreamsMention().GetActivityStreamsHref()
+		if hrefProp != nil && hrefProp.IsIRI() {
+			hrefs = append(hrefs, hrefProp.GetIRI())
+		}
+	}
+	return hrefs
+}
+
+// ExtractAttachments returns all the entries of an interface's attachment property that can be treated as media attachments.
+func ExtractAttachments(i withAttachment) []Attachmentable {
+	attachments := []Attachmentable{}
+	attachmentProp := i.GetActivityStreamsAttachment()
+	if attachmentProp == nil {
+		return attachments
+	}
+	for iter := attachmentProp.Begin(); iter != attachmentProp.End(); iter = iter.Next() {
+		if attachmentable, ok := iter.GetType().(Attachmentable); ok {
+			attachments = append(attachments, attachmentable)
+		}
+	}
+	return attachments
+}
+
+// extractMediaType returns the value of an interface's mediaType property.
+func extractMediaType(i withMediaType) (string, error) {
+	mediaTypeProp := i.GetActivityStreamsMediaType()
+	if mediaTypeProp == nil || mediaTypeProp.Get() == "" {
+		return "", errors.New("could not find media type")
+	}
+	return mediaTypeProp.Get(), nil
+}
+
+// containsPublic returns true if any of the given ids is the special activitystreams Public collection.
+func containsPublic(ids []*url.URL) bool {
+	for _, id := range ids {
+		if pub.IsPublic(id.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsIRI returns true if any of the given ids is the given iri.
+func containsIRI(ids []*url.URL, iri string) bool {
+	for _, id := range ids {
+		if id.String() == iri {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractPublicKeyForOwner extracts the public key from an interface, as long as it belongs to the specified owner.
+// It will return the public key itself, the id/URL of the public key, or an error if something goes wrong.
+func ExtractPublicKeyForOwner(i withPublicKey, forOwner *url.URL) (*rsa.PublicKey, *url.URL, error) {
+	publicKeyProp := i.GetW3IDSecurityV1PublicKey()
+	if publicKeyProp == nil {
+		return nil, nil, errors.New("public key property was nil")
+	}
+
+	for iter := publicKeyProp.Begin(); iter != publicKeyProp.End(); iter = iter.Next() {
+		if !iter.IsW3IDSecurityV1PublicKey() {
+			continue
+		}
+
+		pkey := iter.Get()
+		if pkey == nil {
+			continue
+		}
+
+		pkeyID := pkey.GetJSONLDId()
+		if pkeyID == nil || pkeyID.GetIRI() == nil {
+			continue
+		}
+
+		pkeyOwner := pkey.GetW3IDSecurityV1Owner()
+		if pkeyOwner == nil || !pkeyOwner.IsIRI() || pkeyOwner.GetIRI() == nil {
+			continue
+		}
+		if pkeyOwner.GetIRI().String() != forOwner.String() {
+			continue
+		}
+
+		pkeyPem := pkey.GetW3IDSecurityV1PublicKeyPem()
+		if pkeyPem == nil || !pkeyPem.IsXMLSchemaString() {
+			return nil, nil, errors.New("publicKeyPem property was not a string")
+		}
+
+		p, err := parsePublicKeyPem(pkeyPem.Get())
+		if err != nil {
+			return nil, nil, err
+		}
+		return p, pkeyID.GetIRI(), nil
+	}
+	return nil, nil, fmt.Errorf("could not find public key belonging to owner %s", forOwner)
+}
+
+// parsePublicKeyPem parses an rsa public key from the given pem-encoded string.
+// Both PKIX ("PUBLIC KEY") and PKCS1 ("RSA PUBLIC KEY") encodings are accepted.
+func parsePublicKeyPem(s string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("could not decode publicKeyPem: no pem block found")
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		p, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse public key from block bytes: %s", err)
+		}
+		rsaKey, ok := p.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("public key was not an rsa public key")
+		}
+		return rsaKey, nil
+	case "RSA PUBLIC KEY":
+		rsaKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse public key from block bytes: %s", err)
+		}
+		return rsaKey, nil
+	default:
+		return nil, fmt.Errorf("unexpected pem block type %s", block.Type)
+	}
+}
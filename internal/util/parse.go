@@ -3,13 +3,16 @@ package util
 import "fmt"
 
 type URIs struct {
-	HostURL       string
-	UserURL       string
-	UserURI       string
-	InboxURL      string
-	OutboxURL     string
-	FollowersURL  string
-	CollectionURL string
+	HostURL        string
+	UserURL        string
+	UserURI        string
+	InboxURL       string
+	OutboxURL      string
+	FollowersURL   string
+	FollowingURL   string
+	CollectionURL  string
+	PublicKeyURI   string
+	SharedInboxURL string
 }
 
 func GenerateURIs(username string, protocol string, host string) *URIs {
@@ -19,14 +22,20 @@ func GenerateURIs(username string, protocol string, host string) *URIs {
 	inboxURL := fmt.Sprintf("%s/inbox", userURI)
 	outboxURL := fmt.Sprintf("%s/outbox", userURI)
 	followersURL := fmt.Sprintf("%s/followers", userURI)
+	followingURL := fmt.Sprintf("%s/following", userURI)
 	collectionURL := fmt.Sprintf("%s/collections/featured", userURI)
+	publicKeyURI := fmt.Sprintf("%s#main-key", userURI)
+	sharedInboxURL := fmt.Sprintf("%s/inbox", hostURL)
 	return &URIs{
-		HostURL:       hostURL,
-		UserURL:       userURL,
-		UserURI:       userURI,
-		InboxURL:      inboxURL,
-		OutboxURL:     outboxURL,
-		FollowersURL:  followersURL,
-		CollectionURL: collectionURL,
+		HostURL:        hostURL,
+		UserURL:        userURL,
+		UserURI:        userURI,
+		InboxURL:       inboxURL,
+		OutboxURL:      outboxURL,
+		FollowersURL:   followersURL,
+		FollowingURL:   followingURL,
+		CollectionURL:  collectionURL,
+		PublicKeyURI:   publicKeyURI,
+		SharedInboxURL: sharedInboxURL,
 	}
 }
@@ -64,6 +64,8 @@ type Account struct {
 	Fields []Field `json:"fields"`
 	// An extra entity returned when an account is suspended.
 	Suspended bool `json:"suspended,omitempty"`
+	// Indicates that the profile is currently inactive and that its user has moved to a new account.
+	Moved *Account `json:"moved,omitempty"`
 	// When a timed mute will expire, if applicable. (ISO 8601 Datetime)
 	MuteExpiresAt string `json:"mute_expires_at,omitempty"`
 	// An extra entity to be used with API methods to verify credentials and update credentials.
@@ -88,6 +90,27 @@ type AccountCreateRequest struct {
 	Locale string `form:"locale" binding:"required"`
 }
 
+// AccountDeleteRequest represents the form submitted during a DELETE request to /api/v1/accounts.
+type AccountDeleteRequest struct {
+	// The password of the account, to confirm the deletion.
+	Password string `form:"password" binding:"required"`
+}
+
+// AccountAliasesRequest represents the form submitted during a POST request to /api/v1/accounts/aliases.
+type AccountAliasesRequest struct {
+	// The accounts that this account is also known as, each either as an activitypub uri or as username@domain.
+	// Leaving this empty removes all aliases.
+	AlsoKnownAs []string `form:"also_known_as"`
+}
+
+// AccountMoveRequest represents the form submitted during a POST request to /api/v1/accounts/move.
+type AccountMoveRequest struct {
+	// The password of the account, to confirm the move.
+	Password string `form:"password" binding:"required"`
+	// The account to move to, either as an activitypub uri or as username@domain. It has to list this account as an alias.
+	MovedTo string `form:"moved_to" binding:"required"`
+}
+
 // UpdateCredentialsRequest represents the form submitted during a PATCH request to /api/v1/accounts/update_credentials.
 // See https://docs.joinmastodon.org/methods/accounts/
 type UpdateCredentialsRequest struct {
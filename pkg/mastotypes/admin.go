@@ -79,3 +79,40 @@ type AdminReportInfo struct {
 	// Statuses attached to the report, for context.
 	Statuses []Status `json:"statuses"`
 }
+
+// AdminPendingActivity represents a delivery to one of our inboxes that is being held for an admin to review, because of the
+// poor reputation of the domain that made it.
+type AdminPendingActivity struct {
+	// The ID of the pending activity in the database.
+	ID string `json:"id"`
+	// When the activity was delivered. (ISO 8601 Datetime)
+	CreatedAt string `json:"created_at"`
+	// The domain that the activity was delivered from.
+	Domain string `json:"domain"`
+	// The ID of the account that signed the delivery.
+	AccountID string `json:"account_id"`
+	// The path of the inbox that the activity was delivered to.
+	InboxPath string `json:"inbox_path"`
+	// The activity itself, exactly as it was delivered.
+	Activity string `json:"activity"`
+}
+
+// AdminReputationOverride represents a reputation score that an admin has pinned a remote domain to.
+type AdminReputationOverride struct {
+	// The domain that the override applies to.
+	Domain string `json:"domain"`
+	// The score that the domain is pinned to, from 0 to 100.
+	Score int `json:"score"`
+	// The time the override was last changed. (ISO 8601 Datetime)
+	UpdatedAt string `json:"updated_at"`
+	// A private comment on the override, for other admins.
+	PrivateComment string `json:"private_comment"`
+}
+
+// AdminReputationOverrideRequest represents the form submitted during a PUT request to /api/v1/admin/federation/reputation/:domain.
+type AdminReputationOverrideRequest struct {
+	// The score to pin the domain to, from 0 (not trusted at all) to 100 (fully trusted).
+	Score *int `form:"score" binding:"required"`
+	// A private comment on the override, for other admins.
+	PrivateComment string `form:"private_comment"`
+}
@@ -39,6 +39,16 @@ type StatusRequest struct {
 	ScheduledAt string `form:"scheduled_at"`
 	// ISO 639 language code for this status.
 	Language string `form:"language"`
+	// Format of the text content of the status. Enumerable oneOf text/plain, text/markdown. Defaults to text/plain.
+	ContentType string `form:"content_type"`
+	// Keep the status on this instance, rather than federating it to others?
+	LocalOnly bool `form:"local_only"`
+	// Who can boost the status. Enumerable oneOf everyone, followers, mutuals, mentioned. Defaults to everyone.
+	CanBoost string `form:"can_boost"`
+	// Who can reply to the status. Enumerable oneOf everyone, followers, mutuals, mentioned. Defaults to everyone.
+	CanReply string `form:"can_reply"`
+	// Who can favourite the status. Enumerable oneOf everyone, followers, mutuals, mentioned. Defaults to everyone.
+	CanLike string `form:"can_like"`
 }
 
 // Status represents a mastodon-api Status type, as defined here: https://docs.joinmastodon.org/entities/status/
@@ -61,6 +71,10 @@ type Status struct {
 	// 	private = Visible to followers only, and to any mentioned users.
 	// 	direct = Visible only to mentioned users.
 	Visibility string `json:"visibility"`
+	// Is this status only visible to users of this instance? Not part of the mastodon api, but used by glitch-soc and hometown.
+	LocalOnly bool `json:"local_only"`
+	// Who can boost, reply to and favourite this status. Not part of the mastodon api.
+	InteractionPolicy *InteractionPolicy `json:"interaction_policy"`
 	// Primary language of this status. (ISO 639 Part 1 two-letter language code)
 	Language string `json:"language"`
 	// URI of the status used for federation.
@@ -108,3 +122,15 @@ type Status struct {
 	// the original text from the HTML content.
 	Text string `json:"text"`
 }
+
+// InteractionPolicy represents who can interact with a status, on top of who can see it. Each of its fields is one of
+// everyone, followers, mutuals or mentioned. It's not part of the mastodon api, so clients that don't know about it will
+// just ignore it.
+type InteractionPolicy struct {
+	// Who can boost the status.
+	CanBoost string `json:"can_boost"`
+	// Who can reply to the status.
+	CanReply string `json:"can_reply"`
+	// Who can favourite the status.
+	CanLike string `json:"can_like"`
+}
@@ -0,0 +1,42 @@
+/*
+   GoToSocial
+   Copyright (C) 2021 GoToSocial Authors admin@gotosocial.org
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package mastotypes
+
+// WellKnownResponse represents the JSON Resource Descriptor (JRD) served by /.well-known/webfinger,
+// and by /.well-known/host-meta when it's requested as json. See https://docs.joinmastodon.org/spec/webfinger/
+type WellKnownResponse struct {
+	// The resource that was looked up, eg., acct:some_user@example.org
+	Subject string `json:"subject,omitempty"`
+	// Other URIs that identify the same resource, eg., the account's profile url and ActivityPub URI.
+	Aliases []string `json:"aliases,omitempty"`
+	// Links to more information about the resource.
+	Links []Link `json:"links,omitempty"`
+}
+
+// Link represents one link in a JRD, as returned from /.well-known/webfinger or /.well-known/host-meta.
+type Link struct {
+	// The relation type of the link, eg., self or http://webfinger.net/rel/profile-page
+	Rel string `json:"rel"`
+	// The media type of the linked resource, eg., application/activity+json
+	Type string `json:"type,omitempty"`
+	// The URI of the linked resource.
+	Href string `json:"href,omitempty"`
+	// A URI template, used instead of href by host-meta's lrdd link.
+	Template string `json:"template,omitempty"`
+}